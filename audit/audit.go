@@ -0,0 +1,89 @@
+// Package audit reports the discrepancies between the amounts a document declares, as an invoice received
+// from a supplier, and the ones johnny calculates for it. The importers of the ubl and chile packages rebuild
+// the calculation of the documents they read and fill a [Report].
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Tolerances are the largest differences between a declared and a calculated amount which are accepted.
+type Tolerances struct {
+	// Line is the tolerance of the amounts of each line.
+	Line gyro.Gyro
+	// Total is the tolerance of the totals of the document.
+	Total gyro.Gyro
+}
+
+// Discrepancy is an amount whose declared and calculated values differ by more than the tolerance.
+type Discrepancy struct {
+	// Line is the number of the line the amount belongs to, starting at one, or zero for the totals.
+	Line int
+	// Field is the name of the amount in the document, as "LineExtensionAmount".
+	Field      string
+	Declared   gyro.Gyro
+	Calculated gyro.Gyro
+}
+
+// Difference returns the declared amount minus the calculated one.
+func (d Discrepancy) Difference() gyro.Gyro {
+	return d.Declared.Sub(d.Calculated)
+}
+
+// String describes the discrepancy, as "line 2 LineExtensionAmount: declared 10.5, calculated 10.4".
+func (d Discrepancy) String() string {
+	where := "total"
+
+	if d.Line > 0 {
+		where = fmt.Sprintf("line %d", d.Line)
+	}
+
+	return fmt.Sprintf("%s %s: declared %s, calculated %s", where, d.Field, johnny.DecimalString(d.Declared), johnny.DecimalString(d.Calculated))
+}
+
+// Report holds the discrepancies found auditing a document, in the order they were checked.
+type Report struct {
+	Tolerances    Tolerances
+	Discrepancies []Discrepancy
+}
+
+// NewReport returns an empty report checking amounts with the given tolerances.
+func NewReport(t Tolerances) *Report {
+	return &Report{Tolerances: t}
+}
+
+// Line checks an amount of the line n, reporting it if the difference exceeds the tolerance of the lines.
+func (r *Report) Line(n int, field string, declared, calculated gyro.Gyro) {
+	r.check(n, field, declared, calculated, r.Tolerances.Line)
+}
+
+// Total checks a total of the document, reporting it if the difference exceeds the tolerance of the totals.
+func (r *Report) Total(field string, declared, calculated gyro.Gyro) {
+	r.check(0, field, declared, calculated, r.Tolerances.Total)
+}
+
+func (r *Report) check(n int, field string, declared, calculated, tolerance gyro.Gyro) {
+	if declared.Sub(calculated).Abs().Cmp(tolerance) > 0 {
+		r.Discrepancies = append(r.Discrepancies, Discrepancy{Line: n, Field: field, Declared: declared, Calculated: calculated})
+	}
+}
+
+// OK tells whether every checked amount is within its tolerance.
+func (r *Report) OK() bool {
+	return len(r.Discrepancies) == 0
+}
+
+// String describes every discrepancy of the report, one per line.
+func (r *Report) String() string {
+	lines := make([]string, 0, len(r.Discrepancies))
+
+	for _, d := range r.Discrepancies {
+		lines = append(lines, d.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
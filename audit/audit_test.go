@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func TestReport(t *testing.T) {
+	r := NewReport(Tolerances{Line: udfs("0.01"), Total: udfs("1")})
+
+	r.Line(1, "LineExtensionAmount", udfs("10.50"), udfs("10.49"))
+	r.Line(2, "LineExtensionAmount", udfs("10.50"), udfs("10.48"))
+	r.Total("TaxAmount", udfs("100"), udfs("101"))
+	r.Total("PayableAmount", udfs("98.5"), udfs("100"))
+
+	if r.OK() {
+		t.Fatalf("discrepancies expected")
+	}
+
+	expected := []string{
+		"line 2 LineExtensionAmount: declared 10.50, calculated 10.48",
+		"total PayableAmount: declared 98.5, calculated 100",
+	}
+
+	if len(r.Discrepancies) != len(expected) {
+		t.Fatalf("got %d discrepancies. Expected %d", len(r.Discrepancies), len(expected))
+	}
+
+	for i, d := range r.Discrepancies {
+		if d.String() != expected[i] {
+			t.Errorf("[test case %d] got %q. Expected %q", i, d.String(), expected[i])
+		}
+	}
+
+	if !r.Discrepancies[1].Difference().Equal(udfs("-1.5")) {
+		t.Errorf("got difference %v. Expected -1.5", r.Discrepancies[1].Difference())
+	}
+
+	if ok := NewReport(Tolerances{}); !ok.OK() || ok.String() != "" {
+		t.Errorf("an empty report should be ok")
+	}
+}
@@ -0,0 +1,97 @@
+// Package batch calculates line items read from CSV files using the johnny package,
+// writing for each row its computed net, discounts, taxes and gross values.
+//
+// Rows which can't be calculated don't abort the file: they are written with
+// their error, so they can be fixed and processed again.
+package batch
+
+import (
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Amount is a discount or a tax of a line item.
+type Amount struct {
+	// Code identifies the tax, as "IVA". It's not used by discounts.
+	Code string
+	// Value is the ratio of the amount when Percentual, or the amount itself otherwise.
+	Value gyro.Gyro
+	// Percentual tells whether Value is a ratio or an amount.
+	Percentual bool
+}
+
+// Item is a line item to be calculated.
+type Item struct {
+	// Row is the number of the row the item was read from, starting at 1 for the first row after the header.
+	Row int
+	// Record holds the fields of the row the item was read from.
+	Record []string
+	// Qty is the quantity of the item. HasQty tells whether it was given.
+	Qty    gyro.Gyro
+	HasQty bool
+	// UnitValue is the unit value of the item.
+	UnitValue gyro.Gyro
+	// Discounts holds the discounts to apply to the item, in order.
+	Discounts []Amount
+	// Taxes holds the taxes to apply to the item, in order.
+	Taxes []Amount
+}
+
+// Pipeline builds the Johnny and the visitors which calculate an item.
+// A Pipeline is called for each item, so it must return new visitors every time.
+type Pipeline func(Item) (johnny.Johnny, []johnny.Visitor)
+
+// UnitValuePipeline returns a Pipeline which calculates items starting from their unit value.
+// The quantity is applied over the unit value, followed by the discounts, the rounding of the net to the
+// given scale when it's not negative, and the taxes, which are calculated over the net without being added to it.
+func UnitValuePipeline(round int) Pipeline {
+	return func(it Item) (johnny.Johnny, []johnny.Visitor) {
+		visitors := make([]johnny.Visitor, 0, len(it.Discounts)+len(it.Taxes)+3)
+
+		if it.HasQty {
+			visitors = append(visitors, johnny.WithQTY(it.Qty))
+		}
+
+		for _, d := range it.Discounts {
+			if d.Percentual {
+				visitors = append(visitors, johnny.NewPercentualDiscount(d.Value))
+			} else {
+				visitors = append(visitors, johnny.NewAmountDiscount(d.Value))
+			}
+		}
+
+		if round >= 0 {
+			visitors = append(visitors, johnny.NewRound(int32(round)))
+		}
+
+		visitors = append(visitors, johnny.NamedSnapshot("net"))
+
+		for _, t := range it.Taxes {
+			if t.Percentual {
+				tax := johnny.NewUnbufferedPercTax(t.Value)
+				tax.SetCode(t.Code)
+				visitors = append(visitors, tax)
+			} else {
+				tax := johnny.NewUnbufferedAmountTax(t.Value)
+				tax.SetCode(t.Code)
+				visitors = append(visitors, tax)
+			}
+		}
+
+		return johnny.NewFromUnitValue(it.UnitValue), visitors
+	}
+}
+
+// Calculate runs the pipeline over the item and returns its result.
+// Panics raised during the calculation, as divisions by zero, are returned as errors.
+func Calculate(it Item, p Pipeline) (r johnny.Result, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = johnny.NewJohnnyError(rec)
+		}
+	}()
+
+	b, visitors := p(it)
+
+	return johnny.Run(b, visitors...)
+}
@@ -0,0 +1,528 @@
+package batch
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Column maps a CSV column to a discount or a tax.
+type Column struct {
+	// Name is the name of the column in the header.
+	Name string
+	// Code identifies the tax, as "IVA". It's not used by discounts.
+	Code string
+	// Percentual tells whether the column holds a ratio or an amount.
+	Percentual bool
+}
+
+// Mapping tells which CSV columns hold the values of the line items.
+// Columns are identified by their name in the header of the file.
+type Mapping struct {
+	// Qty is the column holding the quantity. When empty, items have no quantity.
+	Qty string
+	// UnitValue is the column holding the unit value.
+	UnitValue string
+	// Discounts holds the columns of the discounts, in the order they are applied.
+	Discounts []Column
+	// Taxes holds the columns of the taxes, in the order they are applied.
+	Taxes []Column
+}
+
+// RowError is the error of a row which couldn't be read or calculated.
+// Other rows can still be read after a RowError.
+type RowError struct {
+	Row int
+	Err error
+}
+
+// Error implements the error interface.
+func (e *RowError) Error() string {
+	return "row " + strconv.Itoa(e.Row) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads line items from a CSV file with a header.
+type Reader struct {
+	r       *csv.Reader
+	mapping Mapping
+	header  []string
+
+	qty       int
+	unitValue int
+	discounts []int
+	taxes     []int
+
+	row int
+}
+
+// NewReader returns a new Reader reading line items from r, as described by the mapping.
+// The header is read when the first item is read.
+func NewReader(r io.Reader, m Mapping) *Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	return &Reader{
+		r:       cr,
+		mapping: m,
+	}
+}
+
+// WithComma sets the field delimiter of the CSV file, which defaults to ','.
+func (r *Reader) WithComma(comma rune) *Reader {
+	r.r.Comma = comma
+	return r
+}
+
+// Header returns the header of the file, reading it if it wasn't read yet.
+func (r *Reader) Header() ([]string, error) {
+	if r.header != nil {
+		return r.header, nil
+	}
+
+	h, err := r.r.Read()
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("batch: missing CSV header")
+		}
+
+		return nil, err
+	}
+
+	index := make(map[string]int, len(h))
+
+	for i, name := range h {
+		index[strings.TrimSpace(name)] = i
+	}
+
+	find := func(name string) (int, error) {
+		i, ok := index[name]
+
+		if !ok {
+			return 0, fmt.Errorf("batch: column %q not found in header", name)
+		}
+
+		return i, nil
+	}
+
+	r.qty = -1
+
+	if r.mapping.Qty != "" {
+		if r.qty, err = find(r.mapping.Qty); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.unitValue, err = find(r.mapping.UnitValue); err != nil {
+		return nil, err
+	}
+
+	for _, c := range r.mapping.Discounts {
+		i, err := find(c.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.discounts = append(r.discounts, i)
+	}
+
+	for _, c := range r.mapping.Taxes {
+		i, err := find(c.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.taxes = append(r.taxes, i)
+	}
+
+	r.header = h
+	return h, nil
+}
+
+// Read returns the next line item. It returns io.EOF when there are no more items.
+// When the row can't be converted in an item, as when it has more fields than the header, a *RowError
+// is returned, holding the row number, and the item keeps the row record, so reading can continue.
+func (r *Reader) Read() (Item, error) {
+	if _, err := r.Header(); err != nil {
+		return Item{}, err
+	}
+
+	rec, err := r.r.Read()
+
+	if err != nil {
+		var pe *csv.ParseError
+
+		if errors.As(err, &pe) {
+			r.row++
+			return Item{Row: r.row, Record: rec}, &RowError{Row: r.row, Err: err}
+		}
+
+		return Item{}, err
+	}
+
+	r.row++
+
+	if len(rec) > len(r.header) {
+		line, _ := r.r.FieldPos(0)
+		err := fmt.Errorf("line %d has %d fields, more than the %d of the header", line, len(rec), len(r.header))
+
+		return Item{Row: r.row, Record: rec}, &RowError{Row: r.row, Err: err}
+	}
+
+	it, err := r.item(rec)
+
+	if err != nil {
+		return it, &RowError{Row: r.row, Err: err}
+	}
+
+	return it, nil
+}
+
+func (r *Reader) item(rec []string) (Item, error) {
+	it := Item{Row: r.row, Record: rec}
+
+	field := func(i int) (string, error) {
+		if i >= len(rec) {
+			return "", fmt.Errorf("missing column %q", r.header[i])
+		}
+
+		return strings.TrimSpace(rec[i]), nil
+	}
+
+	decimal := func(i int) (gyro.Gyro, bool, error) {
+		f, err := field(i)
+
+		if err != nil || f == "" {
+			return gyro.Gyro{}, false, err
+		}
+
+		g, err := johnny.ParseDecimal(f)
+
+		if err != nil {
+			return gyro.Gyro{}, false, fmt.Errorf("column %q: %w", r.header[i], err)
+		}
+
+		return g, true, nil
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+
+	if r.qty >= 0 {
+		if it.Qty, ok, err = decimal(r.qty); err != nil {
+			return it, err
+		}
+
+		if !ok {
+			return it, fmt.Errorf("empty column %q", r.header[r.qty])
+		}
+
+		it.HasQty = true
+	}
+
+	if it.UnitValue, ok, err = decimal(r.unitValue); err != nil {
+		return it, err
+	}
+
+	if !ok {
+		return it, fmt.Errorf("empty column %q", r.header[r.unitValue])
+	}
+
+	for k, i := range r.discounts {
+		v, ok, err := decimal(i)
+
+		if err != nil {
+			return it, err
+		}
+
+		if ok {
+			c := r.mapping.Discounts[k]
+			it.Discounts = append(it.Discounts, Amount{Value: v, Percentual: c.Percentual})
+		}
+	}
+
+	for k, i := range r.taxes {
+		v, ok, err := decimal(i)
+
+		if err != nil {
+			return it, err
+		}
+
+		if ok {
+			c := r.mapping.Taxes[k]
+			it.Taxes = append(it.Taxes, Amount{Code: c.Code, Value: v, Percentual: c.Percentual})
+		}
+	}
+
+	return it, nil
+}
+
+// Summary reports the outcome of processing a file.
+type Summary struct {
+	// Rows is the number of processed rows.
+	Rows int
+	// Failed is the number of rows written with an error.
+	Failed int
+	// Totals accumulates the results of the rows calculated without error.
+	Totals *johnny.Totals
+}
+
+// chunkSize is the number of rows read before calculating them when the processor has many workers.
+const chunkSize = 1024
+
+// Processor calculates the line items of a CSV file, writing them with their results to another CSV file.
+type Processor struct {
+	mapping  Mapping
+	pipeline Pipeline
+	comma    rune
+	workers  int
+}
+
+// NewProcessor returns a new Processor reading items as described by the mapping and calculating
+// them with the given pipeline. When the pipeline is nil UnitValuePipeline(-1) is used.
+func NewProcessor(m Mapping, p Pipeline) *Processor {
+	if p == nil {
+		p = UnitValuePipeline(-1)
+	}
+
+	return &Processor{
+		mapping:  m,
+		pipeline: p,
+		comma:    ',',
+		workers:  1,
+	}
+}
+
+// WithWorkers sets the number of workers calculating the rows concurrently, which defaults to 1.
+// When workers is not positive, runtime.GOMAXPROCS(0) workers are used.
+// When many workers are used, the pipeline must return new visitors for every item, as the ones
+// returned by UnitValuePipeline and TemplatePipeline do. The rows are written in the order they were read.
+func (p *Processor) WithWorkers(workers int) *Processor {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	p.workers = workers
+	return p
+}
+
+// WithComma sets the field delimiter of the read and written CSV files, which defaults to ','.
+func (p *Processor) WithComma(comma rune) *Processor {
+	p.comma = comma
+	return p
+}
+
+// Codes returns the distinct tax codes of the mapping, in order.
+// Each one is written as a tax_<code> column.
+func (m Mapping) Codes() []string {
+	var codes []string
+
+	seen := map[string]bool{}
+
+	for _, c := range m.Taxes {
+		if c.Code != "" && !seen[c.Code] {
+			seen[c.Code] = true
+			codes = append(codes, c.Code)
+		}
+	}
+
+	return codes
+}
+
+// Process reads the line items from r, calculates them and writes them to w.
+// The written file has the columns of the read one, followed by the net, discounts, taxes and gross of the item,
+// a tax_<code> column for each tax code of the mapping and an error column, which is empty when the row was calculated.
+// Row errors don't stop the processing. Only errors reading or writing the files are returned.
+func (p *Processor) Process(r io.Reader, w io.Writer) (Summary, error) {
+	return p.ProcessContext(context.Background(), r, w)
+}
+
+// ProcessContext is like Process, but stops when ctx is done, returning the context error.
+func (p *Processor) ProcessContext(ctx context.Context, r io.Reader, w io.Writer) (Summary, error) {
+	rd := NewReader(r, p.mapping).WithComma(p.comma)
+	cw := csv.NewWriter(w)
+	cw.Comma = p.comma
+
+	s := Summary{Totals: johnny.NewTotals()}
+
+	header, err := rd.Header()
+
+	if err != nil {
+		return s, err
+	}
+
+	codes := p.mapping.Codes()
+	out := append([]string{}, header...)
+	out = append(out, "net", "discounts", "taxes", "gross")
+
+	for _, code := range codes {
+		out = append(out, "tax_"+code)
+	}
+
+	out = append(out, "error")
+
+	if err := cw.Write(out); err != nil {
+		return s, err
+	}
+
+	width := len(header)
+	chunk := make([]Outcome, 0, chunkSize)
+
+	// flush calculates the rows of the chunk read without errors and writes the whole chunk.
+	flush := func() error {
+		if err := p.calculate(ctx, chunk); err != nil {
+			return err
+		}
+
+		for _, o := range chunk {
+			s.Rows++
+
+			rec := padRecord(o.Item.Record, width)
+
+			if o.Err != nil {
+				s.Failed++
+				rec = append(rec, make([]string, 4+len(codes))...)
+				rec = append(rec, errorMessage(o.Err))
+			} else {
+				s.Totals.Add(o.Result)
+				rec = append(rec, resultRecord(o.Result, codes)...)
+				rec = append(rec, "")
+			}
+
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return s, err
+		}
+
+		it, err := rd.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *RowError
+
+		if err != nil && !errors.As(err, &rowErr) {
+			return s, err
+		}
+
+		chunk = append(chunk, Outcome{Item: it, Err: err})
+
+		if p.workers <= 1 || len(chunk) == chunkSize {
+			if err := flush(); err != nil {
+				return s, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return s, err
+	}
+
+	cw.Flush()
+
+	return s, cw.Error()
+}
+
+// calculate fills the results of the outcomes read without errors.
+func (p *Processor) calculate(ctx context.Context, chunk []Outcome) error {
+	if p.workers <= 1 {
+		for i, o := range chunk {
+			if o.Err == nil {
+				chunk[i].Result, chunk[i].Err = Calculate(o.Item, p.pipeline)
+			}
+		}
+
+		return nil
+	}
+
+	items := make([]Item, 0, len(chunk))
+	index := make([]int, 0, len(chunk))
+
+	for i, o := range chunk {
+		if o.Err == nil {
+			items = append(items, o.Item)
+			index = append(index, i)
+		}
+	}
+
+	outcomes, err := NewExecutor(p.pipeline, p.workers).Run(ctx, items)
+
+	if err != nil {
+		return err
+	}
+
+	for k, o := range outcomes {
+		chunk[index[k]] = o
+	}
+
+	return nil
+}
+
+// padRecord returns a copy of rec with exactly width fields. Records with more fields are rejected by the
+// Reader, so the ones cut here are written with their error.
+func padRecord(rec []string, width int) []string {
+	out := make([]string, width, width+8)
+	copy(out, rec)
+	return out
+}
+
+func resultRecord(r johnny.Result, codes []string) []string {
+	rec := []string{
+		johnny.DecimalString(r.Net),
+		johnny.DecimalString(r.Discounts),
+		johnny.DecimalString(r.Taxes),
+		johnny.DecimalString(r.Gross),
+	}
+
+	for _, code := range codes {
+		rec = append(rec, johnny.DecimalString(r.TaxesByCode[code]))
+	}
+
+	return rec
+}
+
+func errorMessage(err error) string {
+	var rowErr *RowError
+
+	if errors.As(err, &rowErr) {
+		err = rowErr.Err
+	}
+
+	msg := err.Error()
+
+	var je *johnny.JohnnyError
+
+	if errors.As(err, &je) {
+		// JohnnyError carries its call stack after " -- ", which is noise in a CSV cell.
+		msg, _, _ = strings.Cut(msg, " -- ")
+	}
+
+	return msg
+}
@@ -0,0 +1,187 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+var testMapping = Mapping{
+	Qty:       "qty",
+	UnitValue: "price",
+	Discounts: []Column{{Name: "disc", Percentual: true}},
+	Taxes: []Column{
+		{Name: "iva", Code: "IVA", Percentual: true},
+		{Name: "env", Code: "ENV"},
+	},
+}
+
+const testCSV = `sku,qty,price,disc,iva,env
+A,2,100,10,19,
+B,3,10.5,,19,0.5
+C,x,10,,19,
+D,1,0,,19,1
+E,1,50
+`
+
+func TestProcess(t *testing.T) {
+	out := bytes.Buffer{}
+
+	s, err := NewProcessor(testMapping, nil).Process(strings.NewReader(testCSV), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Rows != 5 || s.Failed != 3 {
+		t.Errorf("got %d rows %d failed. Expected 5 rows 3 failed", s.Rows, s.Failed)
+	}
+
+	recs, err := csv.NewReader(&out).ReadAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedHeader := "sku,qty,price,disc,iva,env,net,discounts,taxes,gross,tax_IVA,tax_ENV,error"
+
+	if got := strings.Join(recs[0], ","); got != expectedHeader {
+		t.Fatalf("got header %s. Expected %s", got, expectedHeader)
+	}
+
+	expecteds := []struct {
+		net, taxes, gross, iva, env string
+		err                         bool
+	}{
+		{net: "180", taxes: "34.2", gross: "214.2", iva: "34.2", env: "0"},
+		{net: "31.5", taxes: "6.485", gross: "37.985", iva: "5.985", env: "0.5"},
+		{err: true},
+		// taxing an amount over a zero net divides by zero
+		{err: true},
+		{err: true},
+	}
+
+	for i, e := range expecteds {
+		rec := recs[i+1]
+
+		if len(rec) != 13 {
+			t.Fatalf("[row %d] got %d fields. Expected 13", i+1, len(rec))
+		}
+
+		if e.err {
+			if rec[12] == "" || rec[6] != "" {
+				t.Errorf("[row %d] error expected. Got %v", i+1, rec)
+			}
+
+			continue
+		}
+
+		if rec[12] != "" {
+			t.Errorf("[row %d] unexpected error %s", i+1, rec[12])
+		}
+
+		for k, expected := range map[int]string{6: e.net, 8: e.taxes, 9: e.gross, 10: e.iva, 11: e.env} {
+			if !udfs(rec[k]).Equal(udfs(expected)) {
+				t.Errorf("[row %d] got %s = %s. Expected %s", i+1, recs[0][k], rec[k], expected)
+			}
+		}
+	}
+
+	if !s.Totals.Net.Equal(udfs("211.5")) || s.Totals.Lines != 2 {
+		t.Errorf("got totals net %v lines %d", johnny.DecimalString(s.Totals.Net), s.Totals.Lines)
+	}
+}
+
+func TestReaderRowErrors(t *testing.T) {
+	r := NewReader(strings.NewReader(testCSV), testMapping)
+
+	var rows, failed int
+
+	for {
+		it, err := r.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		rows++
+
+		var rowErr *RowError
+
+		if err != nil {
+			if !errors.As(err, &rowErr) {
+				t.Fatal(err)
+			}
+
+			failed++
+
+			if rowErr.Row != it.Row || len(it.Record) == 0 {
+				t.Errorf("got row error %v for item %+v", rowErr, it)
+			}
+		}
+	}
+
+	if rows != 5 || failed != 2 {
+		t.Errorf("got %d rows %d failed. Expected 5 rows 2 failed", rows, failed)
+	}
+}
+
+func TestProcessExtraFields(t *testing.T) {
+	in := "qty,price\n2,10\n1,5,extra\n"
+	out := bytes.Buffer{}
+
+	s, err := NewProcessor(Mapping{Qty: "qty", UnitValue: "price"}, UnitValuePipeline(0)).Process(strings.NewReader(in), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Rows != 2 || s.Failed != 1 {
+		t.Errorf("got %d rows %d failed. Expected 2 rows 1 failed", s.Rows, s.Failed)
+	}
+
+	if !strings.Contains(out.String(), "line 3 has 3 fields, more than the 2 of the header") {
+		t.Errorf("got %s. Expected the extra fields of line 3 to be reported", out.String())
+	}
+}
+
+func TestProcessMissingColumn(t *testing.T) {
+	m := testMapping
+	m.UnitValue = "unit_price"
+
+	if _, err := NewProcessor(m, nil).Process(strings.NewReader(testCSV), io.Discard); err == nil {
+		t.Errorf("error expected mapping a missing column")
+	}
+
+	if _, err := NewProcessor(m, nil).Process(strings.NewReader(""), io.Discard); err == nil {
+		t.Errorf("error expected processing a file without header")
+	}
+}
+
+func TestProcessWithComma(t *testing.T) {
+	in := "qty;price\n2;10.5\n"
+	out := bytes.Buffer{}
+
+	m := Mapping{Qty: "qty", UnitValue: "price"}
+
+	s, err := NewProcessor(m, UnitValuePipeline(0)).WithComma(';').Process(strings.NewReader(in), &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Failed != 0 || !strings.Contains(out.String(), "qty;price;net;discounts;taxes;gross;error\n2;10.5;21;") {
+		t.Errorf("got %s", out.String())
+	}
+}
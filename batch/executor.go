@@ -0,0 +1,108 @@
+package batch
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/profe-ajedrez/johnny"
+)
+
+// TemplatePipeline returns a Pipeline which calculates every item from its unit value and quantity,
+// followed by clones of the given visitors, so the same template can be used by many items at the
+// same time. The discounts and taxes of the items are ignored, as the template already defines them.
+// An error is returned if any of the visitors doesn't implement johnny.Cloner.
+func TemplatePipeline(visitors ...johnny.Visitor) (Pipeline, error) {
+	template, err := johnny.CloneVisitors(visitors)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(it Item) (johnny.Johnny, []johnny.Visitor) {
+		// the template was already checked, so cloning it can't fail
+		clones, _ := johnny.CloneVisitors(template)
+
+		if it.HasQty {
+			clones = append([]johnny.Visitor{johnny.WithQTY(it.Qty)}, clones...)
+		}
+
+		return johnny.NewFromUnitValue(it.UnitValue), clones
+	}, nil
+}
+
+// Outcome is the result of calculating an item, or the error which prevented it.
+type Outcome struct {
+	Item   Item
+	Result johnny.Result
+	Err    error
+}
+
+// Executor calculates items concurrently over a bounded pool of workers.
+// Every item gets its own Johnny and visitors from the pipeline, so the
+// pipeline must not share stateful visitors between items.
+type Executor struct {
+	pipeline Pipeline
+	workers  int
+}
+
+// NewExecutor returns a new Executor calculating items with the given pipeline over the given number of workers.
+// When workers is not positive, runtime.GOMAXPROCS(0) workers are used.
+func NewExecutor(p Pipeline, workers int) *Executor {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	return &Executor{
+		pipeline: p,
+		workers:  workers,
+	}
+}
+
+// Run calculates the given items and returns their outcomes in the same order as the items.
+// The errors of each item are kept in its outcome and don't stop the others.
+// When ctx is done, the items not calculated yet get the context error as outcome,
+// and the context error is also returned.
+func (e *Executor) Run(ctx context.Context, items []Item) ([]Outcome, error) {
+	outcomes := make([]Outcome, len(items))
+	jobs := make(chan int)
+
+	workers := min(e.workers, len(items))
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				r, err := Calculate(items[i], e.pipeline)
+				outcomes[i] = Outcome{Item: items[i], Result: r, Err: err}
+			}
+		}()
+	}
+
+	next := 0
+
+feed:
+	for ; next < len(items); next++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- next:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if next < len(items) {
+		for i := next; i < len(items); i++ {
+			outcomes[i] = Outcome{Item: items[i], Err: ctx.Err()}
+		}
+
+		return outcomes, ctx.Err()
+	}
+
+	return outcomes, nil
+}
@@ -0,0 +1,149 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/johnny"
+)
+
+func TestExecutorRun(t *testing.T) {
+	p, err := TemplatePipeline(johnny.NewPercentualDiscount(udfs("10")), johnny.NewUnbufferedPercTax(udfs("19")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := make([]Item, 200)
+
+	for i := range items {
+		items[i] = Item{Row: i + 2, UnitValue: udfs(strconv.Itoa(i)), Qty: udfs("2"), HasQty: true}
+	}
+
+	// undoing a 100% discount divides by zero
+	bad, err := TemplatePipeline(johnny.NewPercentualUnDiscount(udfs("100")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outcomes, err := NewExecutor(func(it Item) (johnny.Johnny, []johnny.Visitor) {
+		if it.Row == 50 {
+			return bad(it)
+		}
+
+		return p(it)
+	}, 8).Run(context.Background(), items)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outcomes) != len(items) {
+		t.Fatalf("got %d outcomes. Expected %d", len(outcomes), len(items))
+	}
+
+	for i, o := range outcomes {
+		if o.Item.Row != items[i].Row {
+			t.Fatalf("[item %d] got row %d. Expected %d", i, o.Item.Row, items[i].Row)
+		}
+
+		if o.Item.Row == 50 {
+			if o.Err == nil {
+				t.Errorf("[item %d] error expected", i)
+			}
+
+			continue
+		}
+
+		if o.Err != nil {
+			t.Errorf("[item %d] %v", i, o.Err)
+			continue
+		}
+
+		// 2 * i - 10%, with an unbuffered 19% tax
+		net := udfs(strconv.Itoa(i)).Mul(udfs("1.8"))
+		tax := net.Mul(udfs("0.19"))
+
+		if !o.Result.Net.Equal(net) || !o.Result.Taxes.Equal(tax) {
+			t.Errorf("[item %d] got net %s taxes %s. Expected %s and %s", i,
+				johnny.DecimalString(o.Result.Net), johnny.DecimalString(o.Result.Taxes),
+				johnny.DecimalString(net), johnny.DecimalString(tax))
+		}
+	}
+}
+
+func TestExecutorRunCanceled(t *testing.T) {
+	p, _ := TemplatePipeline()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outcomes, err := NewExecutor(p, 2).Run(ctx, make([]Item, 10))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v. Expected %v", err, context.Canceled)
+	}
+
+	if len(outcomes) != 10 {
+		t.Fatalf("got %d outcomes. Expected 10", len(outcomes))
+	}
+
+	for i, o := range outcomes {
+		if o.Err == nil {
+			continue
+		}
+
+		if !errors.Is(o.Err, context.Canceled) {
+			t.Errorf("[item %d] got error %v. Expected %v", i, o.Err, context.Canceled)
+		}
+	}
+}
+
+func TestTemplatePipelineError(t *testing.T) {
+	var notCloner johnny.Visitor = visitorFunc(func(johnny.Johnny) {})
+
+	if _, err := TemplatePipeline(johnny.NewPercTax(udfs("19")), notCloner); err == nil {
+		t.Errorf("error expected with a visitor which can't be cloned")
+	}
+}
+
+func TestProcessWithWorkers(t *testing.T) {
+	csv := strings.Builder{}
+	csv.WriteString("sku,qty,price,disc,iva,env\n")
+
+	for i := 0; i < 3*chunkSize; i++ {
+		csv.WriteString(strings.SplitN(testCSV, "\n", 7)[1+i%5])
+		csv.WriteString("\n")
+	}
+
+	sequential := bytes.Buffer{}
+	concurrent := bytes.Buffer{}
+
+	s1, err := NewProcessor(testMapping, nil).Process(strings.NewReader(csv.String()), &sequential)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := NewProcessor(testMapping, nil).WithWorkers(4).Process(strings.NewReader(csv.String()), &concurrent)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s1.Rows != s2.Rows || s1.Failed != s2.Failed || !s1.Totals.Gross.Equal(s2.Totals.Gross) {
+		t.Errorf("got summary %+v. Expected %+v", s2, s1)
+	}
+
+	if sequential.String() != concurrent.String() {
+		t.Errorf("concurrent output differs from the sequential one")
+	}
+}
+
+type visitorFunc func(johnny.Johnny)
+
+func (f visitorFunc) Visit(b johnny.Johnny) { f(b) }
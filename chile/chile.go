@@ -0,0 +1,327 @@
+// Package chile calculates the lines and totals of the tax documents of Chile with the johnny package,
+// with the taxes of the SII (Servicio de Impuestos Internos) and its rounding to integer pesos.
+//
+// Lines are calculated with [Calculate], which runs the preset pipeline of the document type, and the
+// totals of a document with [Totalize], which applies the taxes over the totals of its lines as the SII does,
+// instead of adding the taxes of each line. [MarshalDocumento] writes them as the Documento of a DTE,
+// and [AuditDocumento] checks the amounts declared by a received one.
+package chile
+
+import (
+	"fmt"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// IVA is the code of the value added tax.
+const IVA = "IVA"
+
+// Codes of the additional taxes on beverages (ILA), as the SII identifies them in the lines of tax documents.
+const (
+	// ILADestilados is the tax on spirits, as pisco, liquors and whisky.
+	ILADestilados = "24"
+	// ILAVinos is the tax on wines.
+	ILAVinos = "25"
+	// ILACervezas is the tax on beers and other alcoholic beverages.
+	ILACervezas = "26"
+	// ILABebidas is the tax on non-alcoholic beverages and mineral waters.
+	ILABebidas = "27"
+	// ILABebidasAzucaradas is the tax on non-alcoholic beverages with high sugar content.
+	ILABebidasAzucaradas = "271"
+)
+
+// ratios holds the ratios of the taxes, by code.
+var ratios = map[string]string{
+	IVA:                  "19",
+	ILADestilados:        "31.5",
+	ILAVinos:             "20.5",
+	ILACervezas:          "20.5",
+	ILABebidas:           "10",
+	ILABebidasAzucaradas: "18",
+}
+
+// Ratio returns the ratio of the tax identified by code, and false if it's not a known tax.
+func Ratio(code string) (gyro.Gyro, bool) {
+	r, ok := ratios[code]
+
+	if !ok {
+		return gyro.Gyro{}, false
+	}
+
+	g, _ := gyro.NewFromString(r)
+	return g, true
+}
+
+// Round rounds v to integer pesos as the SII does, with halves away from zero.
+func Round(v gyro.Gyro) gyro.Gyro {
+	return v.Round(0)
+}
+
+// DocumentType is a type of tax document, identified by its SII code.
+type DocumentType int
+
+const (
+	// FacturaAfecta is an invoice with IVA, whose prices are net.
+	FacturaAfecta DocumentType = 33
+	// FacturaExenta is an invoice without IVA.
+	FacturaExenta DocumentType = 34
+	// Boleta is a sales receipt with IVA, whose prices include taxes.
+	Boleta DocumentType = 39
+	// BoletaExenta is a sales receipt without IVA.
+	BoletaExenta DocumentType = 41
+	// NotaCredito is a credit note, which corrects or cancels a document, whose prices are net.
+	NotaCredito DocumentType = 61
+)
+
+var documentNames = map[DocumentType]string{
+	FacturaAfecta: "factura afecta",
+	FacturaExenta: "factura exenta",
+	Boleta:        "boleta",
+	BoletaExenta:  "boleta exenta",
+	NotaCredito:   "nota de crédito",
+}
+
+// String returns the name of the document type, as "factura afecta".
+func (d DocumentType) String() string {
+	if n, ok := documentNames[d]; ok {
+		return n
+	}
+
+	return fmt.Sprintf("document type %d", int(d))
+}
+
+// TaxIncluded tells whether the prices of the document include taxes, as the ones of the boletas.
+func (d DocumentType) TaxIncluded() bool {
+	return d == Boleta || d == BoletaExenta
+}
+
+// Exempt tells whether the document is exempted from IVA.
+func (d DocumentType) Exempt() bool {
+	return d == FacturaExenta || d == BoletaExenta
+}
+
+// Line is a line of a tax document, as the Detalle of a DTE.
+type Line struct {
+	// Qty is the quantity of the line (QtyItem), one when zero.
+	Qty gyro.Gyro
+	// Price is the unit price (PrcItem), net in facturas and tax-included in boletas.
+	Price gyro.Gyro
+	// DiscountPct is the percentual discount of the line (DescuentoPct).
+	DiscountPct gyro.Gyro
+	// Discount is the discount amount of the line, applied after DiscountPct.
+	Discount gyro.Gyro
+	// Exempt tells whether the line is exempted from IVA in a document with IVA (IndExe).
+	Exempt bool
+	// Additional is the code of the additional tax of the line (CodImpAdic), as ILACervezas.
+	Additional string
+}
+
+// Pipeline returns the Johnny and the visitors calculating the line in a document of the given type.
+// The quantity and the discounts are applied over the price, the item amount (MontoItem) is rounded to integer
+// pesos and the taxes are calculated over it without being added, so the value of the Johnny is the item amount.
+// The pipelines of documents whose prices include taxes must be run with [johnny.RunTaxIncluded].
+//
+// An error is returned if the additional tax is unknown, or given in a line exempted from IVA.
+func Pipeline(doc DocumentType, l Line) (johnny.Johnny, []johnny.Visitor, error) {
+	visitors := make([]johnny.Visitor, 0, 6)
+
+	if !l.Qty.Equal(gyro.NewZero()) {
+		visitors = append(visitors, johnny.WithQTY(l.Qty))
+	}
+
+	if !l.DiscountPct.Equal(gyro.NewZero()) {
+		visitors = append(visitors, johnny.NewPercentualDiscountRule(l.DiscountPct))
+	}
+
+	if !l.Discount.Equal(gyro.NewZero()) {
+		visitors = append(visitors, johnny.NewAmountDiscountRule(l.Discount))
+	}
+
+	visitors = append(visitors, johnny.NewRound(0))
+
+	iva, _ := Ratio(IVA)
+	tax := johnny.NewUnbufferedPercTaxRule(iva).WithCode(IVA)
+
+	if doc.Exempt() || l.Exempt {
+		if l.Additional != "" {
+			return nil, nil, johnny.NewJohnnyError("exempt lines can't have additional taxes")
+		}
+
+		visitors = append(visitors, tax.WithExemption(johnny.Exempt, ""))
+		return johnny.NewFromUnitValue(l.Price), visitors, nil
+	}
+
+	visitors = append(visitors, tax)
+
+	if l.Additional != "" {
+		ratio, ok := Ratio(l.Additional)
+
+		if !ok || l.Additional == IVA {
+			return nil, nil, johnny.NewJohnnyError("unknown additional tax " + l.Additional)
+		}
+
+		visitors = append(visitors, johnny.NewUnbufferedPercTaxRule(ratio).WithCode(l.Additional))
+	}
+
+	return johnny.NewFromUnitValue(l.Price), visitors, nil
+}
+
+// Calculate calculates the line in a document of the given type with its [Pipeline].
+// The Value of the Result is the item amount, and its Net and Gross are the ones of the line before
+// the taxes are rounded by [Totalize].
+func Calculate(doc DocumentType, l Line) (johnny.Result, error) {
+	b, visitors, err := Pipeline(doc, l)
+
+	if err != nil {
+		return johnny.Result{}, err
+	}
+
+	if doc.TaxIncluded() {
+		return johnny.RunTaxIncluded(b, visitors...)
+	}
+
+	return johnny.Run(b, visitors...)
+}
+
+// Totals are the totals of a tax document in integer pesos, as the Totales of a DTE.
+type Totals struct {
+	// MntNeto is the net amount of the lines with IVA.
+	MntNeto gyro.Gyro
+	// MntExe is the amount of the lines exempted from IVA.
+	MntExe gyro.Gyro
+	// IVA is the amount of the value added tax.
+	IVA gyro.Gyro
+	// Additional holds the amounts of the additional taxes, by code.
+	Additional map[string]gyro.Gyro
+	// MntTotal is the total amount of the document.
+	MntTotal gyro.Gyro
+}
+
+// Totalize returns the totals of a document of the given type, from the results of its lines calculated
+// by [Calculate].
+//
+// In documents whose prices are net, each tax is calculated over the total of the lines it applies to
+// and rounded. In the ones whose prices include taxes, the net amount of the lines of each additional tax
+// is extracted from their total and rounded, and IVA is what remains of the total, so MntTotal is always
+// the sum of the item amounts. An error is returned if a tax or an extracted net amount overflows gyro.
+func Totalize(doc DocumentType, results ...johnny.Result) (Totals, error) {
+	t := Totals{Additional: map[string]gyro.Gyro{}}
+
+	// amounts holds the item amounts of the lines with IVA, by additional tax code
+	amounts := map[string]gyro.Gyro{}
+
+	for _, r := range results {
+		if exempt(r) {
+			t.MntExe = t.MntExe.Add(r.Value)
+			continue
+		}
+
+		code := additional(r)
+		amounts[code] = amounts[code].Add(r.Value)
+	}
+
+	iva, _ := Ratio(IVA)
+
+	for code, amount := range amounts {
+		ratio, _ := Ratio(code)
+
+		if doc.TaxIncluded() {
+			net, err := extract(amount, iva.Add(ratio))
+
+			if err != nil {
+				return Totals{}, err
+			}
+
+			amount = net
+		}
+
+		t.MntNeto = t.MntNeto.Add(amount)
+
+		if code != "" {
+			tax, err := percent(amount, ratio)
+
+			if err != nil {
+				return Totals{}, err
+			}
+
+			t.Additional[code] = tax
+		}
+	}
+
+	if doc.TaxIncluded() {
+		for _, r := range results {
+			t.MntTotal = t.MntTotal.Add(r.Value)
+		}
+
+		t.IVA = t.MntTotal.Sub(t.MntExe).Sub(t.MntNeto).Sub(sum(t.Additional))
+		return t, nil
+	}
+
+	tax, err := percent(t.MntNeto, iva)
+
+	if err != nil {
+		return Totals{}, err
+	}
+
+	t.IVA = tax
+	t.MntTotal = t.MntNeto.Add(t.MntExe).Add(t.IVA).Add(sum(t.Additional))
+
+	return t, nil
+}
+
+// exempt tells whether the line of r was exempted from IVA.
+func exempt(r johnny.Result) bool {
+	for _, e := range r.Exemptions {
+		if e.Code == IVA {
+			return true
+		}
+	}
+
+	return false
+}
+
+// additional returns the code of the additional tax of the line of r, empty when it has none.
+func additional(r johnny.Result) string {
+	for code := range r.TaxesByCode {
+		if code != IVA {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// percent returns the given ratio of amount, rounded to integer pesos.
+// An error is returned if it overflows gyro.
+func percent(amount, ratio gyro.Gyro) (gyro.Gyro, error) {
+	tax, err := johnny.Quo(amount.Mul(ratio), gyro.NewHundred())
+
+	if err != nil {
+		return gyro.Gyro{}, err
+	}
+
+	return Round(tax), nil
+}
+
+// extract returns the net amount of gross with the given ratio of taxes, rounded to integer pesos.
+// An error is returned if it overflows gyro.
+func extract(gross, ratio gyro.Gyro) (gyro.Gyro, error) {
+	net, err := johnny.Quo(gross.Mul(gyro.NewHundred()), gyro.NewHundred().Add(ratio))
+
+	if err != nil {
+		return gyro.Gyro{}, err
+	}
+
+	return Round(net), nil
+}
+
+func sum(amounts map[string]gyro.Gyro) gyro.Gyro {
+	total := gyro.Gyro{}
+
+	for _, a := range amounts {
+		total = total.Add(a)
+	}
+
+	return total
+}
@@ -0,0 +1,149 @@
+package chile
+
+import (
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func TestCalculate(t *testing.T) {
+	testCases := []struct {
+		doc   DocumentType
+		line  Line
+		value string
+		net   string
+		taxes map[string]string
+	}{
+		{FacturaAfecta, Line{Qty: udfs("10"), Price: udfs("1500"), DiscountPct: udfs("10")}, "13500", "13500", map[string]string{IVA: "2565"}},
+		// the item amount is rounded to integer pesos
+		{FacturaAfecta, Line{Qty: udfs("3"), Price: udfs("333.5")}, "1001", "1001", map[string]string{IVA: "190.19"}},
+		{FacturaAfecta, Line{Qty: udfs("24"), Price: udfs("990"), Additional: ILACervezas}, "23760", "23760", map[string]string{IVA: "4514.4", ILACervezas: "4870.8"}},
+		{FacturaAfecta, Line{Price: udfs("5000"), Exempt: true}, "5000", "5000", map[string]string{}},
+		{FacturaExenta, Line{Qty: udfs("2"), Price: udfs("2500"), Discount: udfs("500")}, "4500", "4500", map[string]string{}},
+		{Boleta, Line{Qty: udfs("2"), Price: udfs("595")}, "1190", "1000", map[string]string{IVA: "190"}},
+		{Boleta, Line{Price: udfs("1290"), Additional: ILABebidas}, "1290", "1000", map[string]string{IVA: "190", ILABebidas: "100"}},
+		{BoletaExenta, Line{Price: udfs("1000")}, "1000", "1000", map[string]string{}},
+	}
+
+	for i, tc := range testCases {
+		r, err := Calculate(tc.doc, tc.line)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !r.Value.Equal(udfs(tc.value)) || !r.Net.Equal(udfs(tc.net)) {
+			t.Errorf("[test case %d] got value %v and net %v. Expected %v and %v", i, r.Value, r.Net, tc.value, tc.net)
+		}
+
+		for code, amount := range tc.taxes {
+			if !r.TaxesByCode[code].Equal(udfs(amount)) {
+				t.Errorf("[test case %d] got %s %v. Expected %v", i, code, r.TaxesByCode[code], amount)
+			}
+		}
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	testCases := []struct {
+		doc  DocumentType
+		line Line
+	}{
+		{FacturaAfecta, Line{Price: udfs("1000"), Additional: "99"}},
+		{FacturaAfecta, Line{Price: udfs("1000"), Additional: IVA}},
+		{FacturaExenta, Line{Price: udfs("1000"), Additional: ILAVinos}},
+	}
+
+	for i, tc := range testCases {
+		if _, err := Calculate(tc.doc, tc.line); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
+
+func TestTotalize(t *testing.T) {
+	testCases := []struct {
+		doc        DocumentType
+		lines      []Line
+		neto       string
+		exe        string
+		iva        string
+		additional map[string]string
+		total      string
+	}{
+		// IVA is calculated over the net total, 19% of 23501 being 4465.19
+		{FacturaAfecta, []Line{{Qty: udfs("10"), Price: udfs("1500"), DiscountPct: udfs("10")}, {Qty: udfs("3"), Price: udfs("3333.5")}, {Price: udfs("5000"), Exempt: true}}, "23501", "5000", "4465", nil, "32966"},
+		{FacturaAfecta, []Line{{Qty: udfs("24"), Price: udfs("990"), Additional: ILACervezas}, {Qty: udfs("12"), Price: udfs("1000"), Additional: ILACervezas}, {Qty: udfs("6"), Price: udfs("850"), Additional: ILABebidas}}, "40860", "0", "7763", map[string]string{ILACervezas: "7331", ILABebidas: "510"}, "56464"},
+		{FacturaExenta, []Line{{Qty: udfs("2"), Price: udfs("2500")}, {Price: udfs("1000")}}, "0", "6000", "0", nil, "6000"},
+		// boletas extract the net amount from the total, IVA being what remains
+		{Boleta, []Line{{Price: udfs("1190")}, {Qty: udfs("3"), Price: udfs("990")}}, "3496", "0", "664", nil, "4160"},
+		{Boleta, []Line{{Price: udfs("1290"), Additional: ILABebidas}, {Price: udfs("1190")}, {Price: udfs("2000"), Exempt: true}}, "2000", "2000", "380", map[string]string{ILABebidas: "100"}, "4480"},
+
+		// Worked cases of the rules published by the SII, not sample documents of it: the ratios of the ILA
+		// are the ones of the article 42 of the DL 825 (Ley sobre Impuesto a las Ventas y Servicios), and the
+		// totals follow the description of MntNeto, IVA and ImptoReten in the "Formato Documentos Tributarios
+		// Electrónicos" and the "Formato Boleta Electrónica" of the SII: each tax over the total of its lines,
+		// rounded to integer pesos, and in boletas the net amount extracted from the tax-included total.
+
+		// ILA of spirits at 31.5%, 4715.55 rounded up
+		{FacturaAfecta, []Line{{Qty: udfs("3"), Price: udfs("4990"), Additional: ILADestilados}}, "14970", "0", "2844", map[string]string{ILADestilados: "4716"}, "22530"},
+		// the ILA of beers over the total is 411.23, while rounding each line would give 206 + 206
+		{FacturaAfecta, []Line{{Price: udfs("1003"), Additional: ILACervezas}, {Price: udfs("1003"), Additional: ILACervezas}}, "2006", "0", "381", map[string]string{ILACervezas: "411"}, "2798"},
+		// IVA of 465.5 is rounded half away from zero
+		{FacturaAfecta, []Line{{Qty: udfs("5"), Price: udfs("490")}}, "2450", "0", "466", nil, "2916"},
+		// boleta of a beverage with high sugar content, 1370 being 1000 plus IVA and ILA at 18%
+		{Boleta, []Line{{Price: udfs("1370"), Additional: ILABebidasAzucaradas}}, "1000", "0", "190", map[string]string{ILABebidasAzucaradas: "180"}, "1370"},
+		// boleta of wines, whose net amount is 6980 / 1.395 = 5003.58, and IVA what remains after the ILA of 1025.82
+		{Boleta, []Line{{Qty: udfs("2"), Price: udfs("3490"), Additional: ILAVinos}}, "5004", "0", "950", map[string]string{ILAVinos: "1026"}, "6980"},
+	}
+
+	for i, tc := range testCases {
+		results := make([]johnny.Result, 0, len(tc.lines))
+
+		for _, l := range tc.lines {
+			r, err := Calculate(tc.doc, l)
+
+			if err != nil {
+				t.Fatalf("[test case %d] %v", i, err)
+			}
+
+			results = append(results, r)
+		}
+
+		got, err := Totalize(tc.doc, results...)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !got.MntNeto.Equal(udfs(tc.neto)) || !got.MntExe.Equal(udfs(tc.exe)) || !got.IVA.Equal(udfs(tc.iva)) || !got.MntTotal.Equal(udfs(tc.total)) {
+			t.Errorf("[test case %d] got %v, %v, %v and %v. Expected %v, %v, %v and %v", i, got.MntNeto, got.MntExe, got.IVA, got.MntTotal, tc.neto, tc.exe, tc.iva, tc.total)
+		}
+
+		if len(got.Additional) != len(tc.additional) {
+			t.Errorf("[test case %d] got additional taxes %v. Expected %v", i, got.Additional, tc.additional)
+		}
+
+		for code, amount := range tc.additional {
+			if !got.Additional[code].Equal(udfs(amount)) {
+				t.Errorf("[test case %d] got %s %v. Expected %v", i, code, got.Additional[code], amount)
+			}
+		}
+	}
+}
+
+func TestRatio(t *testing.T) {
+	if r, ok := Ratio(ILADestilados); !ok || !r.Equal(udfs("31.5")) {
+		t.Errorf("got %v. Expected 31.5", r)
+	}
+
+	if _, ok := Ratio("99"); ok {
+		t.Errorf("unknown tax codes should have no ratio")
+	}
+}
@@ -0,0 +1,372 @@
+package chile
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/internal/xsd"
+)
+
+// Namespace is the namespace of the DTE (Documento Tributario Electrónico) of the SII.
+const Namespace = "http://www.sii.cl/SiiDte"
+
+// Party is the issuer (Emisor) or the receiver (Receptor) of a DTE.
+type Party struct {
+	// RUT is the tax identifier with its check digit, as "76543210-3".
+	RUT string
+	// Name is the business name (RznSoc).
+	Name string
+	// Activity is the line of business (Giro).
+	Activity string
+	// ActivityCode is the code of the economic activity of the issuer (Acteco), required in facturas.
+	ActivityCode int
+	Address      string
+	Commune      string
+	City         string
+}
+
+// ReferenceCode tells what a document does with the one it references (CodRef).
+type ReferenceCode int
+
+const (
+	// Cancel cancels the referenced document.
+	Cancel ReferenceCode = 1
+	// FixText corrects the texts of the referenced document.
+	FixText ReferenceCode = 2
+	// FixAmounts corrects the amounts of the referenced document.
+	FixAmounts ReferenceCode = 3
+)
+
+// Reference is a document referenced by a DTE (Referencia), as the factura a nota de crédito corrects.
+type Reference struct {
+	Type  DocumentType
+	Folio string
+	Date  time.Time
+	Code  ReferenceCode
+	// Reason is the reason of the reference (RazonRef).
+	Reason string
+}
+
+// Item is a line of a DTE with the name of its item (NmbItem).
+type Item struct {
+	Name string
+	Line
+}
+
+// DTE is a tax document of the SII.
+type DTE struct {
+	Type       DocumentType
+	Folio      int64
+	Date       time.Time
+	Issuer     Party
+	Receiver   Party
+	Items      []Item
+	References []Reference
+}
+
+// Calculate calculates the items of the document with [Calculate], and its totals with [Totalize].
+// An error is returned if an item or the totals can't be calculated.
+func (d DTE) Calculate() ([]johnny.Result, Totals, error) {
+	results := make([]johnny.Result, 0, len(d.Items))
+
+	for i, it := range d.Items {
+		r, err := Calculate(d.Type, it.Line)
+
+		if err != nil {
+			return nil, Totals{}, johnny.NewJohnnyError(fmt.Sprintf("item %d: %v", i+1, err))
+		}
+
+		results = append(results, r)
+	}
+
+	totals, err := Totalize(d.Type, results...)
+
+	if err != nil {
+		return nil, Totals{}, err
+	}
+
+	return results, totals, nil
+}
+
+type idDocXML struct {
+	TipoDTE     int    `xml:"TipoDTE"`
+	Folio       int64  `xml:"Folio"`
+	FchEmis     string `xml:"FchEmis"`
+	IndServicio int    `xml:"IndServicio,omitempty"`
+}
+
+type emisorXML struct {
+	RUTEmisor    string `xml:"RUTEmisor"`
+	RznSoc       string `xml:"RznSoc,omitempty"`
+	RznSocEmisor string `xml:"RznSocEmisor,omitempty"`
+	GiroEmis     string `xml:"GiroEmis,omitempty"`
+	GiroEmisor   string `xml:"GiroEmisor,omitempty"`
+	Acteco       int    `xml:"Acteco,omitempty"`
+	DirOrigen    string `xml:"DirOrigen,omitempty"`
+	CmnaOrigen   string `xml:"CmnaOrigen,omitempty"`
+	CiudadOrigen string `xml:"CiudadOrigen,omitempty"`
+}
+
+type receptorXML struct {
+	RUTRecep    string `xml:"RUTRecep"`
+	RznSocRecep string `xml:"RznSocRecep,omitempty"`
+	GiroRecep   string `xml:"GiroRecep,omitempty"`
+	DirRecep    string `xml:"DirRecep,omitempty"`
+	CmnaRecep   string `xml:"CmnaRecep,omitempty"`
+	CiudadRecep string `xml:"CiudadRecep,omitempty"`
+}
+
+type impuestoXML struct {
+	TipoImp  string `xml:"TipoImp"`
+	TasaImp  string `xml:"TasaImp"`
+	MontoImp string `xml:"MontoImp"`
+}
+
+type totalesXML struct {
+	MntNeto    string        `xml:"MntNeto,omitempty"`
+	MntExe     string        `xml:"MntExe,omitempty"`
+	TasaIVA    string        `xml:"TasaIVA,omitempty"`
+	IVA        string        `xml:"IVA,omitempty"`
+	ImptoReten []impuestoXML `xml:"ImptoReten"`
+	MntTotal   string        `xml:"MntTotal"`
+}
+
+type detalleXML struct {
+	NroLinDet      int    `xml:"NroLinDet"`
+	IndExe         int    `xml:"IndExe,omitempty"`
+	NmbItem        string `xml:"NmbItem"`
+	QtyItem        string `xml:"QtyItem,omitempty"`
+	PrcItem        string `xml:"PrcItem,omitempty"`
+	DescuentoPct   string `xml:"DescuentoPct,omitempty"`
+	DescuentoMonto string `xml:"DescuentoMonto,omitempty"`
+	CodImpAdic     string `xml:"CodImpAdic,omitempty"`
+	MontoItem      string `xml:"MontoItem"`
+}
+
+type referenciaXML struct {
+	NroLinRef int    `xml:"NroLinRef"`
+	TpoDocRef string `xml:"TpoDocRef"`
+	FolioRef  string `xml:"FolioRef"`
+	FchRef    string `xml:"FchRef"`
+	CodRef    int    `xml:"CodRef,omitempty"`
+	RazonRef  string `xml:"RazonRef,omitempty"`
+}
+
+type documentoXML struct {
+	XMLName    xml.Name        `xml:"Documento"`
+	Xmlns      string          `xml:"xmlns,attr"`
+	ID         string          `xml:"ID,attr"`
+	IdDoc      idDocXML        `xml:"Encabezado>IdDoc"`
+	Emisor     emisorXML       `xml:"Encabezado>Emisor"`
+	Receptor   receptorXML     `xml:"Encabezado>Receptor"`
+	Totales    totalesXML      `xml:"Encabezado>Totales"`
+	Detalle    []detalleXML    `xml:"Detalle"`
+	Referencia []referenciaXML `xml:"Referencia"`
+}
+
+// MarshalDocumento returns the Documento of the DTE as XML, with its Detalle and Totales calculated by
+// [DTE.Calculate], checked with [ValidateDocumento]. The timbre (TED) and the signature are left to the
+// signing of the document.
+//
+// Boletas have no place for additional taxes, which are only part of their MntTotal.
+// An error is returned if the document type isn't supported, the document has no items, a nota de crédito
+// references no document, or the Documento isn't valid.
+func MarshalDocumento(d DTE) ([]byte, error) {
+	if _, ok := documentNames[d.Type]; !ok {
+		return nil, johnny.NewJohnnyError("unsupported " + d.Type.String())
+	}
+
+	if len(d.Items) == 0 {
+		return nil, johnny.NewJohnnyError("a DTE must have items")
+	}
+
+	if d.Type == NotaCredito && len(d.References) == 0 {
+		return nil, johnny.NewJohnnyError("a nota de crédito must reference the document it corrects")
+	}
+
+	if d.Type.TaxIncluded() && len(d.References) > 0 {
+		return nil, johnny.NewJohnnyError("references of boletas are not supported")
+	}
+
+	results, t, err := d.Calculate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	x := documentoXML{
+		Xmlns:    Namespace,
+		ID:       fmt.Sprintf("F%dT%d", d.Folio, int(d.Type)),
+		IdDoc:    idDocXML{TipoDTE: int(d.Type), Folio: d.Folio, FchEmis: d.Date.Format(johnny.DateLayout)},
+		Emisor:   emisorXML{RUTEmisor: d.Issuer.RUT, DirOrigen: d.Issuer.Address, CmnaOrigen: d.Issuer.Commune, CiudadOrigen: d.Issuer.City},
+		Receptor: receptorXML{RUTRecep: d.Receiver.RUT, RznSocRecep: d.Receiver.Name, DirRecep: d.Receiver.Address, CmnaRecep: d.Receiver.Commune, CiudadRecep: d.Receiver.City},
+		Totales:  totales(d.Type, t),
+	}
+
+	if d.Type.TaxIncluded() {
+		// sales of goods and services
+		x.IdDoc.IndServicio = 3
+		x.Emisor.RznSocEmisor, x.Emisor.GiroEmisor = d.Issuer.Name, d.Issuer.Activity
+	} else {
+		x.Emisor.RznSoc, x.Emisor.GiroEmis, x.Emisor.Acteco = d.Issuer.Name, d.Issuer.Activity, d.Issuer.ActivityCode
+		x.Receptor.GiroRecep = d.Receiver.Activity
+	}
+
+	for i, it := range d.Items {
+		x.Detalle = append(x.Detalle, detalle(d.Type, i+1, it, results[i]))
+	}
+
+	for i, ref := range d.References {
+		x.Referencia = append(x.Referencia, referenciaXML{
+			NroLinRef: i + 1,
+			TpoDocRef: fmt.Sprint(int(ref.Type)),
+			FolioRef:  ref.Folio,
+			FchRef:    ref.Date.Format(johnny.DateLayout),
+			CodRef:    int(ref.Code),
+			RazonRef:  ref.Reason,
+		})
+	}
+
+	data, err := xml.MarshalIndent(x, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	data = append([]byte(xml.Header), data...)
+
+	if err := ValidateDocumento(d.Type, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func totales(doc DocumentType, t Totals) totalesXML {
+	x := totalesXML{MntTotal: johnny.DecimalString(t.MntTotal)}
+
+	if !t.MntExe.Equal(gyro.NewZero()) {
+		x.MntExe = johnny.DecimalString(t.MntExe)
+	}
+
+	if t.MntNeto.Equal(gyro.NewZero()) {
+		return x
+	}
+
+	x.MntNeto, x.IVA = johnny.DecimalString(t.MntNeto), johnny.DecimalString(t.IVA)
+
+	if doc.TaxIncluded() {
+		return x
+	}
+
+	iva, _ := Ratio(IVA)
+	x.TasaIVA = johnny.DecimalString(iva)
+
+	codes := make([]string, 0, len(t.Additional))
+
+	for code := range t.Additional {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		ratio, _ := Ratio(code)
+		x.ImptoReten = append(x.ImptoReten, impuestoXML{TipoImp: code, TasaImp: johnny.DecimalString(ratio), MontoImp: johnny.DecimalString(t.Additional[code])})
+	}
+
+	return x
+}
+
+// detalle returns the Detalle of the item. Its discount amount is the difference between the quantity times
+// the price and the item amount, both rounded, so QtyItem * PrcItem - DescuentoMonto rounds to MontoItem,
+// as the SII checks.
+func detalle(doc DocumentType, n int, it Item, r johnny.Result) detalleXML {
+	amount, discount := itemAmounts(it, r)
+	x := detalleXML{NroLinDet: n, NmbItem: it.Name, PrcItem: johnny.DecimalString(it.Price), MontoItem: johnny.DecimalString(amount)}
+
+	if !it.Qty.Equal(gyro.NewZero()) {
+		x.QtyItem = johnny.DecimalString(it.Qty)
+	}
+
+	if it.Exempt && !doc.Exempt() {
+		x.IndExe = 1
+	}
+
+	if !it.DiscountPct.Equal(gyro.NewZero()) {
+		x.DescuentoPct = johnny.DecimalString(it.DiscountPct)
+	}
+
+	if discount.Cmp(gyro.NewZero()) > 0 {
+		x.DescuentoMonto = johnny.DecimalString(discount)
+	}
+
+	if !doc.TaxIncluded() {
+		x.CodImpAdic = it.Additional
+	}
+
+	return x
+}
+
+// itemAmounts returns the item amount of the item calculated as r, and its discount amount, zero when the
+// item has no discount.
+func itemAmounts(it Item, r johnny.Result) (gyro.Gyro, gyro.Gyro) {
+	qty := gyro.NewOne()
+
+	if !it.Qty.Equal(gyro.NewZero()) {
+		qty = it.Qty
+	}
+
+	amount := Round(r.Value)
+	discount := Round(qty.Mul(it.Price)).Sub(amount)
+
+	if discount.Cmp(gyro.NewZero()) < 0 {
+		return amount, gyro.Gyro{}
+	}
+
+	return amount, discount
+}
+
+//go:embed schema/*.xsd
+var schemas embed.FS
+
+var (
+	facturaSchema = loadSchema("DTE_v10-subset.xsd")
+	boletaSchema  = loadSchema("EnvioBOLETA_v11-subset.xsd")
+)
+
+func loadSchema(name string) *xsd.Schema {
+	f, err := schemas.Open("schema/" + name)
+
+	if err != nil {
+		panic(err)
+	}
+
+	s, err := xsd.Load(f)
+
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled schema %s: %v", name, err))
+	}
+
+	return s
+}
+
+// ValidateDocumento checks the Documento of a DTE of the given type against the schemas bundled in chile/schema,
+// which are a structural subset of DTE_v10.xsd and EnvioBOLETA_v11.xsd of the SII covering only the elements
+// written by [MarshalDocumento], with their order, cardinality and data types. It's not a validation against
+// the schemas of the SII, which aren't bundled: a Documento using other elements is rejected, and one passing
+// it may still be rejected by the SII.
+func ValidateDocumento(doc DocumentType, r io.Reader) error {
+	if doc.TaxIncluded() {
+		return boletaSchema.Validate(r)
+	}
+
+	return facturaSchema.Validate(r)
+}
@@ -0,0 +1,127 @@
+package chile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	issuer   = Party{RUT: "76543210-3", Name: "Comercial Los Andes SpA", Activity: "Venta al por menor", ActivityCode: 472101, Address: "Av. Apoquindo 1234", Commune: "Las Condes", City: "Santiago"}
+	receiver = Party{RUT: "77888999-K", Name: "Distribuidora Sur Ltda", Activity: "Distribución", Address: "Calle 5 123", Commune: "Temuco"}
+	issued   = time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC)
+)
+
+func TestMarshalDocumento(t *testing.T) {
+	testCases := []struct {
+		dte      DTE
+		contains []string
+		excludes []string
+	}{
+		{DTE{Type: FacturaAfecta, Folio: 1234, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+			{"Resma carta", Line{Qty: udfs("10"), Price: udfs("1500"), DiscountPct: udfs("10")}},
+			{"Archivador", Line{Qty: udfs("3"), Price: udfs("3333.5")}},
+			{"Curso", Line{Price: udfs("5000"), Exempt: true}},
+		}}, []string{
+			`<Documento xmlns="http://www.sii.cl/SiiDte" ID="F1234T33">`,
+			`<RznSoc>Comercial Los Andes SpA</RznSoc>`,
+			`<Acteco>472101</Acteco>`,
+			"<DescuentoPct>10</DescuentoPct>\n    <DescuentoMonto>1500</DescuentoMonto>\n    <MontoItem>13500</MontoItem>",
+			"<PrcItem>3333.5</PrcItem>\n    <MontoItem>10001</MontoItem>",
+			"<IndExe>1</IndExe>",
+			"<MntNeto>23501</MntNeto>\n      <MntExe>5000</MntExe>\n      <TasaIVA>19</TasaIVA>\n      <IVA>4465</IVA>\n      <MntTotal>32966</MntTotal>",
+		}, []string{"<QtyItem>1</QtyItem>", "Referencia", "IndServicio"}},
+		{DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+			{"Cerveza", Line{Qty: udfs("24"), Price: udfs("990"), Additional: ILACervezas}},
+			{"Bebida", Line{Qty: udfs("6"), Price: udfs("850"), Additional: ILABebidas}},
+		}}, []string{
+			"<CodImpAdic>26</CodImpAdic>",
+			"<ImptoReten>\n        <TipoImp>26</TipoImp>\n        <TasaImp>20.5</TasaImp>\n        <MontoImp>4871</MontoImp>",
+			"<TipoImp>27</TipoImp>\n        <TasaImp>10</TasaImp>\n        <MontoImp>510</MontoImp>",
+			"<MntTotal>39724</MntTotal>",
+		}, nil},
+		{DTE{Type: FacturaExenta, Folio: 7, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+			{"Asesoría", Line{Qty: udfs("2"), Price: udfs("2500"), Discount: udfs("500")}},
+		}}, []string{"<TipoDTE>34</TipoDTE>", "<DescuentoMonto>500</DescuentoMonto>", "<MntExe>4500</MntExe>\n      <MntTotal>4500</MntTotal>"}, []string{"IVA", "IndExe"}},
+		{DTE{Type: Boleta, Folio: 99, Date: issued, Issuer: issuer, Receiver: Party{RUT: "66666666-6"}, Items: []Item{
+			{"Pan", Line{Price: udfs("1190")}},
+			{"Leche", Line{Qty: udfs("3"), Price: udfs("990")}},
+		}}, []string{
+			"<IndServicio>3</IndServicio>",
+			"<RznSocEmisor>Comercial Los Andes SpA</RznSocEmisor>",
+			"<MntNeto>3496</MntNeto>\n      <IVA>664</IVA>\n      <MntTotal>4160</MntTotal>",
+		}, []string{"TasaIVA", "Acteco", "RznSocRecep"}},
+		{DTE{Type: NotaCredito, Folio: 15, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+			{"Resma carta", Line{Qty: udfs("2"), Price: udfs("1350")}},
+		}, References: []Reference{{Type: FacturaAfecta, Folio: "1234", Date: issued, Code: FixAmounts, Reason: "Devolución de mercaderías"}}}, []string{
+			`ID="F15T61"`,
+			"<MntNeto>2700</MntNeto>\n      <TasaIVA>19</TasaIVA>\n      <IVA>513</IVA>\n      <MntTotal>3213</MntTotal>",
+			"<NroLinRef>1</NroLinRef>\n    <TpoDocRef>33</TpoDocRef>\n    <FolioRef>1234</FolioRef>\n    <FchRef>2025-05-20</FchRef>\n    <CodRef>3</CodRef>",
+		}, nil},
+	}
+
+	for i, tc := range testCases {
+		data, err := MarshalDocumento(tc.dte)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		for _, s := range tc.contains {
+			if !bytes.Contains(data, []byte(s)) {
+				t.Errorf("[test case %d] %s not found in\n%s", i, s, data)
+			}
+		}
+
+		for _, s := range tc.excludes {
+			if bytes.Contains(data, []byte(s)) {
+				t.Errorf("[test case %d] %s found in\n%s", i, s, data)
+			}
+		}
+	}
+}
+
+func TestMarshalDocumentoErrors(t *testing.T) {
+	items := []Item{{"Resma carta", Line{Price: udfs("1500")}}}
+	ref := []Reference{{Type: FacturaAfecta, Folio: "1", Date: issued, Code: Cancel}}
+
+	testCases := []struct {
+		dte DTE
+		err string
+	}{
+		{DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver}, "must have items"},
+		{DTE{Type: DocumentType(52), Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: items}, "unsupported"},
+		{DTE{Type: NotaCredito, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: items}, "must reference"},
+		{DTE{Type: Boleta, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: items, References: ref}, "references of boletas"},
+		{DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{{"Vino", Line{Price: udfs("1500"), Additional: "99"}}}}, "item 1"},
+		// the schema requires the activity code of the issuer and checks the RUT
+		{DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: Party{RUT: issuer.RUT, Name: issuer.Name, Activity: issuer.Activity}, Receiver: receiver, Items: items}, "missing element Acteco"},
+		{DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: issuer, Receiver: Party{RUT: "77.888.999-K", Name: receiver.Name}, Items: items}, "Documento/Encabezado/Receptor/RUTRecep"},
+	}
+
+	for i, tc := range testCases {
+		if _, err := MarshalDocumento(tc.dte); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("[test case %d] got %v. Expected %s", i, err, tc.err)
+		}
+	}
+}
+
+func TestValidateDocumento(t *testing.T) {
+	data, err := MarshalDocumento(DTE{Type: FacturaAfecta, Folio: 1, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{{"Resma carta", Line{Price: udfs("1500")}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateDocumento(FacturaAfecta, bytes.NewReader(data)); err != nil {
+		t.Fatalf("got %v. Expected the marshalled Documento to be valid", err)
+	}
+
+	// the Transporte is in the schema of the SII but not in the bundled subset
+	withTransporte := bytes.Replace(data, []byte("</Receptor>"), []byte("</Receptor>\n      <Transporte><Patente>AB1234</Patente></Transporte>"), 1)
+
+	if err := ValidateDocumento(FacturaAfecta, bytes.NewReader(withTransporte)); err == nil || !strings.Contains(err.Error(), "Documento/Encabezado") {
+		t.Errorf("got %v. Expected the Transporte in the Encabezado to be rejected", err)
+	}
+}
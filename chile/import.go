@@ -0,0 +1,230 @@
+package chile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/audit"
+)
+
+// Declared holds the amounts declared by an imported Documento.
+type Declared struct {
+	// Items holds the item amount (MontoItem) of each item.
+	Items []gyro.Gyro
+	// Discounts holds the discount amount (DescuentoMonto) of each item, zero when it has none.
+	Discounts []gyro.Gyro
+	// Totals holds the Totales of the document, with the additional taxes (ImptoReten) by code.
+	Totals Totals
+}
+
+// decimals parses the decimal amounts of an imported Documento, keeping the first error found.
+type decimals struct {
+	err error
+}
+
+// parse returns the value of the named element, zero when it's missing.
+func (d *decimals) parse(element, v string) gyro.Gyro {
+	v = strings.TrimSpace(v)
+
+	if v == "" || d.err != nil {
+		return gyro.Gyro{}
+	}
+
+	g, err := johnny.ParseDecimal(v)
+
+	if err != nil {
+		d.err = johnny.NewJohnnyError(fmt.Sprintf("invalid %s %q", element, v))
+	}
+
+	return g
+}
+
+// ParseDocumento reads the Documento of a DTE, returning the DTE with its items as they were calculated
+// and the amounts it declares. The Documento may be the root of the XML or be wrapped, as in a DTE or an
+// EnvioDTE, in which case the first one is read. Its elements are matched by their local names.
+//
+// The items are rebuilt from their quantity, price, exemption and additional tax. Their discount is the
+// percentual one when DescuentoPct is given, as DescuentoMonto is then the amount it discounts, or else
+// DescuentoMonto. Boletas don't declare the additional taxes of their items, so their items are rebuilt
+// without them. The Documento isn't validated against the bundled schemas, so documents with elements
+// [MarshalDocumento] doesn't write, as the TED, can be read.
+//
+// An error is returned if no Documento is found, its type isn't supported, it has no items, or it has
+// invalid amounts, dates or references.
+func ParseDocumento(r io.Reader) (DTE, Declared, error) {
+	x, err := decodeDocumento(r)
+
+	if err != nil {
+		return DTE{}, Declared{}, err
+	}
+
+	d := DTE{
+		Type:     DocumentType(x.IdDoc.TipoDTE),
+		Folio:    x.IdDoc.Folio,
+		Issuer:   Party{RUT: x.Emisor.RUTEmisor, Name: x.Emisor.RznSoc, Activity: x.Emisor.GiroEmis, ActivityCode: x.Emisor.Acteco, Address: x.Emisor.DirOrigen, Commune: x.Emisor.CmnaOrigen, City: x.Emisor.CiudadOrigen},
+		Receiver: Party{RUT: x.Receptor.RUTRecep, Name: x.Receptor.RznSocRecep, Activity: x.Receptor.GiroRecep, Address: x.Receptor.DirRecep, Commune: x.Receptor.CmnaRecep, City: x.Receptor.CiudadRecep},
+	}
+
+	if _, ok := documentNames[d.Type]; !ok {
+		return DTE{}, Declared{}, johnny.NewJohnnyError("unsupported " + d.Type.String())
+	}
+
+	// boletas name their issuer with their own elements
+	if d.Issuer.Name == "" {
+		d.Issuer.Name, d.Issuer.Activity = x.Emisor.RznSocEmisor, x.Emisor.GiroEmisor
+	}
+
+	if d.Date, err = time.Parse(johnny.DateLayout, strings.TrimSpace(x.IdDoc.FchEmis)); err != nil {
+		return DTE{}, Declared{}, johnny.NewJohnnyError("invalid FchEmis " + x.IdDoc.FchEmis)
+	}
+
+	if len(x.Detalle) == 0 {
+		return DTE{}, Declared{}, johnny.NewJohnnyError("a DTE must have items")
+	}
+
+	dec := &decimals{}
+	var declared Declared
+
+	for _, det := range x.Detalle {
+		it := Item{Name: det.NmbItem, Line: Line{
+			Qty:         dec.parse("QtyItem", det.QtyItem),
+			Price:       dec.parse("PrcItem", det.PrcItem),
+			DiscountPct: dec.parse("DescuentoPct", det.DescuentoPct),
+			Exempt:      det.IndExe == 1,
+			Additional:  strings.TrimSpace(det.CodImpAdic),
+		}}
+
+		discount := dec.parse("DescuentoMonto", det.DescuentoMonto)
+
+		if it.DiscountPct.Equal(gyro.NewZero()) {
+			it.Discount = discount
+		}
+
+		d.Items = append(d.Items, it)
+		declared.Items = append(declared.Items, dec.parse("MontoItem", det.MontoItem))
+		declared.Discounts = append(declared.Discounts, discount)
+	}
+
+	for _, ref := range x.Referencia {
+		typ, err := strconv.Atoi(strings.TrimSpace(ref.TpoDocRef))
+
+		if err != nil {
+			return DTE{}, Declared{}, johnny.NewJohnnyError("invalid TpoDocRef " + ref.TpoDocRef)
+		}
+
+		date, err := time.Parse(johnny.DateLayout, strings.TrimSpace(ref.FchRef))
+
+		if err != nil {
+			return DTE{}, Declared{}, johnny.NewJohnnyError("invalid FchRef " + ref.FchRef)
+		}
+
+		d.References = append(d.References, Reference{Type: DocumentType(typ), Folio: ref.FolioRef, Date: date, Code: ReferenceCode(ref.CodRef), Reason: ref.RazonRef})
+	}
+
+	t := &declared.Totals
+	t.MntNeto = dec.parse("MntNeto", x.Totales.MntNeto)
+	t.MntExe = dec.parse("MntExe", x.Totales.MntExe)
+	t.IVA = dec.parse("IVA", x.Totales.IVA)
+	t.MntTotal = dec.parse("MntTotal", x.Totales.MntTotal)
+	t.Additional = map[string]gyro.Gyro{}
+
+	for _, imp := range x.Totales.ImptoReten {
+		code := strings.TrimSpace(imp.TipoImp)
+		t.Additional[code] = t.Additional[code].Add(dec.parse("MontoImp", imp.MontoImp))
+	}
+
+	if dec.err != nil {
+		return DTE{}, Declared{}, dec.err
+	}
+
+	return d, declared, nil
+}
+
+// decodeDocumento decodes the first Documento element read from r.
+func decodeDocumento(r io.Reader) (documentoXML, error) {
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+
+		if err == io.EOF {
+			return documentoXML{}, johnny.NewJohnnyError("no Documento found")
+		}
+
+		if err != nil {
+			return documentoXML{}, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "Documento" {
+			var x documentoXML
+
+			if err := dec.DecodeElement(&x, &start); err != nil {
+				return documentoXML{}, err
+			}
+
+			return x, nil
+		}
+	}
+}
+
+// AuditDocumento reads the Documento of a DTE with [ParseDocumento], and reports the differences between the
+// amounts it declares and the ones calculated for it by [DTE.Calculate]: the item and discount amounts of each
+// item, and the totals. The additional taxes are checked by code, as "ImptoReten[27]/MontoImp", except in
+// boletas, whose additional taxes are only part of their MntTotal.
+func AuditDocumento(r io.Reader, t audit.Tolerances) (*audit.Report, error) {
+	d, declared, err := ParseDocumento(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results, calculated, err := d.Calculate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := audit.NewReport(t)
+
+	for i, it := range d.Items {
+		amount, discount := itemAmounts(it, results[i])
+		report.Line(i+1, "MontoItem", declared.Items[i], amount)
+		report.Line(i+1, "DescuentoMonto", declared.Discounts[i], discount)
+	}
+
+	dt := declared.Totals
+	report.Total("MntNeto", dt.MntNeto, calculated.MntNeto)
+	report.Total("MntExe", dt.MntExe, calculated.MntExe)
+	report.Total("IVA", dt.IVA, calculated.IVA)
+
+	if !d.Type.TaxIncluded() {
+		codes := make([]string, 0, len(dt.Additional)+len(calculated.Additional))
+
+		for code := range calculated.Additional {
+			codes = append(codes, code)
+		}
+
+		for code := range dt.Additional {
+			if _, ok := calculated.Additional[code]; !ok {
+				codes = append(codes, code)
+			}
+		}
+
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			report.Total("ImptoReten["+code+"]/MontoImp", dt.Additional[code], calculated.Additional[code])
+		}
+	}
+
+	report.Total("MntTotal", dt.MntTotal, calculated.MntTotal)
+
+	return report, nil
+}
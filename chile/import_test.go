@@ -0,0 +1,163 @@
+package chile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/johnny/audit"
+)
+
+var (
+	factura = DTE{Type: FacturaAfecta, Folio: 1234, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+		{"Resma carta", Line{Qty: udfs("10"), Price: udfs("1500"), DiscountPct: udfs("10")}},
+		{"Archivador", Line{Qty: udfs("3"), Price: udfs("3333.5"), Discount: udfs("1")}},
+		{"Curso", Line{Price: udfs("5000"), Exempt: true}},
+		{"Cerveza", Line{Qty: udfs("24"), Price: udfs("990"), Additional: ILACervezas}},
+	}}
+	boleta = DTE{Type: Boleta, Folio: 99, Date: issued, Issuer: issuer, Receiver: Party{RUT: "66666666-6"}, Items: []Item{
+		{"Pan", Line{Price: udfs("1190")}},
+		{"Leche", Line{Qty: udfs("3"), Price: udfs("990")}},
+	}}
+	notaCredito = DTE{Type: NotaCredito, Folio: 15, Date: issued, Issuer: issuer, Receiver: receiver, Items: []Item{
+		{"Resma carta", Line{Qty: udfs("2"), Price: udfs("1350")}},
+	}, References: []Reference{{Type: FacturaAfecta, Folio: "1234", Date: issued, Code: FixAmounts, Reason: "Devolución de mercaderías"}}}
+)
+
+func marshal(t *testing.T, d DTE) string {
+	t.Helper()
+	data, err := MarshalDocumento(d)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestParseDocumento(t *testing.T) {
+	for i, want := range []DTE{factura, boleta, notaCredito} {
+		got, declared, err := ParseDocumento(strings.NewReader(marshal(t, want)))
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if got.Type != want.Type || got.Folio != want.Folio || !got.Date.Equal(want.Date) || got.Issuer.RUT != want.Issuer.RUT || got.Issuer.Name != want.Issuer.Name || len(got.Items) != len(want.Items) || len(got.References) != len(want.References) {
+			t.Fatalf("[test case %d] got %+v. Expected %+v", i, got, want)
+		}
+
+		for j, ref := range got.References {
+			if ref != want.References[j] {
+				t.Errorf("[test case %d] got reference %+v. Expected %+v", i, ref, want.References[j])
+			}
+		}
+
+		results, totals, _ := want.Calculate()
+
+		for j, it := range got.Items {
+			if it.Name != want.Items[j].Name || it.Exempt != want.Items[j].Exempt || !it.Price.Equal(want.Items[j].Price) || !declared.Items[j].Equal(Round(results[j].Value)) {
+				t.Errorf("[test case %d] got item %+v declaring %v. Expected %+v", i, it, declared.Items[j], want.Items[j])
+			}
+		}
+
+		if !declared.Totals.MntTotal.Equal(totals.MntTotal) || !declared.Totals.IVA.Equal(totals.IVA) {
+			t.Errorf("[test case %d] got totals %+v. Expected %+v", i, declared.Totals, totals)
+		}
+	}
+}
+
+func TestAuditDocumento(t *testing.T) {
+	tolerances := audit.Tolerances{Line: udfs("1"), Total: udfs("1")}
+
+	testCases := []struct {
+		doc          string
+		replacements []string
+		expected     []string
+	}{
+		{marshal(t, factura), nil, nil},
+		{marshal(t, boleta), nil, nil},
+		{marshal(t, notaCredito), nil, nil},
+		// a Documento wrapped in a DTE, with a timbre the schemas don't cover
+		{`<DTE xmlns="http://www.sii.cl/SiiDte" version="1.0">` + strings.TrimPrefix(marshal(t, notaCredito), `<?xml version="1.0" encoding="UTF-8"?>`) + `</DTE>`,
+			[]string{"</Referencia>", "</Referencia>\n  <TED version=\"1.0\"><DD><RE>76543210-3</RE></DD></TED>"}, nil},
+		// differences within the tolerances are accepted
+		{marshal(t, factura), []string{"<MntTotal>66110</MntTotal>", "<MntTotal>66111</MntTotal>"}, nil},
+		{marshal(t, factura), []string{
+			"<MontoItem>13500</MontoItem>", "<MontoItem>15000</MontoItem>",
+			"<IVA>8979</IVA>", "<IVA>9264</IVA>",
+			"<MontoImp>4871</MontoImp>", "<MontoImp>4000</MontoImp>",
+		}, []string{
+			"line 1 MontoItem: declared 15000, calculated 13500",
+			"total IVA: declared 9264, calculated 8979",
+			"total ImptoReten[26]/MontoImp: declared 4000, calculated 4871",
+		}},
+		// the amounts are calculated from the price and the discount of the items
+		{marshal(t, factura), []string{"<DescuentoMonto>1</DescuentoMonto>", "<DescuentoMonto>5</DescuentoMonto>"}, []string{
+			"line 2 MontoItem: declared 10000, calculated 9996",
+			"total MntNeto: declared 47260, calculated 47256",
+			"total MntTotal: declared 66110, calculated 66106",
+		}},
+		{marshal(t, factura), []string{"<CodImpAdic>26</CodImpAdic>", "<CodImpAdic>27</CodImpAdic>"}, []string{
+			"total ImptoReten[26]/MontoImp: declared 4871, calculated 0",
+			"total ImptoReten[27]/MontoImp: declared 0, calculated 2376",
+			"total MntTotal: declared 66110, calculated 63615",
+		}},
+		{marshal(t, boleta), []string{"<PrcItem>1190</PrcItem>", "<PrcItem>1290</PrcItem>"}, []string{
+			"line 1 MontoItem: declared 1190, calculated 1290",
+			"total MntNeto: declared 3496, calculated 3580",
+			"total IVA: declared 664, calculated 680",
+			"total MntTotal: declared 4160, calculated 4260",
+		}},
+	}
+
+	for i, tc := range testCases {
+		doc := tc.doc
+
+		for j := 0; j < len(tc.replacements); j += 2 {
+			if !strings.Contains(doc, tc.replacements[j]) {
+				t.Fatalf("[test case %d] %s not found in\n%s", i, tc.replacements[j], doc)
+			}
+
+			doc = strings.Replace(doc, tc.replacements[j], tc.replacements[j+1], 1)
+		}
+
+		report, err := AuditDocumento(strings.NewReader(doc), tolerances)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if len(report.Discrepancies) != len(tc.expected) {
+			t.Fatalf("[test case %d] got discrepancies\n%s\nExpected\n%s", i, report, strings.Join(tc.expected, "\n"))
+		}
+
+		for j, d := range report.Discrepancies {
+			if d.String() != tc.expected[j] {
+				t.Errorf("[test case %d] got %q. Expected %q", i, d.String(), tc.expected[j])
+			}
+		}
+	}
+}
+
+func TestParseDocumentoErrors(t *testing.T) {
+	valid := marshal(t, notaCredito)
+
+	testCases := []struct {
+		doc string
+		err string
+	}{
+		{`<EnvioDTE xmlns="http://www.sii.cl/SiiDte"/>`, "no Documento"},
+		{strings.Replace(valid, "<TipoDTE>61</TipoDTE>", "<TipoDTE>52</TipoDTE>", 1), "unsupported"},
+		{strings.Replace(valid, "<FchEmis>2025-05-20</FchEmis>", "<FchEmis>20-05-2025</FchEmis>", 1), "invalid FchEmis"},
+		{strings.Replace(valid, "<PrcItem>1350</PrcItem>", "<PrcItem>$1350</PrcItem>", 1), "invalid PrcItem"},
+		{strings.Replace(valid, "<TpoDocRef>33</TpoDocRef>", "<TpoDocRef>FAC</TpoDocRef>", 1), "invalid TpoDocRef"},
+		{valid[:strings.Index(valid, "<Detalle>")] + "</Documento>", "must have items"},
+		{"<Documento", "EOF"},
+	}
+
+	for i, tc := range testCases {
+		if _, _, err := ParseDocumento(strings.NewReader(tc.doc)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("[test case %d] got %v. Expected %s", i, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package johnny
+
+import (
+	"fmt"
+)
+
+// Cloner is implemented by visitors able to return an independent copy of themselves.
+// Visitors store the outcome of their last visit, so they can't be shared between calculations
+// running at the same time. Cloning them lets a pipeline be reused as a template.
+type Cloner interface {
+	Clone() Visitor
+}
+
+// CloneVisitors returns a clone of every given visitor, in the same order.
+// Rules are immutable, so they are shared instead of cloned.
+// An error is returned if any other visitor doesn't implement [Cloner].
+func CloneVisitors(visitors []Visitor) ([]Visitor, error) {
+	clones := make([]Visitor, len(visitors))
+
+	for i, v := range visitors {
+		if _, ok := v.(Rule); ok {
+			clones[i] = v
+			continue
+		}
+
+		c, ok := v.(Cloner)
+
+		if !ok {
+			return nil, NewJohnnyError(fmt.Sprintf("visitor %T can't be cloned", v))
+		}
+
+		clones[i] = c.Clone()
+	}
+
+	return clones, nil
+}
+
+// Clone returns an independent copy of the visitor.
+func (pd *PercentualDiscount) Clone() Visitor {
+	c := *pd
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pd *AmountDiscount) Clone() Visitor {
+	c := *pd
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (u *PercentualUndiscount) Clone() Visitor {
+	d := *u.Discount
+	return &PercentualUndiscount{Discount: &d}
+}
+
+// Clone returns an independent copy of the visitor.
+func (u *AmountUndiscount) Clone() Visitor {
+	d := *u.Discount
+	return &AmountUndiscount{Discount: &d}
+}
+
+// Clone returns the visitor itself, as Qty doesn't change when visiting.
+func (q Qty) Clone() Visitor {
+	return q
+}
+
+// Clone returns an independent copy of the visitor.
+func (q *UnitValue) Clone() Visitor {
+	c := *q
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pt *PercTax) Clone() Visitor {
+	c := *pt
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pt *UnbufferedPercTax) Clone() Visitor {
+	c := *pt
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pt *AmountTax) Clone() Visitor {
+	c := *pt
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pt *UnbufferedAmountTax) Clone() Visitor {
+	c := *pt
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pu *PercentualUntax) Clone() Visitor {
+	c := *pu
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (pu *AmountUntax) Clone() Visitor {
+	c := *pu
+	return &c
+}
+
+// Clone returns the visitor itself, as Round doesn't change when visiting.
+func (r Round) Clone() Visitor {
+	return r
+}
+
+// Clone returns an independent copy of the visitor.
+func (s *SnapshotVisitor) Clone() Visitor {
+	c := *s
+	return &c
+}
+
+// Clone returns the visitor itself, as NamedSnapshot doesn't change when visiting.
+func (n NamedSnapshot) Clone() Visitor {
+	return n
+}
+
+// Clone returns an independent copy of the visitor.
+func (t *TaxHandlerFromUnitValue) Clone() Visitor {
+	h := *t.TaxHandler
+	return &TaxHandlerFromUnitValue{TaxHandler: &h}
+}
+
+// Clone returns an independent copy of the visitor.
+func (t *DiscountHandlerFromUnitValue) Clone() Visitor {
+	h := *t.DiscountHandler
+	return &DiscountHandlerFromUnitValue{DiscountHandler: &h}
+}
+
+// Clone returns an independent copy of the visitor.
+func (w *PercWithholding) Clone() Visitor {
+	c := *w
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (w *AmountWithholding) Clone() Visitor {
+	c := *w
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (w *PercentualUnwithholding) Clone() Visitor {
+	c := *w
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (w *AmountUnwithholding) Clone() Visitor {
+	c := *w
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (h *WithholdingHandler) Clone() Visitor {
+	c := *h
+	return &c
+}
+
+// Clone returns an independent copy of the visitor.
+func (h *UnwithholdingHandler) Clone() Visitor {
+	c := *h
+	return &c
+}
@@ -0,0 +1,67 @@
+package johnny
+
+import (
+	"testing"
+)
+
+func TestCloneVisitors(t *testing.T) {
+	th := NewTaxHandlerFromUnitValue()
+	th.WithPercentualTax(udfs("19"))
+
+	template := []Visitor{
+		WithQTY(udfs("3")),
+		NewPercentualDiscount(udfs("10")),
+		NewAmountDiscount(udfs("1")),
+		NewPercentualUnDiscount(udfs("10")),
+		NewAmountUnDiscount(udfs("1")),
+		NewUnitValue(udfs("3")),
+		NewPercTax(udfs("19")),
+		NewUnbufferedPercTax(udfs("19")),
+		NewAmountTax(udfs("1")),
+		NewUnbufferedAmountTax(udfs("1")),
+		NewPercentualUnTax(udfs("19")),
+		NewAmountUnTax(udfs("1")),
+		NewRound(2),
+		NewSnapshot(),
+		NamedSnapshot("net"),
+		th,
+		NewDiscHandlerFromUnitValue(),
+	}
+
+	clones, err := CloneVisitors(template)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range clones {
+		if _, ok := c.(Cloner); !ok {
+			t.Errorf("[visitor %d] clone %T should be a Cloner", i, c)
+		}
+	}
+
+	// running the clones must not change the template
+	mustRun(t, NewFromUnitValue(udfs("100")), clones...)
+
+	if !template[1].(*PercentualDiscount).Amount().Equal(udfs("0")) {
+		t.Errorf("template discount changed to %v", template[1].(*PercentualDiscount).Amount())
+	}
+
+	if !clones[1].(*PercentualDiscount).Amount().Equal(udfs("30")) {
+		t.Errorf("got cloned discount amount %v. Expected 30", clones[1].(*PercentualDiscount).Amount())
+	}
+
+	if !th.TotalRatio().Equal(udfs("19")) || !th.TotalAmount().Equal(udfs("0")) {
+		t.Errorf("template tax handler changed to %v %v", th.TotalRatio(), th.TotalAmount())
+	}
+
+	if _, err := CloneVisitors([]Visitor{visitorFunc(func(Johnny) {})}); err == nil {
+		t.Errorf("error expected cloning a visitor which isn't a Cloner")
+	}
+}
+
+type visitorFunc func(Johnny)
+
+func (f visitorFunc) Visit(b Johnny) {
+	f(b)
+}
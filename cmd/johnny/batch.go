@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/profe-ajedrez/johnny/batch"
+)
+
+// runBatch calculates the line items of a CSV file as described by args.
+func runBatch(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("johnny batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var (
+		discounts listFlag
+		taxes     listFlag
+	)
+
+	in := fs.String("in", "-", "CSV file to read the line items from. - means the standard input")
+	out := fs.String("out", "-", "CSV file to write the results to. - means the standard output")
+	qty := fs.String("qty", "", "column holding the quantity")
+	unitValue := fs.String("unit-value", "", "column holding the unit value")
+	round := fs.Int("round", -1, "scale to round the net value to. Negative means no rounding")
+	comma := fs.String("comma", ",", "field delimiter of the CSV files")
+	workers := fs.Int("workers", 1, "number of rows calculated concurrently. 0 means one per CPU")
+	fs.Var(&discounts, "discount", "column holding a discount, as disc for amounts or disc% for ratios. Can be repeated")
+	fs.Var(&taxes, "tax", "column holding a tax, as env for amounts or iva% for ratios, optionally coded as IVA=iva%. Can be repeated")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *unitValue == "" {
+		return errors.New("-unit-value is required")
+	}
+
+	c, size := utf8.DecodeRuneInString(*comma)
+
+	if size == 0 || size != len(*comma) {
+		return fmt.Errorf("invalid -comma %q", *comma)
+	}
+
+	m := batch.Mapping{Qty: *qty, UnitValue: *unitValue}
+
+	for _, d := range discounts {
+		m.Discounts = append(m.Discounts, parseColumn(d, false))
+	}
+
+	for _, t := range taxes {
+		m.Taxes = append(m.Taxes, parseColumn(t, true))
+	}
+
+	r := stdin
+
+	if *in != "-" {
+		f, err := os.Open(*in)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	w := stdout
+
+	if *out != "-" {
+		f, err := os.Create(*out)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		w = f
+	}
+
+	s, err := batch.NewProcessor(m, batch.UnitValuePipeline(*round)).WithComma(c).WithWorkers(*workers).Process(r, w)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stderr, "%d rows processed, %d with errors\n", s.Rows, s.Failed)
+
+	return nil
+}
+
+// parseColumn parses a column given as flag, as disc, disc% or, when coded, IVA=iva%.
+func parseColumn(s string, coded bool) batch.Column {
+	c := batch.Column{}
+
+	if coded {
+		if code, name, ok := strings.Cut(s, "="); ok {
+			c.Code = code
+			s = name
+		}
+	}
+
+	if name, ok := strings.CutSuffix(s, "%"); ok {
+		c.Percentual = true
+		s = name
+	}
+
+	c.Name = s
+	return c
+}
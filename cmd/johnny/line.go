@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/batch"
+)
+
+const (
+	modeUnit  = "unit"
+	modeBrute = "brute"
+)
+
+// line is a calculation described by its mode, its entry value and the visitors to receive.
+type line struct {
+	mode     string
+	entry    gyro.Gyro
+	visitors []johnny.Visitor
+}
+
+// johnny returns the Johnny where the line is calculated.
+func (l line) johnny() johnny.Johnny {
+	if l.mode == modeBrute {
+		return johnny.NewFromBrute(l.entry)
+	}
+
+	return johnny.NewFromUnitValue(l.entry)
+}
+
+// listFlag is a flag which can be given many times.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// runLine calculates the lines described by args and reports them to w.
+func runLine(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("johnny", flag.ContinueOnError)
+	fs.SetOutput(w)
+
+	var (
+		discounts listFlag
+		taxes     listFlag
+	)
+
+	mode := fs.String("mode", modeUnit, "calculation mode: unit, starting from the unit value, or brute, starting from the brute value")
+	entry := fs.String("entry", "", "entry value: the unit value in unit mode, the brute value in brute mode")
+	qty := fs.String("qty", "", "quantity of the line")
+	round := fs.Int("round", -1, "scale to round to: the net value before the taxes in unit mode, the final value, the unit value when -qty is given, in brute mode. Negative means no rounding")
+	pipeline := fs.String("pipeline", "", "JSON file describing the lines to calculate, instead of the line flags")
+	asJSON := fs.Bool("json", false, "write the results as JSON")
+	exact := fs.Int("exact", -1, "calculate over exact rationals, reporting values rounded to this scale. Negative means gyro decimals")
+	fs.Var(&discounts, "discount", "discount to apply, as 10% or 100. Can be repeated")
+	fs.Var(&taxes, "tax", "tax to apply, as 16% or 14.08, optionally coded as IVA=16%. Can be repeated")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var lines []line
+
+	if *pipeline != "" {
+		var given []string
+
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "mode", "entry", "qty", "round", "discount", "tax":
+				given = append(given, "-"+f.Name)
+			}
+		})
+
+		if len(given) > 0 {
+			return fmt.Errorf("line flags can't be combined with -pipeline, got %s", strings.Join(given, " "))
+		}
+
+		l, err := readPipeline(*pipeline)
+
+		if err != nil {
+			return err
+		}
+
+		lines = l
+	} else {
+		l, err := lineFromFlags(*mode, *entry, *qty, discounts, taxes, *round)
+
+		if err != nil {
+			return err
+		}
+
+		lines = []line{l}
+	}
+
+	results := make([]johnny.Result, 0, len(lines))
+	totals := johnny.NewTotals()
+
+	for _, l := range lines {
+		r, err := calculate(l, *exact)
+
+		if err != nil {
+			return err
+		}
+
+		results = append(results, r)
+		totals.Add(r)
+	}
+
+	if *asJSON {
+		return writeJSON(w, lines, results, totals)
+	}
+
+	return writeText(w, lines, results, totals)
+}
+
+// calculate runs the line, over exact rationals rounded to the given scale when it's not negative.
+// Panics raised during the calculation, as divisions by zero, are returned as errors.
+func calculate(l line, exact int) (r johnny.Result, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = johnny.NewJohnnyError(rec)
+		}
+	}()
+
+	if exact >= 0 {
+		return johnny.RunExact(l.johnny(), int32(exact), l.visitors...)
+	}
+
+	return johnny.Run(l.johnny(), l.visitors...)
+}
+
+// parseAmount parses a discount or tax given as flag, as 10%, 100 or, when coded, IVA=16%.
+func parseAmount(s string, coded bool) (batch.Amount, error) {
+	a := batch.Amount{}
+
+	if coded {
+		if code, v, ok := strings.Cut(s, "="); ok {
+			a.Code = code
+			s = v
+		}
+	}
+
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		a.Percentual = true
+		s = v
+	}
+
+	v, err := johnny.ParseDecimal(s)
+
+	if err != nil {
+		return batch.Amount{}, err
+	}
+
+	a.Value = v
+	return a, nil
+}
+
+// lineFromFlags builds the pipeline of a line from the line flags.
+//
+// In unit mode the quantity is applied over the unit value, followed by the discounts,
+// the rounding of the net and the taxes, which are calculated over the net.
+//
+// In brute mode the taxes are removed from the brute value, the amount ones first and the percentual
+// ones together, followed by the discounts in reverse order, the unit value and the rounding.
+func lineFromFlags(mode, entry, qty string, discounts, taxes []string, round int) (line, error) {
+	if mode != modeUnit && mode != modeBrute {
+		return line{}, fmt.Errorf("unknown mode %q, expected %s or %s", mode, modeUnit, modeBrute)
+	}
+
+	if entry == "" {
+		return line{}, errors.New("-entry is required")
+	}
+
+	e, err := johnny.ParseDecimal(entry)
+
+	if err != nil {
+		return line{}, err
+	}
+
+	l := line{mode: mode, entry: e}
+
+	var q gyro.Gyro
+
+	if qty != "" {
+		if q, err = johnny.ParseDecimal(qty); err != nil {
+			return line{}, err
+		}
+	}
+
+	ds := make([]batch.Amount, 0, len(discounts))
+
+	for _, d := range discounts {
+		a, err := parseAmount(d, false)
+
+		if err != nil {
+			return line{}, err
+		}
+
+		ds = append(ds, a)
+	}
+
+	ts := make([]batch.Amount, 0, len(taxes))
+
+	for _, t := range taxes {
+		a, err := parseAmount(t, true)
+
+		if err != nil {
+			return line{}, err
+		}
+
+		ts = append(ts, a)
+	}
+
+	if mode == modeUnit {
+		it := batch.Item{Qty: q, HasQty: qty != "", UnitValue: e, Discounts: ds, Taxes: ts}
+		_, l.visitors = batch.UnitValuePipeline(round)(it)
+	} else {
+		l.visitors = bruteVisitors(q, qty != "", ds, ts, round)
+	}
+
+	return l, nil
+}
+
+func bruteVisitors(qty gyro.Gyro, withQty bool, discounts, taxes []batch.Amount, round int) []johnny.Visitor {
+	visitors := []johnny.Visitor{johnny.NamedSnapshot("brute")}
+
+	var (
+		ratio gyro.Gyro
+		codes []string
+	)
+
+	for _, t := range taxes {
+		if t.Percentual {
+			ratio = ratio.Add(t.Value)
+			codes = append(codes, t.Code)
+			continue
+		}
+
+		untax := johnny.NewAmountUnTax(t.Value)
+		untax.SetCode(t.Code)
+		visitors = append(visitors, untax)
+	}
+
+	if len(codes) > 0 {
+		untax := johnny.NewPercentualUnTax(ratio)
+		untax.SetCode(strings.Join(codes, "+"))
+		visitors = append(visitors, untax)
+	}
+
+	visitors = append(visitors, johnny.NamedSnapshot("net"))
+
+	for i := len(discounts) - 1; i >= 0; i-- {
+		if discounts[i].Percentual {
+			visitors = append(visitors, johnny.NewPercentualUnDiscount(discounts[i].Value))
+		} else {
+			visitors = append(visitors, johnny.NewAmountUnDiscount(discounts[i].Value))
+		}
+	}
+
+	visitors = append(visitors, johnny.NamedSnapshot("net_without_discount"))
+
+	if withQty {
+		visitors = append(visitors, johnny.NewUnitValue(qty))
+	}
+
+	if round >= 0 {
+		visitors = append(visitors, johnny.NewRound(int32(round)))
+	}
+
+	return visitors
+}
+
+// pipelineLine is the JSON representation of a line in a pipeline file.
+type pipelineLine struct {
+	Mode     string          `json:"mode"`
+	Entry    string          `json:"entry"`
+	Visitors json.RawMessage `json:"visitors"`
+}
+
+// pipelineFile is the JSON representation of a pipeline file.
+// It holds a single line, or many lines under the lines key.
+type pipelineFile struct {
+	pipelineLine
+	Lines []pipelineLine `json:"lines"`
+}
+
+func readPipeline(path string) ([]line, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var f pipelineFile
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("reading pipeline %s: %w", path, err)
+	}
+
+	pls := f.Lines
+
+	if len(pls) == 0 {
+		pls = []pipelineLine{f.pipelineLine}
+	}
+
+	lines := make([]line, 0, len(pls))
+
+	for i, pl := range pls {
+		l, err := pl.line()
+
+		if err != nil {
+			return nil, fmt.Errorf("reading pipeline %s, line %d: %w", path, i+1, err)
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, nil
+}
+
+func (pl pipelineLine) line() (line, error) {
+	mode := pl.Mode
+
+	if mode == "" {
+		mode = modeUnit
+	}
+
+	if mode != modeUnit && mode != modeBrute {
+		return line{}, fmt.Errorf("unknown mode %q, expected %s or %s", mode, modeUnit, modeBrute)
+	}
+
+	e, err := johnny.ParseDecimal(pl.Entry)
+
+	if err != nil {
+		return line{}, err
+	}
+
+	l := line{mode: mode, entry: e}
+
+	if len(pl.Visitors) > 0 {
+		if l.visitors, err = johnny.UnmarshalVisitors(pl.Visitors); err != nil {
+			return line{}, err
+		}
+	}
+
+	return l, nil
+}
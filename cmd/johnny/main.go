@@ -0,0 +1,61 @@
+// Command johnny calculates sales lines and document totals from the terminal,
+// using the visitors provided by the johnny package.
+//
+// A line can be described with flags:
+//
+//	johnny -mode unit -entry 1044.543103448276 -qty 35157 -discount 10% -discount 100 -tax IVA=16% -round 2
+//
+// or loaded from a pipeline file holding one or more lines, whose visitors are
+// encoded as the JSON produced by the johnny package, which can't be combined with the line flags:
+//
+//	johnny -pipeline invoice.json -json
+//
+// In unit mode -round rounds the net value, before the taxes are calculated over it. In brute mode, where
+// the taxes and discounts are removed first, it rounds the final value, the unit value when -qty is given.
+//
+// The batch subcommand calculates the line items of a CSV file, mapping its columns
+// to the quantity, unit value, discounts and taxes of the items:
+//
+//	johnny batch -in lines.csv -out priced.csv -qty qty -unit-value price -discount disc% -tax IVA=iva%
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/profe-ajedrez/johnny"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "johnny:", errorMessage(err))
+		os.Exit(1)
+	}
+}
+
+// errorMessage returns the message of err to report to the user.
+func errorMessage(err error) string {
+	msg := err.Error()
+
+	var je *johnny.JohnnyError
+
+	if errors.As(err, &je) {
+		// JohnnyError carries its call stack after " -- ", which is noise for the user.
+		msg, _, _ = strings.Cut(msg, " -- ")
+	}
+
+	return msg
+}
+
+// run executes the command line given by args, reading its input from stdin
+// when no file is given and writing its output to stdout and its reports to stderr.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) > 0 && args[0] == "batch" {
+		return runBatch(args[1:], stdin, stdout, stderr)
+	}
+
+	return runLine(args, stdout)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func TestRunLineFlags(t *testing.T) {
+	out := bytes.Buffer{}
+
+	err := run([]string{
+		"-entry", "1044.543103448276", "-qty", "35157",
+		"-discount", "10%", "-discount", "100",
+		"-tax", "IVA=16%", "-tax", "ENV=14.08",
+		"-round", "2",
+	}, nil, &out, io.Discard)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"net:            33050601.70",
+		"IVA:          5288096.2720000000000000",
+		"ENV:          14.08",
+		"gross:          38338712.0520000000000000",
+		"round scale=2",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output should contain %q.\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunLineBruteJSON(t *testing.T) {
+	out := bytes.Buffer{}
+
+	err := run([]string{"-mode", "brute", "-entry", "1190", "-qty", "4", "-tax", "IVA=190", "-json"}, nil, &out, io.Discard)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r struct {
+		Lines []struct {
+			Mode   string        `json:"mode"`
+			Result johnny.Result `json:"result"`
+		} `json:"lines"`
+		Totals johnny.Totals `json:"totals"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Lines) != 1 || r.Lines[0].Mode != "brute" {
+		t.Fatalf("got %+v", r.Lines)
+	}
+
+	got := r.Lines[0].Result
+
+	if !got.Net.Equal(udfs("1000")) || !got.UnitValues[0].Equal(udfs("250")) {
+		t.Errorf("got net %s unit value %s. Expected 1000 and 250", johnny.DecimalString(got.Net), johnny.DecimalString(got.UnitValues[0]))
+	}
+
+	if !r.Totals.TaxesByCode["IVA"].Equal(udfs("190")) {
+		t.Errorf("got IVA total %s. Expected 190", johnny.DecimalString(r.Totals.TaxesByCode["IVA"]))
+	}
+}
+
+func TestRunLineBrutePercentualTax(t *testing.T) {
+	out := bytes.Buffer{}
+
+	// gyro alone divides 1619.1 by 1.16 into 0.000000000139578
+	err := run([]string{"-mode", "brute", "-entry", "1619.1", "-qty", "3", "-tax", "IVA=16%", "-json"}, nil, &out, io.Discard)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r struct {
+		Lines []struct {
+			Result johnny.Result `json:"result"`
+		} `json:"lines"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Lines) != 1 {
+		t.Fatalf("got %+v", r.Lines)
+	}
+
+	got := r.Lines[0].Result
+
+	if !got.Snapshots["net"].Equal(udfs("1395.775862068965517")) || !got.UnitValues[0].Equal(udfs("465.258620689655172")) || !got.Gross.Equal(udfs("1619.1")) {
+		t.Errorf("got net %s, unit value %s and gross %s. Expected 1395.775862068965517, 465.258620689655172 and 1619.1",
+			johnny.DecimalString(got.Snapshots["net"]), johnny.DecimalString(got.UnitValues[0]), johnny.DecimalString(got.Gross))
+	}
+
+	if iva := got.TaxesByCode["IVA"]; iva.Round(6).Cmp(udfs("223.324138")) != 0 {
+		t.Errorf("got IVA %s. Expected 223.324138 rounded", johnny.DecimalString(iva))
+	}
+}
+
+func TestRunPipelineFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoice.json")
+
+	pipeline := `{
+		"lines": [
+			{"mode": "unit", "entry": "100", "visitors": [
+				{"type": "qty", "qty": "2"},
+				{"type": "perc_tax", "ratio": "19", "code": "IVA"}
+			]},
+			{"entry": "50.5", "visitors": [
+				{"type": "amount_discount", "amount": "0.5"},
+				{"type": "perc_tax", "ratio": "19", "code": "IVA"}
+			]}
+		]
+	}`
+
+	if err := os.WriteFile(path, []byte(pipeline), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.Buffer{}
+
+	if err := run([]string{"-pipeline", path}, nil, &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"line 2", "document totals (2 lines)", "net:        250.0", "IVA:      47.5000000000000000", "gross:      297.5000000000000000"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output should contain %q.\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunLineExact(t *testing.T) {
+	out := bytes.Buffer{}
+
+	if err := run([]string{"-mode", "brute", "-entry", "1619.1", "-tax", "IVA=16%", "-exact", "6"}, nil, &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"net:        1395.775862", "IVA:      223.324138"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output should contain %q.\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunLineErrors(t *testing.T) {
+	testCases := [][]string{
+		{},
+		{"-entry", "abc"},
+		{"-entry", "10", "-mode", "sideways"},
+		{"-entry", "10", "-tax", "IVA=x%"},
+		{"-pipeline", "missing.json", "-qty", "2"},
+		{"-pipeline", "missing.json"},
+		// undiscounting 100% divides by zero
+		{"-mode", "brute", "-entry", "100", "-discount", "100%"},
+		{"-mode", "brute", "-entry", "100", "-discount", "100%", "-exact", "2"},
+	}
+
+	for i, tc := range testCases {
+		err := run(tc, nil, &bytes.Buffer{}, io.Discard)
+
+		if err == nil {
+			t.Errorf("[test case %d] error expected running %v", i, tc)
+			continue
+		}
+
+		if msg := errorMessage(err); strings.Contains(msg, " -- ") {
+			t.Errorf("[test case %d] got %q. Expected the message without the call stack", i, msg)
+		}
+	}
+}
+
+func TestRunPipelineFlagConflicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "line.json")
+
+	if err := os.WriteFile(path, []byte(`{"entry": "100", "visitors": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"-pipeline", path}, nil, &bytes.Buffer{}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, flags := range [][]string{{"-mode", "brute"}, {"-entry", "10"}, {"-qty", "2"}, {"-round", "2"}, {"-tax", "16%"}} {
+		err := run(append([]string{"-pipeline", path}, flags...), nil, &bytes.Buffer{}, io.Discard)
+
+		if err == nil || !strings.Contains(err.Error(), flags[0]) {
+			t.Errorf("[test case %d] got %v. Expected %s to be rejected with -pipeline", i, err, flags[0])
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	in := strings.NewReader("sku,qty,price,disc,iva\nA,2,100,10,19\nB,x,10,,19\n")
+	out := bytes.Buffer{}
+	report := bytes.Buffer{}
+
+	err := run([]string{"batch", "-qty", "qty", "-unit-value", "price", "-discount", "disc%", "-tax", "IVA=iva%", "-round", "0"}, in, &out, &report)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines. Expected 3.\n%s", len(lines), out.String())
+	}
+
+	if lines[0] != "sku,qty,price,disc,iva,net,discounts,taxes,gross,tax_IVA,error" {
+		t.Errorf("got header %s", lines[0])
+	}
+
+	if !strings.HasPrefix(lines[1], "A,2,100,10,19,180,") || !strings.HasSuffix(lines[1], ",") {
+		t.Errorf("got row %s", lines[1])
+	}
+
+	if !strings.HasPrefix(lines[2], "B,x,10,,19,,,,,,") || strings.HasSuffix(lines[2], ",") {
+		t.Errorf("got row %s", lines[2])
+	}
+
+	if report.String() != "2 rows processed, 1 with errors\n" {
+		t.Errorf("got report %q", report.String())
+	}
+
+	if err := run([]string{"batch", "-qty", "qty"}, in, &out, io.Discard); err == nil {
+		t.Errorf("error expected without -unit-value")
+	}
+}
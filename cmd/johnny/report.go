@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+var dec = johnny.DecimalString
+
+type lineReport struct {
+	Mode   string        `json:"mode"`
+	Result johnny.Result `json:"result"`
+}
+
+type report struct {
+	Lines  []lineReport   `json:"lines"`
+	Totals *johnny.Totals `json:"totals"`
+}
+
+func writeJSON(w io.Writer, lines []line, results []johnny.Result, totals *johnny.Totals) error {
+	r := report{Lines: make([]lineReport, 0, len(lines)), Totals: totals}
+
+	for i, l := range lines {
+		r.Lines = append(r.Lines, lineReport{Mode: l.mode, Result: results[i]})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+func writeText(w io.Writer, lines []line, results []johnny.Result, totals *johnny.Totals) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for i, l := range lines {
+		r := results[i]
+
+		if len(lines) > 1 {
+			fmt.Fprintf(tw, "line %d\n", i+1)
+		}
+
+		fmt.Fprintf(tw, "mode:\t%s\n", l.mode)
+		fmt.Fprintf(tw, "entry:\t%s\n\n", dec(r.Entry))
+		fmt.Fprintln(tw, "#\tstep\tbefore\tafter")
+
+		for j, s := range r.Steps {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", j+1, describe(s.Visitor), dec(s.Before), dec(s.After))
+		}
+
+		fmt.Fprintln(tw)
+		writeAmounts(tw, r.Net, r.Gross, r.Discounts, r.Taxes, r.TaxesByCode)
+		writeWithholdings(tw, r.Withholdings, r.WithholdingsByCode, r.Payable)
+
+		for _, e := range r.Exemptions {
+			fmt.Fprintf(tw, "%s %s %s base:\t%s\n", e.Code, e.Kind, e.Reason, dec(e.Base))
+		}
+
+		for _, v := range r.UnitValues {
+			fmt.Fprintf(tw, "unit value:\t%s\n", dec(v))
+		}
+
+		for _, a := range r.RoundingAdjustments {
+			fmt.Fprintf(tw, "rounding to %d:\t%s\n", a.Scale, dec(a.Adjustment))
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	if len(lines) > 1 {
+		fmt.Fprintf(tw, "document totals (%d lines)\n", totals.Lines)
+		writeAmounts(tw, totals.Net, totals.Gross, totals.Discounts, totals.Taxes, totals.TaxesByCode)
+		writeWithholdings(tw, totals.Withholdings, totals.WithholdingsByCode, totals.Payable)
+	}
+
+	return tw.Flush()
+}
+
+func writeAmounts(w io.Writer, net, gross, discounts, taxes gyro.Gyro, byCode map[string]gyro.Gyro) {
+	fmt.Fprintf(w, "net:\t%s\n", dec(net))
+	fmt.Fprintf(w, "discounts:\t%s\n", dec(discounts))
+	fmt.Fprintf(w, "taxes:\t%s\n", dec(taxes))
+
+	codes := make([]string, 0, len(byCode))
+
+	for code := range byCode {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		if code == "" {
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s:\t%s\n", code, dec(byCode[code]))
+	}
+
+	fmt.Fprintf(w, "gross:\t%s\n", dec(gross))
+}
+
+// writeWithholdings reports the withholdings and the payable value, if anything was withheld.
+func writeWithholdings(w io.Writer, withholdings gyro.Gyro, byCode map[string]gyro.Gyro, payable gyro.Gyro) {
+	if withholdings.Equal(gyro.NewZero()) {
+		return
+	}
+
+	fmt.Fprintf(w, "withholdings:\t%s\n", dec(withholdings))
+
+	codes := make([]string, 0, len(byCode))
+
+	for code := range byCode {
+		if code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %s:\t%s\n", code, dec(byCode[code]))
+	}
+
+	fmt.Fprintf(w, "payable:\t%s\n", dec(payable))
+}
+
+// describe returns a one line description of a visitor, built from its JSON representation.
+func describe(v johnny.Visitor) string {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+
+	var fields map[string]any
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+
+	keys := make([]string, 0, len(fields))
+
+	for k := range fields {
+		if k != "type" {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	w := strings.Builder{}
+	w.WriteString(fmt.Sprint(fields["type"]))
+
+	for _, k := range keys {
+		w.WriteString(" ")
+		w.WriteString(k)
+		w.WriteString("=")
+		w.WriteString(fmt.Sprint(fields[k]))
+	}
+
+	return w.String()
+}
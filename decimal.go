@@ -0,0 +1,114 @@
+package johnny
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/gyro/i128"
+)
+
+// gyroParts returns the coefficient and exponent of g, so that g == coeff * 10^exp.
+// gyro keeps both fields unexported, so they are read through reflection.
+func gyroParts(g gyro.Gyro) (*big.Int, int32) {
+	v := reflect.ValueOf(g)
+	c := v.FieldByName("coeff")
+
+	hi := c.FieldByName("hi").Uint()
+	lo := c.FieldByName("lo").Uint()
+
+	coeff := new(big.Int).SetUint64(hi)
+	coeff.Lsh(coeff, 64)
+	coeff.Or(coeff, new(big.Int).SetUint64(lo))
+
+	// the coefficient is stored as a 128 bits two's complement integer
+	if hi>>63 == 1 {
+		coeff.Sub(coeff, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+
+	return coeff, int32(v.FieldByName("exp").Int())
+}
+
+// gyroFromParts builds a gyro.Gyro equal to coeff * 10^exp.
+func gyroFromParts(coeff *big.Int, exp int32) gyro.Gyro {
+	c, _ := i128.I128FromBigInt(coeff)
+	return gyro.New(c, exp)
+}
+
+// DecimalString returns an exact string representation of g.
+// gyro.Gyro.String loses the leading zeros of the fractional part and the sign of
+// values between -1 and 0, so this is the one to use when a value must be persisted or shown.
+func DecimalString(g gyro.Gyro) string {
+	coeff, exp := gyroParts(g)
+
+	neg := coeff.Sign() < 0
+	digits := new(big.Int).Abs(coeff).String()
+
+	if exp > 0 {
+		digits += strings.Repeat("0", int(exp))
+		exp = 0
+	}
+
+	scale := int(-exp)
+
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+
+	if neg {
+		return "-" + digits
+	}
+
+	return digits
+}
+
+// ParseDecimal parses a decimal string, as the ones produced by DecimalString, into a gyro.Gyro.
+func ParseDecimal(s string) (gyro.Gyro, error) {
+	g, err := gyro.NewFromString(s)
+
+	// gyro errors carry a dump of their call stack, so they aren't wrapped
+	if err != nil {
+		return gyro.Gyro{}, NewJohnnyError("invalid decimal value " + s)
+	}
+
+	return g, nil
+}
+
+// Quo returns a / b rounded to gyro.MaxDivisionScale, every division of the package being made through it.
+// gyro.Gyro.Div loses the magnitude of the quotient when the exponents of a and b are too far apart, as they
+// are dividing 86250 by 0.8625, so both are taken to the same exponent adding them the zero of the other one.
+// As it still may overflow, or round the last digit the wrong way, its quotient is kept only when multiplied
+// by b it gives back a within less than half a unit in its last place, and the division is made over
+// rationals otherwise. An error is returned if the quotient overflows a gyro.Gyro, and like gyro.Gyro.Div it
+// panics if b is zero.
+func Quo(a, b gyro.Gyro) (gyro.Gyro, error) {
+	q := a.Add(b.Sub(b)).Div(b.Add(a.Sub(a)))
+
+	if a.Sub(q.Mul(b)).Abs().Add(productError).Cmp(b.Abs().Mul(halfUlp)) <= 0 {
+		return q, nil
+	}
+
+	return RatToGyro(new(big.Rat).Quo(GyroToRat(a), GyroToRat(b)), gyro.MaxDivisionScale)
+}
+
+// quo is Quo for the divisions without an error to return, which panic like a division by zero does.
+func quo(a, b gyro.Gyro) gyro.Gyro {
+	q, err := Quo(a, b)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// halfUlp is half a unit in the last place of a quotient rounded to gyro.MaxDivisionScale.
+var halfUlp = gyro.NewFromInt64Raw(5, -gyro.MaxDivisionScale-1)
+
+// productError bounds the error of the two products checking a quotient, as gyro truncates them to
+// gyro.MaxScale.
+var productError = gyro.NewFromInt64Raw(2, -gyro.MaxScale)
@@ -0,0 +1,290 @@
+// Package euvat chooses the VAT of the supplies made within the European Union and builds the VAT summary
+// of a document calculated with the johnny package.
+//
+// Rates are held by a [Table] per member state and category, valid over time. The bundled table, returned by
+// [DefaultTable], is a snapshot of the rates published by the member states and must be checked against the
+// current ones, or replaced by one loaded with [LoadTable].
+package euvat
+
+import (
+	_ "embed"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Category is the category of rates a supply is taxed with.
+type Category int
+
+const (
+	// Standard is the standard rate of a member state.
+	Standard Category = iota
+	// Reduced is the reduced rate of a member state, the highest one when it has two.
+	Reduced
+	// SecondReduced is the lowest of the two reduced rates of a member state.
+	SecondReduced
+	// SuperReduced is a rate below 5%, which some member states keep.
+	SuperReduced
+	// Zero is a zero rate, which keeps the right to deduct the VAT paid on purchases.
+	Zero
+)
+
+var categoryNames = [...]string{
+	Standard:      "standard",
+	Reduced:       "reduced",
+	SecondReduced: "second-reduced",
+	SuperReduced:  "super-reduced",
+	Zero:          "zero",
+}
+
+// String returns the name of the category, as "super-reduced".
+func (c Category) String() string {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return "unknown"
+	}
+
+	return categoryNames[c]
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the category by its name.
+func (c Category) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Category) UnmarshalText(text []byte) error {
+	for k, n := range categoryNames {
+		if n == string(text) {
+			*c = Category(k)
+			return nil
+		}
+	}
+
+	return johnny.NewJohnnyError("unknown category " + string(text))
+}
+
+// Exemption reasons of the VATEX code list, used by the electronic invoices of the EU.
+const (
+	// ReasonReverseCharge is the reason of the services whose VAT is accounted by the customer.
+	ReasonReverseCharge = "VATEX-EU-AE"
+	// ReasonIntraCommunity is the reason of the intra-community supplies of goods.
+	ReasonIntraCommunity = "VATEX-EU-IC"
+)
+
+//go:embed rates.csv
+var defaultRates string
+
+// Table holds the rates of the member states per category over time.
+type Table struct {
+	rates *johnny.RateTable
+}
+
+// NewTable returns a Table with the given rates, whose codes are made by [Code].
+func NewTable(rates *johnny.RateTable) *Table {
+	return &Table{rates: rates}
+}
+
+// DefaultTable returns the table bundled with the package.
+func DefaultTable() *Table {
+	t, err := LoadTable(strings.NewReader(defaultRates))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// LoadTable reads a Table from a CSV file with the header code,ratio,from,to, as [johnny.LoadRateTableCSV],
+// whose codes are made by [Code], as "DE:reduced".
+func LoadTable(r io.Reader) (*Table, error) {
+	rates, err := johnny.LoadRateTableCSV(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTable(rates), nil
+}
+
+// Code returns the code of the rate of the given member state and category, as "DE:reduced".
+// Member states are identified by their ISO 3166 code, but Greece, which is EL.
+func Code(country string, c Category) string {
+	return country + ":" + c.String()
+}
+
+// Rate returns the rate of the given member state and category valid at the given date.
+// An error is returned if there is none.
+func (t *Table) Rate(country string, c Category, date time.Time) (gyro.Gyro, error) {
+	return t.rates.Ratio(Code(country, c), date)
+}
+
+// Countries returns the member states of the table, sorted.
+func (t *Table) Countries() []string {
+	var countries []string
+
+	for _, code := range t.rates.Codes() {
+		country, _, _ := strings.Cut(code, ":")
+
+		if len(countries) == 0 || countries[len(countries)-1] != country {
+			countries = append(countries, country)
+		}
+	}
+
+	return countries
+}
+
+// Supply is a sale made by a seller established in a member state.
+type Supply struct {
+	// Origin is the member state the seller is established in.
+	Origin string
+	// Destination is the member state of the customer, or where the goods are delivered.
+	Destination string
+	// Business tells whether the customer is a taxable person identified for VAT in the destination.
+	Business bool
+	// Goods tells whether goods are supplied, services otherwise.
+	Goods bool
+	// Category is the category of rates of the goods or services in the member state they are taxed in.
+	Category Category
+	// OSS tells whether the distance sales to consumers are taxed in their destination, as they are
+	// when the seller exceeds the threshold of EUR 10000 or opts for it, declaring them through the OSS.
+	OSS bool
+}
+
+// VAT is the VAT of a supply.
+type VAT struct {
+	// Country is the member state the supply is taxed in.
+	Country  string
+	Category Category
+	// Rate is the rate charged, zero when the supply is exempted.
+	Rate gyro.Gyro
+	// Exemption tells why the VAT is not charged, and Reason is its VATEX code.
+	Exemption johnny.ExemptionKind
+	Reason    string
+}
+
+// VAT returns the VAT of the given supply, made at the given date.
+//
+// Domestic supplies are taxed with the rates of the origin. Intra-community supplies to businesses are not
+// charged: goods are exempted and services are reverse charged, the customer accounting for the VAT in the
+// destination. Distance sales to consumers are taxed with the rates of the destination when OSS is set,
+// and with the ones of the origin otherwise. An error is returned if the table has no rate for the supply.
+func (t *Table) VAT(s Supply, date time.Time) (VAT, error) {
+	v := VAT{Country: s.Origin, Category: s.Category}
+
+	if s.Destination != s.Origin {
+		switch {
+		case s.Business && s.Goods:
+			v.Country, v.Exemption, v.Reason = s.Destination, johnny.Exempt, ReasonIntraCommunity
+			return v, nil
+		case s.Business:
+			v.Country, v.Exemption, v.Reason = s.Destination, johnny.ReverseCharge, ReasonReverseCharge
+			return v, nil
+		case s.OSS:
+			v.Country = s.Destination
+		}
+	}
+
+	rate, err := t.Rate(v.Country, v.Category, date)
+
+	if err != nil {
+		return VAT{}, err
+	}
+
+	v.Rate = rate
+
+	if s.Category == Zero {
+		v.Exemption = johnny.ZeroRated
+	}
+
+	return v, nil
+}
+
+// Code returns the tax code of the VAT, as "DE:reduced", which its amounts are grouped under in a Result.
+func (v VAT) Code() string {
+	return Code(v.Country, v.Category)
+}
+
+// Rule returns the tax rule charging the VAT, exempted when it's not charged.
+func (v VAT) Rule() johnny.PercTaxRule {
+	r := johnny.NewPercTaxRule(v.Rate).WithCode(v.Code())
+
+	if v.Exemption != johnny.NotExempt {
+		r = r.WithExemption(v.Exemption, v.Reason)
+	}
+
+	return r
+}
+
+// Line is a line of a document with the VAT it was calculated with.
+type Line struct {
+	VAT    VAT
+	Result johnny.Result
+}
+
+// SummaryRow is the total of the lines of a document with the same VAT.
+type SummaryRow struct {
+	VAT VAT
+	// Base is the sum of the net values of the lines, rounded to cents.
+	Base gyro.Gyro
+	// Amount is the VAT over the base, rounded to cents.
+	Amount gyro.Gyro
+}
+
+// Summarize returns the VAT summary of a document, with a row per member state, rate and exemption, sorted
+// by member state and by rate from the highest. The VAT of each row is calculated over its base, as the
+// invoices of the EU require, instead of adding the VAT of the lines.
+//
+// Categories sharing a rate, as the reduced ones of some member states, are kept in rows of their own,
+// sorted by category, so each row adds the amounts the Results of its lines hold under a single tax code,
+// the [VAT.Code], and can be checked against them. An error is returned if the VAT of a row overflows gyro.
+func Summarize(lines ...Line) ([]SummaryRow, error) {
+	var rows []SummaryRow
+
+	for _, l := range lines {
+		i := 0
+
+		for ; i < len(rows); i++ {
+			v := rows[i].VAT
+
+			if v.Country == l.VAT.Country && v.Category == l.VAT.Category && v.Rate.Equal(l.VAT.Rate) && v.Exemption == l.VAT.Exemption && v.Reason == l.VAT.Reason {
+				break
+			}
+		}
+
+		if i == len(rows) {
+			rows = append(rows, SummaryRow{VAT: l.VAT})
+		}
+
+		rows[i].Base = rows[i].Base.Add(l.Result.Net)
+	}
+
+	for i := range rows {
+		rows[i].Base = rows[i].Base.Round(2)
+		amount, err := johnny.Quo(rows[i].Base.Mul(rows[i].VAT.Rate), gyro.NewHundred())
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows[i].Amount = amount.Round(2)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].VAT.Country != rows[j].VAT.Country {
+			return rows[i].VAT.Country < rows[j].VAT.Country
+		}
+
+		if c := rows[i].VAT.Rate.Cmp(rows[j].VAT.Rate); c != 0 {
+			return c > 0
+		}
+
+		return rows[i].VAT.Category < rows[j].VAT.Category
+	})
+
+	return rows, nil
+}
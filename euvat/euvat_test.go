@@ -0,0 +1,211 @@
+package euvat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse(johnny.DateLayout, s)
+	return d
+}
+
+func TestDefaultTable(t *testing.T) {
+	table := DefaultTable()
+
+	if countries := table.Countries(); len(countries) != 27 {
+		t.Errorf("got %d member states %v. Expected 27", len(countries), countries)
+	}
+
+	testCases := []struct {
+		country  string
+		category Category
+		date     string
+		rate     string
+	}{
+		{"DE", Standard, "2025-03-01", "19"},
+		{"DE", Reduced, "2025-03-01", "7"},
+		{"FR", SuperReduced, "2025-03-01", "2.1"},
+		{"FI", Standard, "2024-08-31", "24"},
+		{"FI", Standard, "2024-09-01", "25.5"},
+		{"EL", Standard, "2025-03-01", "24"},
+	}
+
+	for i, tc := range testCases {
+		rate, err := table.Rate(tc.country, tc.category, date(tc.date))
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !rate.Equal(udfs(tc.rate)) {
+			t.Errorf("[test case %d] got %v. Expected %v", i, rate, tc.rate)
+		}
+	}
+
+	if _, err := table.Rate("DK", Reduced, date("2025-03-01")); err == nil {
+		t.Errorf("error expected for a category without rate")
+	}
+}
+
+func TestVAT(t *testing.T) {
+	table := DefaultTable()
+	at := date("2025-03-01")
+
+	testCases := []struct {
+		supply    Supply
+		country   string
+		rate      string
+		exemption johnny.ExemptionKind
+		reason    string
+	}{
+		// domestic supplies are taxed in the origin
+		{Supply{Origin: "ES", Destination: "ES", Business: true}, "ES", "21", johnny.NotExempt, ""},
+		// distance sales to consumers are taxed in the destination through the OSS
+		{Supply{Origin: "ES", Destination: "DE", Category: Reduced, OSS: true}, "DE", "7", johnny.NotExempt, ""},
+		{Supply{Origin: "ES", Destination: "DE", Category: Reduced}, "ES", "10", johnny.NotExempt, ""},
+		{Supply{Origin: "ES", Destination: "FR", Business: true}, "FR", "0", johnny.ReverseCharge, ReasonReverseCharge},
+		{Supply{Origin: "ES", Destination: "FR", Business: true, Goods: true}, "FR", "0", johnny.Exempt, ReasonIntraCommunity},
+		{Supply{Origin: "IE", Destination: "IE", Category: Zero}, "IE", "0", johnny.ZeroRated, ""},
+	}
+
+	for i, tc := range testCases {
+		v, err := table.VAT(tc.supply, at)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if v.Country != tc.country || !v.Rate.Equal(udfs(tc.rate)) || v.Exemption != tc.exemption || v.Reason != tc.reason {
+			t.Errorf("[test case %d] got %+v. Expected %s at %s, %v %s", i, v, tc.country, tc.rate, tc.exemption, tc.reason)
+		}
+	}
+
+	if _, err := table.VAT(Supply{Origin: "XX", Destination: "XX"}, at); err == nil {
+		t.Errorf("error expected for an unknown member state")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	table := DefaultTable()
+	at := date("2025-03-01")
+
+	sales := []struct {
+		supply    Supply
+		unitValue string
+		qty       string
+	}{
+		{Supply{Origin: "ES", Destination: "DE", OSS: true}, "10.33", "3"},
+		{Supply{Origin: "ES", Destination: "DE", OSS: true, Category: Reduced}, "4.99", "2"},
+		{Supply{Origin: "ES", Destination: "DE", OSS: true}, "0.335", "1"},
+		{Supply{Origin: "ES", Destination: "FR", Business: true}, "100", "1"},
+		{Supply{Origin: "ES", Destination: "ES"}, "50", "1"},
+	}
+
+	lines := make([]Line, 0, len(sales))
+
+	for _, s := range sales {
+		v, err := table.VAT(s.supply, at)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := johnny.Run(johnny.NewFromUnitValue(udfs(s.unitValue)), johnny.WithQTY(udfs(s.qty)), v.Rule())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, Line{VAT: v, Result: r})
+	}
+
+	rows, err := Summarize(lines...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		country string
+		rate    string
+		base    string
+		amount  string
+	}{
+		// 31.325 is rounded to 31.33, whose 19% is 5.9527
+		{"DE", "19", "31.33", "5.95"},
+		{"DE", "7", "9.98", "0.7"},
+		{"ES", "21", "50", "10.5"},
+		{"FR", "0", "100", "0"},
+	}
+
+	if len(rows) != len(expected) {
+		t.Fatalf("got %d rows %+v. Expected %d", len(rows), rows, len(expected))
+	}
+
+	for i, e := range expected {
+		r := rows[i]
+
+		if r.VAT.Country != e.country || !r.VAT.Rate.Equal(udfs(e.rate)) || !r.Base.Equal(udfs(e.base)) || !r.Amount.Equal(udfs(e.amount)) {
+			t.Errorf("[test case %d] got %s at %v: %v and %v. Expected %s at %s: %s and %s", i, r.VAT.Country, r.VAT.Rate, r.Base, r.Amount, e.country, e.rate, e.base, e.amount)
+		}
+	}
+
+	if rows[3].VAT.Exemption != johnny.ReverseCharge {
+		t.Errorf("got exemption %v. Expected reverse charge", rows[3].VAT.Exemption)
+	}
+}
+
+func TestSummarizeCategories(t *testing.T) {
+	// categories sharing a rate are summarized apart, as their tax codes are
+	reduced := VAT{Country: "DE", Category: Reduced, Rate: udfs("7")}
+	second := VAT{Country: "DE", Category: SecondReduced, Rate: udfs("7")}
+
+	rows, err := Summarize(
+		Line{VAT: second, Result: johnny.Result{Net: udfs("20")}},
+		Line{VAT: reduced, Result: johnny.Result{Net: udfs("10")}},
+		Line{VAT: second, Result: johnny.Result{Net: udfs("5")}},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows %+v. Expected 2", len(rows), rows)
+	}
+
+	if rows[0].VAT.Code() != "DE:reduced" || !rows[0].Base.Equal(udfs("10")) || rows[1].VAT.Code() != "DE:second-reduced" || !rows[1].Base.Equal(udfs("25")) {
+		t.Errorf("got %s %v and %s %v. Expected DE:reduced 10 and DE:second-reduced 25", rows[0].VAT.Code(), rows[0].Base, rows[1].VAT.Code(), rows[1].Base)
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	table, err := LoadTable(strings.NewReader("code,ratio,from,to\nDE:standard,16,2020-07-01,2021-01-01\nDE:standard,19,2021-01-01,\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rate, _ := table.Rate("DE", Standard, date("2020-12-31")); !rate.Equal(udfs("16")) {
+		t.Errorf("got %v. Expected 16", rate)
+	}
+
+	var c Category
+
+	if err := c.UnmarshalText([]byte("super-reduced")); err != nil || c != SuperReduced {
+		t.Errorf("got %v, %v. Expected super-reduced", c, err)
+	}
+
+	if err := c.UnmarshalText([]byte("parking")); err == nil {
+		t.Errorf("error expected decoding an unknown category")
+	}
+}
@@ -0,0 +1,99 @@
+package johnny
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// RunExact is the exact counterpart of [Run]. The visitors are run over rationals, so repeating decimals,
+// as the ones PercentualUntax produces dividing by 1 + ratio, are kept whole instead of being cut, and values
+// are only rounded by the Round visitors of the pipeline. A pipeline removing a tax and adding it back gives
+// exactly the value it started from.
+//
+// The values of the Result, the snapshots and the final value of b are converted back to gyro rounded to
+// the given scale. The built-in visitors and rules are supported, with the exception of SnapshotVisitor,
+// for which NamedSnapshot must be used, and UnwithholdingHandler. Visitors are not modified, as their outcome
+// is reported in the Result. An error is returned with the first visitor which can't run over rationals,
+// or if a value overflows gyro.
+func RunExact(b Johnny, scale int32, visitors ...Visitor) (Result, error) {
+	for _, v := range visitors {
+		if _, ok, _ := visitorOps(v, gyro.NewOne()); !ok {
+			return Result{}, NewJohnnyError(fmt.Sprintf("visitor %T can't run in exact mode", v))
+		}
+	}
+
+	a := RatArithmetic{}
+	nb := NewNumJohnny[*big.Rat](a, GyroToRat(b.Value()))
+	c := newCollector(b.Value())
+
+	for _, v := range visitors {
+		before := nb.Value()
+		seen := len(nb.effects)
+
+		if name, ok := v.(NamedSnapshot); ok {
+			g, err := RatToGyro(before, scale)
+
+			if err != nil {
+				return Result{}, err
+			}
+
+			b.Snapshots().Set(string(name), g)
+		}
+
+		if err := nb.Receive(v); err != nil {
+			return Result{}, err
+		}
+
+		g, err := ratsToGyro(scale, before, nb.Value(), a.Sub(nb.Value(), before))
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		c.r.Steps = append(c.r.Steps, Step{Visitor: v, Before: g[0], After: g[1]})
+
+		if r, ok := v.(Round); ok {
+			c.r.RoundingAdjustments = append(c.r.RoundingAdjustments, RoundingAdjustment{Scale: r.scale, Adjustment: g[2]})
+		}
+
+		for _, e := range nb.effects[seen:] {
+			ge, err := ratsToGyro(scale, e.Ratio, e.Amount, e.Base)
+
+			if err != nil {
+				return Result{}, err
+			}
+
+			c.collectEffect(Effect{Kind: e.Kind, Code: e.Code, Ratio: ge[0], Amount: ge[1], Base: ge[2], Exemption: e.Exemption, Reason: e.Reason}, g[0])
+		}
+	}
+
+	value, err := RatToGyro(nb.Value(), scale)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	b.Restore(value)
+	c.r.Snapshots = b.Snapshots().Map()
+
+	return c.result(value, isFromBrute(b)), nil
+}
+
+// ratsToGyro converts the given rationals to gyro, rounded to scale.
+func ratsToGyro(scale int32, rats ...*big.Rat) ([]gyro.Gyro, error) {
+	g := make([]gyro.Gyro, len(rats))
+
+	for i, r := range rats {
+		v, err := RatToGyro(r, scale)
+
+		if err != nil {
+			return nil, err
+		}
+
+		g[i] = v
+	}
+
+	return g, nil
+}
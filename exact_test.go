@@ -0,0 +1,86 @@
+package johnny
+
+import (
+	"testing"
+)
+
+func TestRunExactRoundTrip(t *testing.T) {
+	b := NewFromBrute(udfs("1619.1"))
+
+	r, err := RunExact(b, 12,
+		NamedSnapshot("brute"),
+		NewPercentualUnTax(udfs("16")),
+		NamedSnapshot("net"),
+		NewPercTaxRule(udfs("16")),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// removing the tax and adding it back gives exactly the brute value
+	if !r.Value.Equal(udfs("1619.1")) || !b.Value().Equal(udfs("1619.1")) {
+		t.Errorf("got value %s. Expected 1619.1", DecimalString(r.Value))
+	}
+
+	if net, _ := b.Snapshots().Get("net"); !net.Equal(udfs("1395.775862068966")) {
+		t.Errorf("got net snapshot %s. Expected 1395.775862068966", DecimalString(net))
+	}
+
+	if len(r.Steps) != 4 || !r.Steps[1].After.Equal(udfs("1395.775862068966")) {
+		t.Errorf("got steps %+v", r.Steps)
+	}
+
+	r, err = RunExact(NewFromBrute(udfs("1619.1")), 12, NewPercentualUnTax(udfs("16")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Gross.Equal(udfs("1619.1")) || !r.Net.Equal(udfs("1395.775862068966")) || !r.Taxes.Equal(udfs("223.324137931034")) {
+		t.Errorf("got gross %s net %s taxes %s. Expected 1619.1, 1395.775862068966 and 223.324137931034",
+			DecimalString(r.Gross), DecimalString(r.Net), DecimalString(r.Taxes))
+	}
+}
+
+func TestRunExactRound(t *testing.T) {
+	r, err := RunExact(NewFromBrute(udfs("1619.1")), 12,
+		NewPercentualUnTax(udfs("16")),
+		NewUnitValue(udfs("3")),
+		NewRound(2),
+		WithQTY(udfs("3")),
+		NewPercTax(udfs("16")),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the unit value is rounded to 465.26, so the line gives back 465.26 * 3 * 1.16
+	if !r.UnitValues[0].Equal(udfs("465.258620689655")) || !r.Value.Equal(udfs("1619.1048")) {
+		t.Errorf("got unit value %s value %s. Expected 465.258620689655 and 1619.1048", DecimalString(r.UnitValues[0]), DecimalString(r.Value))
+	}
+
+	if len(r.RoundingAdjustments) != 1 || !r.RoundingAdjustments[0].Adjustment.Equal(udfs("0.001379310345")) {
+		t.Errorf("got rounding adjustments %+v", r.RoundingAdjustments)
+	}
+}
+
+func TestRunExactUnsupported(t *testing.T) {
+	testCases := [][]Visitor{
+		{NewSnapshot()},
+		{NewPercTax(udfs("16")), visitorFunc(func(Johnny) {})},
+	}
+
+	for i, tc := range testCases {
+		b := NewFromUnitValue(udfs("10"))
+
+		if _, err := RunExact(b, 6, tc...); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+
+		if !b.Value().Equal(udfs("10")) {
+			t.Errorf("[test case %d] got %v. The Johnny shouldn't change", i, b.Value())
+		}
+	}
+}
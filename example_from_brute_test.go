@@ -53,9 +53,9 @@ func ExampleFromBrute() {
 
 	// Output:
 	// Brute value: 1619.1
-	// Net value: 0.139578
-	// Net rounded: 0.0
-	// Net value with discount: 0.139578
-	// Unit value: 0.47
-	// Buffer value: 0.47
+	// Net value: 1395.775862068965517
+	// Net rounded: 1395.775862
+	// Net value with discount: 1395.775862068965517
+	// Unit value: 465.258620689655
+	// Buffer value: 465.258620689655
 }
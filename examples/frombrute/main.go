@@ -20,30 +20,26 @@ func main() {
 
 	bg := johnny.NewFromBruteDefault().WithBrute(udfs("1619.1"))
 
-	brute := &johnny.SnapshotVisitor{}
-	net := &johnny.SnapshotVisitor{}
-	netWD := &johnny.SnapshotVisitor{}
 	unitValue := johnny.NewUnitValue(udfs("3"))
 
-	bg.Receive(brute)
+	bg.Receive(johnny.NamedSnapshot("brute"))
 	bg.Receive(johnny.NewPercentualUnTax(udfs("16")))
-	bg.Receive(net)
+	bg.Receive(johnny.NamedSnapshot("net"))
 	bg.Receive(johnny.NewPercentualUnDiscount(udfs("0")))
-	bg.Receive(netWD)
+	bg.Receive(johnny.NamedSnapshot("net_without_discount"))
 	bg.Receive(unitValue)
 	bg.Receive(johnny.NewRound(maxScale))
 
-	netRounded := net.Get().Round(scaleForNet)
-	unitValue.Round(maxScale)
+	snapshots := bg.Snapshots()
+
+	brute, _ := snapshots.Get("brute")
+	net, _ := snapshots.Get("net")
+	netWD, _ := snapshots.Get("net_without_discount")
+	taxes, _ := snapshots.Diff("net", "brute")
 
-	fmt.Printf("Brute value: %v\nNet value: %v\nNet rounded: %v\nNet value with discount: %v\nUnit value: %v\nBuffer value: %v",
-		brute.Get().String(), net.Get().String(), netRounded.String(), netWD.Get().String(), unitValue.Get().String(), bg.Value().String())
+	netRounded := net.Round(scaleForNet)
+	unitValue.Round(maxScale)
 
-	//	Output:
-	//	Brute value: 1619.1
-	//	Net value: 0.139578
-	//	Net rounded: 0.0
-	//	Net value with discount: 0.139578
-	//	Unit value: 0.47
-	//	Buffer value: 0.47
+	fmt.Printf("Brute value: %v\nNet value: %v\nNet rounded: %v\nNet value with discount: %v\nTaxes: %v\nUnit value: %v\nBuffer value: %v",
+		brute.String(), net.String(), netRounded.String(), netWD.String(), taxes.String(), unitValue.Get().String(), bg.Value().String())
 }
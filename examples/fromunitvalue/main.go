@@ -29,37 +29,33 @@ func main() {
 	// instance the calculator as a new FromUnitValue
 	calc := johnny.NewFromUnitValue(unitValue)
 
-	// define the visitors to be used in the calculations
-	qtyVisitor := johnny.WithQTY(qty)
-	percDiscVisitor := johnny.NewPercentualDiscount(percDiscount)
-	amountDiscVisitor := johnny.NewAmountDiscount(amountLineDiscount)
+	// define the taxes to be used in the calculations, identified by code
 	percTaxVisitor := johnny.NewUnbufferedPercTax(percTax)
-	amountTaxVisitor := johnny.NewUnbufferedAmountTax(amountLineTax)
-
-	// Receive the visitors to the calculator
-	calc.Receive(qtyVisitor)
-	calc.Receive(percDiscVisitor)
-	calc.Receive(amountDiscVisitor)
-	calc.Receive(percTaxVisitor)
-	calc.Receive(amountTaxVisitor)
-
-	// get the net value from the snapshot visitor
-	net := calc.Snapshot()
-
-	calc.Add(percTaxVisitor.Amount())
-	calc.Add(amountTaxVisitor.Amount())
+	percTaxVisitor.SetCode("IVA")
 
-	// get the brute value from the snapshot visitor
-	brute := calc.Snapshot()
-
-	// get the total taxes amount from the percTaxVisitor and amountTaxVisitor visitors
-	totalTaxes := percTaxVisitor.Amount().Add(amountTaxVisitor.Amount())
-
-	// get the total discount amount from the percDiscVisitor and amountDiscVisitor visitors
-	totalDiscounts := percDiscVisitor.Amount().Add(amountDiscVisitor.Amount())
-
-	fmt.Println("net: ", net.String())
-	fmt.Println("brute: ", brute.String())
-	fmt.Println("total discounts: ", totalDiscounts.String())
-	fmt.Println("total taxes: ", totalTaxes.String())
+	amountTaxVisitor := johnny.NewUnbufferedAmountTax(amountLineTax)
+	amountTaxVisitor.SetCode("ENV")
+
+	// run the visitors over the calculator, collecting the result of the calculation
+	result, err := johnny.Run(calc,
+		johnny.WithQTY(qty),
+		johnny.NewPercentualDiscount(percDiscount),
+		johnny.NewAmountDiscount(amountLineDiscount),
+		percTaxVisitor,
+		amountTaxVisitor,
+	)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("net: ", result.Net.String())
+	fmt.Println("brute: ", result.Gross.String())
+	fmt.Println("total discounts: ", result.Discounts.String())
+	fmt.Println("total taxes: ", result.Taxes.String())
+
+	for code, amount := range result.TaxesByCode {
+		fmt.Println("tax ", code, ": ", amount.String())
+	}
 }
@@ -0,0 +1,135 @@
+package johnny
+
+import (
+	"github.com/profe-ajedrez/gyro"
+)
+
+// ExemptionKind tells why a tax is not charged.
+type ExemptionKind int
+
+const (
+	// NotExempt is a tax charged as usual.
+	NotExempt ExemptionKind = iota
+	// Exempt is a tax the customer or the product is exempted from.
+	Exempt
+	// ZeroRated is a tax charged with a zero ratio, which keeps the right to deduct the taxes paid on purchases.
+	ZeroRated
+	// OutOfScope is a tax which doesn't apply to the operation.
+	OutOfScope
+	// ReverseCharge is a tax accounted by the customer instead of being charged by the seller.
+	ReverseCharge
+)
+
+var exemptionNames = [...]string{
+	NotExempt:     "",
+	Exempt:        "exempt",
+	ZeroRated:     "zero-rated",
+	OutOfScope:    "out-of-scope",
+	ReverseCharge: "reverse-charge",
+}
+
+// String returns the name of the exemption kind, as "zero-rated", or an empty string for NotExempt.
+func (k ExemptionKind) String() string {
+	if k < 0 || int(k) >= len(exemptionNames) {
+		return "unknown"
+	}
+
+	return exemptionNames[k]
+}
+
+// ParseExemptionKind returns the exemption kind with the given name, as returned by String.
+func ParseExemptionKind(name string) (ExemptionKind, error) {
+	for k, n := range exemptionNames {
+		if n == name {
+			return ExemptionKind(k), nil
+		}
+	}
+
+	return NotExempt, NewJohnnyError("unknown exemption kind " + name)
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the kind by its name.
+func (k ExemptionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *ExemptionKind) UnmarshalText(text []byte) error {
+	kind, err := ParseExemptionKind(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*k = kind
+	return nil
+}
+
+// Exemption is a tax which was not charged, with the base it would have been calculated over,
+// as invoices must report it.
+type Exemption struct {
+	// Code identifies the tax, as "IVA".
+	Code string
+	Kind ExemptionKind
+	// Reason is the code of the legal reason of the exemption, as required by the tax authority.
+	Reason string
+	// Base is the value the tax would have been calculated over.
+	Base gyro.Gyro
+}
+
+// taxOp returns the operation of the tax of the given kind and value, exempted as t tells.
+func (t taxDef) taxOp(kind opKind, value gyro.Gyro) op {
+	return op{kind: kind, value: value, code: t.code, exemption: t.exemption, reason: t.reason}
+}
+
+// Exemption returns why the tax is not charged, NotExempt when it is.
+func (t taxDef) Exemption() ExemptionKind {
+	return t.exemption
+}
+
+// Reason returns the code of the legal reason of the exemption.
+func (t taxDef) Reason() string {
+	return t.reason
+}
+
+// Exemption returns why the tax is not charged, NotExempt when it is.
+func (pt *Tax) Exemption() ExemptionKind {
+	return pt.exemption
+}
+
+// Reason returns the code of the legal reason of the exemption.
+func (pt *Tax) Reason() string {
+	return pt.reason
+}
+
+// SetExemption exempts the tax, so it is not charged. Visiting a Johnny leaves it untouched with a zero amount,
+// keeping the taxable value and the reason, a code of the legal reason of the exemption.
+// NotExempt charges the tax again.
+func (pt *Tax) SetExemption(kind ExemptionKind, reason string) {
+	pt.exemption, pt.reason = kind, reason
+}
+
+// charged returns the fixed amount of a tax, zero when it's exempted.
+func (pt *Tax) charged() gyro.Gyro {
+	if pt.exemption != NotExempt {
+		return gyro.Gyro{}
+	}
+
+	return pt.amount
+}
+
+// Exemption returns why the taxes of the handler are not charged, NotExempt when they are.
+func (t *TaxHandler) Exemption() ExemptionKind {
+	return t.exemption
+}
+
+// Reason returns the code of the legal reason of the exemption.
+func (t *TaxHandler) Reason() string {
+	return t.reason
+}
+
+// SetExemption exempts every tax of the handler, so none is charged. Visiting a Johnny leaves it untouched
+// with zero totals, keeping the taxable value and the reason, a code of the legal reason of the exemption.
+func (t *TaxHandler) SetExemption(kind ExemptionKind, reason string) {
+	t.exemption, t.reason = kind, reason
+}
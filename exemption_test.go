@@ -0,0 +1,169 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func TestExemptedTaxes(t *testing.T) {
+	testCases := []struct {
+		visitor  Visitor
+		kind     ExemptionKind
+		expected string
+	}{
+		{NewPercTaxRule(udfs("19")).WithCode("IVA").WithExemption(Exempt, "E01"), Exempt, "1000"},
+		{NewUnbufferedPercTaxRule(udfs("19")).WithCode("IVA").WithExemption(ZeroRated, "Z"), ZeroRated, "1000"},
+		{NewAmountTaxRule(udfs("300")).WithCode("IVA").WithExemption(OutOfScope, "O"), OutOfScope, "1000"},
+		{NewUnbufferedAmountTaxRule(udfs("300")).WithCode("IVA").WithExemption(ReverseCharge, "AE"), ReverseCharge, "1000"},
+		{exemptedTax(NewPercTax(udfs("19"))), Exempt, "1000"},
+		{exemptedTax(NewAmountTax(udfs("300"))), Exempt, "1000"},
+	}
+
+	for i, tc := range testCases {
+		r := mustRun(t, NewFromUnitValue(udfs("1000")), tc.visitor)
+
+		if !r.Value.Equal(udfs(tc.expected)) || !r.Taxes.Equal(udfs("0")) {
+			t.Errorf("[test case %d] got value %v and taxes %v. Expected %v and 0", i, r.Value, r.Taxes, tc.expected)
+		}
+
+		if len(r.Exemptions) != 1 {
+			t.Fatalf("[test case %d] got exemptions %+v", i, r.Exemptions)
+		}
+
+		if e := r.Exemptions[0]; e.Code != "IVA" || e.Kind != tc.kind || e.Reason == "" || !e.Base.Equal(udfs("1000")) {
+			t.Errorf("[test case %d] got exemption %+v", i, e)
+		}
+
+		// the exempted tax still marks the net
+		if !r.Net.Equal(udfs("1000")) || !r.Gross.Equal(udfs("1000")) {
+			t.Errorf("[test case %d] got net %v and gross %v. Expected 1000", i, r.Net, r.Gross)
+		}
+	}
+}
+
+func TestExemptedAmountTaxes(t *testing.T) {
+	testCases := []interface {
+		Visitor
+		Amount() gyro.Gyro
+		Taxable() gyro.Gyro
+		SetExemption(ExemptionKind, string)
+	}{
+		NewAmountTax(udfs("300")),
+		NewUnbufferedAmountTax(udfs("300")),
+		NewAmountUnTax(udfs("300")),
+	}
+
+	for i, v := range testCases {
+		v.SetExemption(Exempt, "E01")
+		b := NewFromUnitValue(udfs("1000"))
+		b.Receive(v)
+
+		if !v.Amount().Equal(udfs("0")) || !v.Taxable().Equal(udfs("1000")) || !b.Value().Equal(udfs("1000")) {
+			t.Errorf("[test case %d] got amount %v, taxable %v and value %v. Expected 0, 1000 and 1000", i, v.Amount(), v.Taxable(), b.Value())
+		}
+
+		// the definition is kept, so the tax is charged again when it's no longer exempted
+		v.SetExemption(NotExempt, "")
+
+		if !v.Amount().Equal(udfs("300")) {
+			t.Errorf("[test case %d] got amount %v. Expected 300", i, v.Amount())
+		}
+	}
+}
+
+func exemptedTax[T interface {
+	Visitor
+	SetCode(string)
+	SetExemption(ExemptionKind, string)
+}](v T) T {
+	v.SetCode("IVA")
+	v.SetExemption(Exempt, "E01")
+	return v
+}
+
+func TestExemptedUntax(t *testing.T) {
+	untax := NewAmountUnTax(udfs("190"))
+	untax.SetCode("IVA")
+	untax.SetExemption(Exempt, "E01")
+
+	r := mustRun(t, NewFromBrute(udfs("1190")), untax, NewPercentualUntaxRule(udfs("16")).WithCode("IEPS").WithExemption(ZeroRated, "Z"))
+
+	if !r.Value.Equal(udfs("1190")) || !r.Net.Equal(udfs("1190")) || len(r.Exemptions) != 2 || r.Exemptions[1].Code != "IEPS" {
+		t.Errorf("got value %v, net %v and exemptions %+v", r.Value, r.Net, r.Exemptions)
+	}
+}
+
+func TestExemptedTaxHandler(t *testing.T) {
+	h := NewTaxHandlerFromUnitValue()
+	h.WithPercentualTax(udfs("19"))
+	h.WithAmountTax(udfs("100"))
+	h.SetExemption(Exempt, "E01")
+
+	r := mustRun(t, NewFromUnitValue(udfs("1000")), h)
+
+	if !r.Value.Equal(udfs("1000")) || !h.TotalAmount().Equal(udfs("0")) || !h.Taxable().Equal(udfs("1000")) {
+		t.Errorf("got value %v, total %v and taxable %v", r.Value, h.TotalAmount(), h.Taxable())
+	}
+
+	if len(r.Exemptions) != 1 || r.Exemptions[0].Reason != "E01" || !r.Exemptions[0].Base.Equal(udfs("1000")) {
+		t.Errorf("got exemptions %+v", r.Exemptions)
+	}
+}
+
+func TestExemptionJSON(t *testing.T) {
+	pt := NewPercTax(udfs("19"))
+	pt.SetCode("IVA")
+	pt.SetExemption(ReverseCharge, "AE")
+
+	data, err := json.Marshal(pt)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := UnmarshalVisitor(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := v.(*PercTax); got.Exemption() != ReverseCharge || got.Reason() != "AE" {
+		t.Errorf("got %s. Expected the reverse charge to be kept", data)
+	}
+
+	r := mustRun(t, NewFromUnitValue(udfs("1000")), pt)
+	data, _ = json.Marshal(r)
+
+	var decoded Result
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Exemptions) != 1 || decoded.Exemptions[0].Kind != ReverseCharge {
+		t.Errorf("got exemptions %+v from %s", decoded.Exemptions, data)
+	}
+
+	var k ExemptionKind
+
+	if err := json.Unmarshal([]byte(`"tax-free"`), &k); err == nil {
+		t.Errorf("error expected decoding an unknown exemption kind")
+	}
+}
+
+func TestRunExactExemption(t *testing.T) {
+	r, err := RunExact(NewFromUnitValue(udfs("1000")), 6,
+		NewPercTaxRule(udfs("19")).WithCode("IVA").WithExemption(ZeroRated, "Z"),
+		NewPercTaxRule(udfs("10")).WithCode("ILA"),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Value.Equal(udfs("1100")) || len(r.Exemptions) != 1 || r.Exemptions[0].Code != "IVA" {
+		t.Errorf("got value %v and exemptions %+v", r.Value, r.Exemptions)
+	}
+}
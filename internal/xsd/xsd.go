@@ -0,0 +1,810 @@
+// Package xsd validates XML documents against schemas written in a subset of XML Schema 1.0, so the documents
+// exported by the johnny subpackages can be validated offline with the standard library only.
+//
+// Schemas are made of global elements, complex types with a sequence of elements and attributes, complex types
+// with simple content, and simple types restricting a built-in type with enumerations, patterns, lengths, digits
+// and bounds. Other constructs, as choices, groups or substitution groups, are rejected when a schema is loaded,
+// so a document is never validated against part of its schema. Imports are resolved among the loaded files.
+//
+// The schemas bundled by the subpackages are structural subsets of the official ones, so a document passing
+// them holds the elements the subpackages write in the right order and with valid data, which doesn't make it
+// valid against the official schemas.
+package xsd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Namespace is the namespace of XML Schema.
+const Namespace = "http://www.w3.org/2001/XMLSchema"
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// Schema is a set of loaded schema files, one per target namespace.
+type Schema struct {
+	elements map[xml.Name]*element
+	complex  map[xml.Name]*complexType
+	simple   map[xml.Name]*simpleType
+}
+
+// element is the declaration of an element, or a reference to a global one when ref is set.
+type element struct {
+	name     xml.Name
+	ref      xml.Name
+	typ      xml.Name
+	complex  *complexType
+	simple   *simpleType
+	min, max int
+}
+
+type complexType struct {
+	sequence []*element
+	attrs    []attribute
+	// content is the type of the text of a complex type with simple content, and zero otherwise.
+	content xml.Name
+}
+
+type attribute struct {
+	name     string
+	typ      xml.Name
+	required bool
+}
+
+type simpleType struct {
+	base         xml.Name
+	enumeration  []string
+	patterns     []*regexp.Regexp
+	minLength    int
+	maxLength    int
+	totalDigits  int
+	fraction     int
+	minInclusive *big.Rat
+	maxInclusive *big.Rat
+}
+
+// Load reads the given schema files, whose references among them are resolved.
+// An error is returned if a file uses an unsupported construct, or refers to an undeclared element or type.
+func Load(files ...io.Reader) (*Schema, error) {
+	s := &Schema{
+		elements: map[xml.Name]*element{},
+		complex:  map[xml.Name]*complexType{},
+		simple:   map[xml.Name]*simpleType{},
+	}
+
+	for _, f := range files {
+		root, err := parse(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.load(root); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.resolve(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load adds the declarations of a schema file.
+func (s *Schema) load(root *node) error {
+	if root.name != (xml.Name{Space: Namespace, Local: "schema"}) {
+		return johnny.NewJohnnyError("not a schema: " + root.name.Local)
+	}
+
+	l := loader{tns: root.attr("targetNamespace"), qualified: root.attr("elementFormDefault") == "qualified"}
+
+	for _, n := range root.children {
+		switch n.xs() {
+		case "element":
+			e, err := l.element(n, true)
+
+			if err != nil {
+				return err
+			}
+
+			s.elements[e.name] = e
+		case "complexType":
+			ct, err := l.complexType(n)
+
+			if err != nil {
+				return err
+			}
+
+			s.complex[xml.Name{Space: l.tns, Local: n.attr("name")}] = ct
+		case "simpleType":
+			st, err := l.simpleType(n)
+
+			if err != nil {
+				return err
+			}
+
+			s.simple[xml.Name{Space: l.tns, Local: n.attr("name")}] = st
+		case "import", "annotation":
+		default:
+			return unsupported(n)
+		}
+	}
+
+	return nil
+}
+
+// loader reads the declarations of a schema file.
+type loader struct {
+	tns       string
+	qualified bool
+}
+
+func unsupported(n *node) error {
+	return johnny.NewJohnnyError(fmt.Sprintf("unsupported schema construct %s:%s", n.name.Space, n.name.Local))
+}
+
+func (l loader) element(n *node, global bool) (*element, error) {
+	e := &element{min: 1, max: 1}
+	var err error
+
+	if !global {
+		if e.min, e.max, err = occurs(n); err != nil {
+			return nil, err
+		}
+	}
+
+	if ref := n.attr("ref"); ref != "" {
+		e.ref, err = n.qname(ref)
+		return e, err
+	}
+
+	e.name = xml.Name{Local: n.attr("name")}
+
+	if global || l.qualified {
+		e.name.Space = l.tns
+	}
+
+	if typ := n.attr("type"); typ != "" {
+		e.typ, err = n.qname(typ)
+		return e, err
+	}
+
+	for _, c := range n.children {
+		switch c.xs() {
+		case "complexType":
+			e.complex, err = l.complexType(c)
+		case "simpleType":
+			e.simple, err = l.simpleType(c)
+		case "annotation":
+		default:
+			return nil, unsupported(c)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.complex == nil && e.simple == nil {
+		return nil, johnny.NewJohnnyError("element " + e.name.Local + " has no type")
+	}
+
+	return e, nil
+}
+
+func occurs(n *node) (int, int, error) {
+	min, max := 1, 1
+	var err error
+
+	if v := n.attr("minOccurs"); v != "" {
+		if min, err = strconv.Atoi(v); err != nil {
+			return 0, 0, johnny.NewJohnnyError("invalid minOccurs " + v)
+		}
+	}
+
+	switch v := n.attr("maxOccurs"); v {
+	case "":
+	case "unbounded":
+		max = -1
+	default:
+		if max, err = strconv.Atoi(v); err != nil {
+			return 0, 0, johnny.NewJohnnyError("invalid maxOccurs " + v)
+		}
+	}
+
+	return min, max, nil
+}
+
+func (l loader) complexType(n *node) (*complexType, error) {
+	ct := &complexType{}
+
+	for _, c := range n.children {
+		switch c.xs() {
+		case "sequence":
+			for _, p := range c.children {
+				if p.xs() == "annotation" {
+					continue
+				}
+
+				if p.xs() != "element" {
+					return nil, unsupported(p)
+				}
+
+				e, err := l.element(p, false)
+
+				if err != nil {
+					return nil, err
+				}
+
+				ct.sequence = append(ct.sequence, e)
+			}
+		case "attribute":
+			a, err := attr(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ct.attrs = append(ct.attrs, a)
+		case "simpleContent":
+			if len(c.children) != 1 || c.children[0].xs() != "extension" {
+				return nil, johnny.NewJohnnyError("simple content must be an extension")
+			}
+
+			ext := c.children[0]
+			var err error
+
+			if ct.content, err = ext.qname(ext.attr("base")); err != nil {
+				return nil, err
+			}
+
+			for _, a := range ext.children {
+				if a.xs() != "attribute" {
+					return nil, unsupported(a)
+				}
+
+				at, err := attr(a)
+
+				if err != nil {
+					return nil, err
+				}
+
+				ct.attrs = append(ct.attrs, at)
+			}
+		case "annotation":
+		default:
+			return nil, unsupported(c)
+		}
+	}
+
+	return ct, nil
+}
+
+func attr(n *node) (attribute, error) {
+	typ, err := n.qname(n.attr("type"))
+
+	if err != nil {
+		return attribute{}, err
+	}
+
+	return attribute{name: n.attr("name"), typ: typ, required: n.attr("use") == "required"}, nil
+}
+
+func (l loader) simpleType(n *node) (*simpleType, error) {
+	st := &simpleType{minLength: -1, maxLength: -1, totalDigits: -1, fraction: -1}
+
+	for _, c := range n.children {
+		if c.xs() == "annotation" {
+			continue
+		}
+
+		if c.xs() != "restriction" {
+			return nil, unsupported(c)
+		}
+
+		var err error
+
+		if st.base, err = c.qname(c.attr("base")); err != nil {
+			return nil, err
+		}
+
+		for _, f := range c.children {
+			if err := st.facet(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if st.base == (xml.Name{}) {
+		return nil, johnny.NewJohnnyError("simple type " + n.attr("name") + " has no restriction")
+	}
+
+	return st, nil
+}
+
+func (st *simpleType) facet(f *node) error {
+	v := f.attr("value")
+	var err error
+
+	switch f.xs() {
+	case "enumeration":
+		st.enumeration = append(st.enumeration, v)
+	case "pattern":
+		var re *regexp.Regexp
+
+		if re, err = regexp.Compile("^(?:" + v + ")$"); err == nil {
+			st.patterns = append(st.patterns, re)
+		}
+	case "length":
+		if st.minLength, err = strconv.Atoi(v); err == nil {
+			st.maxLength = st.minLength
+		}
+	case "minLength":
+		st.minLength, err = strconv.Atoi(v)
+	case "maxLength":
+		st.maxLength, err = strconv.Atoi(v)
+	case "totalDigits":
+		st.totalDigits, err = strconv.Atoi(v)
+	case "fractionDigits":
+		st.fraction, err = strconv.Atoi(v)
+	case "minInclusive":
+		st.minInclusive, err = rat(v)
+	case "maxInclusive":
+		st.maxInclusive, err = rat(v)
+	case "annotation":
+	default:
+		return unsupported(f)
+	}
+
+	if err != nil {
+		return johnny.NewJohnnyError(fmt.Sprintf("invalid %s facet %q", f.name.Local, v))
+	}
+
+	return nil
+}
+
+func rat(v string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(v)
+
+	if !ok {
+		return nil, johnny.NewJohnnyError("invalid decimal " + v)
+	}
+
+	return r, nil
+}
+
+// resolve checks that every referenced element and type is declared.
+func (s *Schema) resolve() error {
+	var check func(e *element) error
+
+	checkComplex := func(ct *complexType) error {
+		for _, p := range ct.sequence {
+			if err := check(p); err != nil {
+				return err
+			}
+		}
+
+		for _, a := range ct.attrs {
+			if !s.isSimple(a.typ) {
+				return johnny.NewJohnnyError("unknown simple type " + a.typ.Local + " of attribute " + a.name)
+			}
+		}
+
+		if ct.content != (xml.Name{}) && !s.isSimple(ct.content) {
+			return johnny.NewJohnnyError("unknown simple type " + ct.content.Local)
+		}
+
+		return nil
+	}
+
+	check = func(e *element) error {
+		if e.ref != (xml.Name{}) {
+			if _, ok := s.elements[e.ref]; !ok {
+				return johnny.NewJohnnyError("unknown element " + e.ref.Space + ":" + e.ref.Local)
+			}
+
+			return nil
+		}
+
+		switch {
+		case e.complex != nil:
+			return checkComplex(e.complex)
+		case e.simple != nil:
+			return s.checkSimple(e.simple)
+		}
+
+		if _, ok := s.complex[e.typ]; !ok && !s.isSimple(e.typ) {
+			return johnny.NewJohnnyError("unknown type " + e.typ.Space + ":" + e.typ.Local + " of element " + e.name.Local)
+		}
+
+		return nil
+	}
+
+	for _, e := range s.elements {
+		if err := check(e); err != nil {
+			return err
+		}
+	}
+
+	for _, ct := range s.complex {
+		if err := checkComplex(ct); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range s.simple {
+		if err := s.checkSimple(st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) checkSimple(st *simpleType) error {
+	if !s.isSimple(st.base) {
+		return johnny.NewJohnnyError("unknown simple type " + st.base.Local)
+	}
+
+	return nil
+}
+
+func (s *Schema) isSimple(name xml.Name) bool {
+	if name.Space == Namespace {
+		_, ok := builtins[name.Local]
+		return ok
+	}
+
+	_, ok := s.simple[name]
+	return ok
+}
+
+var (
+	decimalPattern  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	integerPattern  = regexp.MustCompile(`^[+-]?\d+$`)
+	languagePattern = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+)
+
+// builtins holds the built-in types of XML Schema which are supported, checking the lexical form of a value.
+var builtins = map[string]func(v string) bool{
+	"anySimpleType":    func(string) bool { return true },
+	"string":           func(string) bool { return true },
+	"normalizedString": func(v string) bool { return !strings.ContainsAny(v, "\t\n\r") },
+	"token": func(v string) bool {
+		return !strings.ContainsAny(v, "\t\n\r") && strings.TrimSpace(v) == v && !strings.Contains(v, "  ")
+	},
+	"language": languagePattern.MatchString,
+	"decimal":  decimalPattern.MatchString,
+	"integer":  integerPattern.MatchString,
+	"nonNegativeInteger": func(v string) bool {
+		return integerPattern.MatchString(v) && (!strings.HasPrefix(v, "-") || strings.Trim(v, "-0") == "")
+	},
+	"positiveInteger": func(v string) bool {
+		n, ok := new(big.Int).SetString(strings.TrimPrefix(v, "+"), 10)
+		return integerPattern.MatchString(v) && ok && n.Sign() > 0
+	},
+	"boolean": func(v string) bool { return v == "true" || v == "false" || v == "1" || v == "0" },
+	"date": func(v string) bool {
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	},
+}
+
+// Validate checks that the given XML document is valid against the schema.
+// The returned error tells the path of the first element found invalid.
+func (s *Schema) Validate(r io.Reader) error {
+	root, err := parse(r)
+
+	if err != nil {
+		return err
+	}
+
+	decl, ok := s.elements[root.name]
+
+	if !ok {
+		return johnny.NewJohnnyError("undeclared root element " + root.name.Space + ":" + root.name.Local)
+	}
+
+	return s.element(root, decl, root.name.Local)
+}
+
+func (s *Schema) element(n *node, decl *element, path string) error {
+	switch {
+	case decl.complex != nil:
+		return s.complexContent(n, decl.complex, path)
+	case decl.simple != nil:
+		return s.simpleContent(n, nil, path, func(v string) error { return s.simpleValue(v, decl.simple) })
+	}
+
+	if ct, ok := s.complex[decl.typ]; ok {
+		return s.complexContent(n, ct, path)
+	}
+
+	return s.simpleContent(n, nil, path, func(v string) error { return s.value(v, decl.typ) })
+}
+
+func (s *Schema) complexContent(n *node, ct *complexType, path string) error {
+	if ct.content != (xml.Name{}) {
+		return s.simpleContent(n, ct.attrs, path, func(v string) error { return s.value(v, ct.content) })
+	}
+
+	if err := s.attributes(n, ct.attrs, path); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(n.text) != "" {
+		return johnny.NewJohnnyError(path + ": unexpected text")
+	}
+
+	i := 0
+
+	for _, p := range ct.sequence {
+		decl := p
+
+		if p.ref != (xml.Name{}) {
+			decl = s.elements[p.ref]
+		}
+
+		count := 0
+
+		for i < len(n.children) && n.children[i].name == decl.name && (p.max < 0 || count < p.max) {
+			child := path + "/" + decl.name.Local
+
+			if p.max != 1 {
+				child += fmt.Sprintf("[%d]", count+1)
+			}
+
+			if err := s.element(n.children[i], decl, child); err != nil {
+				return err
+			}
+
+			count++
+			i++
+		}
+
+		if count < p.min {
+			return johnny.NewJohnnyError(fmt.Sprintf("%s: missing element %s", path, decl.name.Local))
+		}
+	}
+
+	if i < len(n.children) {
+		return johnny.NewJohnnyError(fmt.Sprintf("%s: unexpected element %s", path, n.children[i].name.Local))
+	}
+
+	return nil
+}
+
+func (s *Schema) simpleContent(n *node, attrs []attribute, path string, check func(v string) error) error {
+	if err := s.attributes(n, attrs, path); err != nil {
+		return err
+	}
+
+	if len(n.children) > 0 {
+		return johnny.NewJohnnyError(fmt.Sprintf("%s: unexpected element %s", path, n.children[0].name.Local))
+	}
+
+	if err := check(n.text); err != nil {
+		return johnny.NewJohnnyError(fmt.Sprintf("%s: %v", path, err))
+	}
+
+	return nil
+}
+
+func (s *Schema) attributes(n *node, attrs []attribute, path string) error {
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || a.Name.Space == xsiNamespace || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+
+		i := 0
+
+		for ; i < len(attrs) && (a.Name.Space != "" || attrs[i].name != a.Name.Local); i++ {
+		}
+
+		if i == len(attrs) {
+			return johnny.NewJohnnyError(fmt.Sprintf("%s: unexpected attribute %s", path, a.Name.Local))
+		}
+
+		if err := s.value(a.Value, attrs[i].typ); err != nil {
+			return johnny.NewJohnnyError(fmt.Sprintf("%s@%s: %v", path, a.Name.Local, err))
+		}
+	}
+
+	for _, at := range attrs {
+		if at.required && n.attr(at.name) == "" {
+			return johnny.NewJohnnyError(fmt.Sprintf("%s: missing attribute %s", path, at.name))
+		}
+	}
+
+	return nil
+}
+
+// value checks v against the named simple type.
+func (s *Schema) value(v string, typ xml.Name) error {
+	if typ.Space == Namespace {
+		if typ.Local != "string" && typ.Local != "normalizedString" {
+			v = strings.TrimSpace(v)
+		}
+
+		if !builtins[typ.Local](v) {
+			return fmt.Errorf("invalid %s %q", typ.Local, v)
+		}
+
+		return nil
+	}
+
+	return s.simpleValue(v, s.simple[typ])
+}
+
+func (s *Schema) simpleValue(v string, st *simpleType) error {
+	if err := s.value(v, st.base); err != nil {
+		return err
+	}
+
+	if len(st.enumeration) > 0 {
+		i := 0
+
+		for ; i < len(st.enumeration) && st.enumeration[i] != v; i++ {
+		}
+
+		if i == len(st.enumeration) {
+			return fmt.Errorf("%q is not one of %v", v, st.enumeration)
+		}
+	}
+
+	for _, re := range st.patterns {
+		if !re.MatchString(v) {
+			return fmt.Errorf("%q doesn't match %s", v, re)
+		}
+	}
+
+	if n := len([]rune(v)); (st.minLength >= 0 && n < st.minLength) || (st.maxLength >= 0 && n > st.maxLength) {
+		return fmt.Errorf("%q has an invalid length", v)
+	}
+
+	if st.totalDigits < 0 && st.fraction < 0 && st.minInclusive == nil && st.maxInclusive == nil {
+		return nil
+	}
+
+	return st.number(v)
+}
+
+// number checks the numeric facets of a decimal value.
+func (st *simpleType) number(v string) error {
+	v = strings.TrimSpace(v)
+	r, ok := new(big.Rat).SetString(v)
+
+	if !ok {
+		return fmt.Errorf("invalid decimal %q", v)
+	}
+
+	digits := strings.TrimLeft(strings.TrimLeft(v, "+-"), "0")
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	fracPart = strings.TrimRight(fracPart, "0")
+
+	if st.fraction >= 0 && len(fracPart) > st.fraction {
+		return fmt.Errorf("%q has more than %d fraction digits", v, st.fraction)
+	}
+
+	if st.totalDigits >= 0 && len(intPart)+len(fracPart) > st.totalDigits {
+		return fmt.Errorf("%q has more than %d digits", v, st.totalDigits)
+	}
+
+	if (st.minInclusive != nil && r.Cmp(st.minInclusive) < 0) || (st.maxInclusive != nil && r.Cmp(st.maxInclusive) > 0) {
+		return fmt.Errorf("%q is out of range", v)
+	}
+
+	return nil
+}
+
+// node is an element of a parsed XML document.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+	// ns holds the namespaces in scope by prefix, the default one under the empty prefix.
+	ns map[string]string
+}
+
+func (n *node) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// xs returns the local name of a schema node, or an empty string if it's not in the XML Schema namespace.
+func (n *node) xs() string {
+	if n.name.Space != Namespace {
+		return ""
+	}
+
+	return n.name.Local
+}
+
+// qname resolves a qualified name with the namespaces in scope.
+func (n *node) qname(v string) (xml.Name, error) {
+	prefix, local, ok := strings.Cut(v, ":")
+
+	if !ok {
+		prefix, local = "", v
+	}
+
+	space, declared := n.ns[prefix]
+
+	if !declared && prefix != "" {
+		return xml.Name{}, johnny.NewJohnnyError("undeclared prefix in " + v)
+	}
+
+	return xml.Name{Space: space, Local: local}, nil
+}
+
+func parse(r io.Reader) (*node, error) {
+	d := xml.NewDecoder(r)
+	var stack []*node
+	var root *node
+
+	for {
+		tok, err := d.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, attrs: t.Attr, ns: map[string]string{}}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+
+				for k, v := range parent.ns {
+					n.ns[k] = v
+				}
+			} else {
+				root = n
+			}
+
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					n.ns[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					n.ns[""] = a.Value
+				}
+			}
+
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, johnny.NewJohnnyError("empty document")
+	}
+
+	return root, nil
+}
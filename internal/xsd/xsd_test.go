@@ -0,0 +1,102 @@
+package xsd
+
+import (
+	"strings"
+	"testing"
+)
+
+const orderSchema = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns="urn:order" targetNamespace="urn:order" elementFormDefault="qualified">
+  <xs:element name="Order">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="ID" type="Code"/>
+        <xs:element name="Note" type="xs:string" minOccurs="0"/>
+        <xs:element name="Line" type="LineType" maxOccurs="unbounded"/>
+      </xs:sequence>
+      <xs:attribute name="version" type="xs:positiveInteger" use="required"/>
+    </xs:complexType>
+  </xs:element>
+  <xs:complexType name="LineType">
+    <xs:sequence>
+      <xs:element name="Qty" type="Qty"/>
+      <xs:element name="Amount" type="AmountType"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:complexType name="AmountType">
+    <xs:simpleContent>
+      <xs:extension base="Money">
+        <xs:attribute name="currency" type="Code" use="required"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+  <xs:simpleType name="Code">
+    <xs:restriction base="xs:token">
+      <xs:pattern value="[A-Z0-9-]+"/>
+      <xs:maxLength value="8"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="Qty">
+    <xs:restriction base="xs:decimal">
+      <xs:minInclusive value="0"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="Money">
+    <xs:restriction base="xs:decimal">
+      <xs:totalDigits value="8"/>
+      <xs:fractionDigits value="2"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+func TestValidate(t *testing.T) {
+	schema, err := Load(strings.NewReader(orderSchema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := `<Line><Qty>2</Qty><Amount currency="CLP">1500.50</Amount></Line>`
+
+	testCases := []struct {
+		doc string
+		err string
+	}{
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID>` + line + line + `</Order>`, ""},
+		{`<o:Order xmlns:o="urn:order" version="1"><o:ID>A-1</o:ID><o:Note>ok</o:Note><o:Line><o:Qty> 0 </o:Qty><o:Amount currency="CLP">1.5</o:Amount></o:Line></o:Order>`, ""},
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID></Order>`, "Order: missing element Line"},
+		{`<Order xmlns="urn:order"><ID>A-1</ID>` + line + `</Order>`, "Order: missing attribute version"},
+		{`<Order xmlns="urn:order" version="1" lang="es"><ID>A-1</ID>` + line + `</Order>`, "Order: unexpected attribute lang"},
+		{`<Order xmlns="urn:order" version="1">` + line + `<ID>A-1</ID></Order>`, "Order: missing element ID"},
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID>` + line + `<Note>late</Note></Order>`, "Order: unexpected element Note"},
+		{`<Order xmlns="urn:order" version="1"><ID>a-1</ID>` + line + `</Order>`, "Order/ID"},
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID>` + line + `<Line><Qty>-1</Qty><Amount currency="CLP">1</Amount></Line></Order>`, "Order/Line[2]/Qty"},
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID><Line><Qty>1</Qty><Amount currency="CLP">1.505</Amount></Line></Order>`, "Order/Line[1]/Amount"},
+		{`<Order xmlns="urn:order" version="1"><ID>A-1</ID><Line><Qty>1</Qty><Amount>1</Amount></Line></Order>`, "missing attribute currency"},
+		{`<Order version="1"><ID>A-1</ID>` + line + `</Order>`, "undeclared root element"},
+	}
+
+	for i, tc := range testCases {
+		err := schema.Validate(strings.NewReader(tc.doc))
+
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("[test case %d] got %v. Expected no error", i, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("[test case %d] got %v. Expected %s", i, err, tc.err)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for i, schema := range []string{
+		`<schema/>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:group name="g"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:complexType name="T"><xs:choice/></xs:complexType></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="A" type="B"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="A" type="p:B"/></xs:schema>`,
+	} {
+		if _, err := Load(strings.NewReader(schema)); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
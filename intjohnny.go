@@ -0,0 +1,282 @@
+package johnny
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Johnny = &IntJohnny{}
+
+// IntJohnny is a Johnny for currencies without decimals, as CLP or JPY, or any other whose amounts
+// are whole minor units, as cents. While every operation gives a whole number of minor units, the value is
+// kept in an int64, avoiding decimal arithmetic. When an operation gives a fraction of a minor unit, as a
+// division or a percentage may, or overflows int64, the value falls back to gyro and stays there until it is
+// set back to a whole number of minor units, as a Round visitor does.
+type IntJohnny struct {
+	// units is the value in minor units, while the value is not decimal.
+	units int64
+	// scale is the number of decimal places of a minor unit, 0 for CLP or JPY and 2 for cents.
+	scale   int32
+	decimal bool
+	// g is the value once it fell back to gyro.
+	g         gyro.Gyro
+	snapshots *Snapshots
+}
+
+// NewIntJohnny returns a new IntJohnny holding the entry value, counting minor units of the given scale,
+// which is kept between 0 and gyro.MaxScale.
+func NewIntJohnny(entry gyro.Gyro, scale int32) *IntJohnny {
+	b := &IntJohnny{scale: min(max(scale, 0), gyro.MaxScale)}
+	b.set(entry)
+	return b
+}
+
+// Units returns the value in minor units, and false if the value fell back to gyro.
+func (b *IntJohnny) Units() (int64, bool) {
+	return b.units, !b.decimal
+}
+
+// Value returns the current value of the Johnny.
+func (b *IntJohnny) Value() gyro.Gyro {
+	if b.decimal {
+		return b.g
+	}
+
+	return gyro.NewFromInt64Raw(b.units, -b.scale)
+}
+
+// Add adds the given decimal value to the Johnny.
+func (b *IntJohnny) Add(v gyro.Gyro) {
+	if !b.decimal {
+		if u, ok := b.toUnits(v); ok {
+			if s, ok := add64(b.units, u); ok {
+				b.units = s
+				return
+			}
+		}
+
+		b.fallback()
+	}
+
+	b.g = b.g.Add(v)
+}
+
+// Sub subtracts the given decimal value from the Johnny.
+func (b *IntJohnny) Sub(v gyro.Gyro) {
+	if !b.decimal {
+		if u, ok := b.toUnits(v); ok && u != math.MinInt64 {
+			if s, ok := add64(b.units, -u); ok {
+				b.units = s
+				return
+			}
+		}
+
+		b.fallback()
+	}
+
+	b.g = b.g.Sub(v)
+}
+
+// Mul multiplies the Johnny by the given decimal value.
+func (b *IntJohnny) Mul(v gyro.Gyro) {
+	if !b.decimal {
+		if c, exp, ok := gyroInt64(v); ok {
+			if p, ok := mul64(b.units, c); ok {
+				if p, ok = shift64(p, exp); ok {
+					b.units = p
+					return
+				}
+			}
+		}
+
+		b.fallback()
+	}
+
+	b.g = b.g.Mul(v)
+}
+
+// Div divides the Johnny by the given decimal value.
+// As DefaultJohnny does, it panics when dividing by zero.
+func (b *IntJohnny) Div(v gyro.Gyro) {
+	if !b.decimal {
+		if q, ok := b.div(v); ok {
+			b.units = q
+			return
+		}
+
+		b.fallback()
+	}
+
+	b.g = quo(b.g, v)
+}
+
+// div divides the minor units by v, and returns false if the quotient is not a whole number of minor units.
+func (b *IntJohnny) div(v gyro.Gyro) (int64, bool) {
+	c, exp, ok := gyroInt64(v)
+
+	if !ok || c == 0 {
+		return 0, false
+	}
+
+	// units / (c * 10^exp) == (units * 10^-exp) / c
+	n, ok := shift64(b.units, -exp)
+
+	if !ok || n%c != 0 || (n == math.MinInt64 && c == -1) {
+		return 0, false
+	}
+
+	return n / c, true
+}
+
+// fallback moves the value to gyro.
+func (b *IntJohnny) fallback() {
+	b.g = b.Value()
+	b.decimal = true
+}
+
+// toUnits returns v in minor units, and false if v is not a whole number of minor units or doesn't fit in an int64.
+func (b *IntJohnny) toUnits(v gyro.Gyro) (int64, bool) {
+	c, exp, ok := gyroInt64(v)
+
+	if !ok || exp == -b.scale {
+		return c, ok
+	}
+
+	return shift64(c, exp+b.scale)
+}
+
+func (b *IntJohnny) set(v gyro.Gyro) {
+	if u, ok := b.toUnits(v); ok {
+		b.units = u
+		b.decimal = false
+		return
+	}
+
+	b.g = v
+	b.decimal = true
+}
+
+// String returns a string representation of the Johnny value.
+func (b *IntJohnny) String() string {
+	w := strings.Builder{}
+
+	w.WriteString("buffer: ")
+	w.WriteString(b.Value().String())
+
+	return w.String()
+}
+
+// Receive makes the visitor visit the Johnny.
+func (b *IntJohnny) Receive(v Visitor) {
+	v.Visit(b)
+}
+
+// Snapshot returns the current value of the Johnny.
+func (b *IntJohnny) Snapshot() gyro.Gyro {
+	return b.Value()
+}
+
+// Restore sets the value of the Johnny to the provided decimal value,
+// going back to minor units when it is a whole number of them.
+func (b *IntJohnny) Restore(v gyro.Gyro) {
+	b.set(v)
+}
+
+// Snapshots returns the registry where named snapshots of the Johnny are stored.
+// The registry is created the first time it is requested.
+func (b *IntJohnny) Snapshots() *Snapshots {
+	if b.snapshots == nil {
+		b.snapshots = NewSnapshots()
+	}
+
+	return b.snapshots
+}
+
+// pow10Int64 holds the powers of ten fitting in an int64.
+var pow10Int64 = func() [19]int64 {
+	p := [19]int64{1}
+
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+
+	return p
+}()
+
+func add64(a, b int64) (int64, bool) {
+	s := a + b
+	// the sum overflowed if both operands have the same sign and the sum a different one
+	return s, (a >= 0) != (b >= 0) || (s >= 0) == (a >= 0)
+}
+
+func mul64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	neg := (a < 0) != (b < 0)
+	hi, lo := bits.Mul64(absUint64(a), absUint64(b))
+
+	if hi != 0 || lo > math.MaxInt64+1 || (lo == math.MaxInt64+1 && !neg) {
+		return 0, false
+	}
+
+	if neg {
+		return -int64(lo), true
+	}
+
+	return int64(lo), true
+}
+
+func absUint64(a int64) uint64 {
+	if a < 0 {
+		return uint64(-a)
+	}
+
+	return uint64(a)
+}
+
+// shift64 returns a * 10^exp, and false if it overflows or, for a negative exp, it is not a whole number.
+func shift64(a int64, exp int32) (int64, bool) {
+	switch {
+	case exp == 0 || a == 0:
+		return a, true
+	case exp > 0:
+		if int(exp) >= len(pow10Int64) {
+			return 0, false
+		}
+
+		return mul64(a, pow10Int64[exp])
+	default:
+		if int(-exp) >= len(pow10Int64) {
+			return 0, false
+		}
+
+		p := pow10Int64[-exp]
+
+		if a%p != 0 {
+			return 0, false
+		}
+
+		return a / p, true
+	}
+}
+
+// gyroInt64 returns the coefficient and exponent of g, so that g == coeff * 10^exp, and false if the
+// coefficient doesn't fit in an int64. gyro keeps both unexported, but Int64 returns the low 64 bits of the
+// coefficient, so its exponent is the one giving back g. When the coefficient doesn't fit, its low bits give
+// back g with no exponent.
+func gyroInt64(g gyro.Gyro) (int64, int32, bool) {
+	c := g.Int64()
+
+	for exp := int32(0); exp >= -gyro.MaxScale; exp-- {
+		if gyro.NewFromInt64Raw(c, exp).Equal(g) {
+			return c, exp, true
+		}
+	}
+
+	return 0, 0, false
+}
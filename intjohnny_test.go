@@ -0,0 +1,145 @@
+package johnny
+
+import (
+	"math"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func TestIntJohnny(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		scale    int32
+		visitors []Visitor
+		expected string
+		units    int64
+		// integer tells whether the value is expected in minor units, or fallen back to gyro.
+		integer bool
+	}{
+		{"1190", 0, []Visitor{WithQTY(udfs("3")), NewAmountDiscountRule(udfs("70"))}, "3500", 3500, true},
+		{"3500", 0, []Visitor{NewPercTaxRule(udfs("19"))}, "4165", 4165, true},
+		{"25990", 0, []Visitor{NewPercTaxRule(udfs("19"))}, "30928.1", 0, false},
+		{"25990", 0, []Visitor{NewPercTaxRule(udfs("19")), NewRound(0)}, "30928", 30928, true},
+		{"100", 0, []Visitor{NewUnitValueRule(udfs("4"))}, "25", 25, true},
+		{"100", 0, []Visitor{NewUnitValueRule(udfs("3"))}, "33.333333333333333", 0, false},
+		{"19.99", 2, []Visitor{WithQTY(udfs("3")), NewPercentualDiscountRule(udfs("10"))}, "53.973", 0, false},
+		{"19.99", 2, []Visitor{WithQTY(udfs("3")), NewPercentualDiscountRule(udfs("10")), NewRound(2)}, "53.97", 5397, true},
+		{"0.001", 2, nil, "0.001", 0, false},
+		{"-12.5", 2, []Visitor{WithQTY(udfs("2"))}, "-25", -2500, true},
+	}
+
+	for i, tc := range testCases {
+		b := NewIntJohnny(udfs(tc.entry), tc.scale)
+
+		for _, v := range tc.visitors {
+			b.Receive(v)
+		}
+
+		if !b.Value().Equal(udfs(tc.expected)) {
+			t.Errorf("[test case %d] got %v. Expected %v", i, DecimalString(b.Value()), tc.expected)
+		}
+
+		if units, integer := b.Units(); integer != tc.integer || (integer && units != tc.units) {
+			t.Errorf("[test case %d] got %d minor units, %v. Expected %d, %v", i, units, integer, tc.units, tc.integer)
+		}
+
+		// the same visitors give the same value over DefaultJohnny
+		d := NewFromUnitValue(udfs(tc.entry))
+
+		for _, v := range tc.visitors {
+			d.Receive(v)
+		}
+
+		if !b.Value().Equal(d.Value()) {
+			t.Errorf("[test case %d] got %v. DefaultJohnny got %v", i, DecimalString(b.Value()), DecimalString(d.Value()))
+		}
+	}
+}
+
+func TestIntJohnnyOverflow(t *testing.T) {
+	maxUnits := gyro.NewFromInt64Raw(math.MaxInt64, 0)
+
+	testCases := []struct {
+		op       func(b *IntJohnny)
+		expected gyro.Gyro
+	}{
+		{func(b *IntJohnny) { b.Add(udfs("1")) }, maxUnits.Add(udfs("1"))},
+		{func(b *IntJohnny) { b.Sub(udfs("-1")) }, maxUnits.Add(udfs("1"))},
+		{func(b *IntJohnny) { b.Mul(udfs("2")) }, maxUnits.Mul(udfs("2"))},
+		{func(b *IntJohnny) { b.Mul(udfs("10000000000000000000000")) }, maxUnits.Mul(udfs("10000000000000000000000"))},
+	}
+
+	for i, tc := range testCases {
+		b := NewIntJohnny(maxUnits, 0)
+		tc.op(b)
+
+		if _, integer := b.Units(); integer {
+			t.Errorf("[test case %d] the value should fall back to gyro", i)
+		}
+
+		if !b.Value().Equal(tc.expected) {
+			t.Errorf("[test case %d] got %v. Expected %v", i, DecimalString(b.Value()), DecimalString(tc.expected))
+		}
+	}
+
+	// a value which doesn't fit in an int64 minor units starts in gyro, and goes back to minor units when it fits again
+	b := NewIntJohnny(maxUnits.Mul(udfs("10")), 0)
+
+	if _, integer := b.Units(); integer {
+		t.Errorf("the value should start in gyro")
+	}
+
+	b.Restore(udfs("10"))
+
+	if units, integer := b.Units(); !integer || units != 10 {
+		t.Errorf("got %d minor units, %v. Expected 10, true", units, integer)
+	}
+}
+
+func TestIntJohnnyDiv(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		div      string
+		expected string
+		integer  bool
+	}{
+		{"4165", "1.19", "3500", true},
+		{"4165", "0.5", "8330", true},
+		{"-900", "3", "-300", true},
+		{"1000", "3", "333.333333333333333", false},
+		{"1000", "0.3", "3333.333333333333333", false},
+	}
+
+	for i, tc := range testCases {
+		b := NewIntJohnny(udfs(tc.entry), 0)
+		b.Div(udfs(tc.div))
+
+		if !b.Value().Equal(udfs(tc.expected)) {
+			t.Errorf("[test case %d] got %v. Expected %v", i, DecimalString(b.Value()), tc.expected)
+		}
+
+		if _, integer := b.Units(); integer != tc.integer {
+			t.Errorf("[test case %d] got minor units %v. Expected %v", i, integer, tc.integer)
+		}
+	}
+}
+
+func TestIntJohnnyRun(t *testing.T) {
+	b := NewIntJohnny(udfs("1190"), 0)
+
+	r := mustRun(t, b,
+		WithQTY(udfs("3")),
+		NamedSnapshot("net"),
+		NewUnbufferedPercTaxRule(udfs("19")).WithCode("IVA"),
+		NewRound(0),
+	)
+
+	if !r.Net.Equal(udfs("3570")) || !r.Taxes.Equal(udfs("678.3")) {
+		t.Errorf("got net %v taxes %v. Expected 3570 and 678.3", DecimalString(r.Net), DecimalString(r.Taxes))
+	}
+
+	if net, _ := b.Snapshots().Get("net"); !net.Equal(udfs("3570")) {
+		t.Errorf("got net snapshot %v. Expected 3570", DecimalString(net))
+	}
+}
@@ -29,6 +29,9 @@ type Johnny interface {
 	set(gyro.Gyro)
 	String() string
 
+	// Snapshots returns the registry where named snapshots of the Johnny are stored.
+	Snapshots() *Snapshots
+
 	Handler
 }
 
@@ -37,7 +40,8 @@ type Johnny interface {
 // Is used as a common default implementation of the Johnny interface.
 // Also, you could implement your own Johnny type by embedding this struct, to get the basic functionality
 type DefaultJohnny struct {
-	v gyro.Gyro
+	v         gyro.Gyro
+	snapshots *Snapshots
 }
 
 // Value returns the current value of the Johnny.
@@ -60,11 +64,12 @@ func (b *DefaultJohnny) Mul(v gyro.Gyro) {
 	b.v = b.v.Mul(v)
 }
 
-// Div divides the Johnny by the given decimal value.
+// Div divides the Johnny by the given decimal value, through [Quo].
 // This could trigger a division by zero panic because this implementation
-// Visitesn't check if the given value is zero or not.
+// doesn't check if the given value is zero or not. It also panics if the
+// quotient overflows gyro.Gyro, instead of keeping a wrong value.
 func (b *DefaultJohnny) Div(v gyro.Gyro) {
-	b.v = b.v.Div(v)
+	b.v = quo(b.v, v)
 }
 
 // String returns a string representation of the Johnny value.
@@ -94,6 +99,26 @@ func (b *DefaultJohnny) Restore(s gyro.Gyro) {
 	b.set(s)
 }
 
+// Snapshots returns the registry where named snapshots of the Johnny are stored.
+// The registry is created the first time it is requested.
+func (b *DefaultJohnny) Snapshots() *Snapshots {
+	if b.snapshots == nil {
+		b.snapshots = NewSnapshots()
+	}
+
+	return b.snapshots
+}
+
+// Reset sets the value of the Johnny to zero and removes its named snapshots,
+// keeping the memory of the registry for the next calculation.
+func (b *DefaultJohnny) Reset() {
+	b.v = gyro.Gyro{}
+
+	if b.snapshots != nil {
+		b.snapshots.Reset()
+	}
+}
+
 func (b *DefaultJohnny) set(s gyro.Gyro) {
 	b.v = s
 }
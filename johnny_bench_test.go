@@ -284,3 +284,130 @@ func BenchmarkFromUnitValue(b *testing.B) {
 		_ = percDiscVisitor.Amount().Add(amountDiscVisitor.Amount())
 	}
 }
+
+func BenchmarkPooledTax(b *testing.B) {
+	entry := udfs("100.123")
+	ratio := udfs("10")
+	ratio2 := udfs("15")
+	qty := udfs("10")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i <= b.N; i++ {
+		bg := AcquireFromUnitValue(entry)
+		taxOverEntryValue := AcquirePercTax(ratio)
+		taxConsideringQty := AcquirePercTax(ratio2)
+
+		bg.Receive(taxOverEntryValue)
+		bg.Receive(WithQTY(qty))
+		bg.Receive(taxConsideringQty)
+
+		ReleaseVisitor(taxOverEntryValue)
+		ReleaseVisitor(taxConsideringQty)
+		ReleaseJohnny(bg)
+	}
+}
+
+func BenchmarkPooledFromUnitValue(b *testing.B) {
+	unitValue := udfs("1044.543103448276")
+	qty := udfs("35157")
+	percDiscount := udfs("10")
+	amountLineDiscount := udfs("100")
+	percTax := udfs("16")
+	amountLineTax := qty.Div(gyro.NewHundred()).Round(0).Mul(udfs("0.04"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i <= b.N; i++ {
+		calc := AcquireFromUnitValue(unitValue)
+
+		percDiscVisitor := AcquirePercentualDiscount(percDiscount)
+		amountDiscVisitor := AcquireAmountDiscount(amountLineDiscount)
+		percTaxVisitor := AcquireUnbufferedPercTax(percTax)
+		amountTaxVisitor := AcquireUnbufferedAmountTax(amountLineTax)
+
+		calc.Receive(WithQTY(qty))
+		calc.Receive(percDiscVisitor)
+		calc.Receive(amountDiscVisitor)
+		calc.Receive(NamedSnapshot("net"))
+		calc.Receive(percTaxVisitor)
+		calc.Receive(amountTaxVisitor)
+
+		calc.Add(percTaxVisitor.Amount())
+		calc.Add(amountTaxVisitor.Amount())
+
+		ReleaseVisitor(percDiscVisitor)
+		ReleaseVisitor(amountDiscVisitor)
+		ReleaseVisitor(percTaxVisitor)
+		ReleaseVisitor(amountTaxVisitor)
+		ReleaseJohnny(calc)
+	}
+}
+
+func BenchmarkRulesFromUnitValue(b *testing.B) {
+	unitValue := udfs("1044.543103448276")
+	qty := udfs("35157")
+
+	// rules are immutable, so the pipeline is built once and shared by every calculation
+	pipeline := []Rule{
+		NewPercentualDiscountRule(udfs("10")),
+		NewAmountDiscountRule(udfs("100")),
+		NewUnbufferedPercTaxRule(udfs("16")).WithCode("IVA"),
+		NewUnbufferedAmountTaxRule(udfs("14.08")).WithCode("ENV"),
+	}
+
+	rc := NewRunContext()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i <= b.N; i++ {
+		calc := AcquireFromUnitValue(unitValue)
+		calc.Mul(qty)
+
+		for _, r := range pipeline {
+			r.Apply(calc, rc)
+		}
+
+		ReleaseJohnny(calc)
+		rc.Reset()
+	}
+}
+
+// benchmarkCLP calculates the lines and the total of a sale in Chilean pesos, whose amounts have no decimals.
+func benchmarkCLP(b *testing.B, newJohnny func(gyro.Gyro) Johnny) {
+	unitValues := []gyro.Gyro{udfs("1190"), udfs("25990"), udfs("350"), udfs("4490"), udfs("129990")}
+	qtys := []gyro.Gyro{udfs("3"), udfs("1"), udfs("12"), udfs("2"), udfs("1")}
+	discounts := []gyro.Gyro{udfs("70"), udfs("0"), udfs("200"), udfs("980"), udfs("9990")}
+	iva := udfs("1.19")
+	round := NewRound(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i <= b.N; i++ {
+		total := newJohnny(gyro.NewZero())
+		line := newJohnny(gyro.NewZero())
+
+		for j, unitValue := range unitValues {
+			line.Restore(unitValue)
+			line.Mul(qtys[j])
+			line.Sub(discounts[j])
+			line.Mul(iva)
+			line.Receive(round)
+			total.Add(line.Value())
+		}
+
+		_ = total.Value()
+	}
+}
+
+func BenchmarkCLPDefaultJohnny(b *testing.B) {
+	benchmarkCLP(b, func(v gyro.Gyro) Johnny { return &DefaultJohnny{v: v} })
+}
+
+func BenchmarkCLPIntJohnny(b *testing.B) {
+	benchmarkCLP(b, func(v gyro.Gyro) Johnny { return NewIntJohnny(v, 0) })
+}
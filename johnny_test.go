@@ -492,6 +492,28 @@ func TestAmountUndiscount(t *testing.T) {
 	}
 }
 
+// TestDivQuotientMagnitude is the regression test of gyro.Gyro.Div losing the magnitude of the quotient,
+// which gives 100 dividing 86250 by 0.8625.
+func TestDivQuotientMagnitude(t *testing.T) {
+	b := NewFromUnitValue(udfs("86250"))
+	b.Div(udfs("0.8625"))
+
+	if !b.Value().Equal(udfs("100000")) {
+		t.Errorf("got %s. Expected 100000", DecimalString(b.Value()))
+	}
+
+	b = NewFromUnitValue(udfs("86250"))
+	b.Receive(NewUnitValue(udfs("0.8625")))
+
+	if !b.Value().Equal(udfs("100000")) {
+		t.Errorf("got %s from the unit value visitor. Expected 100000", DecimalString(b.Value()))
+	}
+
+	if got := (GyroArithmetic{}).Div(udfs("86250"), udfs("0.8625")); !got.Equal(udfs("100000")) {
+		t.Errorf("got %s from GyroArithmetic. Expected 100000", DecimalString(got))
+	}
+}
+
 func TestHandlerFromUnitv(t *testing.T) {
 	for i, tc := range testCaseTaxHandlerFromUnitValue {
 		b, th, shouldFail, err := tc.tester()
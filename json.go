@@ -0,0 +1,1190 @@
+package johnny
+
+import (
+	"encoding/json"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// type discriminators used in the JSON representation of Johnny and visitors.
+const (
+	typeDefaultJohnny                = "default_johnny"
+	typeFromUnitValue                = "from_unit_value"
+	typeFromBrute                    = "from_brute"
+	typePercentualDiscount           = "percentual_discount"
+	typeAmountDiscount               = "amount_discount"
+	typePercentualUndiscount         = "percentual_undiscount"
+	typeAmountUndiscount             = "amount_undiscount"
+	typeQty                          = "qty"
+	typeUnitValue                    = "unit_value"
+	typePercTax                      = "perc_tax"
+	typeUnbufferedPercTax            = "unbuffered_perc_tax"
+	typeAmountTax                    = "amount_tax"
+	typeUnbufferedAmountTax          = "unbuffered_amount_tax"
+	typePercentualUntax              = "percentual_untax"
+	typeAmountUntax                  = "amount_untax"
+	typeRound                        = "round"
+	typeSnapshot                     = "snapshot"
+	typeNamedSnapshot                = "named_snapshot"
+	typeTaxHandlerFromUnitValue      = "tax_handler_from_unit_value"
+	typeDiscountHandlerFromUnitValue = "discount_handler_from_unit_value"
+	typePercWithholding              = "perc_withholding"
+	typeAmountWithholding            = "amount_withholding"
+	typePercentualUnwithholding      = "percentual_unwithholding"
+	typeAmountUnwithholding          = "amount_unwithholding"
+	typeWithholdingHandler           = "withholding_handler"
+	typeUnwithholdingHandler         = "unwithholding_handler"
+	typeSpecificTax                  = "specific_tax"
+	typeSpecificUntax                = "specific_untax"
+	typeTaxIncluded                  = "tax_included"
+)
+
+// jsonDecimal encodes a gyro.Gyro as a JSON string keeping its full precision.
+type jsonDecimal gyro.Gyro
+
+// MarshalJSON implements json.Marshaler.
+func (d jsonDecimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(DecimalString(gyro.Gyro(d)))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *jsonDecimal) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	g, err := ParseDecimal(s)
+
+	if err != nil {
+		return err
+	}
+
+	*d = jsonDecimal(g)
+	return nil
+}
+
+// orDecimal returns the value of d, or def when it's missing.
+func orDecimal(d *jsonDecimal, def jsonDecimal) gyro.Gyro {
+	if d == nil {
+		return gyro.Gyro(def)
+	}
+
+	return gyro.Gyro(*d)
+}
+
+// typeJSON is used to peek the type discriminator of an encoded value.
+type typeJSON struct {
+	Type string `json:"type"`
+}
+
+// checkType verifies that the decoded type discriminator matches the expected one.
+// An empty discriminator is accepted, so values encoded by hand can omit it.
+func checkType(got, expected string) error {
+	if got != "" && got != expected {
+		return NewJohnnyError("unexpected type " + got + ", expected " + expected)
+	}
+
+	return nil
+}
+
+type johnnyJSON struct {
+	Type      string              `json:"type,omitempty"`
+	Value     jsonDecimal         `json:"value"`
+	Snapshots []namedSnapshotJSON `json:"snapshots,omitempty"`
+}
+
+type namedSnapshotJSON struct {
+	Name  string      `json:"name"`
+	Value jsonDecimal `json:"value"`
+}
+
+type namedSnapshotVisitorJSON struct {
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+}
+
+type discountJSON struct {
+	Type   string      `json:"type,omitempty"`
+	Ratio  jsonDecimal `json:"ratio"`
+	Amount jsonDecimal `json:"amount"`
+}
+
+type taxJSON struct {
+	Type      string        `json:"type,omitempty"`
+	Ratio     jsonDecimal   `json:"ratio"`
+	Amount    jsonDecimal   `json:"amount"`
+	Taxable   jsonDecimal   `json:"taxable"`
+	Code      string        `json:"code,omitempty"`
+	Exemption ExemptionKind `json:"exemption,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+}
+
+type qtyJSON struct {
+	Type string      `json:"type,omitempty"`
+	Qty  jsonDecimal `json:"qty"`
+}
+
+type unitValueJSON struct {
+	Type      string      `json:"type,omitempty"`
+	Qty       jsonDecimal `json:"qty"`
+	UnitValue jsonDecimal `json:"unit_value"`
+}
+
+type roundJSON struct {
+	Type  string `json:"type,omitempty"`
+	Scale int32  `json:"scale"`
+}
+
+type snapshotJSON struct {
+	Type   string      `json:"type,omitempty"`
+	Buffer jsonDecimal `json:"buffer"`
+}
+
+type taxHandlerJSON struct {
+	Type string `json:"type,omitempty"`
+	// Ratio and Amount are the added taxes, the totals when missing.
+	Ratio       *jsonDecimal  `json:"ratio,omitempty"`
+	Amount      *jsonDecimal  `json:"amount,omitempty"`
+	TotalRatio  jsonDecimal   `json:"total_ratio"`
+	TotalAmount jsonDecimal   `json:"total_amount"`
+	Taxable     jsonDecimal   `json:"taxable"`
+	Exemption   ExemptionKind `json:"exemption,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+}
+
+type discountHandlerJSON struct {
+	Type string `json:"type,omitempty"`
+	// Ratio and Amount are the added discounts, the totals when missing.
+	Ratio        *jsonDecimal `json:"ratio,omitempty"`
+	Amount       *jsonDecimal `json:"amount,omitempty"`
+	TotalRatio   jsonDecimal  `json:"total_ratio"`
+	TotalAmount  jsonDecimal  `json:"total_amount"`
+	Discountable jsonDecimal  `json:"discountable"`
+}
+
+type specificTaxJSON struct {
+	Type       string        `json:"type,omitempty"`
+	Rate       jsonDecimal   `json:"rate"`
+	Conversion *jsonDecimal  `json:"conversion,omitempty"`
+	Step       *jsonDecimal  `json:"step,omitempty"`
+	Rounding   StepRounding  `json:"rounding,omitempty"`
+	Qty        *jsonDecimal  `json:"qty,omitempty"`
+	Code       string        `json:"code,omitempty"`
+	Exemption  ExemptionKind `json:"exemption,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+}
+
+type taxIncludedJSON struct {
+	Type  string            `json:"type,omitempty"`
+	Taxes []json.RawMessage `json:"taxes"`
+}
+
+type withholdingJSON struct {
+	Type   string      `json:"type,omitempty"`
+	Ratio  jsonDecimal `json:"ratio"`
+	Amount jsonDecimal `json:"amount"`
+	Base   jsonDecimal `json:"base"`
+	Code   string      `json:"code,omitempty"`
+}
+
+type withholdingHandlerJSON struct {
+	Type string `json:"type,omitempty"`
+	// Ratio and Amount are the added withholdings, the totals when missing.
+	Ratio       *jsonDecimal `json:"ratio,omitempty"`
+	Amount      *jsonDecimal `json:"amount,omitempty"`
+	TotalRatio  jsonDecimal  `json:"total_ratio"`
+	TotalAmount jsonDecimal  `json:"total_amount"`
+	Base        jsonDecimal  `json:"base"`
+}
+
+type unwithholdingHandlerJSON struct {
+	Type              string      `json:"type,omitempty"`
+	TaxRatio          jsonDecimal `json:"tax_ratio"`
+	WithholdingRatio  jsonDecimal `json:"withholding_ratio"`
+	WithholdingAmount jsonDecimal `json:"withholding_amount"`
+	Payable           jsonDecimal `json:"payable"`
+	Taxes             jsonDecimal `json:"taxes"`
+	Withholdings      jsonDecimal `json:"withholdings"`
+}
+
+func marshalJohnny(typ string, b *DefaultJohnny) ([]byte, error) {
+	j := johnnyJSON{Type: typ}
+
+	if b != nil {
+		j.Value = jsonDecimal(b.v)
+
+		if b.snapshots != nil {
+			for _, name := range b.snapshots.names {
+				j.Snapshots = append(j.Snapshots, namedSnapshotJSON{
+					Name:  name,
+					Value: jsonDecimal(b.snapshots.values[name]),
+				})
+			}
+		}
+	}
+
+	return json.Marshal(j)
+}
+
+func unmarshalJohnny(data []byte, typ string, b *DefaultJohnny) error {
+	var j johnnyJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	b.v = gyro.Gyro(j.Value)
+	b.snapshots = nil
+
+	for _, s := range j.Snapshots {
+		b.Snapshots().Set(s.Name, gyro.Gyro(s.Value))
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b *DefaultJohnny) MarshalJSON() ([]byte, error) {
+	return marshalJohnny(typeDefaultJohnny, b)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *DefaultJohnny) UnmarshalJSON(data []byte) error {
+	return unmarshalJohnny(data, typeDefaultJohnny, b)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f FromUnitValue) MarshalJSON() ([]byte, error) {
+	return marshalJohnny(typeFromUnitValue, f.DefaultJohnny)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *FromUnitValue) UnmarshalJSON(data []byte) error {
+	f.DefaultJohnny = &DefaultJohnny{}
+	return unmarshalJohnny(data, typeFromUnitValue, f.DefaultJohnny)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f FromBrute) MarshalJSON() ([]byte, error) {
+	return marshalJohnny(typeFromBrute, f.DefaultJohnny)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *FromBrute) UnmarshalJSON(data []byte) error {
+	f.DefaultJohnny = &DefaultJohnny{}
+	return unmarshalJohnny(data, typeFromBrute, f.DefaultJohnny)
+}
+
+// UnmarshalJohnny decodes a Johnny encoded by any of the built-in Johnny types,
+// choosing the concrete type from its type discriminator.
+func UnmarshalJohnny(data []byte) (Johnny, error) {
+	var t typeJSON
+
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	switch t.Type {
+	case typeDefaultJohnny:
+		j := &DefaultJohnny{}
+		return j, j.UnmarshalJSON(data)
+	case typeFromUnitValue:
+		j := FromUnitValue{}
+		err := j.UnmarshalJSON(data)
+		return j, err
+	case typeFromBrute:
+		j := FromBrute{}
+		err := j.UnmarshalJSON(data)
+		return j, err
+	}
+
+	return nil, NewJohnnyError("unknown johnny type " + t.Type)
+}
+
+func (d *Discount) toJSON(typ string) discountJSON {
+	return discountJSON{Type: typ, Ratio: jsonDecimal(d.ratio), Amount: jsonDecimal(d.amount)}
+}
+
+func (d *Discount) fromJSON(data []byte, typ string) error {
+	var j discountJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	d.ratio = gyro.Gyro(j.Ratio)
+	d.amount = gyro.Gyro(j.Amount)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Discount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.toJSON(""))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Discount) UnmarshalJSON(data []byte) error {
+	return d.fromJSON(data, "")
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pd *PercentualDiscount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pd.toJSON(typePercentualDiscount))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pd *PercentualDiscount) UnmarshalJSON(data []byte) error {
+	return pd.fromJSON(data, typePercentualDiscount)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pd *AmountDiscount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pd.toJSON(typeAmountDiscount))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pd *AmountDiscount) UnmarshalJSON(data []byte) error {
+	return pd.fromJSON(data, typeAmountDiscount)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (u *PercentualUndiscount) MarshalJSON() ([]byte, error) {
+	d := u.Discount
+
+	if d == nil {
+		d = &Discount{}
+	}
+
+	return json.Marshal(d.toJSON(typePercentualUndiscount))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *PercentualUndiscount) UnmarshalJSON(data []byte) error {
+	u.Discount = &Discount{}
+	return u.fromJSON(data, typePercentualUndiscount)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (u *AmountUndiscount) MarshalJSON() ([]byte, error) {
+	d := u.Discount
+
+	if d == nil {
+		d = &Discount{}
+	}
+
+	return json.Marshal(d.toJSON(typeAmountUndiscount))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *AmountUndiscount) UnmarshalJSON(data []byte) error {
+	u.Discount = &Discount{}
+	return u.fromJSON(data, typeAmountUndiscount)
+}
+
+func (pt *Tax) toJSON(typ string) taxJSON {
+	return taxJSON{
+		Type:      typ,
+		Ratio:     jsonDecimal(pt.ratio),
+		Amount:    jsonDecimal(pt.amount),
+		Taxable:   jsonDecimal(pt.taxable),
+		Code:      pt.code,
+		Exemption: pt.exemption,
+		Reason:    pt.reason,
+	}
+}
+
+func (pt *Tax) fromJSON(data []byte, typ string) error {
+	var j taxJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	pt.ratio = gyro.Gyro(j.Ratio)
+	pt.amount = gyro.Gyro(j.Amount)
+	pt.taxable = gyro.Gyro(j.Taxable)
+	pt.code = j.Code
+	pt.exemption, pt.reason = j.Exemption, j.Reason
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pt *Tax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.toJSON(""))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pt *Tax) UnmarshalJSON(data []byte) error {
+	return pt.fromJSON(data, "")
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pt *PercTax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.toJSON(typePercTax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pt *PercTax) UnmarshalJSON(data []byte) error {
+	return pt.fromJSON(data, typePercTax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pt *UnbufferedPercTax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.toJSON(typeUnbufferedPercTax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pt *UnbufferedPercTax) UnmarshalJSON(data []byte) error {
+	return pt.fromJSON(data, typeUnbufferedPercTax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pt *AmountTax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.toJSON(typeAmountTax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pt *AmountTax) UnmarshalJSON(data []byte) error {
+	return pt.fromJSON(data, typeAmountTax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pt *UnbufferedAmountTax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pt.toJSON(typeUnbufferedAmountTax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pt *UnbufferedAmountTax) UnmarshalJSON(data []byte) error {
+	return pt.fromJSON(data, typeUnbufferedAmountTax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pu *PercentualUntax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pu.toJSON(typePercentualUntax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pu *PercentualUntax) UnmarshalJSON(data []byte) error {
+	return pu.fromJSON(data, typePercentualUntax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pu *AmountUntax) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pu.toJSON(typeAmountUntax))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (pu *AmountUntax) UnmarshalJSON(data []byte) error {
+	return pu.fromJSON(data, typeAmountUntax)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (q Qty) MarshalJSON() ([]byte, error) {
+	return json.Marshal(qtyJSON{Type: typeQty, Qty: jsonDecimal(q.qty)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (q *Qty) UnmarshalJSON(data []byte) error {
+	var j qtyJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeQty); err != nil {
+		return err
+	}
+
+	q.qty = gyro.Gyro(j.Qty)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (q *UnitValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(unitValueJSON{
+		Type:      typeUnitValue,
+		Qty:       jsonDecimal(q.qty),
+		UnitValue: jsonDecimal(q.unitValue),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (q *UnitValue) UnmarshalJSON(data []byte) error {
+	var j unitValueJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeUnitValue); err != nil {
+		return err
+	}
+
+	q.qty = gyro.Gyro(j.Qty)
+	q.unitValue = gyro.Gyro(j.UnitValue)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Round) MarshalJSON() ([]byte, error) {
+	return json.Marshal(roundJSON{Type: typeRound, Scale: r.scale})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Round) UnmarshalJSON(data []byte) error {
+	var j roundJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeRound); err != nil {
+		return err
+	}
+
+	r.scale = j.Scale
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *SnapshotVisitor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(snapshotJSON{Type: typeSnapshot, Buffer: jsonDecimal(s.buffer)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *SnapshotVisitor) UnmarshalJSON(data []byte) error {
+	var j snapshotJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeSnapshot); err != nil {
+		return err
+	}
+
+	s.buffer = gyro.Gyro(j.Buffer)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (n NamedSnapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(namedSnapshotVisitorJSON{Type: typeNamedSnapshot, Name: string(n)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (n *NamedSnapshot) UnmarshalJSON(data []byte) error {
+	var j namedSnapshotVisitorJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeNamedSnapshot); err != nil {
+		return err
+	}
+
+	*n = NamedSnapshot(j.Name)
+	return nil
+}
+
+func (t *TaxHandler) toJSON(typ string) taxHandlerJSON {
+	return taxHandlerJSON{
+		Type:        typ,
+		Ratio:       (*jsonDecimal)(&t.ratio),
+		Amount:      (*jsonDecimal)(&t.amount),
+		TotalRatio:  jsonDecimal(t.totalRatio),
+		TotalAmount: jsonDecimal(t.totalAmount),
+		Taxable:     jsonDecimal(t.taxable),
+		Exemption:   t.exemption,
+		Reason:      t.reason,
+	}
+}
+
+func (t *TaxHandler) fromJSON(data []byte, typ string) error {
+	var j taxHandlerJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	t.totalRatio = gyro.Gyro(j.TotalRatio)
+	t.totalAmount = gyro.Gyro(j.TotalAmount)
+	t.ratio = orDecimal(j.Ratio, j.TotalRatio)
+	t.amount = orDecimal(j.Amount, j.TotalAmount)
+	t.taxable = gyro.Gyro(j.Taxable)
+	t.exemption, t.reason = j.Exemption, j.Reason
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *TaxHandler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.toJSON(""))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *TaxHandler) UnmarshalJSON(data []byte) error {
+	return t.fromJSON(data, "")
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *TaxHandlerFromUnitValue) MarshalJSON() ([]byte, error) {
+	h := t.TaxHandler
+
+	if h == nil {
+		h = NewTaxHandler()
+	}
+
+	return json.Marshal(h.toJSON(typeTaxHandlerFromUnitValue))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *TaxHandlerFromUnitValue) UnmarshalJSON(data []byte) error {
+	t.TaxHandler = NewTaxHandler()
+	return t.fromJSON(data, typeTaxHandlerFromUnitValue)
+}
+
+func (t *DiscountHandler) toJSON(typ string) discountHandlerJSON {
+	return discountHandlerJSON{
+		Type:         typ,
+		Ratio:        (*jsonDecimal)(&t.ratio),
+		Amount:       (*jsonDecimal)(&t.amount),
+		TotalRatio:   jsonDecimal(t.totalRatio),
+		TotalAmount:  jsonDecimal(t.totalAmount),
+		Discountable: jsonDecimal(t.discountable),
+	}
+}
+
+func (t *DiscountHandler) fromJSON(data []byte, typ string) error {
+	var j discountHandlerJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	t.totalRatio = gyro.Gyro(j.TotalRatio)
+	t.totalAmount = gyro.Gyro(j.TotalAmount)
+	t.ratio = orDecimal(j.Ratio, j.TotalRatio)
+	t.amount = orDecimal(j.Amount, j.TotalAmount)
+	t.discountable = gyro.Gyro(j.Discountable)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *DiscountHandler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.toJSON(""))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *DiscountHandler) UnmarshalJSON(data []byte) error {
+	return t.fromJSON(data, "")
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *DiscountHandlerFromUnitValue) MarshalJSON() ([]byte, error) {
+	h := t.DiscountHandler
+
+	if h == nil {
+		h = NewDiscountHandler()
+	}
+
+	return json.Marshal(h.toJSON(typeDiscountHandlerFromUnitValue))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *DiscountHandlerFromUnitValue) UnmarshalJSON(data []byte) error {
+	t.DiscountHandler = NewDiscountHandler()
+	return t.fromJSON(data, typeDiscountHandlerFromUnitValue)
+}
+
+func (w *Withholding) toJSON(typ string) withholdingJSON {
+	return withholdingJSON{
+		Type:   typ,
+		Ratio:  jsonDecimal(w.ratio),
+		Amount: jsonDecimal(w.amount),
+		Base:   jsonDecimal(w.base),
+		Code:   w.code,
+	}
+}
+
+func (w *Withholding) fromJSON(data []byte, typ string) error {
+	var j withholdingJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	w.ratio = gyro.Gyro(j.Ratio)
+	w.amount = gyro.Gyro(j.Amount)
+	w.base = gyro.Gyro(j.Base)
+	w.code = j.Code
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w *PercWithholding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.toJSON(typePercWithholding))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *PercWithholding) UnmarshalJSON(data []byte) error {
+	return w.fromJSON(data, typePercWithholding)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w *AmountWithholding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.toJSON(typeAmountWithholding))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *AmountWithholding) UnmarshalJSON(data []byte) error {
+	return w.fromJSON(data, typeAmountWithholding)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w *PercentualUnwithholding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.toJSON(typePercentualUnwithholding))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *PercentualUnwithholding) UnmarshalJSON(data []byte) error {
+	return w.fromJSON(data, typePercentualUnwithholding)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w *AmountUnwithholding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.toJSON(typeAmountUnwithholding))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *AmountUnwithholding) UnmarshalJSON(data []byte) error {
+	return w.fromJSON(data, typeAmountUnwithholding)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h *WithholdingHandler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withholdingHandlerJSON{
+		Type:        typeWithholdingHandler,
+		Ratio:       (*jsonDecimal)(&h.ratio),
+		Amount:      (*jsonDecimal)(&h.amount),
+		TotalRatio:  jsonDecimal(h.totalRatio),
+		TotalAmount: jsonDecimal(h.totalAmount),
+		Base:        jsonDecimal(h.base),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *WithholdingHandler) UnmarshalJSON(data []byte) error {
+	var j withholdingHandlerJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeWithholdingHandler); err != nil {
+		return err
+	}
+
+	h.totalRatio = gyro.Gyro(j.TotalRatio)
+	h.totalAmount = gyro.Gyro(j.TotalAmount)
+	h.ratio = orDecimal(j.Ratio, j.TotalRatio)
+	h.amount = orDecimal(j.Amount, j.TotalAmount)
+	h.base = gyro.Gyro(j.Base)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h *UnwithholdingHandler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(unwithholdingHandlerJSON{
+		Type:              typeUnwithholdingHandler,
+		TaxRatio:          jsonDecimal(h.taxRatio),
+		WithholdingRatio:  jsonDecimal(h.withholdingRatio),
+		WithholdingAmount: jsonDecimal(h.withholdingAmount),
+		Payable:           jsonDecimal(h.payable),
+		Taxes:             jsonDecimal(h.taxes),
+		Withholdings:      jsonDecimal(h.withholdings),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *UnwithholdingHandler) UnmarshalJSON(data []byte) error {
+	var j unwithholdingHandlerJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeUnwithholdingHandler); err != nil {
+		return err
+	}
+
+	h.taxRatio = gyro.Gyro(j.TaxRatio)
+	h.withholdingRatio = gyro.Gyro(j.WithholdingRatio)
+	h.withholdingAmount = gyro.Gyro(j.WithholdingAmount)
+	h.payable = gyro.Gyro(j.Payable)
+	h.taxes = gyro.Gyro(j.Taxes)
+	h.withholdings = gyro.Gyro(j.Withholdings)
+	return nil
+}
+
+// UnmarshalVisitor decodes a visitor encoded by any of the built-in visitors,
+// choosing the concrete type from its type discriminator.
+// The returned visitor has the same form returned by its constructor,
+// for example *PercTax for "perc_tax" and Round for "round".
+func UnmarshalVisitor(data []byte) (Visitor, error) {
+	var t typeJSON
+
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	var v interface {
+		Visitor
+		json.Unmarshaler
+	}
+
+	switch t.Type {
+	case typePercentualDiscount:
+		v = &PercentualDiscount{}
+	case typeAmountDiscount:
+		v = &AmountDiscount{}
+	case typePercentualUndiscount:
+		v = &PercentualUndiscount{}
+	case typeAmountUndiscount:
+		v = &AmountUndiscount{}
+	case typePercTax:
+		v = &PercTax{}
+	case typeUnbufferedPercTax:
+		v = &UnbufferedPercTax{}
+	case typeAmountTax:
+		v = &AmountTax{}
+	case typeUnbufferedAmountTax:
+		v = &UnbufferedAmountTax{}
+	case typePercentualUntax:
+		v = &PercentualUntax{}
+	case typeAmountUntax:
+		v = &AmountUntax{}
+	case typeUnitValue:
+		v = &UnitValue{}
+	case typeSnapshot:
+		v = &SnapshotVisitor{}
+	case typeTaxHandlerFromUnitValue:
+		v = &TaxHandlerFromUnitValue{}
+	case typeDiscountHandlerFromUnitValue:
+		v = &DiscountHandlerFromUnitValue{}
+	case typePercWithholding:
+		v = &PercWithholding{}
+	case typeAmountWithholding:
+		v = &AmountWithholding{}
+	case typePercentualUnwithholding:
+		v = &PercentualUnwithholding{}
+	case typeAmountUnwithholding:
+		v = &AmountUnwithholding{}
+	case typeWithholdingHandler:
+		v = &WithholdingHandler{}
+	case typeUnwithholdingHandler:
+		v = &UnwithholdingHandler{}
+	case typeQty:
+		q := Qty{}
+		err := q.UnmarshalJSON(data)
+		return q, err
+	case typeSpecificTax:
+		r := SpecificTaxRule{}
+		err := r.UnmarshalJSON(data)
+		return r, err
+	case typeSpecificUntax:
+		r := SpecificUntaxRule{}
+		err := r.UnmarshalJSON(data)
+		return r, err
+	case typeTaxIncluded:
+		r := TaxIncludedRule{}
+		err := r.UnmarshalJSON(data)
+		return r, err
+	case typeRound:
+		r := Round{}
+		err := r.UnmarshalJSON(data)
+		return r, err
+	case typeNamedSnapshot:
+		n := NamedSnapshot("")
+		err := n.UnmarshalJSON(data)
+		return n, err
+	default:
+		return nil, NewJohnnyError("unknown visitor type " + t.Type)
+	}
+
+	if err := v.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// UnmarshalVisitors decodes a JSON array of visitors, as produced by
+// json.Marshal over a []Visitor, keeping their order.
+func UnmarshalVisitors(data []byte) ([]Visitor, error) {
+	var raws []json.RawMessage
+
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+
+	visitors := make([]Visitor, 0, len(raws))
+
+	for _, raw := range raws {
+		v, err := UnmarshalVisitor(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		visitors = append(visitors, v)
+	}
+
+	return visitors, nil
+}
+
+// Rules are marshalled as their stateful counterparts without any outcome,
+// so UnmarshalVisitor decodes them as those, and their Rule method gets the rule back.
+
+// MarshalJSON implements json.Marshaler.
+func (r PercentualDiscountRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(discountJSON{Type: typePercentualDiscount, Ratio: jsonDecimal(r.ratio)})
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountDiscountRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(discountJSON{Type: typeAmountDiscount, Amount: jsonDecimal(r.amount)})
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PercentualUndiscountRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(discountJSON{Type: typePercentualUndiscount, Ratio: jsonDecimal(r.ratio)})
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountUndiscountRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(discountJSON{Type: typeAmountUndiscount, Amount: jsonDecimal(r.amount)})
+}
+
+func (t taxDef) toJSON(typ string) taxJSON {
+	return taxJSON{Type: typ, Ratio: jsonDecimal(t.ratio), Amount: jsonDecimal(t.amount), Code: t.code, Exemption: t.exemption, Reason: t.reason}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PercTaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typePercTax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r UnbufferedPercTaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeUnbufferedPercTax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountTaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeAmountTax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r UnbufferedAmountTaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeUnbufferedAmountTax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PercentualUntaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typePercentualUntax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountUntaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeAmountUntax))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r UnitValueRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(unitValueJSON{Type: typeUnitValue, Qty: jsonDecimal(r.qty)})
+}
+
+func (w withholdingDef) toJSON(typ string) withholdingJSON {
+	return withholdingJSON{Type: typ, Ratio: jsonDecimal(w.ratio), Amount: jsonDecimal(w.amount), Code: w.code}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PercWithholdingRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typePercWithholding))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountWithholdingRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeAmountWithholding))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PercentualUnwithholdingRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typePercentualUnwithholding))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r AmountUnwithholdingRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.toJSON(typeAmountUnwithholding))
+}
+
+// optionalDecimal returns g to be encoded by a field omitted when it's zero.
+func optionalDecimal(g gyro.Gyro) *jsonDecimal {
+	if g.Equal(gyro.NewZero()) {
+		return nil
+	}
+
+	d := jsonDecimal(g)
+	return &d
+}
+
+func (s specificDef) toJSON(typ string, def taxDef) specificTaxJSON {
+	j := specificTaxJSON{
+		Type:       typ,
+		Rate:       jsonDecimal(s.rate),
+		Conversion: optionalDecimal(s.factor),
+		Step:       optionalDecimal(s.step),
+		Rounding:   s.rounding,
+		Code:       def.code,
+		Exemption:  def.exemption,
+		Reason:     def.reason,
+	}
+
+	if s.hasQty {
+		qty := jsonDecimal(s.qty)
+		j.Qty = &qty
+	}
+
+	return j
+}
+
+func (s *specificDef) fromJSON(data []byte, typ string, def *taxDef) error {
+	var j specificTaxJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typ); err != nil {
+		return err
+	}
+
+	*s = specificDef{rate: gyro.Gyro(j.Rate), rounding: j.Rounding}
+	*def = taxDef{code: j.Code, exemption: j.Exemption, reason: j.Reason}
+
+	if j.Conversion != nil {
+		s.factor = gyro.Gyro(*j.Conversion)
+	}
+
+	if j.Step != nil {
+		s.step = gyro.Gyro(*j.Step)
+	}
+
+	if j.Qty != nil {
+		s.qty, s.hasQty = gyro.Gyro(*j.Qty), true
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r SpecificTaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.specific.toJSON(typeSpecificTax, r.taxDef))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *SpecificTaxRule) UnmarshalJSON(data []byte) error {
+	return r.specific.fromJSON(data, typeSpecificTax, &r.taxDef)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r SpecificUntaxRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.specific.toJSON(typeSpecificUntax, r.taxDef))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *SpecificUntaxRule) UnmarshalJSON(data []byte) error {
+	return r.specific.fromJSON(data, typeSpecificUntax, &r.taxDef)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r TaxIncludedRule) MarshalJSON() ([]byte, error) {
+	j := taxIncludedJSON{Type: typeTaxIncluded, Taxes: make([]json.RawMessage, 0, len(r.taxes))}
+
+	for _, t := range r.taxes {
+		data, err := json.Marshal(t)
+
+		if err != nil {
+			return nil, err
+		}
+
+		j.Taxes = append(j.Taxes, data)
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Taxes are decoded with [UnmarshalVisitor], so the rules of a [RateTable] can't be decoded.
+func (r *TaxIncludedRule) UnmarshalJSON(data []byte) error {
+	var j taxIncludedJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if err := checkType(j.Type, typeTaxIncluded); err != nil {
+		return err
+	}
+
+	r.taxes = nil
+
+	for _, raw := range j.Taxes {
+		v, err := UnmarshalVisitor(raw)
+
+		if err != nil {
+			return err
+		}
+
+		rules, ok, err := includedTaxes(v)
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return NewJohnnyError("tax-included rules only hold taxes")
+		}
+
+		r.taxes = append(r.taxes, rules...)
+	}
+
+	return nil
+}
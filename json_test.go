@@ -0,0 +1,226 @@
+package johnny
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/gyro/i128"
+)
+
+func TestDecimalString(t *testing.T) {
+	testCases := []struct {
+		entry    gyro.Gyro
+		expected string
+	}{
+		{entry: udfs("1.05"), expected: "1.05"},
+		{entry: udfs("-0.5"), expected: "-0.5"},
+		{entry: udfs("-1.05"), expected: "-1.05"},
+		{entry: udfs("0.0001"), expected: "0.0001"},
+		{entry: udfs("1.50"), expected: "1.50"},
+		{entry: udfs("-3"), expected: "-3"},
+		{entry: udfs("111111111111111100000.123001"), expected: "111111111111111100000.123001"},
+		{entry: udfs("1619.1").Div(udfs("1.16")), expected: "1395.775862068965518"},
+		{entry: gyro.Gyro{}, expected: "0"},
+	}
+
+	for i, tc := range testCases {
+		got := DecimalString(tc.entry)
+
+		if got != tc.expected {
+			t.Errorf("[test case %d] got %s. Expected %s", i, got, tc.expected)
+		}
+
+		back, err := ParseDecimal(got)
+
+		if err != nil {
+			t.Errorf("[test case %d] %v", i, err)
+			continue
+		}
+
+		if !back.Equal(tc.entry) {
+			t.Errorf("[test case %d] round trip got %v. Expected %v", i, DecimalString(back), tc.expected)
+		}
+	}
+}
+
+// TestGyroLayout fails when gyro changes the unexported fields gyroParts reads through reflection.
+func TestGyroLayout(t *testing.T) {
+	g := reflect.TypeOf(gyro.Gyro{})
+
+	if f, ok := g.FieldByName("exp"); !ok || f.Type.Kind() != reflect.Int32 {
+		t.Fatalf("gyro.Gyro has no int32 exp field, gyroParts must be updated")
+	}
+
+	c, ok := g.FieldByName("coeff")
+
+	if !ok || c.Type.Kind() != reflect.Struct {
+		t.Fatalf("gyro.Gyro has no coeff struct field, gyroParts must be updated")
+	}
+
+	for _, name := range []string{"hi", "lo"} {
+		if f, ok := c.Type.FieldByName(name); !ok || f.Type.Kind() != reflect.Uint64 {
+			t.Fatalf("the coeff of gyro.Gyro has no uint64 %s field, gyroParts must be updated", name)
+		}
+	}
+
+	testCases := []struct {
+		coeff    string
+		exp      int32
+		expected string
+	}{
+		{coeff: "170141183460469231731687303715884105727", exp: -gyro.MaxScale, expected: "17014118346046923173168.7303715884105727"},
+		{coeff: "-170141183460469231731687303715884105728", exp: -gyro.MaxScale, expected: "-17014118346046923173168.7303715884105728"},
+		{coeff: "170141183460469231731687303715884105727", exp: 0, expected: "170141183460469231731687303715884105727"},
+		{coeff: "-1", exp: -gyro.MaxScale, expected: "-0.0000000000000001"},
+	}
+
+	for i, tc := range testCases {
+		coeff, exp := gyroParts(gyro.New(i128.MustI128FromString(tc.coeff), tc.exp))
+
+		if coeff.String() != tc.coeff || exp != tc.exp {
+			t.Errorf("[test case %d] got %v, %d. Expected %s, %d", i, coeff, exp, tc.coeff, tc.exp)
+		}
+
+		if got := DecimalString(gyroFromParts(coeff, exp)); got != tc.expected {
+			t.Errorf("[test case %d] got %s. Expected %s", i, got, tc.expected)
+		}
+	}
+
+	if coeff, _ := gyroParts(udfs("-0.5")); coeff.Cmp(big.NewInt(-5)) != 0 {
+		t.Errorf("got coefficient %v. Expected -5", coeff)
+	}
+}
+
+func TestVisitorsJSONRoundTrip(t *testing.T) {
+	b := NewFromUnitValue(udfs("1044.543103448276"))
+
+	pd := NewPercentualDiscount(udfs("10"))
+	ad := NewAmountDiscount(udfs("100"))
+	th := NewTaxHandlerFromUnitValue()
+	th.WithPercentualTax(udfs("16"))
+	dh := NewDiscHandlerFromUnitValue()
+	dh.WithPercentualDiscount(udfs("1.05"))
+	snap := NewSnapshot()
+
+	visitors := []Visitor{
+		WithQTY(udfs("35157")),
+		pd,
+		ad,
+		dh,
+		snap,
+		NewUnbufferedPercTax(udfs("16")),
+		NewUnbufferedAmountTax(udfs("14.08")),
+		th,
+		NewRound(6),
+		NewUnitValue(udfs("3")),
+	}
+
+	for _, v := range visitors {
+		b.Receive(v)
+	}
+
+	visitors = append(visitors,
+		NewPercTax(udfs("19")),
+		NewAmountTax(udfs("-0.5")),
+		NewPercentualUnTax(udfs("19")),
+		NewAmountUnTax(udfs("0.5")),
+		NewPercentualUnDiscount(udfs("10")),
+		NewAmountUnDiscount(udfs("100")),
+	)
+
+	data, err := json.Marshal(visitors)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := UnmarshalVisitors(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != len(visitors) {
+		t.Fatalf("got %d visitors. Expected %d", len(decoded), len(visitors))
+	}
+
+	again, err := json.Marshal(decoded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(again) != string(data) {
+		t.Fatalf("round trip mismatch.\ngot      %s\nexpected %s", again, data)
+	}
+
+	if got := decoded[1].(*PercentualDiscount); !got.Amount().Equal(pd.Amount()) {
+		t.Errorf("got discount amount %v. Expected %v", got.Amount(), pd.Amount())
+	}
+
+	if got := decoded[7].(*TaxHandlerFromUnitValue); !got.TotalAmount().Equal(th.TotalAmount()) {
+		t.Errorf("got tax handler amount %v. Expected %v", got.TotalAmount(), th.TotalAmount())
+	}
+
+	// the decoded handler keeps the added taxes, which its reset restores
+	decodedHandler := decoded[7].(*TaxHandlerFromUnitValue)
+	decodedHandler.Reset()
+
+	if !decodedHandler.TotalRatio().Equal(udfs("16")) {
+		t.Errorf("got tax handler ratio %v after reset. Expected 16", decodedHandler.TotalRatio())
+	}
+
+	if got := decoded[4].(*SnapshotVisitor); !got.Get().Equal(snap.Get()) {
+		t.Errorf("got snapshot %v. Expected %v", got.Get(), snap.Get())
+	}
+}
+
+func TestJohnnyJSONRoundTrip(t *testing.T) {
+	testCases := []Johnny{
+		&DefaultJohnny{v: udfs("-0.05")},
+		NewFromUnitValue(udfs("1044.543103448276")),
+		NewFromBrute(udfs("1619.1")),
+	}
+
+	for i, tc := range testCases {
+		data, err := json.Marshal(tc)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		got, err := UnmarshalJohnny(data)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !got.Value().Equal(tc.Value()) {
+			t.Errorf("[test case %d] got %v. Expected %v", i, got.Value(), tc.Value())
+		}
+	}
+}
+
+func TestUnmarshalVisitorErrors(t *testing.T) {
+	testCases := []string{
+		`{"type":"unknown"}`,
+		`{"type":"perc_tax","ratio":"abc"}`,
+		`{"type":"perc_tax","ratio":16}`,
+		`[]`,
+	}
+
+	for i, tc := range testCases {
+		if _, err := UnmarshalVisitor([]byte(tc)); err == nil {
+			t.Errorf("[test case %d] error expected decoding %s", i, tc)
+		}
+	}
+
+	pt := &PercTax{}
+
+	if err := json.Unmarshal([]byte(`{"type":"amount_tax","ratio":"16"}`), pt); err == nil {
+		t.Errorf("error expected decoding a visitor with a mismatched type")
+	}
+}
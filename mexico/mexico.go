@@ -0,0 +1,441 @@
+// Package mexico calculates the concepts of a CFDI 4.0, the electronic invoice of Mexico, with the johnny
+// package, giving for each concept its transferred (traslados) and withheld (retenciones) taxes with their
+// bases, factor types and rates, as the concept layout of the CFDI requires.
+//
+// Amounts are rounded to the given number of decimals, up to six as the CFDI allows, and can be validated
+// against the tolerance rules of the SAT (Servicio de Administración Tributaria).
+package mexico
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// MaxDecimals is the maximum number of decimals of the amounts of a concept.
+const MaxDecimals = 6
+
+// Codes of the taxes, as the c_Impuesto catalog of the SAT.
+const (
+	ISR  = "001"
+	IVA  = "002"
+	IEPS = "003"
+)
+
+// Factor is the factor type of a tax (TipoFactor).
+type Factor string
+
+const (
+	// Rate is a tax calculated as a rate over the base (Tasa).
+	Rate Factor = "Tasa"
+	// Quota is a tax calculated as an amount per unit of the quantity (Cuota).
+	Quota Factor = "Cuota"
+	// Exempt is a tax the concept is exempted from (Exento), which has base but no amount.
+	Exempt Factor = "Exento"
+)
+
+// Object tells whether a concept is subject to taxes (ObjetoImp), as the c_ObjetoImp catalog of the SAT.
+type Object string
+
+const (
+	// NotObject is a concept not subject to taxes.
+	NotObject Object = "01"
+	// Subject is a concept subject to taxes, which are itemized.
+	Subject Object = "02"
+	// SubjectNotItemized is a concept subject to taxes which are not required to be itemized.
+	SubjectNotItemized Object = "03"
+	// SubjectNotCaused is a concept subject to taxes which don't cause any.
+	SubjectNotCaused Object = "04"
+)
+
+// Tax is the definition of a transferred or withheld tax of a concept.
+type Tax struct {
+	// Code is the tax (Impuesto), as IVA.
+	Code string
+	// Factor is the factor type of the tax (TipoFactor).
+	Factor Factor
+	// Rate is the rate of the tax as a fraction, as 0.16, or its amount per unit when Factor is Quota (TasaOCuota).
+	Rate gyro.Gyro
+}
+
+// Common taxes of the CFDI.
+var (
+	IVA16       = Tax{Code: IVA, Factor: Rate, Rate: rate("0.160000")}
+	IVA8        = Tax{Code: IVA, Factor: Rate, Rate: rate("0.080000")}
+	IVA0        = Tax{Code: IVA, Factor: Rate, Rate: rate("0.000000")}
+	IVAExempt   = Tax{Code: IVA, Factor: Exempt}
+	IVAWithheld = Tax{Code: IVA, Factor: Rate, Rate: rate("0.106667")}
+	ISRWithheld = Tax{Code: ISR, Factor: Rate, Rate: rate("0.100000")}
+)
+
+func rate(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+// Concept is a line of a CFDI (Concepto).
+type Concept struct {
+	// Qty is the quantity of the concept (Cantidad).
+	Qty gyro.Gyro
+	// UnitValue is the unit value of the concept (ValorUnitario).
+	UnitValue gyro.Gyro
+	// Discount is the discount amount of the concept (Descuento).
+	Discount gyro.Gyro
+	// Object tells whether the concept is subject to taxes (ObjetoImp), Subject when empty.
+	Object Object
+	// Transfers holds the transferred taxes of the concept (Traslados).
+	Transfers []Tax
+	// Withholdings holds the withheld taxes of the concept (Retenciones).
+	Withholdings []Tax
+}
+
+// object returns the object of the concept, Subject when not given.
+func (c Concept) object() Object {
+	if c.Object == "" {
+		return Subject
+	}
+
+	return c.Object
+}
+
+// Pipeline returns the Johnny and the visitors calculating the concept. The quantity is applied over the unit
+// value and the discount is subtracted, giving the base of the taxes. Withholdings are calculated over the base,
+// and transfers are added to it, the IVA ones last, so IVA is calculated over the base plus IEPS.
+//
+// An error is returned if the concept has taxes and is not Subject to them, or when it is and it has none,
+// or a tax is given twice.
+func (c Concept) Pipeline() (johnny.Johnny, []johnny.Visitor, error) {
+	hasTaxes := len(c.Transfers) > 0 || len(c.Withholdings) > 0
+
+	if c.object() != Subject && hasTaxes {
+		return nil, nil, johnny.NewJohnnyError(fmt.Sprintf("concepts of object %s can't have taxes", c.object()))
+	}
+
+	if c.object() == Subject && !hasTaxes {
+		return nil, nil, johnny.NewJohnnyError("concepts subject to taxes must have taxes")
+	}
+
+	visitors := []johnny.Visitor{johnny.WithQTY(c.Qty)}
+
+	if !c.Discount.Equal(gyro.NewZero()) {
+		visitors = append(visitors, johnny.NewAmountDiscountRule(c.Discount))
+	}
+
+	if err := unique(c.Withholdings); err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range c.Withholdings {
+		v, err := withholding(t)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		visitors = append(visitors, v)
+	}
+
+	if err := unique(c.Transfers); err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range transferOrder(c.Transfers) {
+		v, err := transfer(t)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		visitors = append(visitors, v)
+	}
+
+	return johnny.NewFromUnitValue(c.UnitValue), visitors, nil
+}
+
+// unique returns an error if a tax code is given twice.
+func unique(taxes []Tax) error {
+	seen := map[string]bool{}
+
+	for _, t := range taxes {
+		if seen[t.Code] {
+			return johnny.NewJohnnyError("tax " + t.Code + " given twice")
+		}
+
+		seen[t.Code] = true
+	}
+
+	return nil
+}
+
+// transferOrder returns the transfers with the IVA ones last.
+func transferOrder(taxes []Tax) []Tax {
+	ordered := make([]Tax, 0, len(taxes))
+
+	for _, t := range taxes {
+		if t.Code != IVA {
+			ordered = append(ordered, t)
+		}
+	}
+
+	for _, t := range taxes {
+		if t.Code == IVA {
+			ordered = append(ordered, t)
+		}
+	}
+
+	return ordered
+}
+
+// percent returns a rate as a percentual ratio.
+func percent(rate gyro.Gyro) gyro.Gyro {
+	return rate.Mul(gyro.NewHundred())
+}
+
+func transfer(t Tax) (johnny.Visitor, error) {
+	switch t.Factor {
+	case Rate:
+		return johnny.NewPercTaxRule(percent(t.Rate)).WithCode(t.Code), nil
+	case Quota:
+		return johnny.NewSpecificTaxRule(t.Rate).WithCode(t.Code), nil
+	case Exempt:
+		return johnny.NewPercTaxRule(gyro.Gyro{}).WithCode(t.Code).WithExemption(johnny.Exempt, ""), nil
+	}
+
+	return nil, johnny.NewJohnnyError("unknown factor type " + string(t.Factor))
+}
+
+func withholding(t Tax) (johnny.Visitor, error) {
+	if t.Factor != Rate {
+		return nil, johnny.NewJohnnyError("withholdings must be of factor type " + string(Rate))
+	}
+
+	return johnny.NewPercWithholdingRule(percent(t.Rate)).WithCode(t.Code), nil
+}
+
+// TaxLine is a transferred or withheld tax of a calculated concept (Traslado or Retencion).
+type TaxLine struct {
+	Tax
+	// Base is the value the tax is calculated over, or the quantity when Factor is Quota.
+	Base gyro.Gyro
+	// Amount is the amount of the tax (Importe), zero when Factor is Exempt.
+	Amount gyro.Gyro
+}
+
+// Line is a calculated concept, with the amounts rounded to Decimals.
+type Line struct {
+	// Concept is the calculated concept.
+	Concept Concept
+	// Decimals is the number of decimals the amounts are rounded to.
+	Decimals int32
+	// Amount is the quantity times the unit value (Importe).
+	Amount gyro.Gyro
+	// Transfers holds the transferred taxes in the order they were calculated, the IVA ones last (Traslados).
+	Transfers []TaxLine
+	// Withholdings holds the withheld taxes, in the order of the concept (Retenciones).
+	Withholdings []TaxLine
+	// Result is the outcome of the pipeline of the concept.
+	Result johnny.Result
+}
+
+// Calculate calculates the concept with its [Concept.Pipeline], rounding the amounts to the given decimals.
+// An error is returned if decimals is not between 0 and [MaxDecimals], or the pipeline can't be built.
+func (c Concept) Calculate(decimals int32) (Line, error) {
+	if decimals < 0 || decimals > MaxDecimals {
+		return Line{}, johnny.NewJohnnyError(fmt.Sprintf("decimals must be between 0 and %d", MaxDecimals))
+	}
+
+	b, visitors, err := c.Pipeline()
+
+	if err != nil {
+		return Line{}, err
+	}
+
+	r, err := johnny.Run(b, visitors...)
+
+	if err != nil {
+		return Line{}, err
+	}
+
+	l := Line{
+		Concept:  c,
+		Decimals: decimals,
+		Amount:   c.Qty.Mul(c.UnitValue).Round(decimals),
+		Result:   r,
+	}
+
+	// each tax is a step of the pipeline, found by its position
+	steps := r.Steps[len(visitors)-len(c.Withholdings)-len(c.Transfers):]
+
+	for i, t := range c.Withholdings {
+		l.Withholdings = append(l.Withholdings, TaxLine{
+			Tax:    t,
+			Base:   steps[i].Before.Round(decimals),
+			Amount: r.WithholdingsByCode[t.Code].Round(decimals),
+		})
+	}
+
+	steps = steps[len(c.Withholdings):]
+
+	for i, t := range transferOrder(c.Transfers) {
+		tl := TaxLine{Tax: t, Base: steps[i].Before.Round(decimals), Amount: r.TaxesByCode[t.Code].Round(decimals)}
+
+		if t.Factor == Quota {
+			tl.Base = c.Qty
+		}
+
+		l.Transfers = append(l.Transfers, tl)
+	}
+
+	return l, nil
+}
+
+// Validate checks the amounts of the line against the tolerance rules of the SAT. The amount of the concept
+// must be between the products of its quantity and unit value decreased and increased by half a unit of
+// their last decimal, and the amount of each tax between the products of its base, decreased and increased
+// the same way, and its rate, truncated and rounded up to the decimals of the line.
+func (l Line) Validate() error {
+	q, v := johnny.GyroToRat(l.Concept.Qty), johnny.GyroToRat(l.Concept.UnitValue)
+	hq, hv := half(l.Concept.Qty), half(l.Concept.UnitValue)
+
+	lower := new(big.Rat).Mul(new(big.Rat).Sub(q, hq), new(big.Rat).Sub(v, hv))
+	upper := new(big.Rat).Mul(new(big.Rat).Add(q, hq), new(big.Rat).Add(v, hv))
+
+	if !within(l.Amount, lower, upper, l.Decimals) {
+		return johnny.NewJohnnyError("amount " + johnny.DecimalString(l.Amount) + " is out of the tolerance of the concept")
+	}
+
+	for _, t := range append(append([]TaxLine(nil), l.Transfers...), l.Withholdings...) {
+		if t.Factor == Exempt {
+			continue
+		}
+
+		base, h, r := johnny.GyroToRat(t.Base), half(t.Base), johnny.GyroToRat(t.Rate)
+		lower := new(big.Rat).Mul(new(big.Rat).Sub(base, h), r)
+		upper := new(big.Rat).Mul(new(big.Rat).Add(base, h), r)
+
+		if !within(t.Amount, lower, upper, l.Decimals) {
+			return johnny.NewJohnnyError("amount " + johnny.DecimalString(t.Amount) + " of tax " + t.Code + " is out of tolerance")
+		}
+	}
+
+	return nil
+}
+
+// half returns half a unit of the last decimal of g.
+func half(g gyro.Gyro) *big.Rat {
+	decimals := 0
+
+	if s := johnny.DecimalString(g); len(s) > 0 {
+		for i := len(s) - 1; i >= 0; i-- {
+			if s[i] == '.' {
+				decimals = len(s) - 1 - i
+				break
+			}
+		}
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(big.NewInt(1), unit.Mul(unit, big.NewInt(2)))
+}
+
+// within tells whether amount is between lower truncated and upper rounded up to the given decimals.
+func within(amount gyro.Gyro, lower, upper *big.Rat, decimals int32) bool {
+	a := johnny.GyroToRat(amount)
+	return a.Cmp(scaled(lower, decimals, false)) >= 0 && a.Cmp(scaled(upper, decimals, true)) <= 0
+}
+
+// scaled returns r truncated, or rounded up when up is set, to the given decimals.
+func scaled(r *big.Rat, decimals int32, up bool) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	x := new(big.Rat).Mul(r, new(big.Rat).SetInt(unit))
+
+	n, rem := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+
+	if up && rem.Sign() > 0 {
+		n.Add(n, big.NewInt(1))
+	}
+
+	return new(big.Rat).SetFrac(n, unit)
+}
+
+// TaxTotal is the total of the taxes of a document with the same code, factor type and rate.
+type TaxTotal struct {
+	Tax
+	Base   gyro.Gyro
+	Amount gyro.Gyro
+}
+
+// Totals are the totals of a CFDI, rounded to the decimals of its currency.
+type Totals struct {
+	// Subtotal is the sum of the amounts of the concepts (SubTotal).
+	Subtotal gyro.Gyro
+	// Discount is the sum of the discounts of the concepts (Descuento).
+	Discount gyro.Gyro
+	// Transfers holds the totals of the transferred taxes, in order of appearance (Traslados).
+	Transfers []TaxTotal
+	// Withholdings holds the totals of the withheld taxes, by code in order of appearance (Retenciones).
+	Withholdings []TaxTotal
+	// Transferred is the total of the transferred taxes (TotalImpuestosTrasladados).
+	Transferred gyro.Gyro
+	// Withheld is the total of the withheld taxes (TotalImpuestosRetenidos).
+	Withheld gyro.Gyro
+	// Total is the subtotal minus the discount plus the transferred taxes minus the withheld ones.
+	Total gyro.Gyro
+}
+
+// Totalize returns the totals of a CFDI from its calculated lines, rounded to the decimals of its currency,
+// as 2 for MXN. Transfers are grouped by code, factor type and rate, and withholdings by code, summing the
+// rounded amounts of the lines.
+func Totalize(decimals int32, lines ...Line) Totals {
+	t := Totals{}
+
+	for _, l := range lines {
+		t.Subtotal = t.Subtotal.Add(l.Amount)
+		t.Discount = t.Discount.Add(l.Concept.Discount)
+
+		for _, tl := range l.Transfers {
+			t.Transfers = addTotal(t.Transfers, tl, func(tt TaxTotal) bool {
+				return tt.Code == tl.Code && tt.Factor == tl.Factor && tt.Rate.Equal(tl.Rate)
+			})
+		}
+
+		for _, tl := range l.Withholdings {
+			t.Withholdings = addTotal(t.Withholdings, tl, func(tt TaxTotal) bool {
+				return tt.Code == tl.Code
+			})
+		}
+	}
+
+	for i := range t.Transfers {
+		t.Transfers[i].Base = t.Transfers[i].Base.Round(decimals)
+		t.Transfers[i].Amount = t.Transfers[i].Amount.Round(decimals)
+		t.Transferred = t.Transferred.Add(t.Transfers[i].Amount)
+	}
+
+	for i := range t.Withholdings {
+		t.Withholdings[i].Base = t.Withholdings[i].Base.Round(decimals)
+		t.Withholdings[i].Amount = t.Withholdings[i].Amount.Round(decimals)
+		t.Withheld = t.Withheld.Add(t.Withholdings[i].Amount)
+	}
+
+	t.Subtotal = t.Subtotal.Round(decimals)
+	t.Discount = t.Discount.Round(decimals)
+	t.Total = t.Subtotal.Sub(t.Discount).Add(t.Transferred).Sub(t.Withheld)
+
+	return t
+}
+
+// addTotal adds tl to the total it belongs to, appending a new one when there is none.
+func addTotal(totals []TaxTotal, tl TaxLine, belongs func(TaxTotal) bool) []TaxTotal {
+	for i, tt := range totals {
+		if belongs(tt) {
+			totals[i].Base = tt.Base.Add(tl.Base)
+			totals[i].Amount = tt.Amount.Add(tl.Amount)
+			return totals
+		}
+	}
+
+	return append(totals, TaxTotal{Tax: tl.Tax, Base: tl.Base, Amount: tl.Amount})
+}
@@ -0,0 +1,155 @@
+package mexico
+
+import (
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func TestCalculate(t *testing.T) {
+	testCases := []struct {
+		concept      Concept
+		amount       string
+		transfers    []string
+		withholdings []string
+	}{
+		{Concept{Qty: udfs("1"), UnitValue: udfs("1000"), Transfers: []Tax{IVA16}}, "1000", []string{"1000", "160"}, nil},
+		// professional fees withholding ISR and two thirds of IVA
+		{Concept{Qty: udfs("1"), UnitValue: udfs("10000"), Transfers: []Tax{IVA16}, Withholdings: []Tax{ISRWithheld, IVAWithheld}}, "10000", []string{"10000", "1600"}, []string{"10000", "1000", "10000", "1066.67"}},
+		// IVA is calculated over the base plus IEPS, whatever the order they are given
+		{Concept{Qty: udfs("10"), UnitValue: udfs("25.5"), Transfers: []Tax{IVA16, {Code: IEPS, Factor: Rate, Rate: udfs("0.08")}}}, "255", []string{"255", "20.4", "275.4", "44.064"}, nil},
+		{Concept{Qty: udfs("3"), UnitValue: udfs("18"), Transfers: []Tax{{Code: IEPS, Factor: Quota, Rate: udfs("1.6451")}, IVA16}}, "54", []string{"3", "4.9353", "58.9353", "9.429648"}, nil},
+		{Concept{Qty: udfs("2"), UnitValue: udfs("150"), Discount: udfs("30"), Transfers: []Tax{IVAExempt}}, "300", []string{"270", "0"}, nil},
+		// amounts are rounded to six decimals
+		{Concept{Qty: udfs("3"), UnitValue: udfs("33.3333333"), Transfers: []Tax{IVA16}}, "100", []string{"100", "16"}, nil},
+		{Concept{Qty: udfs("1"), UnitValue: udfs("500"), Object: NotObject}, "500", nil, nil},
+	}
+
+	for i, tc := range testCases {
+		l, err := tc.concept.Calculate(MaxDecimals)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !l.Amount.Equal(udfs(tc.amount)) {
+			t.Errorf("[test case %d] got amount %v. Expected %v", i, l.Amount, tc.amount)
+		}
+
+		checkTaxLines(t, i, l.Transfers, tc.transfers)
+		checkTaxLines(t, i, l.Withholdings, tc.withholdings)
+
+		if err := l.Validate(); err != nil {
+			t.Errorf("[test case %d] %v", i, err)
+		}
+	}
+}
+
+// checkTaxLines checks the base and amount of each tax line, given in pairs.
+func checkTaxLines(t *testing.T, i int, got []TaxLine, expected []string) {
+	if len(got)*2 != len(expected) {
+		t.Errorf("[test case %d] got %d taxes. Expected %d", i, len(got), len(expected)/2)
+		return
+	}
+
+	for j, tl := range got {
+		if !tl.Base.Equal(udfs(expected[2*j])) || !tl.Amount.Equal(udfs(expected[2*j+1])) {
+			t.Errorf("[test case %d] got base %v and amount %v of tax %s. Expected %v and %v", i, tl.Base, tl.Amount, tl.Code, expected[2*j], expected[2*j+1])
+		}
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	testCases := []Concept{
+		{Qty: udfs("1"), UnitValue: udfs("100")},
+		{Qty: udfs("1"), UnitValue: udfs("100"), Object: SubjectNotCaused, Transfers: []Tax{IVA16}},
+		{Qty: udfs("1"), UnitValue: udfs("100"), Transfers: []Tax{IVA16, IVA8}},
+		{Qty: udfs("1"), UnitValue: udfs("100"), Transfers: []Tax{{Code: IVA, Factor: "Tasa0"}}},
+		{Qty: udfs("1"), UnitValue: udfs("100"), Transfers: []Tax{IVA16}, Withholdings: []Tax{{Code: ISR, Factor: Exempt}}},
+	}
+
+	for i, c := range testCases {
+		if _, err := c.Calculate(MaxDecimals); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+
+	if _, err := (Concept{Qty: udfs("1"), UnitValue: udfs("1"), Transfers: []Tax{IVA16}}).Calculate(7); err == nil {
+		t.Errorf("error expected with more than %d decimals", MaxDecimals)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	l, err := Concept{Qty: udfs("3"), UnitValue: udfs("33.33"), Transfers: []Tax{IVA16}}.Calculate(2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 99.99 at 16% is 15.9984, so 15.99 and 16.00 are both within tolerance
+	for _, amount := range []string{"15.99", "16"} {
+		l.Transfers[0].Amount = udfs(amount)
+
+		if err := l.Validate(); err != nil {
+			t.Errorf("got %v with amount %s", err, amount)
+		}
+	}
+
+	l.Transfers[0].Amount = udfs("16.02")
+
+	if err := l.Validate(); err == nil {
+		t.Errorf("error expected with a tax amount out of tolerance")
+	}
+
+	// the quantity has no decimals, so it may be off by half a unit: 3.5 x 33.335 is 116.6725, rounded up to 116.68
+	l.Transfers[0].Amount = udfs("16")
+	l.Amount = udfs("116.69")
+
+	if err := l.Validate(); err == nil {
+		t.Errorf("error expected with a concept amount out of tolerance")
+	}
+}
+
+func TestTotalize(t *testing.T) {
+	concepts := []Concept{
+		{Qty: udfs("1"), UnitValue: udfs("10000"), Transfers: []Tax{IVA16}, Withholdings: []Tax{ISRWithheld, IVAWithheld}},
+		{Qty: udfs("2"), UnitValue: udfs("150.555"), Discount: udfs("1.11"), Transfers: []Tax{IVA16}},
+		{Qty: udfs("1"), UnitValue: udfs("200"), Transfers: []Tax{IVAExempt}},
+	}
+
+	lines := make([]Line, 0, len(concepts))
+
+	for _, c := range concepts {
+		l, err := c.Calculate(MaxDecimals)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, l)
+	}
+
+	got := Totalize(2, lines...)
+
+	// IVA 16% of 300 is 48, and of 10000 is 1600
+	if len(got.Transfers) != 2 || !got.Transfers[0].Base.Equal(udfs("10300")) || !got.Transfers[0].Amount.Equal(udfs("1648")) {
+		t.Errorf("got transfers %+v", got.Transfers)
+	}
+
+	if !got.Transfers[1].Base.Equal(udfs("200")) || got.Transfers[1].Factor != Exempt {
+		t.Errorf("got exempt transfer %+v", got.Transfers[1])
+	}
+
+	if len(got.Withholdings) != 2 || !got.Withheld.Equal(udfs("2066.67")) {
+		t.Errorf("got withholdings %+v, total %v", got.Withholdings, got.Withheld)
+	}
+
+	if !got.Subtotal.Equal(udfs("10501.11")) || !got.Discount.Equal(udfs("1.11")) || !got.Transferred.Equal(udfs("1648")) || !got.Total.Equal(udfs("10081.33")) {
+		t.Errorf("got subtotal %v, discount %v, transferred %v and total %v", got.Subtotal, got.Discount, got.Transferred, got.Total)
+	}
+}
@@ -0,0 +1,591 @@
+package johnny
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Arithmetic[gyro.Gyro] = GyroArithmetic{}
+var _ Arithmetic[*big.Rat] = RatArithmetic{}
+
+// Arithmetic is a numeric backend, providing the decimal operations a calculation needs over
+// values of type T. It lets [NumJohnny] run the visitors over decimal implementations
+// other than gyro, as shopspring/decimal or math/big.Rat, through a small adapter:
+//
+//	type ShopspringArithmetic struct{}
+//
+//	func (ShopspringArithmetic) Add(a, b decimal.Decimal) decimal.Decimal { return a.Add(b) }
+//	...
+type Arithmetic[T any] interface {
+	// FromInt returns the value of n.
+	FromInt(n int64) T
+	// Parse parses a decimal string, as "1044.543103448276".
+	Parse(s string) (T, error)
+	// String returns a string representation of a.
+	String(a T) string
+	Add(a, b T) T
+	Sub(a, b T) T
+	Mul(a, b T) T
+	// Div returns a / b. Dividing by zero panics, as it does with gyro.
+	Div(a, b T) T
+	// Cmp returns -1, 0 or 1 when a is less than, equal to or greater than b.
+	Cmp(a, b T) int
+	// Round rounds a to the given scale, half away from zero.
+	Round(a T, scale int32) T
+}
+
+// GyroArithmetic is the default numeric backend, running over gyro.Gyro.
+type GyroArithmetic struct{}
+
+// FromInt returns the value of n.
+func (GyroArithmetic) FromInt(n int64) gyro.Gyro {
+	return gyro.NewFromInt64(n)
+}
+
+// Parse parses a decimal string.
+func (GyroArithmetic) Parse(s string) (gyro.Gyro, error) {
+	return ParseDecimal(s)
+}
+
+// String returns an exact string representation of a.
+func (GyroArithmetic) String(a gyro.Gyro) string {
+	return DecimalString(a)
+}
+
+// Add returns a + b.
+func (GyroArithmetic) Add(a, b gyro.Gyro) gyro.Gyro {
+	return a.Add(b)
+}
+
+// Sub returns a - b.
+func (GyroArithmetic) Sub(a, b gyro.Gyro) gyro.Gyro {
+	return a.Sub(b)
+}
+
+// Mul returns a * b.
+func (GyroArithmetic) Mul(a, b gyro.Gyro) gyro.Gyro {
+	return a.Mul(b)
+}
+
+// Div returns a / b rounded to gyro.MaxDivisionScale, see quo.
+func (GyroArithmetic) Div(a, b gyro.Gyro) gyro.Gyro {
+	return quo(a, b)
+}
+
+// Cmp compares a and b.
+func (GyroArithmetic) Cmp(a, b gyro.Gyro) int {
+	return a.Cmp(b)
+}
+
+// Round rounds a to the given scale, half away from zero.
+func (GyroArithmetic) Round(a gyro.Gyro, scale int32) gyro.Gyro {
+	return a.Round(scale)
+}
+
+// RatArithmetic is a numeric backend running over math/big.Rat, for calculations which must be exact,
+// as 1/3 is kept as such instead of being cut at some scale. Every operation returns a new *big.Rat,
+// leaving its operands untouched, and a nil *big.Rat is taken as zero.
+type RatArithmetic struct{}
+
+// FromInt returns the value of n.
+func (RatArithmetic) FromInt(n int64) *big.Rat {
+	return new(big.Rat).SetInt64(n)
+}
+
+// Parse parses a decimal string, as "0.139578", or a fraction, as "1/3".
+func (RatArithmetic) Parse(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+
+	if !ok {
+		return nil, NewJohnnyError("invalid decimal value " + s)
+	}
+
+	return r, nil
+}
+
+// String returns a as an exact decimal when it has a finite decimal expansion, or as a fraction otherwise.
+func (RatArithmetic) String(a *big.Rat) string {
+	a = ratOrZero(a)
+
+	if scale, ok := decimalScale(a.Denom()); ok {
+		return a.FloatString(scale)
+	}
+
+	return a.RatString()
+}
+
+// Add returns a + b.
+func (RatArithmetic) Add(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Add(ratOrZero(a), ratOrZero(b))
+}
+
+// Sub returns a - b.
+func (RatArithmetic) Sub(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Sub(ratOrZero(a), ratOrZero(b))
+}
+
+// Mul returns a * b.
+func (RatArithmetic) Mul(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(ratOrZero(a), ratOrZero(b))
+}
+
+// Div returns a / b.
+func (RatArithmetic) Div(a, b *big.Rat) *big.Rat {
+	return new(big.Rat).Quo(ratOrZero(a), ratOrZero(b))
+}
+
+// Cmp compares a and b.
+func (RatArithmetic) Cmp(a, b *big.Rat) int {
+	return ratOrZero(a).Cmp(ratOrZero(b))
+}
+
+// Round rounds a to the given scale, half away from zero.
+func (RatArithmetic) Round(a *big.Rat, scale int32) *big.Rat {
+	return roundRat(ratOrZero(a), scale)
+}
+
+var zeroRat = new(big.Rat)
+
+func ratOrZero(r *big.Rat) *big.Rat {
+	if r == nil {
+		return zeroRat
+	}
+
+	return r
+}
+
+// decimalScale returns the number of decimal places needed to write 1/denom exactly,
+// and false if its decimal expansion is infinite.
+func decimalScale(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+	twos, fives := 0, 0
+
+	for m.Mod(d, two).Sign() == 0 {
+		d.Quo(d, two)
+		twos++
+	}
+
+	for m.Mod(d, five).Sign() == 0 {
+		d.Quo(d, five)
+		fives++
+	}
+
+	return max(twos, fives), d.IsInt64() && d.Int64() == 1
+}
+
+// roundRat rounds r to the given scale, half away from zero.
+func roundRat(r *big.Rat, scale int32) *big.Rat {
+	shift := pow10(scale)
+	x := new(big.Rat).Mul(r, shift)
+	q, rem := new(big.Int).QuoRem(new(big.Int).Abs(x.Num()), x.Denom(), new(big.Int))
+
+	if rem.Lsh(rem, 1).Cmp(x.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if x.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	return new(big.Rat).Quo(new(big.Rat).SetInt(q), shift)
+}
+
+// pow10 returns 10^n, which is a fraction when n is negative.
+func pow10(n int32) *big.Rat {
+	if n < 0 {
+		return new(big.Rat).Inv(pow10(-n))
+	}
+
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
+
+// GyroToRat returns the exact value of g as a *big.Rat.
+func GyroToRat(g gyro.Gyro) *big.Rat {
+	coeff, exp := gyroParts(g)
+	r := new(big.Rat).SetInt(coeff)
+	return r.Mul(r, pow10(exp))
+}
+
+// RatToGyro returns r rounded to the given scale, half away from zero, as a gyro.Gyro.
+// An error is returned if the rounded value doesn't fit in the 128 bits coefficient of gyro.
+func RatToGyro(r *big.Rat, scale int32) (gyro.Gyro, error) {
+	x := new(big.Rat).Mul(roundRat(ratOrZero(r), scale), pow10(scale))
+
+	// after rounding, x is an integer
+	coeff := x.Num()
+
+	if coeff.BitLen() > 127 {
+		return gyro.Gyro{}, NewJohnnyError("value " + r.RatString() + " overflows gyro")
+	}
+
+	return gyroFromParts(coeff, -scale), nil
+}
+
+// NumEffect is the outcome of a visitor over a [NumJohnny], the generic counterpart of [Effect].
+type NumEffect[T any] struct {
+	Kind      EffectKind
+	Code      string
+	Ratio     T
+	Amount    T
+	Base      T
+	Exemption ExemptionKind
+	Reason    string
+}
+
+// NumJohnny runs the built-in visitors and rules over any numeric backend, with the same arithmetic they
+// have over gyro, which is written once for every backend. As visitors are not modified, it keeps their
+// effects itself, so it is meant to be used for a single calculation.
+//
+// It is the only part of the package running over other backends. [Johnny], [DefaultJohnny] and the
+// visitors remain gyro based, and NumJohnny doesn't implement Johnny: it takes the definitions of the
+// visitors, which are gyro values, converting them to the backend, and custom visitors can't run over it.
+//
+//	b := johnny.NewNumJohnny(johnny.RatArithmetic{}, unitValue)
+//	err := b.Receive(johnny.WithQTY(qty))
+//	err = b.Receive(johnny.NewPercTaxRule(ratio).WithCode("IVA"))
+type NumJohnny[T any] struct {
+	a       Arithmetic[T]
+	v       T
+	effects []NumEffect[T]
+	// qty is the product of the received quantities, which specific taxes are calculated for.
+	qty gyro.Gyro
+}
+
+// NewNumJohnny returns a new NumJohnny over the given backend, holding the entry value.
+func NewNumJohnny[T any](a Arithmetic[T], entry T) *NumJohnny[T] {
+	return &NumJohnny[T]{a: a, v: entry, qty: gyro.NewOne()}
+}
+
+// Arithmetic returns the numeric backend of the Johnny.
+func (b *NumJohnny[T]) Arithmetic() Arithmetic[T] {
+	return b.a
+}
+
+// Receive applies the visitor to the Johnny, recording its effects. The definitions of the visitors, which are
+// gyro values, are converted to the backend. The built-in visitors and rules are supported, with the exception
+// of SnapshotVisitor, UnwithholdingHandler and the rules resolving their definition by date. NamedSnapshot is
+// accepted and does nothing. An error is returned, leaving the Johnny untouched, if the visitor isn't supported
+// or its definition can't be calculated or converted to the backend.
+func (b *NumJohnny[T]) Receive(v Visitor) error {
+	ops, ok, err := visitorOps(v, b.qty)
+
+	if !ok {
+		return NewJohnnyError(fmt.Sprintf("visitor %T can't run over a numeric backend", v))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	values := make([]T, len(ops))
+
+	for i, o := range ops {
+		value, err := fromGyro(b.a, o.value)
+
+		if err != nil {
+			return err
+		}
+
+		values[i] = value
+	}
+
+	for i, o := range ops {
+		if e, ok := eval(b.a, o, values[i], &b.v); ok {
+			b.effects = append(b.effects, e)
+		}
+	}
+
+	if q, ok := v.(Qty); ok {
+		b.qty = b.qty.Mul(q.qty)
+	}
+
+	return nil
+}
+
+// Value returns the current value of the Johnny.
+func (b *NumJohnny[T]) Value() T {
+	return b.v
+}
+
+// String returns a string representation of the Johnny value.
+func (b *NumJohnny[T]) String() string {
+	return "buffer: " + b.a.String(b.v)
+}
+
+// Effects returns the effects of the received visitors, in the order they were received.
+func (b *NumJohnny[T]) Effects() []NumEffect[T] {
+	effects := make([]NumEffect[T], len(b.effects))
+	copy(effects, b.effects)
+	return effects
+}
+
+// Total returns the sum of the amounts of the effects of the given kinds,
+// as Total(TaxEffect, UntaxEffect) for the taxes of the calculation.
+func (b *NumJohnny[T]) Total(kinds ...EffectKind) T {
+	total := b.a.FromInt(0)
+
+	for _, e := range b.effects {
+		for _, k := range kinds {
+			if e.Kind == k {
+				total = b.a.Add(total, e.Amount)
+				break
+			}
+		}
+	}
+
+	return total
+}
+
+// fromGyro converts g to the backend a.
+func fromGyro[T any](a Arithmetic[T], g gyro.Gyro) (T, error) {
+	switch any(a).(type) {
+	case GyroArithmetic:
+		return any(g).(T), nil
+	case RatArithmetic:
+		return any(GyroToRat(g)).(T), nil
+	}
+
+	return a.Parse(DecimalString(g))
+}
+
+// opKind identifies the operation of an op.
+type opKind int
+
+const (
+	opQty opKind = iota
+	opRound
+	opUnitValue
+	opPercDiscount
+	opAmountDiscount
+	opPercUndiscount
+	opAmountUndiscount
+	opPercTax
+	opUnbufferedPercTax
+	opAmountTax
+	opUnbufferedAmountTax
+	opPercUntax
+	opAmountUntax
+	opPercWithholding
+	opAmountWithholding
+	opPercUnwithholding
+	opAmountUnwithholding
+)
+
+// tax tells whether the operation is a tax, which can be exempted.
+func (k opKind) tax() bool {
+	return k >= opPercTax && k <= opAmountUntax
+}
+
+// op is the definition of a built-in rule as an operation, whose arithmetic is written once in [eval]
+// for every numeric backend. value holds the ratio, amount or quantity of the operation, as told by kind.
+type op struct {
+	kind  opKind
+	value gyro.Gyro
+	code  string
+	scale int32
+	// exemption and reason exempt the taxes, which leave the value untouched.
+	exemption ExemptionKind
+	reason    string
+}
+
+// applyOp applies o to b over gyro, returning its effect.
+func applyOp(b Johnny, o op) Effect {
+	v := b.Value()
+	e, _ := eval[gyro.Gyro](GyroArithmetic{}, o, o.value, &v)
+
+	if o.changes() {
+		b.set(v)
+	}
+
+	return Effect(e)
+}
+
+// changes tells whether the operation may change the value it's applied to.
+func (o op) changes() bool {
+	switch o.kind {
+	case opUnbufferedPercTax, opUnbufferedAmountTax, opPercWithholding, opAmountWithholding:
+		return false
+	}
+
+	return o.exemption == NotExempt || !o.kind.tax()
+}
+
+// eval applies the operation o, whose value converted to the backend a is value, to v, returning its effect
+// and false for the operations which have none, as the quantity and the rounding.
+func eval[T any](a Arithmetic[T], o op, value T, v *T) (NumEffect[T], bool) {
+	hundred := a.FromInt(100)
+	zero := a.FromInt(0)
+	e := NumEffect[T]{Code: o.code, Ratio: zero, Amount: zero, Base: *v}
+
+	// ratioOver returns the ratio amount represents over base. Only withholdings, which don't change the
+	// value, have a zero ratio over a zero base, any other amount over a zero base divides by zero.
+	ratioOver := func(amount, base T) T {
+		if o.kind >= opPercWithholding && a.Cmp(base, zero) == 0 {
+			return zero
+		}
+
+		return a.Div(a.Mul(amount, hundred), base)
+	}
+
+	if o.exemption != NotExempt && o.kind.tax() {
+		e.Kind, e.Exemption, e.Reason = TaxEffect, o.exemption, o.reason
+
+		if o.kind >= opPercUntax {
+			e.Kind = UntaxEffect
+		}
+
+		return e, true
+	}
+
+	switch o.kind {
+	case opQty:
+		*v = a.Mul(*v, value)
+		return e, false
+	case opRound:
+		*v = a.Round(*v, o.scale)
+		return e, false
+	case opUnitValue:
+		e.Kind = UnitValueEffect
+
+		if a.Cmp(value, zero) > 0 {
+			*v = a.Div(*v, value)
+			e.Amount = *v
+		}
+	case opPercDiscount:
+		e.Kind, e.Ratio = DiscountEffect, value
+		e.Amount = a.Div(a.Mul(*v, value), hundred)
+		*v = a.Sub(*v, e.Amount)
+	case opAmountDiscount:
+		e.Kind = DiscountEffect
+
+		if a.Cmp(*v, zero) != 0 {
+			e.Amount, e.Ratio = value, ratioOver(value, *v)
+			*v = a.Sub(*v, value)
+		}
+	case opPercUndiscount:
+		e.Kind, e.Ratio = UndiscountEffect, value
+
+		if a.Cmp(value, zero) != 0 {
+			*v = a.Mul(a.Div(*v, a.Sub(hundred, value)), hundred)
+			e.Base = *v
+			e.Amount = a.Mul(*v, a.Div(value, hundred))
+		}
+	case opAmountUndiscount:
+		*v = a.Add(*v, value)
+		e.Kind, e.Amount, e.Base = UndiscountEffect, value, *v
+		e.Ratio = ratioOver(value, *v)
+	case opPercTax, opUnbufferedPercTax:
+		e.Kind, e.Ratio = TaxEffect, value
+		e.Amount = a.Mul(*v, a.Div(value, hundred))
+
+		if o.kind == opPercTax {
+			*v = a.Add(*v, e.Amount)
+		}
+	case opAmountTax, opUnbufferedAmountTax:
+		e.Kind, e.Amount = TaxEffect, value
+		e.Ratio = ratioOver(value, *v)
+
+		if o.kind == opAmountTax {
+			*v = a.Add(*v, value)
+		}
+	case opPercUntax:
+		ratio := a.Div(value, hundred)
+		*v = a.Div(*v, a.Add(a.FromInt(1), ratio))
+		e.Kind, e.Ratio, e.Base = UntaxEffect, value, *v
+		e.Amount = a.Mul(*v, ratio)
+	case opAmountUntax:
+		*v = a.Sub(*v, value)
+		e.Kind, e.Amount, e.Base = UntaxEffect, value, *v
+		e.Ratio = ratioOver(value, *v)
+	case opPercWithholding:
+		e.Kind, e.Ratio = WithholdingEffect, value
+		e.Amount = a.Mul(*v, a.Div(value, hundred))
+	case opAmountWithholding:
+		e.Kind, e.Amount = WithholdingEffect, value
+		e.Ratio = ratioOver(value, *v)
+	case opPercUnwithholding:
+		ratio := a.Div(value, hundred)
+		*v = a.Div(*v, a.Sub(a.FromInt(1), ratio))
+		e.Kind, e.Ratio, e.Base = UnwithholdingEffect, value, *v
+		e.Amount = a.Mul(*v, ratio)
+	case opAmountUnwithholding:
+		*v = a.Add(*v, value)
+		e.Kind, e.Amount, e.Base = UnwithholdingEffect, value, *v
+		e.Ratio = ratioOver(value, *v)
+	}
+
+	return e, true
+}
+
+// operation is implemented by the rules defined by a single op.
+type operation interface {
+	op() op
+}
+
+// visitorOps returns the operations doing what v does in a calculation of the given quantity,
+// and false if v is not a built-in visitor which can run over any backend. An error is returned if
+// the definition of an operation can't be calculated for the quantity.
+func visitorOps(v Visitor, qty gyro.Gyro) ([]op, bool, error) {
+	switch t := v.(type) {
+	case operation:
+		return []op{t.op()}, true, nil
+	case NamedSnapshot:
+		return nil, true, nil
+	case Qty:
+		return []op{{kind: opQty, value: t.qty}}, true, nil
+	case Round:
+		return []op{{kind: opRound, scale: t.scale}}, true, nil
+	case SpecificTaxRule:
+		o, err := t.op(qty)
+		return []op{o}, true, err
+	case SpecificUntaxRule:
+		o, err := t.op(qty)
+		return []op{o}, true, err
+	case *UnitValue:
+		return visitorOps(t.Rule(), qty)
+	case *PercentualDiscount:
+		return visitorOps(t.Rule(), qty)
+	case *AmountDiscount:
+		return visitorOps(t.Rule(), qty)
+	case *PercentualUndiscount:
+		return visitorOps(t.Rule(), qty)
+	case *AmountUndiscount:
+		return visitorOps(t.Rule(), qty)
+	case *PercTax:
+		return visitorOps(t.Rule(), qty)
+	case *UnbufferedPercTax:
+		return visitorOps(t.Rule(), qty)
+	case *AmountTax:
+		return visitorOps(t.Rule(), qty)
+	case *UnbufferedAmountTax:
+		return visitorOps(t.Rule(), qty)
+	case *PercentualUntax:
+		return visitorOps(t.Rule(), qty)
+	case *AmountUntax:
+		return visitorOps(t.Rule(), qty)
+	case *PercWithholding:
+		return visitorOps(t.Rule(), qty)
+	case *AmountWithholding:
+		return visitorOps(t.Rule(), qty)
+	case *PercentualUnwithholding:
+		return visitorOps(t.Rule(), qty)
+	case *AmountUnwithholding:
+		return visitorOps(t.Rule(), qty)
+	case *WithholdingHandler:
+		return []op{{kind: opPercWithholding, value: t.ratio}, {kind: opAmountWithholding, value: t.amount}}, true, nil
+	case *TaxHandlerFromUnitValue:
+		if t.exemption != NotExempt {
+			return []op{{kind: opPercTax, exemption: t.exemption, reason: t.reason}}, true, nil
+		}
+
+		return []op{{kind: opPercTax, value: t.ratio}, {kind: opAmountTax, value: t.amount}}, true, nil
+	case *DiscountHandlerFromUnitValue:
+		return []op{{kind: opPercDiscount, value: t.ratio}, {kind: opAmountDiscount, value: t.amount}}, true, nil
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,188 @@
+package johnny
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func rat(s string) *big.Rat {
+	r, _ := new(big.Rat).SetString(s)
+	return r
+}
+
+// numPipeline calculates a line from its unit value over any backend, with the same visitors as over gyro.
+func numPipeline[T any](t *testing.T, a Arithmetic[T], parse func(string) T) *NumJohnny[T] {
+	b := NewNumJohnny(a, parse("1044.543103448276"))
+
+	for _, v := range []Visitor{
+		WithQTY(udfs("35157")),
+		NewPercentualDiscount(udfs("10")),
+		NewAmountDiscountRule(udfs("100")),
+		NewUnbufferedPercTaxRule(udfs("16")).WithCode("IVA"),
+		NewUnbufferedAmountTax(udfs("14.08")),
+	} {
+		if err := b.Receive(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return b
+}
+
+func TestNumJohnnyBackends(t *testing.T) {
+	g := numPipeline[gyro.Gyro](t, GyroArithmetic{}, udfs)
+	r := numPipeline[*big.Rat](t, RatArithmetic{}, rat)
+
+	// the gyro backend gives the same values as the gyro based visitors
+	calc := NewFromUnitValue(udfs("1044.543103448276"))
+	pt := NewUnbufferedPercTax(udfs("16"))
+
+	for _, v := range []Visitor{WithQTY(udfs("35157")), NewPercentualDiscount(udfs("10")), NewAmountDiscount(udfs("100")), pt} {
+		calc.Receive(v)
+	}
+
+	if !g.Value().Equal(calc.Value()) || !g.Total(TaxEffect).Sub(udfs("14.08")).Equal(pt.Amount()) {
+		t.Errorf("got %v with taxes %v. Expected %v with taxes %v", g.Value(), g.Total(TaxEffect), calc.Value(), pt.Amount())
+	}
+
+	// as no division is inexact, both backends agree
+	if got, expected := (RatArithmetic{}).String(r.Value()), DecimalString(g.Value()); rat(got).Cmp(rat(expected)) != 0 {
+		t.Errorf("got %s with big.Rat. Expected %s", got, expected)
+	}
+
+	if got := (RatArithmetic{}).String(r.Total(DiscountEffect)); got != "3672400.1887931039332" {
+		t.Errorf("got discounts %s. Expected 3672400.1887931039332", got)
+	}
+
+	if effects := r.Effects(); len(effects) != 4 || effects[2].Code != "IVA" {
+		t.Errorf("got effects %+v", effects)
+	}
+}
+
+func TestRatBackendIsExact(t *testing.T) {
+	a := RatArithmetic{}
+	b := NewNumJohnny(a, rat("100"))
+
+	b.Receive(NewUnitValue(udfs("3")))
+
+	if got := a.String(b.Value()); got != "100/3" {
+		t.Errorf("got %s. Expected 100/3", got)
+	}
+
+	b.Receive(WithQTY(udfs("3")))
+
+	if got := a.String(b.Value()); got != "100" {
+		t.Errorf("got %s. Expected 100", got)
+	}
+
+	// the brute 1619.1 with a 16% tax gives back the same brute after untaxing and taxing again
+	brute := rat("1619.1")
+	b = NewNumJohnny(a, brute)
+	b.Receive(NewPercentualUntaxRule(udfs("16")).WithCode("IVA"))
+	b.Receive(NewPercTaxRule(udfs("16")).WithCode("IVA"))
+
+	if b.Value().Cmp(brute) != 0 {
+		t.Errorf("got %s. Expected 1619.1", a.String(b.Value()))
+	}
+}
+
+func TestNumJohnnyUnsupported(t *testing.T) {
+	b := NewNumJohnny[*big.Rat](RatArithmetic{}, rat("100"))
+
+	if err := b.Receive(&SnapshotVisitor{}); err == nil {
+		t.Error("error expected receiving a SnapshotVisitor")
+	}
+
+	if b.Value().Cmp(rat("100")) != 0 || len(b.Effects()) != 0 {
+		t.Errorf("got %s with effects %+v. Expected the Johnny untouched", b, b.Effects())
+	}
+}
+
+func TestRatRound(t *testing.T) {
+	a := RatArithmetic{}
+
+	testCases := []struct {
+		entry    string
+		scale    int32
+		expected string
+		// decimal tells whether entry can also be rounded with gyro.
+		decimal bool
+	}{
+		{"2.5", 0, "3", true},
+		{"-2.5", 0, "-3", true},
+		{"2.449", 1, "2.4", true},
+		{"1/3", 4, "0.3333", false},
+		{"2/3", 2, "0.67", false},
+		{"1250", -2, "1300", false},
+	}
+
+	for i, tc := range testCases {
+		got := a.String(a.Round(rat(tc.entry), tc.scale))
+
+		if got != tc.expected {
+			t.Errorf("[test case %d] got %s. Expected %s", i, got, tc.expected)
+		}
+
+		// rounding gyro gives the same result
+		if tc.decimal {
+			if g := DecimalString(GyroArithmetic{}.Round(udfs(tc.entry), tc.scale)); rat(g).Cmp(rat(tc.expected)) != 0 {
+				t.Errorf("[test case %d] got %s with gyro. Expected %s", i, g, tc.expected)
+			}
+		}
+	}
+}
+
+func TestGyroRatConversion(t *testing.T) {
+	for i, s := range []string{"1044.543103448276", "-0.05", "0", "111111111111111100000.123001", "-3"} {
+		r := GyroToRat(udfs(s))
+
+		if r.Cmp(rat(s)) != 0 {
+			t.Errorf("[test case %d] got %s. Expected %s", i, r.RatString(), s)
+		}
+	}
+
+	g, err := RatToGyro(rat("1/3"), 6)
+
+	if err != nil || DecimalString(g) != "0.333333" {
+		t.Errorf("got %s, %v. Expected 0.333333", DecimalString(g), err)
+	}
+
+	g, err = RatToGyro(rat("1250"), -2)
+
+	if err != nil || !g.Equal(udfs("1300")) {
+		t.Errorf("got %s, %v. Expected 1300", DecimalString(g), err)
+	}
+
+	if _, err := RatToGyro(new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 130)), 0); err == nil {
+		t.Errorf("error expected converting a value which overflows gyro")
+	}
+}
+
+func TestQuo(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected string
+	}{
+		// gyro.Gyro.Div gives 100 for the first one, and rounds the last digit of the second one the wrong way
+		{"86250", "0.8625", "100000"},
+		{"1619.1", "1.16", "1395.775862068965517"},
+		{"10.005", "1.19", "8.407563025210084"},
+		{"1408", "36722901.887931039332", "0.000038341196573"},
+		{"-1", "3", "-0.333333333333333"},
+		{"100", "-0.0001", "-1000000"},
+	}
+
+	for i, tc := range testCases {
+		got, err := Quo(udfs(tc.a), udfs(tc.b))
+
+		if err != nil || !got.Equal(udfs(tc.expected)) {
+			t.Errorf("[test case %d] got %s, %v. Expected %s", i, DecimalString(got), err, tc.expected)
+		}
+	}
+
+	if _, err := Quo(udfs("100000000000000000000000000000000000"), udfs("0.0001")); err == nil {
+		t.Errorf("error expected dividing into a value which overflows gyro")
+	}
+}
@@ -0,0 +1,199 @@
+package johnny
+
+import (
+	"sync"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// pool is a typed sync.Pool.
+type pool[T any] struct {
+	p sync.Pool
+}
+
+func newPool[T any](fn func() *T) *pool[T] {
+	return &pool[T]{p: sync.Pool{New: func() any { return fn() }}}
+}
+
+func (p *pool[T]) get() *T {
+	return p.p.Get().(*T)
+}
+
+func (p *pool[T]) put(v *T) {
+	p.p.Put(v)
+}
+
+var (
+	johnnyPool               = newPool(func() *DefaultJohnny { return &DefaultJohnny{} })
+	percentualDiscountPool   = newPool(func() *PercentualDiscount { return &PercentualDiscount{} })
+	amountDiscountPool       = newPool(func() *AmountDiscount { return &AmountDiscount{} })
+	percentualUndiscountPool = newPool(func() *PercentualUndiscount { return &PercentualUndiscount{Discount: &Discount{}} })
+	amountUndiscountPool     = newPool(func() *AmountUndiscount { return &AmountUndiscount{Discount: &Discount{}} })
+	percTaxPool              = newPool(func() *PercTax { return &PercTax{} })
+	unbufferedPercTaxPool    = newPool(func() *UnbufferedPercTax { return &UnbufferedPercTax{} })
+	amountTaxPool            = newPool(func() *AmountTax { return &AmountTax{} })
+	unbufferedAmountTaxPool  = newPool(func() *UnbufferedAmountTax { return &UnbufferedAmountTax{} })
+	percentualUntaxPool      = newPool(func() *PercentualUntax { return &PercentualUntax{} })
+	amountUntaxPool          = newPool(func() *AmountUntax { return &AmountUntax{} })
+	unitValuePool            = newPool(func() *UnitValue { return &UnitValue{} })
+	snapshotPool             = newPool(func() *SnapshotVisitor { return &SnapshotVisitor{} })
+)
+
+// AcquireDefaultJohnny returns a DefaultJohnny holding the given entry value, taken from a pool.
+// Return it with ReleaseJohnny once it is no longer used, so later calculations don't allocate a new one.
+func AcquireDefaultJohnny(entry gyro.Gyro) *DefaultJohnny {
+	b := johnnyPool.get()
+	b.v = entry
+	return b
+}
+
+// AcquireFromUnitValue is the pooled counterpart of NewFromUnitValue.
+func AcquireFromUnitValue(entry gyro.Gyro) FromUnitValue {
+	return FromUnitValue{DefaultJohnny: AcquireDefaultJohnny(entry)}
+}
+
+// AcquireFromBrute is the pooled counterpart of NewFromBrute.
+func AcquireFromBrute(brute gyro.Gyro) FromBrute {
+	return FromBrute{DefaultJohnny: AcquireDefaultJohnny(brute)}
+}
+
+// ReleaseJohnny resets b and returns it to its pool. b must not be used after being released.
+// Only the Johnny types of this package are pooled, any other is ignored.
+func ReleaseJohnny(b Johnny) {
+	var d *DefaultJohnny
+
+	switch t := b.(type) {
+	case *DefaultJohnny:
+		d = t
+	case FromUnitValue:
+		d = t.DefaultJohnny
+	case FromBrute:
+		d = t.DefaultJohnny
+	}
+
+	if d == nil {
+		return
+	}
+
+	d.Reset()
+	johnnyPool.put(d)
+}
+
+// AcquirePercentualDiscount is the pooled counterpart of NewPercentualDiscount.
+func AcquirePercentualDiscount(ratio gyro.Gyro) *PercentualDiscount {
+	pd := percentualDiscountPool.get()
+	pd.Discount = Discount{ratio: ratio}
+	return pd
+}
+
+// AcquireAmountDiscount is the pooled counterpart of NewAmountDiscount.
+func AcquireAmountDiscount(amount gyro.Gyro) *AmountDiscount {
+	pd := amountDiscountPool.get()
+	pd.Discount = Discount{amount: amount}
+	return pd
+}
+
+// AcquirePercentualUnDiscount is the pooled counterpart of NewPercentualUnDiscount.
+func AcquirePercentualUnDiscount(ratio gyro.Gyro) *PercentualUndiscount {
+	u := percentualUndiscountPool.get()
+	*u.Discount = Discount{ratio: ratio}
+	return u
+}
+
+// AcquireAmountUnDiscount is the pooled counterpart of NewAmountUnDiscount.
+func AcquireAmountUnDiscount(amount gyro.Gyro) *AmountUndiscount {
+	u := amountUndiscountPool.get()
+	*u.Discount = Discount{amount: amount}
+	return u
+}
+
+// AcquirePercTax is the pooled counterpart of NewPercTax.
+func AcquirePercTax(ratio gyro.Gyro) *PercTax {
+	pt := percTaxPool.get()
+	pt.Tax = Tax{ratio: ratio}
+	return pt
+}
+
+// AcquireUnbufferedPercTax is the pooled counterpart of NewUnbufferedPercTax.
+func AcquireUnbufferedPercTax(ratio gyro.Gyro) *UnbufferedPercTax {
+	pt := unbufferedPercTaxPool.get()
+	pt.Tax = Tax{ratio: ratio}
+	return pt
+}
+
+// AcquireAmountTax is the pooled counterpart of NewAmountTax.
+func AcquireAmountTax(amount gyro.Gyro) *AmountTax {
+	pt := amountTaxPool.get()
+	pt.Tax = Tax{amount: amount}
+	return pt
+}
+
+// AcquireUnbufferedAmountTax is the pooled counterpart of NewUnbufferedAmountTax.
+func AcquireUnbufferedAmountTax(amount gyro.Gyro) *UnbufferedAmountTax {
+	pt := unbufferedAmountTaxPool.get()
+	pt.Tax = Tax{amount: amount}
+	return pt
+}
+
+// AcquirePercentualUnTax is the pooled counterpart of NewPercentualUnTax.
+func AcquirePercentualUnTax(ratio gyro.Gyro) *PercentualUntax {
+	pu := percentualUntaxPool.get()
+	pu.Tax = Tax{ratio: ratio}
+	return pu
+}
+
+// AcquireAmountUnTax is the pooled counterpart of NewAmountUnTax.
+func AcquireAmountUnTax(amount gyro.Gyro) *AmountUntax {
+	pu := amountUntaxPool.get()
+	pu.Tax = Tax{amount: amount}
+	return pu
+}
+
+// AcquireUnitValue is the pooled counterpart of NewUnitValue.
+func AcquireUnitValue(qty gyro.Gyro) *UnitValue {
+	q := unitValuePool.get()
+	*q = UnitValue{qty: qty}
+	return q
+}
+
+// AcquireSnapshot is the pooled counterpart of NewSnapshot.
+func AcquireSnapshot() *SnapshotVisitor {
+	s := snapshotPool.get()
+	s.buffer = gyro.Gyro{}
+	return s
+}
+
+// ReleaseVisitor returns v to its pool. v must not be used after being released.
+// Only the visitors with an Acquire function are pooled, any other is ignored.
+func ReleaseVisitor(v Visitor) {
+	switch t := v.(type) {
+	case *PercentualDiscount:
+		percentualDiscountPool.put(t)
+	case *AmountDiscount:
+		amountDiscountPool.put(t)
+	case *PercentualUndiscount:
+		if t.Discount != nil {
+			percentualUndiscountPool.put(t)
+		}
+	case *AmountUndiscount:
+		if t.Discount != nil {
+			amountUndiscountPool.put(t)
+		}
+	case *PercTax:
+		percTaxPool.put(t)
+	case *UnbufferedPercTax:
+		unbufferedPercTaxPool.put(t)
+	case *AmountTax:
+		amountTaxPool.put(t)
+	case *UnbufferedAmountTax:
+		unbufferedAmountTaxPool.put(t)
+	case *PercentualUntax:
+		percentualUntaxPool.put(t)
+	case *AmountUntax:
+		amountUntaxPool.put(t)
+	case *UnitValue:
+		unitValuePool.put(t)
+	case *SnapshotVisitor:
+		snapshotPool.put(t)
+	}
+}
@@ -0,0 +1,154 @@
+package johnny
+
+import (
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func TestAcquiredAreClean(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		calc := AcquireFromUnitValue(udfs("100"))
+
+		if !calc.Value().Equal(udfs("100")) || calc.Snapshots().Len() != 0 {
+			t.Fatalf("[round %d] got value %v with %d snapshots. Expected 100 without snapshots", i, calc.Value(), calc.Snapshots().Len())
+		}
+
+		pt := AcquirePercTax(udfs("19"))
+
+		if !pt.Amount().Equal(gyro.Gyro{}) || !pt.Taxable().Equal(gyro.Gyro{}) || pt.Code() != "" {
+			t.Fatalf("[round %d] got a used tax %+v", i, pt)
+		}
+
+		pt.SetCode("IVA")
+		calc.Receive(NamedSnapshot("net"))
+		calc.Receive(pt)
+
+		if !calc.Value().Equal(udfs("119")) {
+			t.Errorf("[round %d] got %v. Expected 119", i, calc.Value())
+		}
+
+		ReleaseVisitor(pt)
+		ReleaseJohnny(calc)
+	}
+
+	u := AcquirePercentualUnDiscount(udfs("10"))
+	calc := AcquireFromBrute(udfs("90"))
+	calc.Receive(u)
+
+	if !u.Amount().Equal(udfs("10")) {
+		t.Errorf("got undiscount amount %v. Expected 10", u.Amount())
+	}
+
+	ReleaseVisitor(u)
+	ReleaseJohnny(calc)
+}
+
+func TestReset(t *testing.T) {
+	b := NewFromUnitValue(udfs("100"))
+	b.Receive(NamedSnapshot("entry"))
+
+	pt := NewPercTax(udfs("19"))
+	at := NewAmountTax(udfs("10"))
+	b.Receive(pt)
+	b.Receive(at)
+
+	pt.Reset()
+	at.Reset()
+
+	if !pt.Ratio().Equal(udfs("19")) || !pt.Amount().Equal(gyro.Gyro{}) || !pt.Taxable().Equal(gyro.Gyro{}) {
+		t.Errorf("got percentual tax %+v after reset", pt)
+	}
+
+	if !at.Amount().Equal(udfs("10")) || !at.Ratio().Equal(gyro.Gyro{}) {
+		t.Errorf("got amount tax %+v after reset", at)
+	}
+
+	b.Reset()
+
+	if !b.Value().Equal(gyro.Gyro{}) || b.Snapshots().Len() != 0 {
+		t.Errorf("got value %v with %d snapshots after reset", b.Value(), b.Snapshots().Len())
+	}
+
+	th := NewTaxHandlerFromUnitValue()
+	th.WithPercentualTax(udfs("16"))
+	th.WithAmountTax(udfs("4"))
+	th.Visit(NewFromUnitValue(udfs("100")))
+	th.Reset()
+
+	if !th.TotalRatio().Equal(udfs("16")) || !th.TotalAmount().Equal(udfs("4")) || !th.Taxable().Equal(gyro.Gyro{}) {
+		t.Errorf("got tax handler %+v after reset", th.TaxHandler)
+	}
+}
+
+func TestHandlersReusedAfterReset(t *testing.T) {
+	th := NewTaxHandlerFromUnitValue()
+	th.WithPercentualTax(udfs("16"))
+	th.WithAmountTax(udfs("4"))
+
+	dh := NewDiscHandlerFromUnitValue()
+	dh.WithPercentualDiscount(udfs("10"))
+	dh.WithAmountDiscount(udfs("5"))
+
+	wh := NewWithholdingHandler()
+	wh.WithPercentualWithholding(udfs("10"))
+	wh.WithAmountWithholding(udfs("1"))
+
+	// every line is calculated by the same handlers, reset after each one
+	for i, tc := range []struct {
+		unitValue, value, taxes, discounts, withholdings string
+	}{
+		{"100", "102.6", "17.6", "15", "9.5"},
+		{"200", "207", "32", "25", "18.5"},
+	} {
+		b := NewFromUnitValue(udfs(tc.unitValue))
+		b.Receive(dh)
+		b.Receive(wh)
+		b.Receive(th)
+
+		if !b.Value().Equal(udfs(tc.value)) || !th.TotalAmount().Equal(udfs(tc.taxes)) || !dh.TotalAmount().Equal(udfs(tc.discounts)) || !wh.TotalAmount().Equal(udfs(tc.withholdings)) {
+			t.Errorf("[test case %d] got value %v, taxes %v, discounts %v and withholdings %v. Expected %s, %s, %s and %s", i, b.Value(), th.TotalAmount(), dh.TotalAmount(), wh.TotalAmount(), tc.value, tc.taxes, tc.discounts, tc.withholdings)
+		}
+
+		th.Reset()
+		dh.Reset()
+		wh.Reset()
+	}
+}
+
+func TestPooledPipelineDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random under the race detector")
+	}
+
+	unitValue := udfs("1044.543103448276")
+	qty := udfs("35157")
+	discount := udfs("100")
+	tax := udfs("14.08")
+	rules := []Rule{NewPercentualDiscountRule(udfs("10")), NewUnbufferedPercTaxRule(udfs("16"))}
+	rc := NewRunContext()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		calc := AcquireFromUnitValue(unitValue)
+		pd := AcquireAmountDiscount(discount)
+		pt := AcquireUnbufferedAmountTax(tax)
+
+		calc.Receive(WithQTY(qty))
+		calc.Receive(pd)
+		calc.Receive(NamedSnapshot("net"))
+		calc.Receive(pt)
+
+		for _, r := range rules {
+			r.Apply(calc, rc)
+		}
+
+		ReleaseVisitor(pd)
+		ReleaseVisitor(pt)
+		ReleaseJohnny(calc)
+		rc.Reset()
+	})
+
+	if allocs != 0 {
+		t.Errorf("got %v allocations per run. Expected 0", allocs)
+	}
+}
@@ -0,0 +1,416 @@
+package johnny
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Rule = RateRule{}
+var _ Rule = RateHandler{}
+
+// DateLayout is the layout of the dates of the rate tables loaded from JSON or CSV.
+const DateLayout = "2006-01-02"
+
+// Rate is the ratio of a tax during a validity interval.
+type Rate struct {
+	// Code identifies the tax, as "IVA".
+	Code  string
+	Ratio gyro.Gyro
+	// From is the first instant the rate is valid.
+	From time.Time
+	// To is the instant the rate stops being valid, which is excluded from the interval.
+	// A zero To means the rate is valid from then on.
+	To time.Time
+}
+
+// ValidAt tells whether the rate is valid at the given date.
+func (r Rate) ValidAt(date time.Time) bool {
+	return !date.Before(r.From) && (r.To.IsZero() || date.Before(r.To))
+}
+
+// overlaps tells whether the validity intervals of both rates share any instant.
+func (r Rate) overlaps(o Rate) bool {
+	return (r.To.IsZero() || o.From.Before(r.To)) && (o.To.IsZero() || r.From.Before(o.To))
+}
+
+// RateTable holds the rates of the taxes over time, so historical calculations
+// can be recomputed with the rates which were valid at their date. The zero value is an empty table.
+type RateTable struct {
+	// rates holds the rates of each tax code, sorted by From.
+	rates map[string][]Rate
+}
+
+// NewRateTable returns a new RateTable holding the given rates.
+// An error is returned if any of them is not valid, as described by [RateTable.Add].
+func NewRateTable(rates ...Rate) (*RateTable, error) {
+	t := &RateTable{rates: map[string][]Rate{}}
+
+	for _, r := range rates {
+		if err := t.Add(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Add adds the given rate to the table.
+// An error is returned if the rate has no code, ends before it starts, or its validity overlaps
+// the one of another rate of the same tax.
+func (t *RateTable) Add(r Rate) error {
+	if r.Code == "" {
+		return NewJohnnyError("rate without tax code")
+	}
+
+	if !r.To.IsZero() && !r.From.Before(r.To) {
+		return NewJohnnyError(fmt.Sprintf("rate of %s ends before it starts", r.Code))
+	}
+
+	if t.rates == nil {
+		t.rates = map[string][]Rate{}
+	}
+
+	rates := t.rates[r.Code]
+
+	for _, o := range rates {
+		if r.overlaps(o) {
+			return NewJohnnyError(fmt.Sprintf("rate of %s from %s overlaps the one from %s", r.Code, r.From.Format(DateLayout), o.From.Format(DateLayout)))
+		}
+	}
+
+	i := sort.Search(len(rates), func(i int) bool { return r.From.Before(rates[i].From) })
+	rates = append(rates, Rate{})
+	copy(rates[i+1:], rates[i:])
+	rates[i] = r
+	t.rates[r.Code] = rates
+
+	return nil
+}
+
+// Rate returns the rate of the tax identified by code which is valid at the given date.
+// An error is returned if there is none.
+func (t *RateTable) Rate(code string, date time.Time) (Rate, error) {
+	rates := t.rates[code]
+
+	// the last rate starting until the date is the only one which can be valid
+	i := sort.Search(len(rates), func(i int) bool { return date.Before(rates[i].From) })
+
+	if i == 0 || !rates[i-1].ValidAt(date) {
+		return Rate{}, NewJohnnyError(fmt.Sprintf("no rate of %s valid at %s", code, date.Format(DateLayout)))
+	}
+
+	return rates[i-1], nil
+}
+
+// Ratio returns the ratio of the tax identified by code which is valid at the given date.
+// An error is returned if there is none.
+func (t *RateTable) Ratio(code string, date time.Time) (gyro.Gyro, error) {
+	r, err := t.Rate(code, date)
+	return r.Ratio, err
+}
+
+// Rates returns the rates of the tax identified by code, sorted by the start of their validity.
+func (t *RateTable) Rates(code string) []Rate {
+	rates := make([]Rate, len(t.rates[code]))
+	copy(rates, t.rates[code])
+	return rates
+}
+
+// Codes returns the codes of the taxes in the table, sorted.
+func (t *RateTable) Codes() []string {
+	codes := make([]string, 0, len(t.rates))
+
+	for code := range t.rates {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	return codes
+}
+
+type rateJSON struct {
+	Code  string      `json:"code"`
+	Ratio jsonDecimal `json:"ratio"`
+	From  string      `json:"from"`
+	To    string      `json:"to,omitempty"`
+}
+
+// LoadRateTableJSON reads a RateTable from a JSON array of rates, as
+//
+//	[{"code": "IVA", "ratio": "19", "from": "2003-10-01"}]
+//
+// Dates follow [DateLayout], and "to" can be omitted for the rates which are still valid.
+func LoadRateTableJSON(r io.Reader) (*RateTable, error) {
+	var rates []rateJSON
+
+	if err := json.NewDecoder(r).Decode(&rates); err != nil {
+		return nil, err
+	}
+
+	t, _ := NewRateTable()
+
+	for _, j := range rates {
+		rate, err := parseRate(j.Code, gyro.Gyro(j.Ratio), j.From, j.To)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.Add(rate); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// LoadRateTableCSV reads a RateTable from a CSV file with the header code,ratio,from,to.
+// Columns may come in any order. Dates follow [DateLayout], and "to" can be empty for the rates
+// which are still valid.
+func LoadRateTableCSV(r io.Reader) (*RateTable, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, name := range []string{"code", "ratio", "from", "to"} {
+		if _, ok := columns[name]; !ok {
+			return nil, NewJohnnyError("column " + name + " not found")
+		}
+	}
+
+	t, _ := NewRateTable()
+
+	for {
+		record, err := cr.Read()
+
+		if err == io.EOF {
+			return t, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			return strings.TrimSpace(record[columns[name]])
+		}
+
+		ratio, err := ParseDecimal(field("ratio"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		rate, err := parseRate(field("code"), ratio, field("from"), field("to"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.Add(rate); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseRate returns the rate of the tax identified by code, valid between the given dates.
+func parseRate(code string, ratio gyro.Gyro, from, to string) (Rate, error) {
+	r := Rate{Code: code, Ratio: ratio}
+	var err error
+
+	if r.From, err = time.Parse(DateLayout, from); err != nil {
+		return Rate{}, NewJohnnyError(fmt.Sprintf("invalid date %q of %s", from, code))
+	}
+
+	if to == "" {
+		return r, nil
+	}
+
+	if r.To, err = time.Parse(DateLayout, to); err != nil {
+		return Rate{}, NewJohnnyError(fmt.Sprintf("invalid date %q of %s", to, code))
+	}
+
+	return r, nil
+}
+
+// rateKind tells which tax rule a RateRule resolves to.
+type rateKind int
+
+const (
+	ratePercTax rateKind = iota
+	rateUnbufferedPercTax
+	ratePercentualUntax
+)
+
+// RateRule is a percentual tax rule whose ratio is resolved from a [RateTable]
+// with the date of the [RunContext] it's applied with.
+type RateRule struct {
+	table *RateTable
+	code  string
+	kind  rateKind
+}
+
+// PercTax returns a rule applying the tax identified by code as a [PercTaxRule].
+func (t *RateTable) PercTax(code string) RateRule {
+	return RateRule{table: t, code: code, kind: ratePercTax}
+}
+
+// UnbufferedPercTax returns a rule applying the tax identified by code as an [UnbufferedPercTaxRule].
+func (t *RateTable) UnbufferedPercTax(code string) RateRule {
+	return RateRule{table: t, code: code, kind: rateUnbufferedPercTax}
+}
+
+// PercentualUntax returns a rule removing the tax identified by code as a [PercentualUntaxRule].
+func (t *RateTable) PercentualUntax(code string) RateRule {
+	return RateRule{table: t, code: code, kind: ratePercentualUntax}
+}
+
+// Code returns the code identifying the tax.
+func (r RateRule) Code() string {
+	return r.code
+}
+
+// At returns the tax rule with the ratio valid at the given date.
+// An error is returned if the table has no rate of the tax valid at that date.
+func (r RateRule) At(date time.Time) (Rule, error) {
+	ratio, err := r.table.Ratio(r.code, date)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.kind {
+	case rateUnbufferedPercTax:
+		return NewUnbufferedPercTaxRule(ratio).WithCode(r.code), nil
+	case ratePercentualUntax:
+		return NewPercentualUntaxRule(ratio).WithCode(r.code), nil
+	default:
+		return NewPercTaxRule(ratio).WithCode(r.code), nil
+	}
+}
+
+// Apply applies the tax with the ratio valid at the date of rc, recording its effect in rc.
+// When rc has no date or no rate is valid at that date, the Johnny is left untouched and the error
+// is recorded in rc.
+func (r RateRule) Apply(b Johnny, rc *RunContext) {
+	date, err := dateOf(rc)
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	rule, err := r.At(date)
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	rule.Apply(b, rc)
+}
+
+// Visit panics, leaving the Johnny untouched, as a visitor has no date to resolve the ratio with.
+// The rule must be run with [RunAt], or applied with a [RunContext] holding the date of the calculation.
+func (r RateRule) Visit(b Johnny) {
+	panic(errNoDate())
+}
+
+func (r RateRule) check(date time.Time) error {
+	_, err := r.table.Rate(r.code, date)
+	return err
+}
+
+// RateHandler is the dated counterpart of [TaxHandlerFromUnitValue]. It applies several percentual taxes
+// over the same value, with the ratios valid at the date of the [RunContext] it's applied with,
+// recording an effect for each tax.
+type RateHandler struct {
+	table *RateTable
+	codes []string
+}
+
+// TaxHandler returns a handler applying the taxes identified by codes over the same value.
+func (t *RateTable) TaxHandler(codes ...string) RateHandler {
+	return RateHandler{table: t, codes: codes}
+}
+
+// Apply adds the taxes over the value of b, with the ratios valid at the date of rc, recording their effects in rc.
+// When rc has no date or any of the taxes has no rate valid at that date, the Johnny is left untouched and the
+// error is recorded in rc.
+func (h RateHandler) Apply(b Johnny, rc *RunContext) {
+	date, err := dateOf(rc)
+
+	if err == nil {
+		err = h.check(date)
+	}
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	base := b.Value()
+	total := gyro.Gyro{}
+
+	for _, code := range h.codes {
+		rate, _ := h.table.Rate(code, date)
+		e := Effect{Kind: TaxEffect, Code: code, Ratio: rate.Ratio, Base: base}
+		e.Amount = base.Mul(quo(rate.Ratio, gyro.NewHundred()))
+		total = total.Add(e.Amount)
+		rc.Record(e)
+	}
+
+	b.Add(total)
+}
+
+// Visit panics, leaving the Johnny untouched, as a visitor has no date to resolve the ratios with.
+// The handler must be run with [RunAt], or applied with a [RunContext] holding the date of the calculation.
+func (h RateHandler) Visit(b Johnny) {
+	panic(errNoDate())
+}
+
+func (h RateHandler) check(date time.Time) error {
+	for _, code := range h.codes {
+		if _, err := h.table.Rate(code, date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dateOf returns the date of rc, and an error when it has none, as the rates are resolved by it.
+func dateOf(rc *RunContext) (time.Time, error) {
+	if rc.Date().IsZero() {
+		return time.Time{}, errNoDate()
+	}
+
+	return rc.Date(), nil
+}
+
+// errNoDate returns the error of resolving a rate without the date of the calculation.
+func errNoDate() error {
+	return NewJohnnyError("rates need the date of the calculation, see RunAt")
+}
+
+// dated is implemented by the rules resolving their definition by the date of the calculation.
+type dated interface {
+	check(date time.Time) error
+}
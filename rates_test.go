@@ -0,0 +1,225 @@
+package johnny
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse(DateLayout, s)
+	return d
+}
+
+// ivaHistoryCSV is the history of the Chilean IVA, with a made up temporary cut, and the ILA.
+const ivaHistoryCSV = `code,ratio,from,to
+IVA,18,1998-01-01,2003-10-01
+IVA,19,2003-10-01,2020-04-01
+IVA,16,2020-04-01,2020-07-01
+IVA,19,2020-07-01,
+ILA,31.5,2014-10-01,
+`
+
+const ivaHistoryJSON = `[
+	{"code": "IVA", "ratio": "18", "from": "1998-01-01", "to": "2003-10-01"},
+	{"code": "IVA", "ratio": "19", "from": "2003-10-01", "to": "2020-04-01"},
+	{"code": "IVA", "ratio": "16", "from": "2020-04-01", "to": "2020-07-01"},
+	{"code": "IVA", "ratio": "19", "from": "2020-07-01"},
+	{"code": "ILA", "ratio": "31.5", "from": "2014-10-01"}
+]`
+
+func TestRateTable(t *testing.T) {
+	fromCSV, err := LoadRateTableCSV(strings.NewReader(ivaHistoryCSV))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, err := LoadRateTableJSON(strings.NewReader(ivaHistoryJSON))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		code     string
+		date     string
+		expected string
+	}{
+		{"IVA", "2001-05-10", "18"},
+		{"IVA", "2003-10-01", "19"},
+		{"IVA", "2020-03-31", "19"},
+		{"IVA", "2020-04-01", "16"},
+		{"IVA", "2020-06-30", "16"},
+		{"IVA", "2024-01-01", "19"},
+		{"ILA", "2024-01-01", "31.5"},
+		{"IVA", "1990-01-01", ""},
+		{"ILA", "2010-01-01", ""},
+		{"IEC", "2024-01-01", ""},
+	}
+
+	for i, tc := range testCases {
+		for _, table := range []*RateTable{fromCSV, fromJSON} {
+			got, err := table.Ratio(tc.code, date(tc.date))
+
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("[test case %d] error expected, got %v", i, got)
+				}
+
+				continue
+			}
+
+			if err != nil || !got.Equal(udfs(tc.expected)) {
+				t.Errorf("[test case %d] got %v, %v. Expected %v", i, got, err, tc.expected)
+			}
+		}
+	}
+
+	if codes := fromCSV.Codes(); len(codes) != 2 || codes[0] != "ILA" || codes[1] != "IVA" {
+		t.Errorf("got codes %v. Expected [ILA IVA]", codes)
+	}
+
+	if rates := fromJSON.Rates("IVA"); len(rates) != 4 || !rates[2].Ratio.Equal(udfs("16")) {
+		t.Errorf("got rates %+v", rates)
+	}
+}
+
+func TestRateTableErrors(t *testing.T) {
+	testCases := []string{
+		"code,ratio,from\nIVA,19,2003-10-01\n",
+		"code,ratio,from,to\nIVA,19,2003-10-01,\nIVA,16,2020-04-01,2020-07-01\n",
+		"code,ratio,from,to\nIVA,19,2003-10-01,2003-10-01\n",
+		"code,ratio,from,to\nIVA,19,01/10/2003,\n",
+		"code,ratio,from,to\nIVA,x,2003-10-01,\n",
+		"code,ratio,from,to\n,19,2003-10-01,\n",
+	}
+
+	for i, tc := range testCases {
+		if _, err := LoadRateTableCSV(strings.NewReader(tc)); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
+
+func TestRunAt(t *testing.T) {
+	table, _ := LoadRateTableCSV(strings.NewReader(ivaHistoryCSV))
+
+	testCases := []struct {
+		date     string
+		taxes    string
+		expected string
+	}{
+		{"2001-05-10", "180", "1180"},
+		{"2020-05-15", "160", "1160"},
+		{"2024-01-01", "190", "1190"},
+	}
+
+	for i, tc := range testCases {
+		r, err := RunAt(date(tc.date), NewFromUnitValue(udfs("1000")), table.PercTax("IVA"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !r.Taxes.Equal(udfs(tc.taxes)) || !r.TaxesByCode["IVA"].Equal(udfs(tc.taxes)) || !r.Value.Equal(udfs(tc.expected)) {
+			t.Errorf("[test case %d] got taxes %v and value %v. Expected %v and %v", i, r.Taxes, r.Value, tc.taxes, tc.expected)
+		}
+	}
+
+	// removing the tax from a brute of the cut uses the rate of the cut
+	rule, err := table.PercentualUntax("IVA").At(date("2020-05-15"))
+
+	if untax, ok := rule.(PercentualUntaxRule); err != nil || !ok || !untax.Ratio().Equal(udfs("16")) || untax.Code() != "IVA" {
+		t.Errorf("got %+v, %v. Expected the untax of IVA at 16", rule, err)
+	}
+
+	// no visitor runs when a rate is missing
+	b := NewFromUnitValue(udfs("1000"))
+
+	if _, err := RunAt(date("2010-01-01"), b, table.PercTax("IVA"), table.UnbufferedPercTax("ILA")); err == nil {
+		t.Errorf("error expected, as ILA has no rate in 2010")
+	}
+
+	if !b.Value().Equal(udfs("1000")) {
+		t.Errorf("got %v. The Johnny shouldn't change", b.Value())
+	}
+}
+
+func TestRateHandler(t *testing.T) {
+	table, _ := LoadRateTableCSV(strings.NewReader(ivaHistoryCSV))
+	rc := NewRunContextAt(date("2020-05-15"))
+	b := NewFromUnitValue(udfs("1000"))
+
+	table.TaxHandler("IVA", "ILA").Apply(b, rc)
+
+	// both taxes are calculated over the same value
+	if !b.Value().Equal(udfs("1475")) {
+		t.Errorf("got %v. Expected 1475", b.Value())
+	}
+
+	effects := rc.Effects()
+
+	if len(effects) != 2 || effects[0].Code != "IVA" || !effects[0].Amount.Equal(udfs("160")) ||
+		effects[1].Code != "ILA" || !effects[1].Amount.Equal(udfs("315")) || !effects[1].Base.Equal(udfs("1000")) {
+		t.Errorf("got effects %+v", effects)
+	}
+
+	// a missing rate leaves the Johnny untouched and is reported by the context
+	rc = NewRunContextAt(date("2010-01-01"))
+	table.TaxHandler("IVA", "ILA").Apply(b, rc)
+
+	if rc.Err() == nil || len(rc.Effects()) != 0 || !b.Value().Equal(udfs("1475")) {
+		t.Errorf("got %v with effects %+v and error %v", b.Value(), rc.Effects(), rc.Err())
+	}
+
+	rc.Reset()
+
+	if rc.Err() != nil || !rc.Date().Equal(date("2010-01-01")) {
+		t.Errorf("reset should clear the error, keeping the date")
+	}
+}
+
+func TestRatesNeedDate(t *testing.T) {
+	table, _ := LoadRateTableCSV(strings.NewReader(ivaHistoryCSV))
+
+	// Run has no date to resolve the rates with
+	for i, v := range []Visitor{table.PercTax("IVA"), table.TaxHandler("IVA", "ILA")} {
+		r, err := Run(NewFromUnitValue(udfs("1000")), v)
+
+		if err == nil || !r.Taxes.Equal(udfs("0")) || !r.Value.Equal(udfs("1000")) {
+			t.Errorf("[test case %d] got taxes %v, value %v and error %v. Expected an error", i, r.Taxes, r.Value, err)
+		}
+	}
+
+	// a visitor has no date, so visiting a rate panics instead of resolving it with the current date
+	for i, v := range []Visitor{table.PercTax("IVA"), table.TaxHandler("IVA")} {
+		b := NewFromUnitValue(udfs("1000"))
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("[test case %d] panic expected visiting a rate", i)
+				}
+			}()
+
+			b.Receive(v)
+		}()
+
+		if !b.Value().Equal(udfs("1000")) {
+			t.Errorf("[test case %d] got value %v. Expected the Johnny untouched", i, b.Value())
+		}
+	}
+}
+
+func TestZeroRateTable(t *testing.T) {
+	var table RateTable
+
+	if err := table.Add(Rate{Code: "IVA", Ratio: udfs("19"), From: date("2020-01-01")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := table.Ratio("IVA", date("2024-01-01")); err != nil || !r.Equal(udfs("19")) {
+		t.Errorf("got %v, %v. Expected 19", r, err)
+	}
+}
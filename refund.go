@@ -0,0 +1,211 @@
+package johnny
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// Refunds derives the credit notes of a line from the Result of its original calculation, as the returns of
+// some of its units or partial refunds of its amount, and keeps track of what was already refunded so the
+// refunds never exceed the original. It's safe for concurrent use.
+//
+// Every amount of a refund is the proportional part of the original one, rounded to the scale of the invoice:
+// the net value, the discounts, each tax and withholding by code, and the bases of the exemptions. Rounding
+// is made over the cumulative refunds, each refund being the rounded cumulative amount minus the one already
+// refunded, so the rounding differences don't pile up and refunding the whole line gives back exactly the
+// original amounts rounded to the scale. Returning 1 of 3 units whose tax is 1.90 refunds 0.63 of it, the
+// second one 0.64 and the last one 0.63.
+type Refunds struct {
+	mu       sync.Mutex
+	original Result
+	qty      gyro.Gyro
+	scale    int32
+
+	// total is the original rounded to the scale, the most that can be refunded.
+	total Result
+	// fraction is the refunded fraction of the original.
+	fraction    *big.Rat
+	refunded    Result
+	refundedQty gyro.Gyro
+}
+
+// NewRefunds returns the refunds of the line calculated as original, whose quantity is qty, with their amounts
+// rounded to scale. An error is returned if qty isn't positive.
+func NewRefunds(original Result, qty gyro.Gyro, scale int32) (*Refunds, error) {
+	if qty.Cmp(gyro.NewZero()) <= 0 {
+		return nil, NewJohnnyError("the quantity of the refunded line must be positive, got " + DecimalString(qty))
+	}
+
+	r := &Refunds{original: original, qty: qty, scale: scale, fraction: new(big.Rat)}
+	r.total = r.at(big.NewRat(1, 1), nil)
+	r.refunded = r.at(r.fraction, nil)
+
+	return r, nil
+}
+
+// Qty returns the refund of returning qty units of the line. An error is returned, refunding nothing, if qty
+// isn't positive or the refund would exceed what remains of the original, as when more units are returned
+// than the ones left or after refunds of amounts.
+func (r *Refunds) Qty(qty gyro.Gyro) (Result, error) {
+	if qty.Cmp(gyro.NewZero()) <= 0 {
+		return Result{}, NewJohnnyError("the returned quantity must be positive, got " + DecimalString(qty))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f := new(big.Rat).Quo(GyroToRat(qty), GyroToRat(r.qty))
+	f.Add(f, r.fraction)
+
+	if f.Cmp(big.NewRat(1, 1)) > 0 {
+		return Result{}, NewJohnnyError(fmt.Sprintf("returning %s units exceeds what remains of the line, %s of %s units were returned", DecimalString(qty), DecimalString(r.refundedQty), DecimalString(r.qty)))
+	}
+
+	refund := r.advance(f, nil)
+	r.refundedQty = r.refundedQty.Add(qty)
+
+	return refund, nil
+}
+
+// Amount returns the refund of the given gross amount of the line, as a discount granted after the invoice.
+// Its taxes are the proportional part of the original ones and its net value the rest of the amount, so its
+// Gross is exactly amount. An error is returned, refunding nothing, if amount isn't positive or exceeds the
+// gross value which remains to be refunded.
+func (r *Refunds) Amount(amount gyro.Gyro) (Result, error) {
+	if amount.Cmp(gyro.NewZero()) <= 0 {
+		return Result{}, NewJohnnyError("the refunded amount must be positive, got " + DecimalString(amount))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	gross := r.refunded.Gross.Add(amount)
+
+	if gross.Cmp(r.total.Gross) > 0 {
+		return Result{}, NewJohnnyError(fmt.Sprintf("refunding %s exceeds the %s which remain of the line", DecimalString(amount), DecimalString(r.total.Gross.Sub(r.refunded.Gross))))
+	}
+
+	f := new(big.Rat).Quo(GyroToRat(gross), GyroToRat(r.total.Gross))
+
+	return r.advance(f, &gross), nil
+}
+
+// Refunded returns the sum of the refunds made, and the quantity of returned units.
+func (r *Refunds) Refunded() (Result, gyro.Gyro) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.refunded, r.refundedQty
+}
+
+// Remaining returns what remains to be refunded of the original, rounded to the scale.
+func (r *Refunds) Remaining() Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return subtractResult(r.total, r.refunded)
+}
+
+// advance refunds up to the fraction f of the original, returning the refund made.
+func (r *Refunds) advance(f *big.Rat, gross *gyro.Gyro) Result {
+	refunded := r.at(f, gross)
+	refund := subtractResult(refunded, r.refunded)
+	r.fraction, r.refunded = f, refunded
+
+	return refund
+}
+
+// at returns the fraction f of the original, rounded to the scale. The net value is the given gross value
+// minus the taxes when there's one, and the proportional part of the original net value otherwise.
+func (r *Refunds) at(f *big.Rat, gross *gyro.Gyro) Result {
+	o := r.original
+	res := Result{
+		Entry:              o.Entry,
+		Discounts:          r.part(o.Discounts, f),
+		TaxesByCode:        make(map[string]gyro.Gyro, len(o.TaxesByCode)),
+		WithholdingsByCode: make(map[string]gyro.Gyro, len(o.WithholdingsByCode)),
+	}
+
+	for code, amount := range o.TaxesByCode {
+		res.TaxesByCode[code] = r.part(amount, f)
+		res.Taxes = res.Taxes.Add(res.TaxesByCode[code])
+	}
+
+	for code, amount := range o.WithholdingsByCode {
+		res.WithholdingsByCode[code] = r.part(amount, f)
+		res.Withholdings = res.Withholdings.Add(res.WithholdingsByCode[code])
+	}
+
+	for _, e := range o.Exemptions {
+		e.Base = r.part(e.Base, f)
+		res.Exemptions = append(res.Exemptions, e)
+	}
+
+	if gross != nil {
+		res.Net = gross.Sub(res.Taxes)
+	} else {
+		res.Net = r.part(o.Net, f)
+	}
+
+	res.Gross = res.Net.Add(res.Taxes)
+	res.Payable = res.Gross.Sub(res.Withholdings)
+
+	// the value of the Johnny is the net or the gross value, depending on whether the taxes were added to it
+	switch {
+	case o.Value.Equal(o.Gross):
+		res.Value = res.Gross
+	case o.Value.Equal(o.Net):
+		res.Value = res.Net
+	default:
+		res.Value = r.part(o.Value, f)
+	}
+
+	return res
+}
+
+// part returns the fraction f of v rounded to the scale.
+func (r *Refunds) part(v gyro.Gyro, f *big.Rat) gyro.Gyro {
+	p := new(big.Rat).Mul(GyroToRat(v), f)
+	g, err := RatToGyro(p, r.scale)
+
+	// a fraction up to one of a gyro fits in a gyro
+	if err != nil {
+		return v
+	}
+
+	return g
+}
+
+// subtractResult returns the amounts of a minus the ones of b, a Result derived from the same original.
+func subtractResult(a, b Result) Result {
+	res := Result{
+		Entry:              a.Entry,
+		Value:              a.Value.Sub(b.Value),
+		Net:                a.Net.Sub(b.Net),
+		Gross:              a.Gross.Sub(b.Gross),
+		Discounts:          a.Discounts.Sub(b.Discounts),
+		Taxes:              a.Taxes.Sub(b.Taxes),
+		TaxesByCode:        make(map[string]gyro.Gyro, len(a.TaxesByCode)),
+		Withholdings:       a.Withholdings.Sub(b.Withholdings),
+		WithholdingsByCode: make(map[string]gyro.Gyro, len(a.WithholdingsByCode)),
+		Payable:            a.Payable.Sub(b.Payable),
+	}
+
+	for code, amount := range a.TaxesByCode {
+		res.TaxesByCode[code] = amount.Sub(b.TaxesByCode[code])
+	}
+
+	for code, amount := range a.WithholdingsByCode {
+		res.WithholdingsByCode[code] = amount.Sub(b.WithholdingsByCode[code])
+	}
+
+	for i, e := range a.Exemptions {
+		e.Base = e.Base.Sub(b.Exemptions[i].Base)
+		res.Exemptions = append(res.Exemptions, e)
+	}
+
+	return res
+}
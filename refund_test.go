@@ -0,0 +1,146 @@
+package johnny
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func TestRefundsQty(t *testing.T) {
+	original := mustRun(t, NewFromUnitValue(udfs("10")), WithQTY(udfs("10")), NewPercentualDiscountRule(udfs("10")), NewPercTaxRule(udfs("19")).WithCode("IVA"))
+	refunds, err := NewRefunds(original, udfs("10"), 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		qty       string
+		net       string
+		discounts string
+		taxes     string
+		gross     string
+	}{
+		{"3", "27", "3", "5.13", "32.13"},
+		{"0.5", "4.5", "0.5", "0.86", "5.36"},
+		{"6.5", "58.5", "6.5", "11.11", "69.61"},
+	}
+
+	for i, tc := range testCases {
+		r, err := refunds.Qty(udfs(tc.qty))
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !r.Net.Equal(udfs(tc.net)) || !r.Discounts.Equal(udfs(tc.discounts)) || !r.Taxes.Equal(udfs(tc.taxes)) || !r.TaxesByCode["IVA"].Equal(udfs(tc.taxes)) || !r.Gross.Equal(udfs(tc.gross)) || !r.Value.Equal(r.Gross) {
+			t.Errorf("[test case %d] got net %v discounts %v taxes %v gross %v. Expected %s %s %s %s", i, DecimalString(r.Net), DecimalString(r.Discounts), DecimalString(r.Taxes), DecimalString(r.Gross), tc.net, tc.discounts, tc.taxes, tc.gross)
+		}
+	}
+
+	refunded, qty := refunds.Refunded()
+
+	if !qty.Equal(udfs("10")) || !refunded.Net.Equal(original.Net) || !refunded.Taxes.Equal(original.Taxes) || !refunded.Gross.Equal(original.Gross) {
+		t.Errorf("got refunded %v units with net %v taxes %v gross %v. Expected the original", DecimalString(qty), DecimalString(refunded.Net), DecimalString(refunded.Taxes), DecimalString(refunded.Gross))
+	}
+
+	if remaining := refunds.Remaining(); !remaining.Gross.Equal(gyro.NewZero()) {
+		t.Errorf("got remaining %v. Expected 0", DecimalString(remaining.Gross))
+	}
+
+	if _, err := refunds.Qty(udfs("0.01")); err == nil || !strings.Contains(err.Error(), "of 10 units were returned") {
+		t.Errorf("got %v. Expected the refund to exceed the line", err)
+	}
+}
+
+func TestRefundsRounding(t *testing.T) {
+	// the tax of 9.99 at 19% is 1.8981, invoiced as 1.90
+	original := mustRun(t, NewFromUnitValue(udfs("3.33")), WithQTY(udfs("3")), NewUnbufferedPercTaxRule(udfs("19")).WithCode("IVA"), NewPercWithholdingRule(udfs("10")).WithCode("RET"))
+	refunds, _ := NewRefunds(original, udfs("3"), 2)
+
+	taxes := gyro.Gyro{}
+	withholdings := gyro.Gyro{}
+
+	for i, expected := range []string{"0.63", "0.64", "0.63"} {
+		r, err := refunds.Qty(udfs("1"))
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !r.Net.Equal(udfs("3.33")) || !r.Value.Equal(r.Net) || !r.Taxes.Equal(udfs(expected)) || !r.Payable.Equal(r.Gross.Sub(r.Withholdings)) {
+			t.Errorf("[test case %d] got net %v value %v taxes %v. Expected 3.33 3.33 %s", i, DecimalString(r.Net), DecimalString(r.Value), DecimalString(r.Taxes), expected)
+		}
+
+		taxes, withholdings = taxes.Add(r.Taxes), withholdings.Add(r.WithholdingsByCode["RET"])
+	}
+
+	if !taxes.Equal(udfs("1.90")) || !withholdings.Equal(original.Withholdings.Round(2)) {
+		t.Errorf("got taxes %v withholdings %v. Expected 1.90 and %v", DecimalString(taxes), DecimalString(withholdings), DecimalString(original.Withholdings.Round(2)))
+	}
+}
+
+func TestRefundsAmount(t *testing.T) {
+	original := mustRun(t, NewFromUnitValue(udfs("50")), WithQTY(udfs("2")), NewPercTaxRule(udfs("19")).WithCode("IVA"), NewPercTaxRule(udfs("5")).WithCode("LUX").WithExemption(Exempt, "export"))
+	refunds, _ := NewRefunds(original, udfs("2"), 2)
+
+	r, err := refunds.Amount(udfs("10"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 is 10/119 of the original, whose tax is 19 and whose exempted tax has a base of 119
+	if !r.Gross.Equal(udfs("10")) || !r.Taxes.Equal(udfs("1.60")) || !r.Net.Equal(udfs("8.40")) || len(r.Exemptions) != 1 || !r.Exemptions[0].Base.Equal(udfs("10")) {
+		t.Errorf("got gross %v taxes %v net %v exemptions %+v", DecimalString(r.Gross), DecimalString(r.Taxes), DecimalString(r.Net), r.Exemptions)
+	}
+
+	// a unit is half the line, but 10 were already refunded
+	if _, err := refunds.Qty(udfs("2")); err == nil {
+		t.Error("refunding the whole line after a partial refund must fail")
+	}
+
+	r, err = refunds.Qty(udfs("1"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Gross.Equal(udfs("59.50")) || !r.Taxes.Equal(udfs("9.50")) {
+		t.Errorf("got gross %v taxes %v. Expected 59.50 9.50", DecimalString(r.Gross), DecimalString(r.Taxes))
+	}
+
+	if _, err := refunds.Amount(udfs("49.51")); err == nil || !strings.Contains(err.Error(), "exceeds the 49.50 which remain") {
+		t.Errorf("got %v. Expected the refund to exceed the line", err)
+	}
+
+	if r, err = refunds.Amount(udfs("49.50")); err != nil || !r.Taxes.Equal(udfs("7.90")) || !refunds.Remaining().Taxes.Equal(gyro.NewZero()) {
+		t.Errorf("got taxes %v and %v. Expected 7.90", DecimalString(r.Taxes), err)
+	}
+}
+
+func TestRefundsErrors(t *testing.T) {
+	original := mustRun(t, NewFromUnitValue(udfs("10")), WithQTY(udfs("2")))
+
+	if _, err := NewRefunds(original, udfs("0"), 2); err == nil {
+		t.Error("a line without quantity must fail")
+	}
+
+	refunds, _ := NewRefunds(original, udfs("2"), 2)
+
+	for i, refund := range []func() (Result, error){
+		func() (Result, error) { return refunds.Qty(udfs("0")) },
+		func() (Result, error) { return refunds.Qty(udfs("-1")) },
+		func() (Result, error) { return refunds.Amount(udfs("0")) },
+		func() (Result, error) { return refunds.Amount(udfs("20.01")) },
+	} {
+		if _, err := refund(); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+
+	if refunded, _ := refunds.Refunded(); !refunded.Gross.Equal(gyro.NewZero()) {
+		t.Errorf("got refunded %v. Expected 0", DecimalString(refunded.Gross))
+	}
+}
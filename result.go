@@ -0,0 +1,494 @@
+package johnny
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// Result holds the outcome of running a pipeline of visitors over a Johnny,
+// so it can be consumed the same way whether the calculation started from
+// a unit value or from a brute value.
+//
+// Gross is Net plus Taxes, and Payable is Gross minus Withholdings. Adjustments made by Round
+// visitors are not spread over those values but reported apart in RoundingAdjustments. When the taxes
+// are removed from the brute value, Net is the value they left, which may differ from Gross minus Taxes
+// in the last digits of the divisions removing them.
+type Result struct {
+	// Entry is the value of the Johnny before the first visitor was received.
+	Entry gyro.Gyro
+	// Value is the value of the Johnny after the last visitor was received.
+	Value gyro.Gyro
+	// Net is the value before taxes.
+	Net gyro.Gyro
+	// Gross is the value with taxes, also known as brute.
+	Gross gyro.Gyro
+	// Discounts is the total amount of discounts applied or removed.
+	Discounts gyro.Gyro
+	// Taxes is the total amount of taxes applied or removed.
+	Taxes gyro.Gyro
+	// TaxesByCode holds the tax amounts grouped by tax code.
+	// Taxes without code are grouped under the empty code.
+	TaxesByCode map[string]gyro.Gyro
+	// Exemptions holds the taxes which were not charged, with their base and reason, in pipeline order.
+	Exemptions []Exemption
+	// Withholdings is the total amount withheld from what the customer pays.
+	Withholdings gyro.Gyro
+	// WithholdingsByCode holds the withheld amounts grouped by withholding code.
+	WithholdingsByCode map[string]gyro.Gyro
+	// Payable is what the customer pays, the gross value minus the withholdings.
+	Payable gyro.Gyro
+	// UnitValues holds the values calculated by UnitValue visitors, in pipeline order.
+	UnitValues []gyro.Gyro
+	// Snapshots holds the values captured by NamedSnapshot visitors over the Johnny.
+	Snapshots map[string]gyro.Gyro
+	// RoundingAdjustments holds the adjustments made by Round visitors, in pipeline order.
+	RoundingAdjustments []RoundingAdjustment
+	// Steps holds every received visitor with the value of the Johnny before and after receiving it.
+	Steps []Step
+}
+
+// Step is a visitor received during a Run, with the value of the Johnny before and after receiving it.
+type Step struct {
+	Visitor Visitor
+	Before  gyro.Gyro
+	After   gyro.Gyro
+}
+
+// RoundingAdjustment is the difference a Round visitor made on the Johnny value.
+type RoundingAdjustment struct {
+	// Scale is the scale the value was rounded to.
+	Scale int32
+	// Adjustment is the rounded value minus the value before rounding.
+	Adjustment gyro.Gyro
+}
+
+// Run makes b receive every visitor in the given order and returns the [Result] of the calculation.
+//
+// When the pipeline applies taxes over the buffer, as FromUnitValue lines do, Net is the value the first
+// tax was calculated over. When it removes taxes from the buffer, as FromBrute lines do, Gross is the value
+// before the first untax visitor and Net the value after the last one, as its steps show. A pipeline without taxes has equal Net and Gross, being the entry value
+// for FromBrute and the final value otherwise.
+//
+// Withholdings don't change Net nor Gross, but Payable. A FromBrute line starting from the payable value
+// and removing withholdings without taxes has the value after the last unwithholding as Net and Gross.
+//
+// Rules are applied with a [RunContext] owned by the Run, so their effects are part of the Result
+// while the rules themselves remain untouched. The error of the first rule which couldn't be applied, as a
+// [RateRule] outside [RunAt], is returned along with the Result of running every visitor.
+func Run(b Johnny, visitors ...Visitor) (Result, error) {
+	c := newCollector(b.Value())
+	r := run(c, b, visitors)
+
+	return r, c.rc.Err()
+}
+
+// RunAt is [Run] for a calculation made at the given date, as the invoice date, which the rules
+// of a [RateTable] resolve their ratios with. An error is returned, without running any visitor,
+// if a rate isn't valid at that date, and after running them if a rule couldn't be applied.
+func RunAt(date time.Time, b Johnny, visitors ...Visitor) (Result, error) {
+	for _, v := range visitors {
+		if d, ok := v.(dated); ok {
+			if err := d.check(date); err != nil {
+				return Result{}, err
+			}
+		}
+	}
+
+	c := newCollector(b.Value())
+	c.rc.date = date
+	r := run(c, b, visitors)
+
+	return r, c.rc.Err()
+}
+
+func run(c *collector, b Johnny, visitors []Visitor) Result {
+	for _, v := range visitors {
+		before := b.Value()
+
+		if r, ok := v.(Rule); ok {
+			b.Receive(boundRule{rule: r, rc: &c.rc})
+		} else {
+			b.Receive(v)
+		}
+
+		c.collect(v, before, b.Value())
+	}
+
+	c.r.Snapshots = b.Snapshots().Map()
+
+	return c.result(b.Value(), isFromBrute(b))
+}
+
+func isFromBrute(b Johnny) bool {
+	switch b.(type) {
+	case FromBrute, *FromBrute:
+		return true
+	}
+
+	return false
+}
+
+// taxer is implemented by every visitor embedding a Tax.
+type taxer interface {
+	tax() *Tax
+}
+
+// discounter is implemented by every visitor embedding a Discount.
+type discounter interface {
+	discount() *Discount
+}
+
+func (pt *Tax) tax() *Tax {
+	return pt
+}
+
+func (d *Discount) discount() *Discount {
+	return d
+}
+
+// collector gathers the outcome of each visitor received during a Run.
+type collector struct {
+	r Result
+
+	// rc holds the effects of the applied rules, of which the first seen were already collected.
+	rc   RunContext
+	seen int
+
+	// net and gross are the values marked by the first tax or untax visitor.
+	net   *gyro.Gyro
+	gross *gyro.Gyro
+	// untaxed is the value after the last untax visitor, the net of a reverse pipeline.
+	untaxed *gyro.Gyro
+	// unwithheld is the value after the last unwithholding visitor, the gross of a reverse pipeline without taxes.
+	unwithheld *gyro.Gyro
+}
+
+func newCollector(entry gyro.Gyro) *collector {
+	return &collector{
+		r: Result{
+			Entry:              entry,
+			TaxesByCode:        map[string]gyro.Gyro{},
+			WithholdingsByCode: map[string]gyro.Gyro{},
+		},
+	}
+}
+
+// collect records the outcome of v, which changed the Johnny value from before to after.
+func (c *collector) collect(v Visitor, before, after gyro.Gyro) {
+	c.r.Steps = append(c.r.Steps, Step{Visitor: v, Before: before, After: after})
+
+	switch t := v.(type) {
+	case Rule:
+		for _, e := range c.rc.effects[c.seen:] {
+			c.collectEffect(e, before)
+		}
+
+		c.seen = len(c.rc.effects)
+	case *TaxHandlerFromUnitValue:
+		if t.exemption != NotExempt {
+			c.addExemption(Exemption{Kind: t.exemption, Reason: t.reason, Base: t.taxable})
+		} else {
+			c.addTax("", t.totalAmount)
+		}
+
+		c.markNet(before)
+	case *DiscountHandlerFromUnitValue:
+		c.r.Discounts = c.r.Discounts.Add(t.totalAmount)
+	case *WithholdingHandler:
+		c.addWithholding("", t.totalAmount)
+	case *UnwithholdingHandler:
+		c.addTax("", t.taxes)
+		c.addWithholding("", t.withholdings)
+		c.markGross(after.Add(t.taxes))
+		c.untaxed = &after
+	case *PercentualUnwithholding, *AmountUnwithholding:
+		w := t.(withholder).withholding()
+		c.addWithholding(w.code, w.amount)
+		c.unwithheld = &after
+	case withholder:
+		w := t.withholding()
+		c.addWithholding(w.code, w.amount)
+	case *PercentualUntax, *AmountUntax:
+		c.collectTax(t.(taxer).tax())
+		c.markGross(before)
+		c.untaxed = &after
+	case taxer:
+		c.collectTax(t.tax())
+		c.markNet(before)
+	case discounter:
+		c.r.Discounts = c.r.Discounts.Add(t.discount().amount)
+	case *UnitValue:
+		c.r.UnitValues = append(c.r.UnitValues, t.unitValue)
+	case Round:
+		c.r.RoundingAdjustments = append(c.r.RoundingAdjustments, RoundingAdjustment{
+			Scale:      t.scale,
+			Adjustment: after.Sub(before),
+		})
+	}
+}
+
+// collectEffect records the effect of a rule, applied over the given value.
+func (c *collector) collectEffect(e Effect, before gyro.Gyro) {
+	switch e.Kind {
+	case TaxEffect:
+		c.collectTaxEffect(e)
+		c.markNet(before)
+	case UntaxEffect:
+		c.collectTaxEffect(e)
+		c.markGross(before)
+		c.untaxed = &e.Base
+	case DiscountEffect, UndiscountEffect:
+		c.r.Discounts = c.r.Discounts.Add(e.Amount)
+	case UnitValueEffect:
+		c.r.UnitValues = append(c.r.UnitValues, e.Amount)
+	case WithholdingEffect:
+		c.addWithholding(e.Code, e.Amount)
+	case UnwithholdingEffect:
+		c.addWithholding(e.Code, e.Amount)
+		c.unwithheld = &e.Base
+	}
+}
+
+// collectTax records the amount of a tax visitor, or its exemption when it was not charged.
+// Exempted amount taxes keep their defined amount, which is not added.
+func (c *collector) collectTax(tx *Tax) {
+	if tx.exemption != NotExempt {
+		c.addExemption(Exemption{Code: tx.code, Kind: tx.exemption, Reason: tx.reason, Base: tx.taxable})
+		return
+	}
+
+	c.addTax(tx.code, tx.amount)
+}
+
+// collectTaxEffect records the amount of a tax effect, or its exemption when the tax was not charged.
+func (c *collector) collectTaxEffect(e Effect) {
+	if e.Exemption != NotExempt {
+		c.addExemption(Exemption{Code: e.Code, Kind: e.Exemption, Reason: e.Reason, Base: e.Base})
+		return
+	}
+
+	c.addTax(e.Code, e.Amount)
+}
+
+func (c *collector) addExemption(e Exemption) {
+	c.r.Exemptions = append(c.r.Exemptions, e)
+}
+
+func (c *collector) addTax(code string, amount gyro.Gyro) {
+	c.r.Taxes = c.r.Taxes.Add(amount)
+	c.r.TaxesByCode[code] = c.r.TaxesByCode[code].Add(amount)
+}
+
+func (c *collector) addWithholding(code string, amount gyro.Gyro) {
+	c.r.Withholdings = c.r.Withholdings.Add(amount)
+	c.r.WithholdingsByCode[code] = c.r.WithholdingsByCode[code].Add(amount)
+}
+
+func (c *collector) markNet(v gyro.Gyro) {
+	if c.net == nil && c.gross == nil {
+		c.net = &v
+	}
+}
+
+func (c *collector) markGross(v gyro.Gyro) {
+	if c.net == nil && c.gross == nil {
+		c.gross = &v
+	}
+}
+
+// result closes the collection, given the final value of the Johnny and
+// whether the calculation started from the brute value.
+func (c *collector) result(value gyro.Gyro, reverse bool) Result {
+	c.r.Value = value
+
+	switch {
+	case c.net != nil:
+		c.r.Net = *c.net
+		c.r.Gross = c.r.Net.Add(c.r.Taxes)
+	case c.gross != nil && reverse:
+		c.r.Gross = *c.gross
+		c.r.Net = *c.untaxed
+	case c.gross != nil:
+		c.r.Gross = *c.gross
+		c.r.Net = c.r.Gross.Sub(c.r.Taxes)
+	case reverse && c.unwithheld != nil:
+		c.r.Net = *c.unwithheld
+		c.r.Gross = *c.unwithheld
+	case reverse:
+		c.r.Net = c.r.Entry
+		c.r.Gross = c.r.Entry
+	default:
+		c.r.Net = value
+		c.r.Gross = value
+	}
+
+	c.r.Payable = c.r.Gross.Sub(c.r.Withholdings)
+
+	return c.r
+}
+
+type resultJSON struct {
+	Entry               jsonDecimal              `json:"entry"`
+	Value               jsonDecimal              `json:"value"`
+	Net                 jsonDecimal              `json:"net"`
+	Gross               jsonDecimal              `json:"gross"`
+	Discounts           jsonDecimal              `json:"discounts"`
+	Taxes               jsonDecimal              `json:"taxes"`
+	TaxesByCode         map[string]jsonDecimal   `json:"taxes_by_code"`
+	Exemptions          []exemptionJSON          `json:"exemptions"`
+	Withholdings        jsonDecimal              `json:"withholdings"`
+	WithholdingsByCode  map[string]jsonDecimal   `json:"withholdings_by_code"`
+	Payable             jsonDecimal              `json:"payable"`
+	UnitValues          []jsonDecimal            `json:"unit_values"`
+	Snapshots           map[string]jsonDecimal   `json:"snapshots"`
+	RoundingAdjustments []roundingAdjustmentJSON `json:"rounding_adjustments"`
+	Steps               []stepJSON               `json:"steps"`
+}
+
+type stepJSON struct {
+	Visitor json.RawMessage `json:"visitor"`
+	Before  jsonDecimal     `json:"before"`
+	After   jsonDecimal     `json:"after"`
+}
+
+type exemptionJSON struct {
+	Code   string        `json:"code"`
+	Kind   ExemptionKind `json:"kind"`
+	Reason string        `json:"reason"`
+	Base   jsonDecimal   `json:"base"`
+}
+
+type roundingAdjustmentJSON struct {
+	Scale      int32       `json:"scale"`
+	Adjustment jsonDecimal `json:"adjustment"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Result) MarshalJSON() ([]byte, error) {
+	j := resultJSON{
+		Entry:               jsonDecimal(r.Entry),
+		Value:               jsonDecimal(r.Value),
+		Net:                 jsonDecimal(r.Net),
+		Gross:               jsonDecimal(r.Gross),
+		Discounts:           jsonDecimal(r.Discounts),
+		Taxes:               jsonDecimal(r.Taxes),
+		TaxesByCode:         make(map[string]jsonDecimal, len(r.TaxesByCode)),
+		Exemptions:          make([]exemptionJSON, 0, len(r.Exemptions)),
+		Withholdings:        jsonDecimal(r.Withholdings),
+		WithholdingsByCode:  make(map[string]jsonDecimal, len(r.WithholdingsByCode)),
+		Payable:             jsonDecimal(r.Payable),
+		UnitValues:          make([]jsonDecimal, 0, len(r.UnitValues)),
+		Snapshots:           make(map[string]jsonDecimal, len(r.Snapshots)),
+		RoundingAdjustments: make([]roundingAdjustmentJSON, 0, len(r.RoundingAdjustments)),
+		Steps:               make([]stepJSON, 0, len(r.Steps)),
+	}
+
+	for k, v := range r.TaxesByCode {
+		j.TaxesByCode[k] = jsonDecimal(v)
+	}
+
+	for _, v := range r.Exemptions {
+		j.Exemptions = append(j.Exemptions, exemptionJSON{Code: v.Code, Kind: v.Kind, Reason: v.Reason, Base: jsonDecimal(v.Base)})
+	}
+
+	for k, v := range r.WithholdingsByCode {
+		j.WithholdingsByCode[k] = jsonDecimal(v)
+	}
+
+	for _, v := range r.UnitValues {
+		j.UnitValues = append(j.UnitValues, jsonDecimal(v))
+	}
+
+	for k, v := range r.Snapshots {
+		j.Snapshots[k] = jsonDecimal(v)
+	}
+
+	for _, v := range r.RoundingAdjustments {
+		j.RoundingAdjustments = append(j.RoundingAdjustments, roundingAdjustmentJSON{
+			Scale:      v.Scale,
+			Adjustment: jsonDecimal(v.Adjustment),
+		})
+	}
+
+	for _, v := range r.Steps {
+		visitor, err := json.Marshal(v.Visitor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		j.Steps = append(j.Steps, stepJSON{
+			Visitor: visitor,
+			Before:  jsonDecimal(v.Before),
+			After:   jsonDecimal(v.After),
+		})
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// The visitors of the steps are decoded with [UnmarshalVisitor]. Visitors which
+// are not built into this package can't be decoded and are left as nil.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var j resultJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*r = Result{
+		Entry:              gyro.Gyro(j.Entry),
+		Value:              gyro.Gyro(j.Value),
+		Net:                gyro.Gyro(j.Net),
+		Gross:              gyro.Gyro(j.Gross),
+		Discounts:          gyro.Gyro(j.Discounts),
+		Taxes:              gyro.Gyro(j.Taxes),
+		TaxesByCode:        make(map[string]gyro.Gyro, len(j.TaxesByCode)),
+		Withholdings:       gyro.Gyro(j.Withholdings),
+		WithholdingsByCode: make(map[string]gyro.Gyro, len(j.WithholdingsByCode)),
+		Payable:            gyro.Gyro(j.Payable),
+		Snapshots:          make(map[string]gyro.Gyro, len(j.Snapshots)),
+	}
+
+	for k, v := range j.TaxesByCode {
+		r.TaxesByCode[k] = gyro.Gyro(v)
+	}
+
+	for _, v := range j.Exemptions {
+		r.Exemptions = append(r.Exemptions, Exemption{Code: v.Code, Kind: v.Kind, Reason: v.Reason, Base: gyro.Gyro(v.Base)})
+	}
+
+	for k, v := range j.WithholdingsByCode {
+		r.WithholdingsByCode[k] = gyro.Gyro(v)
+	}
+
+	for _, v := range j.UnitValues {
+		r.UnitValues = append(r.UnitValues, gyro.Gyro(v))
+	}
+
+	for k, v := range j.Snapshots {
+		r.Snapshots[k] = gyro.Gyro(v)
+	}
+
+	for _, v := range j.RoundingAdjustments {
+		r.RoundingAdjustments = append(r.RoundingAdjustments, RoundingAdjustment{
+			Scale:      v.Scale,
+			Adjustment: gyro.Gyro(v.Adjustment),
+		})
+	}
+
+	for _, v := range j.Steps {
+		visitor, _ := UnmarshalVisitor(v.Visitor)
+
+		r.Steps = append(r.Steps, Step{
+			Visitor: visitor,
+			Before:  gyro.Gyro(v.Before),
+			After:   gyro.Gyro(v.After),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// mustRun returns the Result of Run, failing the test if it returns an error.
+func mustRun(t *testing.T, b Johnny, visitors ...Visitor) Result {
+	t.Helper()
+
+	r, err := Run(b, visitors...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestRunFromUnitValue(t *testing.T) {
+	qty := udfs("35157")
+
+	percTax := NewUnbufferedPercTax(udfs("16"))
+	percTax.SetCode("IVA")
+	amountTax := NewUnbufferedAmountTax(udfs("14.04"))
+	amountTax.SetCode("ENV")
+
+	r := mustRun(t, NewFromUnitValue(udfs("1044.543103448276")),
+		WithQTY(qty),
+		NewPercentualDiscount(udfs("10")),
+		NewAmountDiscount(udfs("100")),
+		percTax,
+		amountTax,
+		NewRound(2),
+	)
+
+	expecteds := map[string]struct{ got, expected string }{
+		"entry":     {DecimalString(r.Entry), "1044.543103448276"},
+		"net":       {DecimalString(r.Net), "33050601.6991379353988"},
+		"gross":     {DecimalString(r.Gross), "38338712.0110000050626080"},
+		"discounts": {DecimalString(r.Discounts), "3672400.1887931039332"},
+		"taxes":     {DecimalString(r.Taxes), "5288110.3118620696638080"},
+		"IVA":       {DecimalString(r.TaxesByCode["IVA"]), "5288096.2718620696638080"},
+		"ENV":       {DecimalString(r.TaxesByCode["ENV"]), "14.04"},
+		"value":     {DecimalString(r.Value), "33050601.70"},
+	}
+
+	for name, e := range expecteds {
+		if !udfs(e.got).Equal(udfs(e.expected)) {
+			t.Errorf("[%s] got %s. Expected %s", name, e.got, e.expected)
+		}
+	}
+
+	if len(r.RoundingAdjustments) != 1 || !r.RoundingAdjustments[0].Adjustment.Equal(udfs("0.0008620646012")) {
+		t.Errorf("got rounding adjustments %v", r.RoundingAdjustments)
+	}
+}
+
+func TestRunFromBrute(t *testing.T) {
+	untax := NewAmountUnTax(udfs("190"))
+	untax.SetCode("IVA")
+
+	r := mustRun(t, NewFromBrute(udfs("1190")),
+		untax,
+		NewPercentualUnDiscount(udfs("0")),
+		NewUnitValue(udfs("4")),
+	)
+
+	if !r.Gross.Equal(udfs("1190")) {
+		t.Errorf("got gross %v. Expected 1190", r.Gross)
+	}
+
+	if !r.Net.Equal(udfs("1000")) {
+		t.Errorf("got net %v. Expected 1000", DecimalString(r.Net))
+	}
+
+	if !r.TaxesByCode["IVA"].Equal(udfs("190")) {
+		t.Errorf("got IVA %v. Expected 190", DecimalString(r.TaxesByCode["IVA"]))
+	}
+
+	if len(r.UnitValues) != 1 || !r.UnitValues[0].Equal(udfs("250")) {
+		t.Errorf("got unit values %v. Expected [250]", r.UnitValues)
+	}
+}
+
+func TestRunFromBruteNetIsUntaxedValue(t *testing.T) {
+	for i, untax := range []Visitor{NewPercentualUnTax(udfs("16")), NewPercentualUntaxRule(udfs("16"))} {
+		r := mustRun(t, NewFromBrute(udfs("1619.1")), untax, NamedSnapshot("net"), NewUnitValue(udfs("3")))
+
+		if !r.Net.Equal(udfs("1395.775862068965517")) || !r.Net.Equal(r.Steps[0].After) || !r.Net.Equal(r.Snapshots["net"]) {
+			t.Errorf("[test case %d] got net %s, step %s and snapshot %s. Expected 1395.775862068965517", i, DecimalString(r.Net), DecimalString(r.Steps[0].After), DecimalString(r.Snapshots["net"]))
+		}
+
+		if !r.Gross.Equal(udfs("1619.1")) {
+			t.Errorf("[test case %d] got gross %s. Expected 1619.1", i, DecimalString(r.Gross))
+		}
+	}
+}
+
+func TestRunWithoutTaxes(t *testing.T) {
+	r := mustRun(t, NewFromBrute(udfs("100")), NewUnitValue(udfs("4")))
+
+	if !r.Net.Equal(udfs("100")) || !r.Gross.Equal(udfs("100")) {
+		t.Errorf("got net %v gross %v. Expected 100", r.Net, r.Gross)
+	}
+
+	r = mustRun(t, NewFromUnitValue(udfs("25")), WithQTY(udfs("4")))
+
+	if !r.Net.Equal(udfs("100")) || !r.Gross.Equal(udfs("100")) {
+		t.Errorf("got net %v gross %v. Expected 100", r.Net, r.Gross)
+	}
+}
+
+func TestResultJSONRoundTrip(t *testing.T) {
+	th := NewTaxHandlerFromUnitValue()
+	th.WithPercentualTax(udfs("19"))
+
+	r := mustRun(t, NewFromUnitValue(udfs("10.05")),
+		WithQTY(udfs("3")),
+		NewPercentualDiscount(udfs("5")),
+		th,
+		NewUnitValue(udfs("3")),
+		NewRound(0),
+	)
+
+	data, err := json.Marshal(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Result
+
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	again, _ := json.Marshal(got)
+
+	if string(again) != string(data) {
+		t.Fatalf("round trip mismatch.\ngot      %s\nexpected %s", again, data)
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	qty := WithQTY(udfs("3"))
+	tax := NewPercTax(udfs("10"))
+
+	r := mustRun(t, NewFromUnitValue(udfs("10")), qty, tax)
+
+	if len(r.Steps) != 2 {
+		t.Fatalf("got %d steps. Expected 2", len(r.Steps))
+	}
+
+	if r.Steps[1].Visitor != tax || !r.Steps[1].Before.Equal(udfs("30")) || !r.Steps[1].After.Equal(udfs("33")) {
+		t.Errorf("got step %+v", r.Steps[1])
+	}
+}
+
+func TestTotals(t *testing.T) {
+	totals := NewTotals()
+
+	for _, entry := range []string{"100", "50.5"} {
+		tax := NewUnbufferedPercTax(udfs("19"))
+		tax.SetCode("IVA")
+		totals.Add(mustRun(t, NewFromUnitValue(udfs(entry)), WithQTY(udfs("2")), tax))
+	}
+
+	if totals.Lines != 2 {
+		t.Errorf("got %d lines. Expected 2", totals.Lines)
+	}
+
+	if !totals.Net.Equal(udfs("301")) || !totals.Gross.Equal(udfs("358.19")) || !totals.TaxesByCode["IVA"].Equal(udfs("57.19")) {
+		t.Errorf("got net %v gross %v IVA %v", DecimalString(totals.Net), DecimalString(totals.Gross), DecimalString(totals.TaxesByCode["IVA"]))
+	}
+}
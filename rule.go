@@ -0,0 +1,581 @@
+package johnny
+
+import (
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Rule = PercTaxRule{}
+var _ Rule = PercentualDiscountRule{}
+
+// Rule is an immutable visitor definition. Instead of storing the outcome of a visit in itself,
+// as the stateful visitors do, a rule writes it as an [Effect] into the given [RunContext],
+// so a single rule can be shared between lines and goroutines.
+//
+// Rules are also visitors, which apply themselves discarding their effects, so they can be
+// mixed with stateful visitors in any pipeline. [Run] records their effects in its [Result].
+type Rule interface {
+	Visitor
+	Apply(b Johnny, rc *RunContext)
+}
+
+// EffectKind tells what a rule did to the value of a Johnny.
+type EffectKind int
+
+const (
+	// DiscountEffect is a discount subtracted from the value.
+	DiscountEffect EffectKind = iota + 1
+	// UndiscountEffect is a discount removed from the value, adding it back.
+	UndiscountEffect
+	// TaxEffect is a tax calculated over the value, whether it was added to it or not.
+	TaxEffect
+	// UntaxEffect is a tax removed from the value.
+	UntaxEffect
+	// UnitValueEffect is a unit value calculated from the value.
+	UnitValueEffect
+	// WithholdingEffect is a withholding calculated over the value, which is left untouched.
+	WithholdingEffect
+	// UnwithholdingEffect is a withholding removed from a payable value, adding it back.
+	UnwithholdingEffect
+)
+
+// Effect is the outcome of applying a rule to a Johnny.
+// It doesn't reference the applied rule, as boxing it would allocate on every application.
+type Effect struct {
+	Kind EffectKind
+	// Code identifies the applied tax or withholding, if any.
+	Code string
+	// Ratio is the percentage of the discount, tax or withholding, calculated when the rule was defined by amount.
+	Ratio gyro.Gyro
+	// Amount is the discount, tax or withholding amount, calculated when the rule was defined by ratio.
+	// For unit values, it holds the calculated unit value.
+	Amount gyro.Gyro
+	// Base is the value the discount, tax, withholding or unit value was calculated over.
+	Base gyro.Gyro
+	// Exemption tells why a tax was not charged, leaving its amount zero. Reason is the code of its legal reason.
+	Exemption ExemptionKind
+	Reason    string
+}
+
+// RunContext collects the effects of the rules applied during a calculation.
+// A RunContext must not be shared between calculations running at the same time.
+type RunContext struct {
+	effects []Effect
+	// date is the date of the calculation, as the invoice date, which dated rules resolve their ratios with.
+	date time.Time
+	err  error
+	// qty is the product of the quantities applied by Qty rules, valid when hasQty is set.
+	qty    gyro.Gyro
+	hasQty bool
+}
+
+// NewRunContext returns a new empty instance of RunContext.
+func NewRunContext() *RunContext {
+	return &RunContext{}
+}
+
+// NewRunContextAt returns a new empty instance of RunContext for a calculation made at the given date.
+func NewRunContextAt(date time.Time) *RunContext {
+	return &RunContext{date: date}
+}
+
+// Record appends the given effect to the context.
+func (rc *RunContext) Record(e Effect) {
+	rc.effects = append(rc.effects, e)
+}
+
+// Effects returns the recorded effects, in the order they were recorded.
+func (rc *RunContext) Effects() []Effect {
+	effects := make([]Effect, len(rc.effects))
+	copy(effects, rc.effects)
+	return effects
+}
+
+// Date returns the date of the calculation, the zero time for a context without date.
+func (rc *RunContext) Date() time.Time {
+	return rc.date
+}
+
+// SetDate sets the date of the calculation.
+func (rc *RunContext) SetDate(date time.Time) {
+	rc.date = date
+}
+
+// Fail records an error of a rule which couldn't be applied. Only the first error is kept.
+func (rc *RunContext) Fail(err error) {
+	if rc.err == nil {
+		rc.err = err
+	}
+}
+
+// Err returns the first error recorded by a rule which couldn't be applied, if any.
+func (rc *RunContext) Err() error {
+	return rc.err
+}
+
+// Qty returns the quantity of the calculation, the product of the quantities applied by Qty rules,
+// or 1 when none was applied, as the Johnny holds the value of a single unit.
+func (rc *RunContext) Qty() gyro.Gyro {
+	if !rc.hasQty {
+		return gyro.NewOne()
+	}
+
+	return rc.qty
+}
+
+// SetQty sets the quantity of the calculation, as the one a FromBrute line is divided by with UnitValue.
+func (rc *RunContext) SetQty(qty gyro.Gyro) {
+	rc.qty, rc.hasQty = qty, true
+}
+
+// Reset removes the recorded effects, quantity and error, so the context can be used by another calculation.
+// The date is kept.
+func (rc *RunContext) Reset() {
+	rc.effects = rc.effects[:0]
+	rc.err = nil
+	rc.qty, rc.hasQty = gyro.Gyro{}, false
+}
+
+// boundRule is a visitor applying a rule and recording its effects in a run context.
+type boundRule struct {
+	rule Rule
+	rc   *RunContext
+}
+
+func (br boundRule) Visit(b Johnny) {
+	br.rule.Apply(b, br.rc)
+}
+
+// discountDef holds the definition shared by discount rules.
+type discountDef struct {
+	ratio  gyro.Gyro
+	amount gyro.Gyro
+}
+
+// Ratio returns the ratio of the discount.
+func (d discountDef) Ratio() gyro.Gyro {
+	return d.ratio
+}
+
+// Amount returns the fixed amount of the discount.
+func (d discountDef) Amount() gyro.Gyro {
+	return d.amount
+}
+
+// taxDef holds the definition shared by tax rules.
+type taxDef struct {
+	ratio     gyro.Gyro
+	amount    gyro.Gyro
+	code      string
+	exemption ExemptionKind
+	reason    string
+}
+
+// Ratio returns the ratio of the tax.
+func (t taxDef) Ratio() gyro.Gyro {
+	return t.ratio
+}
+
+// Amount returns the fixed amount of the tax.
+func (t taxDef) Amount() gyro.Gyro {
+	return t.amount
+}
+
+// Code returns the code identifying the tax.
+func (t taxDef) Code() string {
+	return t.code
+}
+
+// PercentualDiscountRule is the immutable definition of a [PercentualDiscount].
+type PercentualDiscountRule struct {
+	discountDef
+}
+
+// NewPercentualDiscountRule returns a new PercentualDiscountRule with the given ratio.
+func NewPercentualDiscountRule(ratio gyro.Gyro) PercentualDiscountRule {
+	return PercentualDiscountRule{discountDef{ratio: ratio}}
+}
+
+// Apply subtracts the percentual discount from the Johnny value and records it in rc.
+func (r PercentualDiscountRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit subtracts the percentual discount from the Johnny value.
+func (r PercentualDiscountRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercentualDiscountRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercentualDiscountRule) op() op {
+	return op{kind: opPercDiscount, value: r.ratio}
+}
+
+// AmountDiscountRule is the immutable definition of an [AmountDiscount].
+type AmountDiscountRule struct {
+	discountDef
+}
+
+// NewAmountDiscountRule returns a new AmountDiscountRule with the given fixed amount.
+func NewAmountDiscountRule(amount gyro.Gyro) AmountDiscountRule {
+	return AmountDiscountRule{discountDef{amount: amount}}
+}
+
+// Apply subtracts the fixed amount discount from the Johnny value and records it in rc.
+// Nothing is subtracted when the Johnny value is zero.
+func (r AmountDiscountRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit subtracts the fixed amount discount from the Johnny value.
+func (r AmountDiscountRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountDiscountRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountDiscountRule) op() op {
+	return op{kind: opAmountDiscount, value: r.amount}
+}
+
+// PercentualUndiscountRule is the immutable definition of a [PercentualUndiscount].
+type PercentualUndiscountRule struct {
+	discountDef
+}
+
+// NewPercentualUndiscountRule returns a new PercentualUndiscountRule with the given ratio.
+func NewPercentualUndiscountRule(ratio gyro.Gyro) PercentualUndiscountRule {
+	return PercentualUndiscountRule{discountDef{ratio: ratio}}
+}
+
+// Apply adds the percentual discount back to the Johnny value and records it in rc.
+func (r PercentualUndiscountRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit adds the percentual discount back to the Johnny value.
+func (r PercentualUndiscountRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercentualUndiscountRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercentualUndiscountRule) op() op {
+	return op{kind: opPercUndiscount, value: r.ratio}
+}
+
+// AmountUndiscountRule is the immutable definition of an [AmountUndiscount].
+type AmountUndiscountRule struct {
+	discountDef
+}
+
+// NewAmountUndiscountRule returns a new AmountUndiscountRule with the given fixed amount.
+func NewAmountUndiscountRule(amount gyro.Gyro) AmountUndiscountRule {
+	return AmountUndiscountRule{discountDef{amount: amount}}
+}
+
+// Apply adds the fixed amount discount back to the Johnny value and records it in rc.
+func (r AmountUndiscountRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit adds the fixed amount discount back to the Johnny value.
+func (r AmountUndiscountRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountUndiscountRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountUndiscountRule) op() op {
+	return op{kind: opAmountUndiscount, value: r.amount}
+}
+
+// PercTaxRule is the immutable definition of a [PercTax].
+type PercTaxRule struct {
+	taxDef
+}
+
+// NewPercTaxRule returns a new PercTaxRule with the given ratio.
+func NewPercTaxRule(ratio gyro.Gyro) PercTaxRule {
+	return PercTaxRule{taxDef{ratio: ratio}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r PercTaxRule) WithCode(code string) PercTaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r PercTaxRule) WithExemption(kind ExemptionKind, reason string) PercTaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply adds the percentual tax to the Johnny value and records it in rc.
+func (r PercTaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit adds the percentual tax to the Johnny value.
+func (r PercTaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercTaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercTaxRule) op() op {
+	return r.taxOp(opPercTax, r.ratio)
+}
+
+// UnbufferedPercTaxRule is the immutable definition of an [UnbufferedPercTax].
+type UnbufferedPercTaxRule struct {
+	taxDef
+}
+
+// NewUnbufferedPercTaxRule returns a new UnbufferedPercTaxRule with the given ratio.
+func NewUnbufferedPercTaxRule(ratio gyro.Gyro) UnbufferedPercTaxRule {
+	return UnbufferedPercTaxRule{taxDef{ratio: ratio}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r UnbufferedPercTaxRule) WithCode(code string) UnbufferedPercTaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r UnbufferedPercTaxRule) WithExemption(kind ExemptionKind, reason string) UnbufferedPercTaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply calculates the percentual tax over the Johnny value, without adding it, and records it in rc.
+func (r UnbufferedPercTaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit calculates the percentual tax over the Johnny value. As the tax is not added, it has no effect on the Johnny.
+func (r UnbufferedPercTaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r UnbufferedPercTaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r UnbufferedPercTaxRule) op() op {
+	return r.taxOp(opUnbufferedPercTax, r.ratio)
+}
+
+// AmountTaxRule is the immutable definition of an [AmountTax].
+type AmountTaxRule struct {
+	taxDef
+}
+
+// NewAmountTaxRule returns a new AmountTaxRule with the given fixed amount.
+func NewAmountTaxRule(amount gyro.Gyro) AmountTaxRule {
+	return AmountTaxRule{taxDef{amount: amount}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r AmountTaxRule) WithCode(code string) AmountTaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r AmountTaxRule) WithExemption(kind ExemptionKind, reason string) AmountTaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply adds the fixed amount tax to the Johnny value and records it in rc.
+func (r AmountTaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit adds the fixed amount tax to the Johnny value.
+func (r AmountTaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountTaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountTaxRule) op() op {
+	return r.taxOp(opAmountTax, r.amount)
+}
+
+// UnbufferedAmountTaxRule is the immutable definition of an [UnbufferedAmountTax].
+type UnbufferedAmountTaxRule struct {
+	taxDef
+}
+
+// NewUnbufferedAmountTaxRule returns a new UnbufferedAmountTaxRule with the given fixed amount.
+func NewUnbufferedAmountTaxRule(amount gyro.Gyro) UnbufferedAmountTaxRule {
+	return UnbufferedAmountTaxRule{taxDef{amount: amount}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r UnbufferedAmountTaxRule) WithCode(code string) UnbufferedAmountTaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r UnbufferedAmountTaxRule) WithExemption(kind ExemptionKind, reason string) UnbufferedAmountTaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply calculates the ratio of the fixed amount tax over the Johnny value, without adding it, and records it in rc.
+func (r UnbufferedAmountTaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit calculates the ratio of the fixed amount tax. As the tax is not added, it has no effect on the Johnny.
+func (r UnbufferedAmountTaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r UnbufferedAmountTaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r UnbufferedAmountTaxRule) op() op {
+	return r.taxOp(opUnbufferedAmountTax, r.amount)
+}
+
+// PercentualUntaxRule is the immutable definition of a [PercentualUntax].
+type PercentualUntaxRule struct {
+	taxDef
+}
+
+// NewPercentualUntaxRule returns a new PercentualUntaxRule with the given ratio.
+func NewPercentualUntaxRule(ratio gyro.Gyro) PercentualUntaxRule {
+	return PercentualUntaxRule{taxDef{ratio: ratio}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r PercentualUntaxRule) WithCode(code string) PercentualUntaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r PercentualUntaxRule) WithExemption(kind ExemptionKind, reason string) PercentualUntaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply removes the percentual tax from the Johnny value and records it in rc.
+func (r PercentualUntaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit removes the percentual tax from the Johnny value.
+func (r PercentualUntaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercentualUntaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercentualUntaxRule) op() op {
+	return r.taxOp(opPercUntax, r.ratio)
+}
+
+// AmountUntaxRule is the immutable definition of an [AmountUntax].
+type AmountUntaxRule struct {
+	taxDef
+}
+
+// NewAmountUntaxRule returns a new AmountUntaxRule with the given fixed amount.
+func NewAmountUntaxRule(amount gyro.Gyro) AmountUntaxRule {
+	return AmountUntaxRule{taxDef{amount: amount}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r AmountUntaxRule) WithCode(code string) AmountUntaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason code.
+// An exempted rule leaves the Johnny untouched, recording a zero amount over the value it was applied to.
+func (r AmountUntaxRule) WithExemption(kind ExemptionKind, reason string) AmountUntaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// Apply removes the fixed amount tax from the Johnny value and records it in rc.
+func (r AmountUntaxRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit removes the fixed amount tax from the Johnny value.
+func (r AmountUntaxRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountUntaxRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountUntaxRule) op() op {
+	return r.taxOp(opAmountUntax, r.amount)
+}
+
+// UnitValueRule is the immutable definition of a [UnitValue].
+type UnitValueRule struct {
+	qty gyro.Gyro
+}
+
+// NewUnitValueRule returns a new UnitValueRule dividing by the given quantity.
+func NewUnitValueRule(qty gyro.Gyro) UnitValueRule {
+	return UnitValueRule{qty: qty}
+}
+
+// Qty returns the quantity the Johnny value is divided by.
+func (r UnitValueRule) Qty() gyro.Gyro {
+	return r.qty
+}
+
+// Apply sets the Johnny value to its unit value and records it in rc.
+// The Johnny value is left untouched when the quantity is not positive.
+func (r UnitValueRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit sets the Johnny value to its unit value.
+func (r UnitValueRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r UnitValueRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r UnitValueRule) op() op {
+	return op{kind: opUnitValue, value: r.qty}
+}
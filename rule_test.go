@@ -0,0 +1,207 @@
+package johnny
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+func TestRulesMatchVisitors(t *testing.T) {
+	entry := udfs("1044.543103448276")
+
+	type ruleCase struct {
+		rule    Rule
+		visitor Visitor
+		// outcome returns the amount and ratio stored by the visitor.
+		outcome func() (gyro.Gyro, gyro.Gyro)
+	}
+
+	testCases := []ruleCase{}
+
+	add := func(r Rule, v Visitor, outcome func() (gyro.Gyro, gyro.Gyro)) {
+		testCases = append(testCases, ruleCase{r, v, outcome})
+	}
+
+	pd := NewPercentualDiscount(udfs("10"))
+	add(pd.Rule(), pd, func() (gyro.Gyro, gyro.Gyro) { return pd.Amount(), pd.Ratio() })
+	ad := NewAmountDiscount(udfs("100"))
+	add(ad.Rule(), ad, func() (gyro.Gyro, gyro.Gyro) { return ad.Amount(), ad.Ratio() })
+	pu := NewPercentualUnDiscount(udfs("10"))
+	add(pu.Rule(), pu, func() (gyro.Gyro, gyro.Gyro) { return pu.Amount(), pu.Ratio() })
+	au := NewAmountUnDiscount(udfs("100"))
+	add(au.Rule(), au, func() (gyro.Gyro, gyro.Gyro) { return au.Amount(), au.Ratio() })
+	pt := NewPercTax(udfs("16"))
+	add(pt.Rule(), pt, func() (gyro.Gyro, gyro.Gyro) { return pt.Amount(), pt.Ratio() })
+	upt := NewUnbufferedPercTax(udfs("16"))
+	add(upt.Rule(), upt, func() (gyro.Gyro, gyro.Gyro) { return upt.Amount(), upt.Ratio() })
+	at := NewAmountTax(udfs("14.08"))
+	add(at.Rule(), at, func() (gyro.Gyro, gyro.Gyro) { return at.Amount(), at.Ratio() })
+	uat := NewUnbufferedAmountTax(udfs("14.08"))
+	add(uat.Rule(), uat, func() (gyro.Gyro, gyro.Gyro) { return uat.Amount(), uat.Ratio() })
+	put := NewPercentualUnTax(udfs("16"))
+	add(put.Rule(), put, func() (gyro.Gyro, gyro.Gyro) { return put.Amount(), put.Ratio() })
+	aut := NewAmountUnTax(udfs("14.08"))
+	add(aut.Rule(), aut, func() (gyro.Gyro, gyro.Gyro) { return aut.Amount(), aut.Ratio() })
+	uv := NewUnitValue(udfs("3"))
+	add(uv.Rule(), uv, func() (gyro.Gyro, gyro.Gyro) { return uv.Get(), gyro.Gyro{} })
+
+	for i, tc := range testCases {
+		b1 := NewFromUnitValue(entry)
+		b1.Receive(tc.visitor)
+
+		rc := NewRunContext()
+		b2 := NewFromUnitValue(entry)
+		tc.rule.Apply(b2, rc)
+
+		if !b1.Value().Equal(b2.Value()) {
+			t.Errorf("[test case %d] got value %v. Expected %v", i, b2.Value(), b1.Value())
+		}
+
+		effects := rc.Effects()
+
+		if len(effects) != 1 {
+			t.Fatalf("[test case %d] got effects %+v", i, effects)
+		}
+
+		amount, ratio := tc.outcome()
+		e := effects[0]
+
+		if !e.Amount.Equal(amount) {
+			t.Errorf("[test case %d] got amount %v. Expected %v", i, e.Amount, amount)
+		}
+
+		if e.Kind != UnitValueEffect && !e.Ratio.Equal(ratio) {
+			t.Errorf("[test case %d] got ratio %v. Expected %v", i, e.Ratio, ratio)
+		}
+
+		// visiting a rule has the same effect on the value
+		b3 := NewFromUnitValue(entry)
+		b3.Receive(tc.rule)
+
+		if !b3.Value().Equal(b1.Value()) {
+			t.Errorf("[test case %d] got visited value %v. Expected %v", i, b3.Value(), b1.Value())
+		}
+	}
+}
+
+func TestRunRules(t *testing.T) {
+	entry := udfs("1044.543103448276")
+
+	stateful := mustRun(t, NewFromUnitValue(entry),
+		WithQTY(udfs("35157")),
+		NewPercentualDiscount(udfs("10")),
+		NewAmountDiscount(udfs("100")),
+		NewRound(2),
+		NewUnbufferedPercTax(udfs("16")),
+		NewUnbufferedAmountTax(udfs("14.08")),
+		NewUnitValue(udfs("35157")),
+	)
+
+	rules := []Visitor{
+		WithQTY(udfs("35157")),
+		NewPercentualDiscountRule(udfs("10")),
+		NewAmountDiscountRule(udfs("100")),
+		NewRound(2),
+		NewUnbufferedPercTaxRule(udfs("16")),
+		NewUnbufferedAmountTaxRule(udfs("14.08")),
+		NewUnitValueRule(udfs("35157")),
+	}
+
+	before, _ := json.Marshal(rules)
+
+	// the same rules are shared by every calculation
+	wg := sync.WaitGroup{}
+	results := make([]Result, 8)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			r, err := Run(NewFromUnitValue(entry), rules...)
+
+			if err != nil {
+				t.Error(err)
+			}
+
+			results[i] = r
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, got := range results {
+		if !got.Net.Equal(stateful.Net) || !got.Gross.Equal(stateful.Gross) ||
+			!got.Discounts.Equal(stateful.Discounts) || !got.Taxes.Equal(stateful.Taxes) ||
+			!got.UnitValues[0].Equal(stateful.UnitValues[0]) {
+			t.Errorf("[run %d] got %+v. Expected %+v", i, got, stateful)
+		}
+	}
+
+	after, _ := json.Marshal(rules)
+
+	if string(before) != string(after) {
+		t.Errorf("rules changed after running.\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+func TestRuleDivisions(t *testing.T) {
+	testCases := []struct {
+		b        Johnny
+		rule     Visitor
+		expected string
+	}{
+		{NewFromUnitValue(udfs("86250")), NewPercentualUndiscountRule(udfs("13.75")), "100000"},
+		{NewFromUnitValue(udfs("86250")), NewUnitValueRule(udfs("0.8625")), "100000"},
+		{NewFromBrute(udfs("1619.1")), NewPercentualUntaxRule(udfs("16")), "1395.775862068965517"},
+		{NewFromBrute(udfs("1619.1")), NewPercentualUnTax(udfs("16")), "1395.775862068965517"},
+	}
+
+	for i, tc := range testCases {
+		tc.b.Receive(tc.rule)
+
+		if !tc.b.Value().Equal(udfs(tc.expected)) {
+			t.Errorf("[test case %d] got %s. Expected %s", i, DecimalString(tc.b.Value()), tc.expected)
+		}
+	}
+}
+
+func TestRuleJSON(t *testing.T) {
+	data, err := json.Marshal(NewPercTaxRule(udfs("19")).WithCode("IVA"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := UnmarshalVisitor(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt, ok := v.(*PercTax)
+
+	if !ok {
+		t.Fatalf("got %T. Expected *PercTax", v)
+	}
+
+	if r := pt.Rule(); !r.Ratio().Equal(udfs("19")) || r.Code() != "IVA" {
+		t.Errorf("got rule ratio %v code %s. Expected 19 and IVA", r.Ratio(), r.Code())
+	}
+}
+
+func TestCloneVisitorsSharesRules(t *testing.T) {
+	r := NewPercTaxRule(udfs("19"))
+
+	clones, err := CloneVisitors([]Visitor{r})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clones[0] != Visitor(r) {
+		t.Errorf("got %v. Expected the rule itself", clones[0])
+	}
+}
@@ -0,0 +1,422 @@
+// Package salestax calculates the sales taxes of the United States with the johnny package. The tax of a sale
+// is stacked from the ones of the jurisdictions of its location, as the state, county, city and special
+// districts, each with its own rate and taxability of the product categories, and holidays exempting some
+// categories below a price threshold.
+//
+// Rules are read from local files with [LoadRules], so calculations don't depend on a live service.
+package salestax
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+// Level is the level of a jurisdiction.
+type Level int
+
+const (
+	// State is the level of the states.
+	State Level = iota
+	// County is the level of the counties, or parishes and boroughs.
+	County
+	// City is the level of the cities and towns.
+	City
+	// District is the level of the special purpose districts, as transit authorities.
+	District
+)
+
+var levelNames = [...]string{
+	State:    "state",
+	County:   "county",
+	City:     "city",
+	District: "district",
+}
+
+// String returns the name of the level, as "county".
+func (l Level) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return "unknown"
+	}
+
+	return levelNames[l]
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the level by its name.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *Level) UnmarshalText(text []byte) error {
+	for k, n := range levelNames {
+		if n == string(text) {
+			*l = Level(k)
+			return nil
+		}
+	}
+
+	return johnny.NewJohnnyError("unknown level " + string(text))
+}
+
+// Taxability is how a jurisdiction taxes a product category.
+type Taxability struct {
+	// Exempt tells whether the category is exempted from the tax of the jurisdiction.
+	Exempt bool
+	// Rate replaces the rate of the jurisdiction for the category when HasRate is set.
+	Rate    gyro.Gyro
+	HasRate bool
+}
+
+// Jurisdiction is a taxing jurisdiction.
+type Jurisdiction struct {
+	// Code identifies the jurisdiction, as "TX-AUSTIN".
+	Code  string
+	Name  string
+	Level Level
+	// Rate is the percentual rate of the jurisdiction.
+	Rate gyro.Gyro
+	// Categories holds the taxability of the product categories which are not taxed at the rate.
+	Categories map[string]Taxability
+}
+
+// Holiday is a sales tax holiday, exempting the items of some categories whose unit value doesn't exceed
+// the threshold from the taxes of some jurisdictions.
+type Holiday struct {
+	Name string
+	// From is the first day of the holiday, and To the day it ends, which is excluded.
+	From time.Time
+	To   time.Time
+	// Categories holds the product categories exempted.
+	Categories []string
+	// Threshold is the highest unit value exempted, no limit when zero.
+	Threshold gyro.Gyro
+	// Jurisdictions holds the codes of the jurisdictions whose taxes are exempted.
+	Jurisdictions []string
+}
+
+// applies tells whether the holiday exempts an item of the given category and unit value sold at date
+// from the taxes of the jurisdiction identified by code.
+func (h Holiday) applies(code, category string, unitValue gyro.Gyro, date time.Time) bool {
+	if date.Before(h.From) || !date.Before(h.To) {
+		return false
+	}
+
+	if !h.Threshold.Equal(gyro.NewZero()) && unitValue.Cmp(h.Threshold) > 0 {
+		return false
+	}
+
+	return contains(h.Categories, category) && contains(h.Jurisdictions, code)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules holds the jurisdictions and holidays sales are taxed with.
+type Rules struct {
+	jurisdictions map[string]Jurisdiction
+	holidays      []Holiday
+}
+
+// NewRules returns the rules of the given jurisdictions and holidays.
+// An error is returned if a jurisdiction is given twice, or a holiday refers to an unknown one.
+func NewRules(jurisdictions []Jurisdiction, holidays []Holiday) (*Rules, error) {
+	r := &Rules{jurisdictions: map[string]Jurisdiction{}}
+
+	for _, j := range jurisdictions {
+		if _, ok := r.jurisdictions[j.Code]; ok {
+			return nil, johnny.NewJohnnyError("jurisdiction " + j.Code + " given twice")
+		}
+
+		r.jurisdictions[j.Code] = j
+	}
+
+	for _, h := range holidays {
+		for _, code := range h.Jurisdictions {
+			if _, ok := r.jurisdictions[code]; !ok {
+				return nil, johnny.NewJohnnyError(fmt.Sprintf("holiday %s refers to unknown jurisdiction %s", h.Name, code))
+			}
+		}
+
+		r.holidays = append(r.holidays, h)
+	}
+
+	return r, nil
+}
+
+// Jurisdiction returns the jurisdiction identified by code, and false if there is none.
+func (r *Rules) Jurisdiction(code string) (Jurisdiction, bool) {
+	j, ok := r.jurisdictions[code]
+	return j, ok
+}
+
+type taxabilityJSON struct {
+	Exempt bool    `json:"exempt,omitempty"`
+	Rate   *string `json:"rate,omitempty"`
+}
+
+type jurisdictionJSON struct {
+	Code       string                    `json:"code"`
+	Name       string                    `json:"name"`
+	Level      Level                     `json:"level"`
+	Rate       string                    `json:"rate"`
+	Categories map[string]taxabilityJSON `json:"categories,omitempty"`
+}
+
+type holidayJSON struct {
+	Name          string   `json:"name"`
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	Categories    []string `json:"categories"`
+	Threshold     string   `json:"threshold,omitempty"`
+	Jurisdictions []string `json:"jurisdictions"`
+}
+
+type rulesJSON struct {
+	Jurisdictions []jurisdictionJSON `json:"jurisdictions"`
+	Holidays      []holidayJSON      `json:"holidays"`
+}
+
+// LoadRules reads the rules from a JSON file, as
+//
+//	{"jurisdictions": [
+//	  {"code": "TX", "name": "Texas", "level": "state", "rate": "6.25", "categories": {"grocery": {"exempt": true}}},
+//	  {"code": "TX-AUSTIN", "name": "Austin", "level": "city", "rate": "1"}
+//	], "holidays": [
+//	  {"name": "back to school", "from": "2025-08-08", "to": "2025-08-11", "categories": ["clothing"],
+//	   "threshold": "99.99", "jurisdictions": ["TX", "TX-AUSTIN"]}
+//	]}
+//
+// Dates follow [johnny.DateLayout], and the day of "to" is excluded from the holiday.
+func LoadRules(r io.Reader) (*Rules, error) {
+	var j rulesJSON
+
+	if err := json.NewDecoder(r).Decode(&j); err != nil {
+		return nil, err
+	}
+
+	jurisdictions := make([]Jurisdiction, 0, len(j.Jurisdictions))
+
+	for _, jj := range j.Jurisdictions {
+		rate, err := johnny.ParseDecimal(jj.Rate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		jur := Jurisdiction{Code: jj.Code, Name: jj.Name, Level: jj.Level, Rate: rate, Categories: map[string]Taxability{}}
+
+		for category, t := range jj.Categories {
+			tx := Taxability{Exempt: t.Exempt}
+
+			if t.Rate != nil {
+				if tx.Rate, err = johnny.ParseDecimal(*t.Rate); err != nil {
+					return nil, err
+				}
+
+				tx.HasRate = true
+			}
+
+			jur.Categories[category] = tx
+		}
+
+		jurisdictions = append(jurisdictions, jur)
+	}
+
+	holidays := make([]Holiday, 0, len(j.Holidays))
+
+	for _, hj := range j.Holidays {
+		h := Holiday{Name: hj.Name, Categories: hj.Categories, Jurisdictions: hj.Jurisdictions}
+		var err error
+
+		if h.From, err = time.Parse(johnny.DateLayout, hj.From); err != nil {
+			return nil, johnny.NewJohnnyError(fmt.Sprintf("invalid date %q of holiday %s", hj.From, hj.Name))
+		}
+
+		if h.To, err = time.Parse(johnny.DateLayout, hj.To); err != nil {
+			return nil, johnny.NewJohnnyError(fmt.Sprintf("invalid date %q of holiday %s", hj.To, hj.Name))
+		}
+
+		if hj.Threshold != "" {
+			if h.Threshold, err = johnny.ParseDecimal(hj.Threshold); err != nil {
+				return nil, err
+			}
+		}
+
+		holidays = append(holidays, h)
+	}
+
+	return NewRules(jurisdictions, holidays)
+}
+
+// Item is a sale of a product.
+type Item struct {
+	// Category is the product category, as "clothing". Products without category are taxed at the rates.
+	Category  string
+	Qty       gyro.Gyro
+	UnitValue gyro.Gyro
+	// Date is the date of the sale, which holidays are checked with.
+	Date time.Time
+	// Location holds the codes of the jurisdictions the sale is taxed in, as "TX", "TX-TRAVIS" and "TX-AUSTIN".
+	Location []string
+}
+
+// JurisdictionTax is the tax of a jurisdiction over a sale or a document.
+type JurisdictionTax struct {
+	Jurisdiction Jurisdiction
+	// Rate is the rate applied, the one of the category when it has its own.
+	Rate gyro.Gyro
+	// Base is the value the tax is calculated over.
+	Base   gyro.Gyro
+	Amount gyro.Gyro
+	// Exemption tells why the tax is not charged, and Reason is the category or the holiday exempting it.
+	Exemption johnny.ExemptionKind
+	Reason    string
+}
+
+// Visitors returns the visitors calculating the taxes of the item, one for each jurisdiction of its location,
+// all of them over the value of the item, which they don't change. The taxes are coded by jurisdiction.
+// An error is returned if a jurisdiction of the location is unknown.
+func (r *Rules) Visitors(it Item) ([]johnny.Visitor, error) {
+	taxes, err := r.taxes(it)
+
+	if err != nil {
+		return nil, err
+	}
+
+	visitors := make([]johnny.Visitor, 0, len(taxes))
+
+	for _, t := range taxes {
+		visitors = append(visitors, t.rule())
+	}
+
+	return visitors, nil
+}
+
+// taxes returns the taxes of the item without amounts.
+func (r *Rules) taxes(it Item) ([]JurisdictionTax, error) {
+	taxes := make([]JurisdictionTax, 0, len(it.Location))
+
+	for _, code := range it.Location {
+		j, ok := r.jurisdictions[code]
+
+		if !ok {
+			return nil, johnny.NewJohnnyError("unknown jurisdiction " + code)
+		}
+
+		t := JurisdictionTax{Jurisdiction: j, Rate: j.Rate}
+
+		if tx, ok := j.Categories[it.Category]; ok {
+			if tx.HasRate {
+				t.Rate = tx.Rate
+			}
+
+			if tx.Exempt {
+				t.Exemption, t.Reason = johnny.Exempt, it.Category
+			}
+		}
+
+		for _, h := range r.holidays {
+			if t.Exemption == johnny.NotExempt && h.applies(code, it.Category, it.UnitValue, it.Date) {
+				t.Exemption, t.Reason = johnny.Exempt, h.Name
+			}
+		}
+
+		taxes = append(taxes, t)
+	}
+
+	return taxes, nil
+}
+
+func (t JurisdictionTax) rule() johnny.Rule {
+	rule := johnny.NewUnbufferedPercTaxRule(t.Rate).WithCode(t.Jurisdiction.Code)
+
+	if t.Exemption != johnny.NotExempt {
+		rule = rule.WithExemption(t.Exemption, t.Reason)
+	}
+
+	return rule
+}
+
+// Line is a calculated item, with the tax of each jurisdiction of its location.
+type Line struct {
+	Item   Item
+	Taxes  []JurisdictionTax
+	Result johnny.Result
+}
+
+// Calculate calculates the taxes of the item over its quantity times its unit value.
+// An error is returned if a jurisdiction of its location is unknown.
+func (r *Rules) Calculate(it Item) (Line, error) {
+	taxes, err := r.taxes(it)
+
+	if err != nil {
+		return Line{}, err
+	}
+
+	visitors := make([]johnny.Visitor, 0, len(taxes)+1)
+	visitors = append(visitors, johnny.WithQTY(it.Qty))
+
+	for _, t := range taxes {
+		visitors = append(visitors, t.rule())
+	}
+
+	res, err := johnny.Run(johnny.NewFromUnitValue(it.UnitValue), visitors...)
+
+	if err != nil {
+		return Line{}, err
+	}
+
+	for i := range taxes {
+		taxes[i].Base = res.Net
+		taxes[i].Amount = res.TaxesByCode[taxes[i].Jurisdiction.Code]
+	}
+
+	return Line{Item: it, Taxes: taxes, Result: res}, nil
+}
+
+// Summarize returns the taxes of a document per jurisdiction, in order of appearance, with the bases and
+// amounts of its lines added and rounded to cents. Lines taxed at another rate or exempted are reported apart,
+// in a tax per jurisdiction, rate and reason.
+func Summarize(lines ...Line) []JurisdictionTax {
+	var taxes []JurisdictionTax
+
+	for _, l := range lines {
+		for _, t := range l.Taxes {
+			i := 0
+
+			for ; i < len(taxes); i++ {
+				s := taxes[i]
+
+				if s.Jurisdiction.Code == t.Jurisdiction.Code && s.Exemption == t.Exemption && s.Reason == t.Reason && s.Rate.Equal(t.Rate) {
+					break
+				}
+			}
+
+			if i == len(taxes) {
+				taxes = append(taxes, JurisdictionTax{Jurisdiction: t.Jurisdiction, Rate: t.Rate, Exemption: t.Exemption, Reason: t.Reason})
+			}
+
+			taxes[i].Base = taxes[i].Base.Add(t.Base)
+			taxes[i].Amount = taxes[i].Amount.Add(t.Amount)
+		}
+	}
+
+	for i := range taxes {
+		taxes[i].Base = taxes[i].Base.Round(2)
+		taxes[i].Amount = taxes[i].Amount.Round(2)
+	}
+
+	return taxes
+}
@@ -0,0 +1,136 @@
+package salestax
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse(johnny.DateLayout, s)
+	return d
+}
+
+const rulesFile = `{"jurisdictions": [
+  {"code": "TX", "name": "Texas", "level": "state", "rate": "6.25", "categories": {"grocery": {"exempt": true}}},
+  {"code": "TX-TRAVIS", "name": "Travis County", "level": "county", "rate": "0"},
+  {"code": "TX-AUSTIN", "name": "Austin", "level": "city", "rate": "1"},
+  {"code": "TX-AUSTIN-MTA", "name": "Austin MTA", "level": "district", "rate": "1", "categories": {"prepared-food": {"rate": "0.5"}}},
+  {"code": "TX-AUSTIN-HEALTH", "name": "Travis County Health District", "level": "district", "rate": "0.25"}
+], "holidays": [
+  {"name": "back to school", "from": "2025-08-08", "to": "2025-08-11", "categories": ["clothing"], "threshold": "99.99", "jurisdictions": ["TX", "TX-AUSTIN", "TX-AUSTIN-MTA", "TX-AUSTIN-HEALTH"]}
+]}`
+
+var austin = []string{"TX", "TX-TRAVIS", "TX-AUSTIN", "TX-AUSTIN-MTA", "TX-AUSTIN-HEALTH"}
+
+func TestCalculate(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(rulesFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		item    Item
+		amounts []string
+		total   string
+	}{
+		{Item{Qty: udfs("2"), UnitValue: udfs("50"), Date: date("2025-06-01"), Location: austin}, []string{"6.25", "0", "1", "1", "0.25"}, "8.5"},
+		// each jurisdiction has its own taxability
+		{Item{Category: "grocery", Qty: udfs("1"), UnitValue: udfs("40"), Date: date("2025-06-01"), Location: austin}, []string{"0", "0", "0.4", "0.4", "0.1"}, "0.9"},
+		{Item{Category: "prepared-food", Qty: udfs("1"), UnitValue: udfs("20"), Date: date("2025-06-01"), Location: austin}, []string{"1.25", "0", "0.2", "0.1", "0.05"}, "1.6"},
+		// holidays exempt the items below the threshold during the holiday
+		{Item{Category: "clothing", Qty: udfs("3"), UnitValue: udfs("99.99"), Date: date("2025-08-10"), Location: austin}, []string{"0", "0", "0", "0", "0"}, "0"},
+		{Item{Category: "clothing", Qty: udfs("1"), UnitValue: udfs("120"), Date: date("2025-08-10"), Location: austin}, []string{"7.5", "0", "1.2", "1.2", "0.3"}, "10.2"},
+		{Item{Category: "clothing", Qty: udfs("1"), UnitValue: udfs("80"), Date: date("2025-08-11"), Location: austin}, []string{"5", "0", "0.8", "0.8", "0.2"}, "6.8"},
+		{Item{Qty: udfs("1"), UnitValue: udfs("80"), Date: date("2025-08-10"), Location: []string{"TX"}}, []string{"5"}, "5"},
+	}
+
+	for i, tc := range testCases {
+		l, err := rules.Calculate(tc.item)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if len(l.Taxes) != len(tc.amounts) {
+			t.Fatalf("[test case %d] got %d taxes. Expected %d", i, len(l.Taxes), len(tc.amounts))
+		}
+
+		for j, tax := range l.Taxes {
+			if !tax.Amount.Equal(udfs(tc.amounts[j])) || !tax.Base.Equal(tc.item.Qty.Mul(tc.item.UnitValue)) {
+				t.Errorf("[test case %d] got %v over %v for %s. Expected %v", i, tax.Amount, tax.Base, tax.Jurisdiction.Code, tc.amounts[j])
+			}
+		}
+
+		if !l.Result.Taxes.Equal(udfs(tc.total)) {
+			t.Errorf("[test case %d] got total %v. Expected %v", i, l.Result.Taxes, tc.total)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(rulesFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []Item{
+		{Qty: udfs("1"), UnitValue: udfs("10.99"), Date: date("2025-08-09"), Location: austin},
+		{Qty: udfs("1"), UnitValue: udfs("5.55"), Date: date("2025-08-09"), Location: austin},
+		{Category: "clothing", Qty: udfs("1"), UnitValue: udfs("30"), Date: date("2025-08-09"), Location: austin},
+	}
+
+	lines := make([]Line, 0, len(items))
+
+	for _, it := range items {
+		l, err := rules.Calculate(it)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, l)
+	}
+
+	taxes := Summarize(lines...)
+
+	// 6.25% of 16.54 is 1.03375
+	if len(taxes) != 9 || taxes[0].Jurisdiction.Code != "TX" || !taxes[0].Base.Equal(udfs("16.54")) || !taxes[0].Amount.Equal(udfs("1.03")) {
+		t.Fatalf("got %+v", taxes)
+	}
+
+	last := taxes[len(taxes)-1]
+
+	if last.Jurisdiction.Code != "TX-AUSTIN-HEALTH" || last.Exemption != johnny.Exempt || last.Reason != "back to school" || !last.Base.Equal(udfs("30")) {
+		t.Errorf("got %+v", last)
+	}
+}
+
+func TestRulesErrors(t *testing.T) {
+	rules, _ := LoadRules(strings.NewReader(rulesFile))
+
+	if _, err := rules.Calculate(Item{Qty: udfs("1"), UnitValue: udfs("1"), Location: []string{"CA"}}); err == nil {
+		t.Errorf("error expected for an unknown jurisdiction")
+	}
+
+	for i, data := range []string{
+		`{"jurisdictions": [{"code": "TX", "rate": "6.25"}, {"code": "TX", "rate": "6.25"}]}`,
+		`{"jurisdictions": [{"code": "TX", "rate": "6.25"}], "holidays": [{"name": "h", "from": "2025-08-08", "to": "2025-08-11", "jurisdictions": ["CA"]}]}`,
+		`{"jurisdictions": [{"code": "TX", "rate": "6.25", "level": "country"}]}`,
+		`{"jurisdictions": [{"code": "TX", "rate": "6.25"}], "holidays": [{"name": "h", "from": "08/08/2025", "to": "2025-08-11"}]}`,
+	} {
+		if _, err := LoadRules(strings.NewReader(data)); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
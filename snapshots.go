@@ -0,0 +1,105 @@
+package johnny
+
+import (
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Visitor = NamedSnapshot("")
+
+// Snapshots is a registry of values captured by name during a calculation,
+// as "net" or "net_without_discount", so they can be looked up later by reports.
+type Snapshots struct {
+	values map[string]gyro.Gyro
+	// names keeps the order in which the snapshots were first taken.
+	names []string
+}
+
+// NewSnapshots returns a new empty instance of Snapshots.
+func NewSnapshots() *Snapshots {
+	return &Snapshots{
+		values: map[string]gyro.Gyro{},
+	}
+}
+
+// Set stores v under the given name, replacing any previous value with that name.
+func (s *Snapshots) Set(name string, v gyro.Gyro) {
+	if _, ok := s.values[name]; !ok {
+		s.names = append(s.names, name)
+	}
+
+	s.values[name] = v
+}
+
+// Get returns the value stored under the given name,
+// and whether a snapshot with that name was taken.
+func (s *Snapshots) Get(name string) (gyro.Gyro, bool) {
+	v, ok := s.values[name]
+	return v, ok
+}
+
+// Names returns the names of the taken snapshots, in the order they were first taken.
+func (s *Snapshots) Names() []string {
+	names := make([]string, len(s.names))
+	copy(names, s.names)
+	return names
+}
+
+// Len returns the number of taken snapshots.
+func (s *Snapshots) Len() int {
+	return len(s.names)
+}
+
+// Diff returns the value of the snapshot named to minus the value of the snapshot named from.
+// An error is returned if any of both snapshots was not taken.
+func (s *Snapshots) Diff(from, to string) (gyro.Gyro, error) {
+	f, ok := s.values[from]
+
+	if !ok {
+		return gyro.Gyro{}, NewJohnnyError("snapshot " + from + " not found")
+	}
+
+	t, ok := s.values[to]
+
+	if !ok {
+		return gyro.Gyro{}, NewJohnnyError("snapshot " + to + " not found")
+	}
+
+	return t.Sub(f), nil
+}
+
+// Map returns a copy of the taken snapshots keyed by name.
+func (s *Snapshots) Map() map[string]gyro.Gyro {
+	m := make(map[string]gyro.Gyro, len(s.values))
+
+	for k, v := range s.values {
+		m[k] = v
+	}
+
+	return m
+}
+
+// Reset removes every snapshot, keeping the allocated memory.
+func (s *Snapshots) Reset() {
+	clear(s.values)
+	s.names = s.names[:0]
+}
+
+// Clone returns an independent copy of the registry.
+func (s *Snapshots) Clone() *Snapshots {
+	return &Snapshots{
+		values: s.Map(),
+		names:  s.Names(),
+	}
+}
+
+// NamedSnapshot is a visitor that stores the current value of the Johnny
+// in its snapshots registry, under the name given by the visitor.
+//
+//	b.Receive(johnny.NamedSnapshot("net"))
+//	net, _ := b.Snapshots().Get("net")
+type NamedSnapshot string
+
+// Visit stores the current value of the Johnny under the snapshot name.
+func (n NamedSnapshot) Visit(b Johnny) {
+	b.Snapshots().Set(string(n), b.Value())
+}
@@ -0,0 +1,110 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNamedSnapshot(t *testing.T) {
+	b := NewFromBrute(udfs("1190"))
+
+	r := mustRun(t, b,
+		NamedSnapshot("brute"),
+		NewAmountUnTax(udfs("190")),
+		NamedSnapshot("net"),
+		NewAmountUnDiscount(udfs("100")),
+		NamedSnapshot("net_without_discount"),
+	)
+
+	expecteds := map[string]string{
+		"brute":                "1190",
+		"net":                  "1000",
+		"net_without_discount": "1100",
+	}
+
+	for name, expected := range expecteds {
+		got, ok := b.Snapshots().Get(name)
+
+		if !ok || !got.Equal(udfs(expected)) {
+			t.Errorf("[%s] got %v, %v. Expected %s", name, got, ok, expected)
+		}
+
+		if !r.Snapshots[name].Equal(udfs(expected)) {
+			t.Errorf("[%s] got result snapshot %v. Expected %s", name, r.Snapshots[name], expected)
+		}
+	}
+
+	names := b.Snapshots().Names()
+
+	if len(names) != 3 || names[0] != "brute" || names[1] != "net" || names[2] != "net_without_discount" {
+		t.Errorf("got names %v", names)
+	}
+
+	if _, ok := b.Snapshots().Get("gross"); ok {
+		t.Errorf("snapshot gross should not exist")
+	}
+}
+
+func TestSnapshotsDiff(t *testing.T) {
+	s := NewSnapshots()
+	s.Set("net", udfs("1000"))
+	s.Set("brute", udfs("1190"))
+	s.Set("net", udfs("1000.5"))
+
+	d, err := s.Diff("net", "brute")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !d.Equal(udfs("189.5")) {
+		t.Errorf("got diff %v. Expected 189.5", d)
+	}
+
+	if s.Len() != 2 || s.Names()[0] != "net" {
+		t.Errorf("overwriting a snapshot should keep its position. Got %v", s.Names())
+	}
+
+	if _, err := s.Diff("net", "gross"); err == nil {
+		t.Errorf("error expected diffing against a missing snapshot")
+	}
+}
+
+func TestNamedSnapshotJSON(t *testing.T) {
+	b := NewFromUnitValue(udfs("10.05"))
+	b.Receive(NamedSnapshot("unit"))
+	b.Receive(WithQTY(udfs("3")))
+	b.Receive(NamedSnapshot("net"))
+
+	data, err := json.Marshal(b)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := UnmarshalJohnny(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := got.Snapshots().Names()
+
+	if len(names) != 2 || names[0] != "unit" || names[1] != "net" {
+		t.Fatalf("got names %v", names)
+	}
+
+	if net, _ := got.Snapshots().Get("net"); !net.Equal(udfs("30.15")) {
+		t.Errorf("got net %v. Expected 30.15", net)
+	}
+
+	v, err := UnmarshalVisitor([]byte(`{"type":"named_snapshot","name":"net"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != NamedSnapshot("net") {
+		t.Errorf("got visitor %v. Expected NamedSnapshot(net)", v)
+	}
+}
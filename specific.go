@@ -0,0 +1,288 @@
+package johnny
+
+import (
+	"math/big"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Rule = SpecificTaxRule{}
+var _ Rule = SpecificUntaxRule{}
+
+// StepRounding tells how the quantity of a specific tax charged by steps, as "0.04 per 100 units",
+// is turned into a number of steps.
+type StepRounding int
+
+const (
+	// ProportionalSteps charges the steps proportionally, so 150 units are 1.5 steps of 100.
+	ProportionalSteps StepRounding = iota
+	// RoundSteps rounds the number of steps half away from zero, so 150 units are 2 steps of 100 and 149 are 1.
+	RoundSteps
+	// StartedSteps charges every started step, so 101 units are 2 steps of 100.
+	StartedSteps
+	// CompleteSteps charges only the complete steps, so 199 units are 1 step of 100.
+	CompleteSteps
+)
+
+var stepRoundingNames = [...]string{
+	ProportionalSteps: "proportional",
+	RoundSteps:        "round",
+	StartedSteps:      "started",
+	CompleteSteps:     "complete",
+}
+
+// String returns the name of the step rounding, as "started".
+func (s StepRounding) String() string {
+	if s < 0 || int(s) >= len(stepRoundingNames) {
+		return "unknown"
+	}
+
+	return stepRoundingNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler, encoding the step rounding by its name.
+func (s StepRounding) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *StepRounding) UnmarshalText(text []byte) error {
+	for k, n := range stepRoundingNames {
+		if n == string(text) {
+			*s = StepRounding(k)
+			return nil
+		}
+	}
+
+	return NewJohnnyError("unknown step rounding " + string(text))
+}
+
+// specificDef holds the definition shared by specific tax rules.
+type specificDef struct {
+	// rate is the amount charged per step of the unit of measure.
+	rate gyro.Gyro
+	// factor converts a unit of the quantity to the unit of measure of the rate, one when zero.
+	factor gyro.Gyro
+	// step is the number of units of measure the rate is charged per, one when zero.
+	step     gyro.Gyro
+	rounding StepRounding
+	// qty is the quantity the tax is calculated for, the one of the calculation when not set.
+	qty    gyro.Gyro
+	hasQty bool
+}
+
+// amount returns the tax amount for the given quantity, and an error if it overflows gyro.
+func (s specificDef) amount(qty gyro.Gyro) (gyro.Gyro, error) {
+	if s.hasQty {
+		qty = s.qty
+	}
+
+	steps := GyroToRat(qty)
+
+	if !s.factor.Equal(gyro.NewZero()) {
+		steps.Mul(steps, GyroToRat(s.factor))
+	}
+
+	if !s.step.Equal(gyro.NewZero()) {
+		steps.Quo(steps, GyroToRat(s.step))
+	}
+
+	switch s.rounding {
+	case RoundSteps:
+		steps = roundRat(steps, 0)
+	case StartedSteps, CompleteSteps:
+		n, rem := new(big.Int).QuoRem(steps.Num(), steps.Denom(), new(big.Int))
+
+		// QuoRem truncates toward zero, which completes the steps; started ones go away from zero
+		if s.rounding == StartedSteps && rem.Sign() != 0 {
+			n.Add(n, big.NewInt(int64(rem.Sign())))
+		}
+
+		steps.SetInt(n)
+	}
+
+	steps.Mul(steps, GyroToRat(s.rate))
+
+	// proportional steps may not have a finite decimal expansion
+	scale, ok := decimalScale(steps.Denom())
+
+	if !ok || scale > gyro.MaxDivisionScale {
+		scale = gyro.MaxDivisionScale
+	}
+
+	return RatToGyro(steps, int32(scale))
+}
+
+// SpecificTaxRule is a tax charged per unit of measure, as the excise duties on fuel, alcohol or sugary
+// drinks, which is added to the Johnny value. Its amount is calculated from the quantity of the calculation,
+// set by the Qty rules of the [Run], optionally converted to the unit of measure of the rate and charged
+// by steps, as "0.04 per 100 units, rounded":
+//
+//	NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), RoundSteps)
+type SpecificTaxRule struct {
+	taxDef
+	specific specificDef
+}
+
+// NewSpecificTaxRule returns a new SpecificTaxRule charging rate per unit of the quantity.
+func NewSpecificTaxRule(rate gyro.Gyro) SpecificTaxRule {
+	return SpecificTaxRule{specific: specificDef{rate: rate}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r SpecificTaxRule) WithCode(code string) SpecificTaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason.
+func (r SpecificTaxRule) WithExemption(kind ExemptionKind, reason string) SpecificTaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// WithConversion returns a copy of the rule converting each unit of the quantity to factor units of measure
+// of the rate, as 0.35 for cans of 350 ml taxed per liter.
+func (r SpecificTaxRule) WithConversion(factor gyro.Gyro) SpecificTaxRule {
+	r.specific.factor = factor
+	return r
+}
+
+// WithStep returns a copy of the rule charging the rate per step units of measure, counted as rounding tells.
+func (r SpecificTaxRule) WithStep(step gyro.Gyro, rounding StepRounding) SpecificTaxRule {
+	r.specific.step, r.specific.rounding = step, rounding
+	return r
+}
+
+// WithQty returns a copy of the rule calculated for the given quantity instead of the one of the calculation.
+func (r SpecificTaxRule) WithQty(qty gyro.Gyro) SpecificTaxRule {
+	r.specific.qty, r.specific.hasQty = qty, true
+	return r
+}
+
+// Rate returns the amount charged per step of the unit of measure.
+func (r SpecificTaxRule) Rate() gyro.Gyro {
+	return r.specific.rate
+}
+
+// Amount returns the tax amount for the given quantity, unless the rule has its own.
+// An error is returned if the amount overflows gyro.
+func (r SpecificTaxRule) Amount(qty gyro.Gyro) (gyro.Gyro, error) {
+	return r.specific.amount(qty)
+}
+
+// Apply adds the tax for the quantity of rc to the Johnny value and records it in rc.
+// When the amount overflows gyro, the Johnny is left untouched and the error is recorded in rc.
+func (r SpecificTaxRule) Apply(b Johnny, rc *RunContext) {
+	o, err := r.op(rc.Qty())
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	rc.Record(applyOp(b, o))
+}
+
+// Visit adds the tax for a single unit, or the quantity of the rule, to the Johnny value.
+// It panics when the amount overflows gyro, as a visitor can't report it.
+func (r SpecificTaxRule) Visit(b Johnny) {
+	o, err := r.op(gyro.NewOne())
+
+	if err != nil {
+		panic(err)
+	}
+
+	applyOp(b, o)
+}
+
+// op returns the operation of the tax for a calculation of the given quantity.
+func (r SpecificTaxRule) op(qty gyro.Gyro) (op, error) {
+	amount, err := r.specific.amount(qty)
+	return r.taxOp(opAmountTax, amount), err
+}
+
+// SpecificUntaxRule is the reverse of a [SpecificTaxRule], subtracting the tax from the Johnny value.
+// As FromBrute lines are divided by their quantity at the end of the pipeline, with UnitValue, the quantity
+// is usually given with WithQty.
+type SpecificUntaxRule struct {
+	taxDef
+	specific specificDef
+}
+
+// NewSpecificUntaxRule returns a new SpecificUntaxRule removing rate per unit of the quantity.
+func NewSpecificUntaxRule(rate gyro.Gyro) SpecificUntaxRule {
+	return SpecificUntaxRule{specific: specificDef{rate: rate}}
+}
+
+// WithCode returns a copy of the rule identified by the given tax code.
+func (r SpecificUntaxRule) WithCode(code string) SpecificUntaxRule {
+	r.code = code
+	return r
+}
+
+// WithExemption returns a copy of the rule exempted by the given kind and reason.
+func (r SpecificUntaxRule) WithExemption(kind ExemptionKind, reason string) SpecificUntaxRule {
+	r.exemption, r.reason = kind, reason
+	return r
+}
+
+// WithConversion returns a copy of the rule converting each unit of the quantity to factor units of measure.
+func (r SpecificUntaxRule) WithConversion(factor gyro.Gyro) SpecificUntaxRule {
+	r.specific.factor = factor
+	return r
+}
+
+// WithStep returns a copy of the rule removing the rate per step units of measure, counted as rounding tells.
+func (r SpecificUntaxRule) WithStep(step gyro.Gyro, rounding StepRounding) SpecificUntaxRule {
+	r.specific.step, r.specific.rounding = step, rounding
+	return r
+}
+
+// WithQty returns a copy of the rule calculated for the given quantity instead of the one of the calculation.
+func (r SpecificUntaxRule) WithQty(qty gyro.Gyro) SpecificUntaxRule {
+	r.specific.qty, r.specific.hasQty = qty, true
+	return r
+}
+
+// Rate returns the amount removed per step of the unit of measure.
+func (r SpecificUntaxRule) Rate() gyro.Gyro {
+	return r.specific.rate
+}
+
+// Amount returns the tax amount for the given quantity, unless the rule has its own.
+// An error is returned if the amount overflows gyro.
+func (r SpecificUntaxRule) Amount(qty gyro.Gyro) (gyro.Gyro, error) {
+	return r.specific.amount(qty)
+}
+
+// Apply subtracts the tax for the quantity of rc from the Johnny value and records it in rc.
+// When the amount overflows gyro, the Johnny is left untouched and the error is recorded in rc.
+func (r SpecificUntaxRule) Apply(b Johnny, rc *RunContext) {
+	o, err := r.op(rc.Qty())
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	rc.Record(applyOp(b, o))
+}
+
+// Visit subtracts the tax for a single unit, or the quantity of the rule, from the Johnny value.
+// It panics when the amount overflows gyro, as a visitor can't report it.
+func (r SpecificUntaxRule) Visit(b Johnny) {
+	o, err := r.op(gyro.NewOne())
+
+	if err != nil {
+		panic(err)
+	}
+
+	applyOp(b, o)
+}
+
+// op returns the operation of the tax for a calculation of the given quantity.
+func (r SpecificUntaxRule) op(qty gyro.Gyro) (op, error) {
+	amount, err := r.specific.amount(qty)
+	return r.taxOp(opAmountUntax, amount), err
+}
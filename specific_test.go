@@ -0,0 +1,156 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSpecificTax(t *testing.T) {
+	testCases := []struct {
+		visitors []Visitor
+		amount   string
+	}{
+		// packaging tax of 0.04 per 100 units
+		{[]Visitor{WithQTY(udfs("35157")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), RoundSteps)}, "14.08"},
+		{[]Visitor{WithQTY(udfs("35149")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), RoundSteps)}, "14.04"},
+		{[]Visitor{WithQTY(udfs("35101")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), StartedSteps)}, "14.08"},
+		{[]Visitor{WithQTY(udfs("35199")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), CompleteSteps)}, "14.04"},
+		{[]Visitor{WithQTY(udfs("35157")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), ProportionalSteps)}, "14.0628"},
+		// 24 cans of 350 ml taxed per liter
+		{[]Visitor{WithQTY(udfs("24")), NewSpecificTaxRule(udfs("0.5")).WithConversion(udfs("0.35"))}, "4.2"},
+		// quantities are multiplied
+		{[]Visitor{WithQTY(udfs("2")), WithQTY(udfs("3")), NewSpecificTaxRule(udfs("1.5"))}, "9"},
+		// a line without quantity is a single unit
+		{[]Visitor{NewSpecificTaxRule(udfs("1.5"))}, "1.5"},
+		{[]Visitor{WithQTY(udfs("2")), NewSpecificTaxRule(udfs("1.5")).WithQty(udfs("10"))}, "15"},
+		// credit lines have negative quantities
+		{[]Visitor{WithQTY(udfs("-101")), NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), StartedSteps)}, "-0.08"},
+	}
+
+	for i, tc := range testCases {
+		visitors := append(tc.visitors, NamedSnapshot("taxed"))
+		r := mustRun(t, NewFromUnitValue(udfs("10")), visitors...)
+
+		if !r.Taxes.Equal(udfs(tc.amount)) || !r.TaxesByCode[""].Equal(udfs(tc.amount)) {
+			t.Errorf("[test case %d] got taxes %v. Expected %v", i, r.Taxes, tc.amount)
+		}
+
+		if !r.Value.Equal(r.Net.Add(udfs(tc.amount))) {
+			t.Errorf("[test case %d] got value %v. Expected net %v plus %v", i, r.Value, r.Net, tc.amount)
+		}
+
+		// exact mode gives the same amount
+		e, err := RunExact(NewFromUnitValue(udfs("10")), 6, visitors...)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !e.Taxes.Equal(udfs(tc.amount)) {
+			t.Errorf("[test case %d] got exact taxes %v. Expected %v", i, e.Taxes, tc.amount)
+		}
+	}
+}
+
+func TestSpecificUntax(t *testing.T) {
+	untax := NewSpecificUntaxRule(udfs("0.5")).WithConversion(udfs("0.35")).WithQty(udfs("24")).WithCode("IABA")
+	r := mustRun(t, NewFromBrute(udfs("124.2")), untax, NewUnitValueRule(udfs("24")))
+
+	if !r.Net.Equal(udfs("120")) || !r.Gross.Equal(udfs("124.2")) || !r.TaxesByCode["IABA"].Equal(udfs("4.2")) {
+		t.Errorf("got net %v, gross %v and taxes %v. Expected 120, 124.2 and 4.2", r.Net, r.Gross, r.TaxesByCode)
+	}
+
+	if !r.Value.Equal(udfs("5")) {
+		t.Errorf("got unit value %v. Expected 5", r.Value)
+	}
+
+	// adding the tax back gives the brute value
+	r = mustRun(t, NewFromUnitValue(r.Value), WithQTY(udfs("24")), NewSpecificTaxRule(udfs("0.5")).WithConversion(udfs("0.35")).WithCode("IABA"))
+
+	if !r.Gross.Equal(udfs("124.2")) {
+		t.Errorf("got gross %v. Expected 124.2", r.Gross)
+	}
+}
+
+func TestSpecificTaxExemption(t *testing.T) {
+	r := mustRun(t, NewFromUnitValue(udfs("10")), WithQTY(udfs("3")), NewSpecificTaxRule(udfs("1.5")).WithCode("IABA").WithExemption(Exempt, "E01"))
+
+	if !r.Value.Equal(udfs("30")) || !r.Taxes.Equal(udfs("0")) || len(r.Exemptions) != 1 {
+		t.Errorf("got value %v, taxes %v and exemptions %+v", r.Value, r.Taxes, r.Exemptions)
+	}
+}
+
+func TestSpecificTaxOverflow(t *testing.T) {
+	rule := NewSpecificTaxRule(udfs("100000000000000000000")).WithCode("IABA")
+
+	if _, err := rule.Amount(udfs("100000000000000000000")); err == nil {
+		t.Errorf("error expected calculating an amount which overflows gyro")
+	}
+
+	r, err := Run(NewFromUnitValue(udfs("10")), WithQTY(udfs("100000000000000000000")), rule)
+
+	if err == nil || !r.Taxes.Equal(udfs("0")) {
+		t.Errorf("got taxes %v and error %v. Expected an error", r.Taxes, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("panic expected visiting a tax which overflows gyro")
+		}
+	}()
+
+	NewFromUnitValue(udfs("10")).Receive(rule.WithQty(udfs("100000000000000000000")))
+}
+
+func TestRunContextQty(t *testing.T) {
+	rc := NewRunContext()
+
+	if !rc.Qty().Equal(udfs("1")) {
+		t.Errorf("got qty %v. Expected 1", rc.Qty())
+	}
+
+	b := NewFromUnitValue(udfs("10"))
+	WithQTY(udfs("3")).Apply(b, rc)
+	WithQTY(udfs("2")).Apply(b, rc)
+
+	if !rc.Qty().Equal(udfs("6")) || !b.Value().Equal(udfs("60")) {
+		t.Errorf("got qty %v and value %v. Expected 6 and 60", rc.Qty(), b.Value())
+	}
+
+	rc.Reset()
+
+	if !rc.Qty().Equal(udfs("1")) {
+		t.Errorf("got qty %v after reset. Expected 1", rc.Qty())
+	}
+}
+
+func TestSpecificTaxJSON(t *testing.T) {
+	visitors := []Visitor{
+		NewSpecificTaxRule(udfs("0.04")).WithStep(udfs("100"), RoundSteps).WithCode("ENV"),
+		NewSpecificUntaxRule(udfs("0.5")).WithConversion(udfs("0.35")).WithQty(udfs("24")),
+	}
+
+	data, err := json.Marshal(visitors)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := UnmarshalVisitors(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range decoded {
+		if v != visitors[i] {
+			t.Errorf("[test case %d] got %#v from %s. Expected %#v", i, v, data, visitors[i])
+		}
+	}
+
+	var s StepRounding
+
+	if err := json.Unmarshal([]byte(`"ceil"`), &s); err == nil {
+		t.Errorf("error expected decoding an unknown step rounding")
+	}
+}
@@ -0,0 +1,118 @@
+package johnny
+
+import (
+	"sync"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Johnny = &SyncJohnny{}
+
+// SyncJohnny is a Johnny safe for concurrent use, as a running buffer where
+// many goroutines accumulate their totals. It wraps another Johnny, guarding
+// every operation over it with a lock.
+//
+// Receive holds the lock while the visitor runs, so the visitor sees a consistent
+// buffer and no other operation happens in between its reads and writes.
+type SyncJohnny struct {
+	mu sync.RWMutex
+	b  Johnny
+}
+
+// NewSyncJohnny returns a new SyncJohnny wrapping b.
+// b must not be used directly after being wrapped.
+func NewSyncJohnny(b Johnny) *SyncJohnny {
+	return &SyncJohnny{b: b}
+}
+
+// Receive makes the wrapped Johnny receive the visitor, holding the lock until the visit is done.
+// The visitor is given the wrapped Johnny, so it must not use the SyncJohnny, which would deadlock.
+func (s *SyncJohnny) Receive(v Visitor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Receive(v)
+}
+
+// Value returns the current value of the Johnny.
+func (s *SyncJohnny) Value() gyro.Gyro {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.b.Value()
+}
+
+// Add adds the given decimal value to the Johnny.
+func (s *SyncJohnny) Add(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Add(v)
+}
+
+// Sub subtracts the given decimal value from the Johnny.
+func (s *SyncJohnny) Sub(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Sub(v)
+}
+
+// Mul multiplies the Johnny by the given decimal value.
+func (s *SyncJohnny) Mul(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Mul(v)
+}
+
+// Div divides the Johnny by the given decimal value.
+// As DefaultJohnny does, it panics when dividing by zero, releasing the lock.
+func (s *SyncJohnny) Div(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Div(v)
+}
+
+func (s *SyncJohnny) set(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.set(v)
+}
+
+// String returns a string representation of the Johnny value.
+func (s *SyncJohnny) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.b.String()
+}
+
+// Snapshot returns the current value of the Johnny.
+func (s *SyncJohnny) Snapshot() gyro.Gyro {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.b.Snapshot()
+}
+
+// Restore sets the value of the Johnny to the provided decimal value.
+func (s *SyncJohnny) Restore(v gyro.Gyro) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.b.Restore(v)
+}
+
+// Snapshots returns a copy of the snapshots registry of the wrapped Johnny, as the registry
+// itself is not safe for concurrent use. Snapshots are taken with NamedSnapshot visitors
+// received by the SyncJohnny, not by setting them in the returned copy.
+func (s *SyncJohnny) Snapshots() *Snapshots {
+	// the registry may be created lazily by the wrapped Johnny, so this is a write
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.b.Snapshots().Clone()
+}
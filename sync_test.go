@@ -0,0 +1,95 @@
+package johnny
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSyncJohnnyAccumulate(t *testing.T) {
+	acc := NewSyncJohnny(NewFromUnitValueDefault())
+
+	const goroutines, lines = 16, 250
+
+	wg := sync.WaitGroup{}
+	wg.Add(goroutines)
+
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < lines; i++ {
+				acc.Add(udfs("10.25"))
+				acc.Sub(udfs("0.25"))
+				_ = acc.Value()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	expected := udfs("10").Mul(udfs("4000"))
+
+	if !acc.Value().Equal(expected) {
+		t.Errorf("got %v. Expected %v", acc.Value(), expected)
+	}
+}
+
+func TestSyncJohnnyReceive(t *testing.T) {
+	acc := NewSyncJohnny(NewFromUnitValue(udfs("0")))
+
+	const goroutines = 32
+
+	wg := sync.WaitGroup{}
+	wg.Add(goroutines)
+
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+
+			// reads and writes the buffer in two steps, which would lose updates if the visit weren't atomic
+			acc.Receive(visitorFunc(func(b Johnny) {
+				v := b.Value()
+				b.set(v.Add(udfs("1.5")))
+			}))
+			acc.Receive(NamedSnapshot("last"))
+			_ = acc.Snapshots()
+			_ = acc.String()
+		}()
+	}
+
+	wg.Wait()
+
+	expected := udfs("1.5").Mul(udfs("32"))
+
+	if !acc.Value().Equal(expected) {
+		t.Errorf("got %v. Expected %v", acc.Value(), expected)
+	}
+
+	if last, ok := acc.Snapshots().Get("last"); !ok || !last.Equal(expected) {
+		t.Errorf("got last snapshot %v. Expected %v", last, expected)
+	}
+}
+
+func TestSyncJohnnyHandler(t *testing.T) {
+	acc := NewSyncJohnny(NewFromBrute(udfs("1190")))
+
+	s := acc.Snapshot()
+	acc.Receive(NewAmountUntaxRule(udfs("190")))
+
+	if !acc.Value().Equal(udfs("1000")) {
+		t.Errorf("got %v. Expected 1000", acc.Value())
+	}
+
+	acc.Restore(s)
+
+	if !acc.Value().Equal(udfs("1190")) {
+		t.Errorf("got %v after restoring. Expected 1190", acc.Value())
+	}
+
+	acc.Mul(udfs("2"))
+	acc.Div(udfs("4"))
+
+	if !acc.Value().Equal(udfs("595")) {
+		t.Errorf("got %v. Expected 595", acc.Value())
+	}
+}
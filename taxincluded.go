@@ -0,0 +1,212 @@
+package johnny
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Rule = TaxIncludedRule{}
+
+// TaxIncludedRule extracts taxes from a value which includes them, as the retail prices do. The taxes are
+// defined as for a tax-exclusive line, so the rule finds the net value which, taxed by them in order, gives
+// the value it's applied to, and records them as removed over that net value.
+//
+// Unlike the untax rules, the Johnny value is left untouched, so a tax-included line keeps its gross value
+// as a tax-exclusive line does after being taxed, and the [Result] has the same shape for both.
+//
+// Any rule recording only tax effects whose amount grows linearly with the value is supported, as the
+// percentual, amount and specific taxes, and the rules and handlers of a [RateTable].
+type TaxIncludedRule struct {
+	taxes []Rule
+}
+
+// NewTaxIncludedRule returns a new TaxIncludedRule extracting the given taxes, in the order they would be applied.
+func NewTaxIncludedRule(taxes ...Rule) TaxIncludedRule {
+	return TaxIncludedRule{taxes: append([]Rule(nil), taxes...)}
+}
+
+// Taxes returns the taxes extracted by the rule.
+func (r TaxIncludedRule) Taxes() []Rule {
+	return append([]Rule(nil), r.taxes...)
+}
+
+// Apply extracts the taxes from the Johnny value and records them in rc as removed.
+// When a tax can't be extracted the error is recorded in rc and nothing is removed.
+func (r TaxIncludedRule) Apply(b Johnny, rc *RunContext) {
+	effects, err := r.extract(b.Value(), rc)
+
+	if err != nil {
+		rc.Fail(err)
+		return
+	}
+
+	for _, e := range effects {
+		rc.Record(e)
+	}
+}
+
+// Visit extracts the taxes from the Johnny value. As the value is left untouched, it has no effect on the Johnny.
+func (r TaxIncludedRule) Visit(b Johnny) {
+	_, _ = r.extract(b.Value(), NewRunContext())
+}
+
+// extract returns the effects of the taxes over the net value of gross.
+// The taxes are affine over the net value, so their total over 1 and 2 gives the net value gross comes from.
+func (r TaxIncludedRule) extract(gross gyro.Gyro, rc *RunContext) ([]Effect, error) {
+	_, t1, err := r.taxed(gyro.NewOne(), rc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, t2, err := r.taxed(gyro.NewFromInt64(2), rc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slope := t2.Sub(t1)
+	fixed := t1.Sub(slope)
+	divisor := gyro.NewOne().Add(slope)
+
+	if divisor.Cmp(gyro.NewZero()) <= 0 {
+		return nil, NewJohnnyError("taxes can't be extracted from a tax-included value")
+	}
+
+	effects, _, err := r.taxed(quo(gross.Sub(fixed), divisor), rc)
+
+	for i := range effects {
+		effects[i].Kind = UntaxEffect
+	}
+
+	return effects, err
+}
+
+// taxed applies the taxes over net, with the date and quantity of rc, returning their effects and total amount.
+func (r TaxIncludedRule) taxed(net gyro.Gyro, rc *RunContext) ([]Effect, gyro.Gyro, error) {
+	scratch := NewRunContextAt(rc.date)
+	scratch.qty, scratch.hasQty = rc.qty, rc.hasQty
+
+	b := NewFromUnitValue(net)
+
+	for _, t := range r.taxes {
+		t.Apply(b, scratch)
+	}
+
+	if err := scratch.Err(); err != nil {
+		return nil, gyro.Gyro{}, err
+	}
+
+	total := gyro.Gyro{}
+
+	for _, e := range scratch.effects {
+		if e.Kind != TaxEffect {
+			return nil, gyro.Gyro{}, NewJohnnyError("only taxes can be extracted from a tax-included value")
+		}
+
+		total = total.Add(e.Amount)
+	}
+
+	return scratch.effects, total, nil
+}
+
+func (r TaxIncludedRule) check(date time.Time) error {
+	for _, t := range r.taxes {
+		if d, ok := t.(dated); ok {
+			if err := d.check(date); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RunTaxIncluded is [Run] for a line whose unit value includes taxes, as retail prices do. The visitors are
+// the ones of the tax-exclusive line, so quantities and discounts are applied over the gross value, and every
+// run of consecutive tax visitors is replaced by a [TaxIncludedRule] extracting them. The Result has the
+// same shape as the one of a tax-exclusive line, being Value the gross value and Net the value the first
+// taxes were extracted from minus those taxes.
+//
+// Stateful tax visitors are converted to their rules, so they are not modified, and TaxHandlerFromUnitValue
+// to the rules of its totals. An error is returned, without running any visitor, if b starts from the brute
+// value or a visitor removes taxes, and after running them if a tax couldn't be extracted.
+func RunTaxIncluded(b Johnny, visitors ...Visitor) (Result, error) {
+	if isFromBrute(b) {
+		return Result{}, NewJohnnyError("tax-included lines start from a unit value")
+	}
+
+	pipeline := make([]Visitor, 0, len(visitors))
+	var taxes []Rule
+
+	for _, v := range visitors {
+		rules, ok, err := includedTaxes(v)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		if ok {
+			taxes = append(taxes, rules...)
+			continue
+		}
+
+		if len(taxes) > 0 {
+			pipeline = append(pipeline, NewTaxIncludedRule(taxes...))
+			taxes = nil
+		}
+
+		pipeline = append(pipeline, v)
+	}
+
+	if len(taxes) > 0 {
+		pipeline = append(pipeline, NewTaxIncludedRule(taxes...))
+	}
+
+	c := newCollector(b.Value())
+	r := run(c, b, pipeline)
+
+	return r, c.rc.Err()
+}
+
+// includedTaxes returns the rules of v when it's a tax visitor, and an error when it removes taxes.
+func includedTaxes(v Visitor) ([]Rule, bool, error) {
+	switch t := v.(type) {
+	case PercTaxRule, UnbufferedPercTaxRule, AmountTaxRule, UnbufferedAmountTaxRule, SpecificTaxRule, RateHandler:
+		return []Rule{t.(Rule)}, true, nil
+	case RateRule:
+		if t.kind == ratePercentualUntax {
+			break
+		}
+
+		return []Rule{t}, true, nil
+	case *PercTax:
+		return []Rule{t.Rule()}, true, nil
+	case *UnbufferedPercTax:
+		return []Rule{t.Rule()}, true, nil
+	case *AmountTax:
+		return []Rule{t.Rule()}, true, nil
+	case *UnbufferedAmountTax:
+		return []Rule{t.Rule()}, true, nil
+	case *TaxHandlerFromUnitValue:
+		if t.exemption != NotExempt {
+			return []Rule{NewPercTaxRule(t.ratio).WithExemption(t.exemption, t.reason)}, true, nil
+		}
+
+		rules := []Rule{NewPercTaxRule(t.ratio)}
+
+		// an amount tax over a zero value has no ratio, so it's only added when there is an amount
+		if !t.amount.Equal(gyro.NewZero()) {
+			rules = append(rules, NewAmountTaxRule(t.amount))
+		}
+
+		return rules, true, nil
+	case PercentualUntaxRule, AmountUntaxRule, SpecificUntaxRule, *PercentualUntax, *AmountUntax, *UnwithholdingHandler:
+	default:
+		return nil, false, nil
+	}
+
+	return nil, false, NewJohnnyError(fmt.Sprintf("visitor %T can't run in a tax-included line", v))
+}
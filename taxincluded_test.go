@@ -0,0 +1,127 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRunTaxIncluded(t *testing.T) {
+	testCases := []struct {
+		unitValue string
+		visitors  []Visitor
+		net       string
+		gross     string
+		taxes     string
+	}{
+		// retail price of 119 with IVA 19, 2 units and a 10% discount over the gross
+		{"119", []Visitor{WithQTY(udfs("2")), NewPercentualDiscountRule(udfs("10")), NewPercTaxRule(udfs("19"))}, "180", "214.2", "34.2"},
+		{"119", []Visitor{WithQTY(udfs("2")), NewPercentualDiscount(udfs("10")), NewPercTax(udfs("19"))}, "180", "214.2", "34.2"},
+		// compound taxes are extracted in reverse order
+		{"115.5", []Visitor{NewPercTaxRule(udfs("10")), NewPercTaxRule(udfs("5"))}, "100", "115.5", "15.5"},
+		// unbuffered taxes are calculated over the same net value
+		{"115", []Visitor{NewUnbufferedPercTaxRule(udfs("10")), NewPercTaxRule(udfs("5"))}, "100", "115", "15"},
+		// specific taxes are extracted for the quantity of the line
+		{"120.785", []Visitor{WithQTY(udfs("2")), NewSpecificTaxRule(udfs("1.5")), NewPercTaxRule(udfs("19"))}, "200", "241.57", "41.57"},
+		{"12", []Visitor{NewAmountTaxRule(udfs("2"))}, "10", "12", "2"},
+		{"116", []Visitor{includedTaxHandler("10", "6")}, "100", "116", "16"},
+		// rounding after the taxes rounds the value, not the gross the taxes were extracted from
+		{"10.005", []Visitor{NewPercTaxRule(udfs("19")), NewRound(2)}, "8.4075630252100841", "10.005", "1.5974369747899159"},
+	}
+
+	for i, tc := range testCases {
+		r, err := RunTaxIncluded(NewFromUnitValue(udfs(tc.unitValue)), tc.visitors...)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if !r.Net.Equal(udfs(tc.net)) || !r.Gross.Equal(udfs(tc.gross)) || !r.Taxes.Equal(udfs(tc.taxes)) {
+			t.Errorf("[test case %d] got net %v, gross %v and taxes %v. Expected %v, %v and %v", i, r.Net, r.Gross, r.Taxes, tc.net, tc.gross, tc.taxes)
+		}
+	}
+}
+
+func TestRunTaxIncludedMatchesTaxExcluded(t *testing.T) {
+	included, err := RunTaxIncluded(NewFromUnitValue(udfs("119")), WithQTY(udfs("2")), NewPercentualDiscountRule(udfs("10")), NewPercTaxRule(udfs("19")).WithCode("IVA"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excluded := mustRun(t, NewFromUnitValue(udfs("100")), WithQTY(udfs("2")), NewPercentualDiscountRule(udfs("10")), NewPercTaxRule(udfs("19")).WithCode("IVA"))
+
+	if !included.Net.Equal(excluded.Net) || !included.Gross.Equal(excluded.Gross) || !included.Value.Equal(excluded.Value) {
+		t.Errorf("got net %v, gross %v and value %v. Expected %v, %v and %v", included.Net, included.Gross, included.Value, excluded.Net, excluded.Gross, excluded.Value)
+	}
+
+	if !included.TaxesByCode["IVA"].Equal(excluded.TaxesByCode["IVA"]) {
+		t.Errorf("got taxes %v. Expected %v", included.TaxesByCode, excluded.TaxesByCode)
+	}
+
+	// discounts are applied over the gross value
+	if !included.Discounts.Equal(udfs("23.8")) {
+		t.Errorf("got discounts %v. Expected 23.8", included.Discounts)
+	}
+}
+
+func TestRunTaxIncludedExemption(t *testing.T) {
+	r, err := RunTaxIncluded(NewFromUnitValue(udfs("100")), NewPercTaxRule(udfs("19")).WithCode("IVA").WithExemption(Exempt, "E01"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Net.Equal(udfs("100")) || !r.Taxes.Equal(udfs("0")) || len(r.Exemptions) != 1 || !r.Exemptions[0].Base.Equal(udfs("100")) {
+		t.Errorf("got net %v, taxes %v and exemptions %+v", r.Net, r.Taxes, r.Exemptions)
+	}
+}
+
+func TestRunTaxIncludedErrors(t *testing.T) {
+	testCases := []struct {
+		b        Johnny
+		visitors []Visitor
+	}{
+		{NewFromBrute(udfs("119")), []Visitor{NewPercTaxRule(udfs("19"))}},
+		{NewFromUnitValue(udfs("119")), []Visitor{NewPercentualUntaxRule(udfs("19"))}},
+		{NewFromUnitValue(udfs("119")), []Visitor{NewAmountUnTax(udfs("19"))}},
+		{NewFromUnitValue(udfs("119")), []Visitor{NewTaxIncludedRule(NewPercentualDiscountRule(udfs("10")))}},
+		{NewFromUnitValue(udfs("119")), []Visitor{NewPercTaxRule(udfs("-100"))}},
+	}
+
+	for i, tc := range testCases {
+		if _, err := RunTaxIncluded(tc.b, tc.visitors...); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
+
+func TestTaxIncludedRuleJSON(t *testing.T) {
+	rule := NewTaxIncludedRule(NewPercTaxRule(udfs("19")).WithCode("IVA"), NewSpecificTaxRule(udfs("1.5")).WithCode("ILA"))
+	data, err := json.Marshal(rule)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := UnmarshalVisitor(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, ok := v.(TaxIncludedRule)
+
+	if !ok || len(decoded.Taxes()) != 2 || decoded.Taxes()[0] != rule.Taxes()[0] || decoded.Taxes()[1] != rule.Taxes()[1] {
+		t.Errorf("got %#v from %s. Expected %#v", v, data, rule)
+	}
+}
+
+func includedTaxHandler(ratios ...string) *TaxHandlerFromUnitValue {
+	h := NewTaxHandlerFromUnitValue()
+
+	for _, r := range ratios {
+		h.WithPercentualTax(udfs(r))
+	}
+
+	return h
+}
@@ -0,0 +1,132 @@
+package johnny
+
+import (
+	"encoding/json"
+
+	"github.com/profe-ajedrez/gyro"
+)
+
+// Totals accumulates the results of the lines of a document.
+type Totals struct {
+	// Lines is the number of accumulated results.
+	Lines int
+	// Net is the sum of the net values of the lines.
+	Net gyro.Gyro
+	// Gross is the sum of the gross values of the lines.
+	Gross gyro.Gyro
+	// Discounts is the sum of the discounts of the lines.
+	Discounts gyro.Gyro
+	// Taxes is the sum of the taxes of the lines.
+	Taxes gyro.Gyro
+	// TaxesByCode holds the sum of the taxes of the lines grouped by tax code.
+	TaxesByCode map[string]gyro.Gyro
+	// Withholdings is the sum of the withholdings of the lines.
+	Withholdings gyro.Gyro
+	// WithholdingsByCode holds the sum of the withholdings of the lines grouped by withholding code.
+	WithholdingsByCode map[string]gyro.Gyro
+	// Payable is the sum of the payable values of the lines.
+	Payable gyro.Gyro
+}
+
+// NewTotals returns a new instance of Totals with all its values in zero.
+func NewTotals() *Totals {
+	return &Totals{
+		TaxesByCode:        map[string]gyro.Gyro{},
+		WithholdingsByCode: map[string]gyro.Gyro{},
+	}
+}
+
+// Add accumulates the given line result into the totals.
+func (t *Totals) Add(r Result) {
+	if t.TaxesByCode == nil {
+		t.TaxesByCode = map[string]gyro.Gyro{}
+	}
+
+	if t.WithholdingsByCode == nil {
+		t.WithholdingsByCode = map[string]gyro.Gyro{}
+	}
+
+	t.Lines++
+	t.Net = t.Net.Add(r.Net)
+	t.Gross = t.Gross.Add(r.Gross)
+	t.Discounts = t.Discounts.Add(r.Discounts)
+	t.Taxes = t.Taxes.Add(r.Taxes)
+	t.Withholdings = t.Withholdings.Add(r.Withholdings)
+	t.Payable = t.Payable.Add(r.Payable)
+
+	for code, amount := range r.TaxesByCode {
+		t.TaxesByCode[code] = t.TaxesByCode[code].Add(amount)
+	}
+
+	for code, amount := range r.WithholdingsByCode {
+		t.WithholdingsByCode[code] = t.WithholdingsByCode[code].Add(amount)
+	}
+}
+
+type totalsJSON struct {
+	Lines              int                    `json:"lines"`
+	Net                jsonDecimal            `json:"net"`
+	Gross              jsonDecimal            `json:"gross"`
+	Discounts          jsonDecimal            `json:"discounts"`
+	Taxes              jsonDecimal            `json:"taxes"`
+	TaxesByCode        map[string]jsonDecimal `json:"taxes_by_code"`
+	Withholdings       jsonDecimal            `json:"withholdings"`
+	WithholdingsByCode map[string]jsonDecimal `json:"withholdings_by_code"`
+	Payable            jsonDecimal            `json:"payable"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *Totals) MarshalJSON() ([]byte, error) {
+	j := totalsJSON{
+		Lines:              t.Lines,
+		Net:                jsonDecimal(t.Net),
+		Gross:              jsonDecimal(t.Gross),
+		Discounts:          jsonDecimal(t.Discounts),
+		Taxes:              jsonDecimal(t.Taxes),
+		TaxesByCode:        make(map[string]jsonDecimal, len(t.TaxesByCode)),
+		Withholdings:       jsonDecimal(t.Withholdings),
+		WithholdingsByCode: make(map[string]jsonDecimal, len(t.WithholdingsByCode)),
+		Payable:            jsonDecimal(t.Payable),
+	}
+
+	for k, v := range t.TaxesByCode {
+		j.TaxesByCode[k] = jsonDecimal(v)
+	}
+
+	for k, v := range t.WithholdingsByCode {
+		j.WithholdingsByCode[k] = jsonDecimal(v)
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Totals) UnmarshalJSON(data []byte) error {
+	var j totalsJSON
+
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*t = Totals{
+		Lines:              j.Lines,
+		Net:                gyro.Gyro(j.Net),
+		Gross:              gyro.Gyro(j.Gross),
+		Discounts:          gyro.Gyro(j.Discounts),
+		Taxes:              gyro.Gyro(j.Taxes),
+		TaxesByCode:        make(map[string]gyro.Gyro, len(j.TaxesByCode)),
+		Withholdings:       gyro.Gyro(j.Withholdings),
+		WithholdingsByCode: make(map[string]gyro.Gyro, len(j.WithholdingsByCode)),
+		Payable:            gyro.Gyro(j.Payable),
+	}
+
+	for k, v := range j.TaxesByCode {
+		t.TaxesByCode[k] = gyro.Gyro(v)
+	}
+
+	for k, v := range j.WithholdingsByCode {
+		t.WithholdingsByCode[k] = gyro.Gyro(v)
+	}
+
+	return nil
+}
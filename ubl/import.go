@@ -0,0 +1,381 @@
+package ubl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/audit"
+)
+
+// Declared holds the amounts declared by an imported document.
+type Declared struct {
+	// Lines holds the LineExtensionAmount of each line.
+	Lines []gyro.Gyro
+	// Totals holds the monetary totals and the tax subtotals of the document.
+	Totals Totals
+	// Prepaid and PayableRounding are the amounts which make the payable amount differ from the tax inclusive one.
+	Prepaid         gyro.Gyro
+	PayableRounding gyro.Gyro
+}
+
+// The structures of the imported documents match the elements by their local names, in any namespace.
+
+type importAmount struct {
+	Value string `xml:",chardata"`
+}
+
+type importTaxCategory struct {
+	ID                  string `xml:"ID"`
+	Percent             string `xml:"Percent"`
+	ExemptionReasonCode string `xml:"TaxExemptionReasonCode"`
+	ExemptionReason     string `xml:"TaxExemptionReason"`
+	Scheme              string `xml:"TaxScheme>ID"`
+}
+
+type importAllowanceCharge struct {
+	ChargeIndicator string             `xml:"ChargeIndicator"`
+	Reason          string             `xml:"AllowanceChargeReason"`
+	Amount          string             `xml:"Amount"`
+	TaxCategory     *importTaxCategory `xml:"TaxCategory"`
+}
+
+type importQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type importLine struct {
+	ID                    string                  `xml:"ID"`
+	InvoicedQuantity      *importQuantity         `xml:"InvoicedQuantity"`
+	CreditedQuantity      *importQuantity         `xml:"CreditedQuantity"`
+	LineExtensionAmount   string                  `xml:"LineExtensionAmount"`
+	AllowanceCharges      []importAllowanceCharge `xml:"AllowanceCharge"`
+	Name                  string                  `xml:"Item>Name"`
+	ClassifiedTaxCategory importTaxCategory       `xml:"Item>ClassifiedTaxCategory"`
+	PriceAmount           string                  `xml:"Price>PriceAmount"`
+	BaseQuantity          string                  `xml:"Price>BaseQuantity"`
+}
+
+type importParty struct {
+	Name             string `xml:"Party>PartyName>Name"`
+	RegistrationName string `xml:"Party>PartyLegalEntity>RegistrationName"`
+	CompanyID        string `xml:"Party>PartyTaxScheme>CompanyID"`
+	Street           string `xml:"Party>PostalAddress>StreetName"`
+	City             string `xml:"Party>PostalAddress>CityName"`
+	PostalZone       string `xml:"Party>PostalAddress>PostalZone"`
+	Country          string `xml:"Party>PostalAddress>Country>IdentificationCode"`
+}
+
+type importSubtotal struct {
+	TaxableAmount string            `xml:"TaxableAmount"`
+	TaxAmount     string            `xml:"TaxAmount"`
+	TaxCategory   importTaxCategory `xml:"TaxCategory"`
+}
+
+type importDocument struct {
+	XMLName          xml.Name
+	CustomizationID  string                  `xml:"CustomizationID"`
+	ID               string                  `xml:"ID"`
+	IssueDate        string                  `xml:"IssueDate"`
+	DueDate          string                  `xml:"DueDate"`
+	Note             string                  `xml:"Note"`
+	Currency         string                  `xml:"DocumentCurrencyCode"`
+	InvoiceID        string                  `xml:"BillingReference>InvoiceDocumentReference>ID"`
+	Supplier         importParty             `xml:"AccountingSupplierParty"`
+	Customer         importParty             `xml:"AccountingCustomerParty"`
+	AllowanceCharges []importAllowanceCharge `xml:"AllowanceCharge"`
+	TaxTotals        []struct {
+		TaxAmount    string           `xml:"TaxAmount"`
+		TaxSubtotals []importSubtotal `xml:"TaxSubtotal"`
+	} `xml:"TaxTotal"`
+	Total struct {
+		LineExtensionAmount   string `xml:"LineExtensionAmount"`
+		TaxExclusiveAmount    string `xml:"TaxExclusiveAmount"`
+		TaxInclusiveAmount    string `xml:"TaxInclusiveAmount"`
+		AllowanceTotalAmount  string `xml:"AllowanceTotalAmount"`
+		ChargeTotalAmount     string `xml:"ChargeTotalAmount"`
+		PrepaidAmount         string `xml:"PrepaidAmount"`
+		PayableRoundingAmount string `xml:"PayableRoundingAmount"`
+		PayableAmount         string `xml:"PayableAmount"`
+	} `xml:"LegalMonetaryTotal"`
+	InvoiceLines    []importLine `xml:"InvoiceLine"`
+	CreditNoteLines []importLine `xml:"CreditNoteLine"`
+}
+
+// decimals parses the decimal amounts of an imported document, keeping the first error found.
+type decimals struct {
+	err error
+}
+
+// parse returns the value of the named element, zero when it's missing.
+func (d *decimals) parse(element, v string) gyro.Gyro {
+	v = strings.TrimSpace(v)
+
+	if v == "" || d.err != nil {
+		return gyro.Gyro{}
+	}
+
+	g, err := johnny.ParseDecimal(v)
+
+	if err != nil {
+		d.err = johnny.NewJohnnyError(fmt.Sprintf("invalid %s %q", element, v))
+	}
+
+	return g
+}
+
+// quo returns a / b, the value of the named element divided by its base quantity.
+func (d *decimals) quo(element string, a, b gyro.Gyro) gyro.Gyro {
+	q, err := johnny.Quo(a, b)
+
+	if err != nil && d.err == nil {
+		d.err = johnny.NewJohnnyError(fmt.Sprintf("%s divided by its base quantity: %v", element, err))
+	}
+
+	return q
+}
+
+func (d *decimals) category(t importTaxCategory) TaxCategory {
+	return TaxCategory{
+		ID:                  strings.TrimSpace(t.ID),
+		Percent:             d.parse("Percent", t.Percent),
+		ExemptionReasonCode: strings.TrimSpace(t.ExemptionReasonCode),
+		ExemptionReason:     t.ExemptionReason,
+		Scheme:              strings.TrimSpace(t.Scheme),
+	}
+}
+
+// Parse reads a UBL invoice or credit note, returning the document with the calculation of each line rebuilt
+// and the amounts it declares.
+//
+// Each line is calculated from its unit price, the price amount divided by its base quantity, with the
+// quantity, the allowances and charges of the line and the tax of its category. The document isn't validated
+// against the bundled schemas, which only cover the documents [Marshal] writes, so documents with other
+// elements can be read.
+//
+// An error is returned if the document is neither an invoice nor a credit note, has no lines, or has
+// invalid amounts or dates.
+func Parse(r io.Reader) (Document, Declared, error) {
+	var x importDocument
+
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return Document{}, Declared{}, err
+	}
+
+	d := Document{
+		CustomizationID: x.CustomizationID,
+		ID:              x.ID,
+		Note:            x.Note,
+		Currency:        x.Currency,
+		InvoiceID:       x.InvoiceID,
+		Supplier:        x.Supplier.party(),
+		Customer:        x.Customer.party(),
+	}
+
+	lines := x.InvoiceLines
+
+	switch x.XMLName.Local {
+	case Invoice.String():
+		d.Type = Invoice
+	case CreditNote.String():
+		d.Type, lines = CreditNote, x.CreditNoteLines
+	default:
+		return Document{}, Declared{}, johnny.NewJohnnyError("not a UBL invoice nor credit note: " + x.XMLName.Local)
+	}
+
+	var err error
+
+	if d.IssueDate, err = time.Parse(johnny.DateLayout, strings.TrimSpace(x.IssueDate)); err != nil {
+		return Document{}, Declared{}, johnny.NewJohnnyError("invalid IssueDate " + x.IssueDate)
+	}
+
+	if x.DueDate != "" {
+		if d.DueDate, err = time.Parse(johnny.DateLayout, strings.TrimSpace(x.DueDate)); err != nil {
+			return Document{}, Declared{}, johnny.NewJohnnyError("invalid DueDate " + x.DueDate)
+		}
+	}
+
+	if len(lines) == 0 {
+		return Document{}, Declared{}, johnny.NewJohnnyError("a document must have lines")
+	}
+
+	dec := &decimals{}
+	var declared Declared
+
+	for _, lx := range lines {
+		l, amount := dec.line(lx)
+		d.Lines = append(d.Lines, l)
+		declared.Lines = append(declared.Lines, amount)
+	}
+
+	for _, ac := range x.AllowanceCharges {
+		d.AllowanceCharges = append(d.AllowanceCharges, dec.allowanceCharge(ac))
+	}
+
+	t := &declared.Totals
+	t.LineExtension = dec.parse("LineExtensionAmount", x.Total.LineExtensionAmount)
+	t.TaxExclusive = dec.parse("TaxExclusiveAmount", x.Total.TaxExclusiveAmount)
+	t.TaxInclusive = dec.parse("TaxInclusiveAmount", x.Total.TaxInclusiveAmount)
+	t.Allowances = dec.parse("AllowanceTotalAmount", x.Total.AllowanceTotalAmount)
+	t.Charges = dec.parse("ChargeTotalAmount", x.Total.ChargeTotalAmount)
+	t.Payable = dec.parse("PayableAmount", x.Total.PayableAmount)
+	declared.Prepaid = dec.parse("PrepaidAmount", x.Total.PrepaidAmount)
+	declared.PayableRounding = dec.parse("PayableRoundingAmount", x.Total.PayableRoundingAmount)
+
+	// a second tax total is the one in the tax currency, when it differs from the one of the document
+	if len(x.TaxTotals) > 0 {
+		t.Tax = dec.parse("TaxAmount", x.TaxTotals[0].TaxAmount)
+
+		for _, s := range x.TaxTotals[0].TaxSubtotals {
+			t.Subtotals = append(t.Subtotals, Subtotal{
+				Tax:     dec.category(s.TaxCategory),
+				Taxable: dec.parse("TaxableAmount", s.TaxableAmount),
+				Amount:  dec.parse("TaxAmount", s.TaxAmount),
+			})
+		}
+	}
+
+	if dec.err != nil {
+		return Document{}, Declared{}, dec.err
+	}
+
+	return d, declared, nil
+}
+
+func (p importParty) party() Party {
+	name := p.RegistrationName
+
+	if name == "" {
+		name = p.Name
+	}
+
+	return Party{Name: name, TaxID: p.CompanyID, Street: p.Street, City: p.City, PostalZone: p.PostalZone, Country: p.Country}
+}
+
+func (d *decimals) allowanceCharge(x importAllowanceCharge) AllowanceCharge {
+	ac := AllowanceCharge{Charge: strings.TrimSpace(x.ChargeIndicator) == "true", Reason: x.Reason, Amount: d.parse("Amount", x.Amount)}
+
+	if x.TaxCategory != nil {
+		ac.Tax = d.category(*x.TaxCategory)
+	}
+
+	return ac
+}
+
+// line returns the line with its calculation rebuilt, and its declared amount.
+func (d *decimals) line(x importLine) (Line, gyro.Gyro) {
+	q := x.InvoicedQuantity
+
+	if q == nil {
+		q = x.CreditedQuantity
+	}
+
+	l := Line{ID: x.ID, Name: x.Name, Tax: d.category(x.ClassifiedTaxCategory), Qty: gyro.NewOne()}
+
+	if q != nil {
+		l.Qty, l.UnitCode = d.parse("Quantity", q.Value), q.UnitCode
+	}
+
+	price := d.parse("PriceAmount", x.PriceAmount)
+
+	if base := d.parse("BaseQuantity", x.BaseQuantity); d.err == nil && !base.Equal(gyro.NewZero()) && !base.Equal(gyro.NewOne()) {
+		price = d.quo("PriceAmount", price, base)
+	}
+
+	visitors := []johnny.Visitor{johnny.WithQTY(l.Qty)}
+
+	for _, ac := range x.AllowanceCharges {
+		a := d.allowanceCharge(ac)
+
+		if a.Charge {
+			visitors = append(visitors, johnny.NewAmountUndiscountRule(a.Amount))
+			continue
+		}
+
+		visitors = append(visitors, johnny.NewAmountDiscountRule(a.Amount))
+
+		if l.AllowanceReason == "" {
+			l.AllowanceReason = a.Reason
+		}
+	}
+
+	visitors = append(visitors, l.Tax.Rule())
+	r, err := johnny.Run(johnny.NewFromUnitValue(price), visitors...)
+
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+
+	l.Result = r
+
+	return l, d.parse("LineExtensionAmount", x.LineExtensionAmount)
+}
+
+// Audit reads a UBL invoice or credit note with [Parse], and reports the differences between the amounts it
+// declares and the ones calculated for it: the amount of each line, the monetary totals and the taxable and tax
+// amounts of each tax subtotal. Subtotals are matched by their tax category, and a subtotal missing on either
+// side is reported with zero amounts on that side.
+func Audit(r io.Reader, t audit.Tolerances) (*audit.Report, error) {
+	d, declared, err := Parse(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	calculated, err := d.Totals()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := audit.NewReport(t)
+
+	for i, l := range d.Lines {
+		amount, _ := l.amounts()
+		report.Line(i+1, "LineExtensionAmount", declared.Lines[i], amount)
+	}
+
+	dt := declared.Totals
+	report.Total("LineExtensionAmount", dt.LineExtension, calculated.LineExtension)
+	report.Total("AllowanceTotalAmount", dt.Allowances, calculated.Allowances)
+	report.Total("ChargeTotalAmount", dt.Charges, calculated.Charges)
+	report.Total("TaxExclusiveAmount", dt.TaxExclusive, calculated.TaxExclusive)
+	report.Total("TaxAmount", dt.Tax, calculated.Tax)
+	report.Total("TaxInclusiveAmount", dt.TaxInclusive, calculated.TaxInclusive)
+	report.Total("PayableAmount", dt.Payable, calculated.Payable.Sub(declared.Prepaid).Add(declared.PayableRounding))
+
+	matched := make([]bool, len(dt.Subtotals))
+
+	for _, c := range calculated.Subtotals {
+		s := Subtotal{Tax: c.Tax}
+
+		for i, ds := range dt.Subtotals {
+			if !matched[i] && ds.Tax.same(c.Tax) {
+				s, matched[i] = ds, true
+				break
+			}
+		}
+
+		report.Total(subtotalField(c.Tax, "TaxableAmount"), s.Taxable, c.Taxable)
+		report.Total(subtotalField(c.Tax, "TaxAmount"), s.Amount, c.Amount)
+	}
+
+	for i, ds := range dt.Subtotals {
+		if !matched[i] {
+			report.Total(subtotalField(ds.Tax, "TaxableAmount"), ds.Taxable, gyro.Gyro{})
+			report.Total(subtotalField(ds.Tax, "TaxAmount"), ds.Amount, gyro.Gyro{})
+		}
+	}
+
+	return report, nil
+}
+
+// subtotalField returns the name of an amount of the subtotal of a category, as "TaxSubtotal[S 19]/TaxAmount".
+func subtotalField(t TaxCategory, field string) string {
+	return fmt.Sprintf("TaxSubtotal[%s %s]/%s", t.ID, johnny.DecimalString(t.Percent), field)
+}
@@ -0,0 +1,148 @@
+package ubl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/profe-ajedrez/johnny/audit"
+)
+
+func TestParse(t *testing.T) {
+	for i, typ := range []DocumentType{Invoice, CreditNote} {
+		want := document(typ)
+		data, err := Marshal(want)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, declared, err := Parse(strings.NewReader(string(data)))
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if got.Type != typ || got.ID != want.ID || !got.IssueDate.Equal(want.IssueDate) || got.Currency != want.Currency || got.Supplier.TaxID != want.Supplier.TaxID || len(got.Lines) != len(want.Lines) {
+			t.Fatalf("[test case %d] got %+v", i, got)
+		}
+
+		for j, l := range got.Lines {
+			if !l.Result.Net.Equal(want.Lines[j].Result.Net) || !l.Result.Taxes.Equal(want.Lines[j].Result.Taxes) || !declared.Lines[j].Equal(l.Result.Net) {
+				t.Errorf("[test case %d] line %d: got net %v and taxes %v. Expected %v and %v", i, j+1, l.Result.Net, l.Result.Taxes, want.Lines[j].Result.Net, want.Lines[j].Result.Taxes)
+			}
+		}
+
+		totals, _ := want.Totals()
+
+		if !declared.Totals.Payable.Equal(totals.Payable) || len(declared.Totals.Subtotals) != len(totals.Subtotals) {
+			t.Errorf("[test case %d] got declared totals %+v", i, declared.Totals)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	data, err := Marshal(document(Invoice))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := string(data)
+	tolerances := audit.Tolerances{Line: udfs("0.01"), Total: udfs("0.02")}
+
+	testCases := []struct {
+		replacements []string
+		expected     []string
+	}{
+		{nil, nil},
+		// differences within the tolerances are accepted
+		{[]string{`<cbc:LineExtensionAmount currencyID="EUR">15.98</cbc:LineExtensionAmount>`, `<cbc:LineExtensionAmount currencyID="EUR">15.99</cbc:LineExtensionAmount>`}, nil},
+		{[]string{
+			`<cbc:LineExtensionAmount currencyID="EUR">33.75</cbc:LineExtensionAmount>
+    <cac:AllowanceCharge>`, `<cbc:LineExtensionAmount currencyID="EUR">37.50</cbc:LineExtensionAmount>
+    <cac:AllowanceCharge>`,
+			`<cbc:TaxAmount currencyID="EUR">1.12</cbc:TaxAmount>`, `<cbc:TaxAmount currencyID="EUR">1.20</cbc:TaxAmount>`,
+			`<cbc:PayableAmount currencyID="EUR">154.29</cbc:PayableAmount>`, `<cbc:PayableAmount currencyID="EUR">154.39</cbc:PayableAmount>`,
+		}, []string{
+			"line 1 LineExtensionAmount: declared 37.50, calculated 33.75",
+			"total PayableAmount: declared 154.39, calculated 154.29",
+			"total TaxSubtotal[S 7]/TaxAmount: declared 1.20, calculated 1.12",
+		}},
+		// the line is calculated from its price, quantity and allowances
+		{[]string{`<cbc:PriceAmount currencyID="EUR">7.99</cbc:PriceAmount>`, `<cbc:PriceAmount currencyID="EUR">79.9</cbc:PriceAmount>
+      <cbc:BaseQuantity unitCode="C62">10</cbc:BaseQuantity>`}, nil},
+		{[]string{`<cbc:PriceAmount currencyID="EUR">7.99</cbc:PriceAmount>`, `<cbc:PriceAmount currencyID="EUR">8.99</cbc:PriceAmount>`}, []string{
+			"line 2 LineExtensionAmount: declared 15.98, calculated 17.98",
+			"total LineExtensionAmount: declared 149.73, calculated 151.73",
+			"total TaxExclusiveAmount: declared 147.23, calculated 149.23",
+			"total TaxAmount: declared 7.06, calculated 7.20",
+			"total TaxInclusiveAmount: declared 154.29, calculated 156.43",
+			"total PayableAmount: declared 154.29, calculated 156.43",
+			"total TaxSubtotal[S 7]/TaxableAmount: declared 15.98, calculated 17.98",
+			"total TaxSubtotal[S 7]/TaxAmount: declared 1.12, calculated 1.26",
+		}},
+		// a subtotal declared with another rate doesn't match the calculated one
+		{[]string{`<cbc:Percent>7</cbc:Percent>
+        <cac:TaxScheme>
+          <cbc:ID>VAT</cbc:ID>
+        </cac:TaxScheme>
+      </cac:TaxCategory>`, `<cbc:Percent>10</cbc:Percent>
+        <cac:TaxScheme>
+          <cbc:ID>VAT</cbc:ID>
+        </cac:TaxScheme>
+      </cac:TaxCategory>`}, []string{
+			"total TaxSubtotal[S 7]/TaxableAmount: declared 0, calculated 15.98",
+			"total TaxSubtotal[S 7]/TaxAmount: declared 0, calculated 1.12",
+			"total TaxSubtotal[S 10]/TaxableAmount: declared 15.98, calculated 0",
+			"total TaxSubtotal[S 10]/TaxAmount: declared 1.12, calculated 0",
+		}},
+	}
+
+	for i, tc := range testCases {
+		doc := valid
+
+		for j := 0; j < len(tc.replacements); j += 2 {
+			if !strings.Contains(doc, tc.replacements[j]) {
+				t.Fatalf("[test case %d] %s not found", i, tc.replacements[j])
+			}
+
+			doc = strings.Replace(doc, tc.replacements[j], tc.replacements[j+1], 1)
+		}
+
+		report, err := Audit(strings.NewReader(doc), tolerances)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if len(report.Discrepancies) != len(tc.expected) {
+			t.Fatalf("[test case %d] got discrepancies\n%s\nExpected\n%s", i, report, strings.Join(tc.expected, "\n"))
+		}
+
+		for j, d := range report.Discrepancies {
+			if d.String() != tc.expected[j] {
+				t.Errorf("[test case %d] got %q. Expected %q", i, d.String(), tc.expected[j])
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	data, _ := Marshal(document(Invoice))
+	valid := string(data)
+
+	for i, doc := range []string{
+		`<Order xmlns="urn:oasis:names:specification:ubl:schema:xsd:Order-2"/>`,
+		strings.Replace(valid, "<cbc:IssueDate>2025-03-14</cbc:IssueDate>", "<cbc:IssueDate>14/03/2025</cbc:IssueDate>", 1),
+		strings.Replace(valid, `<cbc:PriceAmount currencyID="EUR">7.99</cbc:PriceAmount>`, `<cbc:PriceAmount currencyID="EUR">7,99</cbc:PriceAmount>`, 1),
+		// the price per unit overflows gyro
+		strings.Replace(valid, `<cbc:PriceAmount currencyID="EUR">7.99</cbc:PriceAmount>`, `<cbc:PriceAmount currencyID="EUR">10000000000000000000000000</cbc:PriceAmount>
+      <cbc:BaseQuantity unitCode="C62">0.0000000001</cbc:BaseQuantity>`, 1),
+		valid[:strings.Index(valid, "<cac:InvoiceLine>")] + "</Invoice>",
+		"<Invoice",
+	} {
+		if _, _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+// Package ubl exports documents calculated with the johnny package as UBL 2.1 invoices and credit notes, the
+// syntax of the European standard on electronic invoicing (EN 16931) and of PEPPOL.
+//
+// Lines are reported with the amounts of their [johnny.Result], and the tax subtotals and the monetary totals
+// of the document are calculated with johnny rules too. Exported documents are checked offline with
+// [ValidateStructure] against a structural subset of the UBL 2.1 schemas, covering the elements the package
+// writes. It's not a validation against the official OASIS schemas, which aren't bundled, and the business
+// rules of EN 16931, which are given as Schematron, are not checked either.
+//
+// Received documents are read with [Parse], which rebuilds the calculation of their lines, and [Audit] reports
+// the amounts they declare which differ from the calculated ones.
+package ubl
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/euvat"
+	"github.com/profe-ajedrez/johnny/internal/xsd"
+)
+
+// Namespaces of the UBL 2.1 documents.
+const (
+	InvoiceNamespace    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	CreditNoteNamespace = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	CACNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	CBCNamespace        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Decimals is the number of decimals of the amounts of a document, as EN 16931 allows.
+const Decimals = 2
+
+// Codes of the tax categories, as the UNCL5305 code list.
+const (
+	StandardRate   = "S"
+	ZeroRated      = "Z"
+	Exempt         = "E"
+	ReverseCharge  = "AE"
+	IntraCommunity = "K"
+	OutOfScope     = "O"
+)
+
+// DocumentType is the type of a UBL document.
+type DocumentType int
+
+const (
+	// Invoice is a commercial invoice, of type code 380.
+	Invoice DocumentType = iota
+	// CreditNote is a credit note, of type code 381, which corrects an invoice.
+	CreditNote
+)
+
+var documentNames = [...]string{
+	Invoice:    "Invoice",
+	CreditNote: "CreditNote",
+}
+
+// String returns the name of the root element of the document, as "CreditNote".
+func (t DocumentType) String() string {
+	if t < 0 || int(t) >= len(documentNames) {
+		return "unknown"
+	}
+
+	return documentNames[t]
+}
+
+// TypeCode returns the type code of the document, as the UNCL1001 code list.
+func (t DocumentType) TypeCode() string {
+	if t == CreditNote {
+		return "381"
+	}
+
+	return "380"
+}
+
+// TaxCategory is the tax category a line, an allowance or a charge is taxed in.
+type TaxCategory struct {
+	// ID is the code of the category, as [StandardRate].
+	ID string
+	// Percent is the rate of the tax, zero when the category is not taxed.
+	Percent gyro.Gyro
+	// ExemptionReasonCode is the VATEX code of the reason of the exemption, and ExemptionReason its text.
+	ExemptionReasonCode string
+	ExemptionReason     string
+	// Scheme is the tax scheme, "VAT" when empty.
+	Scheme string
+}
+
+// Category returns the tax category of a tax charged at percent, or not charged because of the given
+// exemption and reason, as the ones of an [euvat.VAT]. Intra-community supplies of goods get their own
+// category, [IntraCommunity].
+func Category(kind johnny.ExemptionKind, percent gyro.Gyro, reason string) TaxCategory {
+	t := TaxCategory{ID: StandardRate, Percent: percent}
+
+	switch kind {
+	case johnny.NotExempt:
+		return t
+	case johnny.ZeroRated:
+		t.ID = ZeroRated
+	case johnny.Exempt:
+		t.ID = Exempt
+
+		if reason == euvat.ReasonIntraCommunity {
+			t.ID = IntraCommunity
+		}
+	case johnny.ReverseCharge:
+		t.ID = ReverseCharge
+	case johnny.OutOfScope:
+		t.ID = OutOfScope
+	}
+
+	t.Percent, t.ExemptionReasonCode = gyro.NewZero(), reason
+
+	return t
+}
+
+var categoryKinds = map[string]johnny.ExemptionKind{
+	StandardRate:   johnny.NotExempt,
+	ZeroRated:      johnny.ZeroRated,
+	Exempt:         johnny.Exempt,
+	IntraCommunity: johnny.Exempt,
+	ReverseCharge:  johnny.ReverseCharge,
+	OutOfScope:     johnny.OutOfScope,
+}
+
+// Rule returns the tax rule of the category, exempted when it's not charged.
+func (t TaxCategory) Rule() johnny.PercTaxRule {
+	r := johnny.NewPercTaxRule(t.Percent).WithCode(t.ID)
+
+	if kind := categoryKinds[t.ID]; kind != johnny.NotExempt {
+		r = r.WithExemption(kind, t.ExemptionReasonCode)
+	}
+
+	return r
+}
+
+// same tells whether both categories are reported in the same tax subtotal.
+func (t TaxCategory) same(o TaxCategory) bool {
+	return t.ID == o.ID && t.Percent.Equal(o.Percent) && t.ExemptionReasonCode == o.ExemptionReasonCode && t.scheme() == o.scheme()
+}
+
+func (t TaxCategory) scheme() string {
+	if t.Scheme == "" {
+		return "VAT"
+	}
+
+	return t.Scheme
+}
+
+// Party is the supplier or the customer of a document.
+type Party struct {
+	Name string
+	// TaxID is the VAT identifier of the party, as "DE123456789".
+	TaxID  string
+	Street string
+	City   string
+	// PostalZone is the postal code of the address.
+	PostalZone string
+	// Country is the ISO 3166 code of the country of the address.
+	Country string
+}
+
+// Line is a line of a document, calculated from its unit value.
+type Line struct {
+	ID   string
+	Name string
+	Qty  gyro.Gyro
+	// UnitCode is the unit of the quantity, as the UN/ECE recommendation 20, "C62" (one) when empty.
+	UnitCode string
+	Tax      TaxCategory
+	// AllowanceReason is the reason of the discounts of the line, "Discount" when empty.
+	AllowanceReason string
+	// Result is the calculation of the line, whose entry value is the unit price.
+	Result johnny.Result
+}
+
+// amounts returns the amount of the line, its net value rounded, and the allowance, or charge when negative,
+// making the difference with the quantity times the price.
+func (l Line) amounts() (gyro.Gyro, gyro.Gyro) {
+	amount := l.Result.Net.Round(Decimals)
+	return amount, l.Qty.Mul(l.Result.Entry).Round(Decimals).Sub(amount)
+}
+
+// AllowanceCharge is an allowance or a charge over the whole document.
+type AllowanceCharge struct {
+	// Charge tells whether it's a charge, an allowance otherwise.
+	Charge bool
+	Reason string
+	Amount gyro.Gyro
+	// Tax is the tax category the amount is taxed in.
+	Tax TaxCategory
+}
+
+// Document is an invoice or a credit note.
+type Document struct {
+	Type DocumentType
+	// CustomizationID identifies the specification the document follows, as the one of PEPPOL BIS Billing 3.0.
+	CustomizationID string
+	ID              string
+	IssueDate       time.Time
+	// DueDate is the date the invoice is due, not reported when zero.
+	DueDate time.Time
+	Note    string
+	// Currency is the ISO 4217 code of the currency of the document.
+	Currency string
+	// InvoiceID is the ID of the invoice a credit note corrects.
+	InvoiceID string
+	Supplier  Party
+	Customer  Party
+	Lines     []Line
+	// AllowanceCharges holds the allowances and charges over the whole document.
+	AllowanceCharges []AllowanceCharge
+}
+
+// Subtotal is the tax of a category of a document.
+type Subtotal struct {
+	Tax TaxCategory
+	// Taxable is the sum of the amounts of the lines of the category, minus its allowances plus its charges.
+	Taxable gyro.Gyro
+	// Amount is the tax charged over the taxable amount, rounded.
+	Amount gyro.Gyro
+}
+
+// Totals holds the monetary totals of a document, whose amounts are rounded to [Decimals].
+type Totals struct {
+	// LineExtension is the sum of the amounts of the lines.
+	LineExtension gyro.Gyro
+	Allowances    gyro.Gyro
+	Charges       gyro.Gyro
+	// TaxExclusive is the amount of the lines minus the allowances plus the charges.
+	TaxExclusive gyro.Gyro
+	Tax          gyro.Gyro
+	TaxInclusive gyro.Gyro
+	Payable      gyro.Gyro
+	// Subtotals holds the tax of each category, in the order they first appear in the document.
+	Subtotals []Subtotal
+}
+
+// Totals returns the totals of the document. The tax of each category is calculated over its taxable
+// amount, as EN 16931 requires, instead of adding the taxes of the lines.
+// An error is returned if the document has no lines.
+func (d Document) Totals() (Totals, error) {
+	if len(d.Lines) == 0 {
+		return Totals{}, johnny.NewJohnnyError("a document must have lines")
+	}
+
+	var t Totals
+
+	subtotal := func(tax TaxCategory) *Subtotal {
+		for i := range t.Subtotals {
+			if t.Subtotals[i].Tax.same(tax) {
+				return &t.Subtotals[i]
+			}
+		}
+
+		t.Subtotals = append(t.Subtotals, Subtotal{Tax: tax})
+		return &t.Subtotals[len(t.Subtotals)-1]
+	}
+
+	for _, l := range d.Lines {
+		amount, _ := l.amounts()
+		t.LineExtension = t.LineExtension.Add(amount)
+
+		s := subtotal(l.Tax)
+		s.Taxable = s.Taxable.Add(amount)
+	}
+
+	for _, ac := range d.AllowanceCharges {
+		amount := ac.Amount.Round(Decimals)
+		s := subtotal(ac.Tax)
+
+		if ac.Charge {
+			t.Charges = t.Charges.Add(amount)
+			s.Taxable = s.Taxable.Add(amount)
+		} else {
+			t.Allowances = t.Allowances.Add(amount)
+			s.Taxable = s.Taxable.Sub(amount)
+		}
+	}
+
+	for i, s := range t.Subtotals {
+		r, err := johnny.Run(johnny.NewFromUnitValue(s.Taxable), s.Tax.Rule())
+
+		if err != nil {
+			return Totals{}, err
+		}
+
+		t.Subtotals[i].Amount = r.Taxes.Round(Decimals)
+		t.Tax = t.Tax.Add(t.Subtotals[i].Amount)
+	}
+
+	t.TaxExclusive = t.LineExtension.Sub(t.Allowances).Add(t.Charges)
+	t.TaxInclusive = t.TaxExclusive.Add(t.Tax)
+	t.Payable = t.TaxInclusive
+
+	return t, nil
+}
+
+type amountXML struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type quantityXML struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type taxSchemeXML struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type taxCategoryXML struct {
+	ID                  string       `xml:"cbc:ID"`
+	Percent             string       `xml:"cbc:Percent,omitempty"`
+	ExemptionReasonCode string       `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason     string       `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme           taxSchemeXML `xml:"cac:TaxScheme"`
+}
+
+type allowanceChargeXML struct {
+	ChargeIndicator bool            `xml:"cbc:ChargeIndicator"`
+	Reason          string          `xml:"cbc:AllowanceChargeReason,omitempty"`
+	Amount          amountXML       `xml:"cbc:Amount"`
+	BaseAmount      *amountXML      `xml:"cbc:BaseAmount,omitempty"`
+	TaxCategory     *taxCategoryXML `xml:"cac:TaxCategory,omitempty"`
+}
+
+type countryXML struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+type addressXML struct {
+	StreetName string      `xml:"cbc:StreetName,omitempty"`
+	CityName   string      `xml:"cbc:CityName,omitempty"`
+	PostalZone string      `xml:"cbc:PostalZone,omitempty"`
+	Country    *countryXML `xml:"cac:Country,omitempty"`
+}
+
+type partyTaxSchemeXML struct {
+	CompanyID string       `xml:"cbc:CompanyID"`
+	TaxScheme taxSchemeXML `xml:"cac:TaxScheme"`
+}
+
+type partyLegalEntityXML struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+}
+
+type partyXML struct {
+	PostalAddress    *addressXML          `xml:"cac:Party>cac:PostalAddress,omitempty"`
+	PartyTaxScheme   *partyTaxSchemeXML   `xml:"cac:Party>cac:PartyTaxScheme,omitempty"`
+	PartyLegalEntity *partyLegalEntityXML `xml:"cac:Party>cac:PartyLegalEntity,omitempty"`
+}
+
+type billingReferenceXML struct {
+	InvoiceID string `xml:"cac:InvoiceDocumentReference>cbc:ID"`
+}
+
+type taxSubtotalXML struct {
+	TaxableAmount amountXML      `xml:"cbc:TaxableAmount"`
+	TaxAmount     amountXML      `xml:"cbc:TaxAmount"`
+	TaxCategory   taxCategoryXML `xml:"cac:TaxCategory"`
+}
+
+type taxTotalXML struct {
+	TaxAmount    amountXML        `xml:"cbc:TaxAmount"`
+	TaxSubtotals []taxSubtotalXML `xml:"cac:TaxSubtotal"`
+}
+
+type monetaryTotalXML struct {
+	LineExtensionAmount  amountXML  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount   amountXML  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount   amountXML  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotalAmount *amountXML `xml:"cbc:AllowanceTotalAmount,omitempty"`
+	ChargeTotalAmount    *amountXML `xml:"cbc:ChargeTotalAmount,omitempty"`
+	PayableAmount        amountXML  `xml:"cbc:PayableAmount"`
+}
+
+type lineXML struct {
+	ID                    string               `xml:"cbc:ID"`
+	InvoicedQuantity      *quantityXML         `xml:"cbc:InvoicedQuantity,omitempty"`
+	CreditedQuantity      *quantityXML         `xml:"cbc:CreditedQuantity,omitempty"`
+	LineExtensionAmount   amountXML            `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharges      []allowanceChargeXML `xml:"cac:AllowanceCharge"`
+	Name                  string               `xml:"cac:Item>cbc:Name"`
+	ClassifiedTaxCategory taxCategoryXML       `xml:"cac:Item>cac:ClassifiedTaxCategory"`
+	PriceAmount           amountXML            `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+type documentXML struct {
+	XMLName                 xml.Name
+	Xmlns                   string               `xml:"xmlns,attr"`
+	XmlnsCAC                string               `xml:"xmlns:cac,attr"`
+	XmlnsCBC                string               `xml:"xmlns:cbc,attr"`
+	UBLVersionID            string               `xml:"cbc:UBLVersionID"`
+	CustomizationID         string               `xml:"cbc:CustomizationID,omitempty"`
+	ID                      string               `xml:"cbc:ID"`
+	IssueDate               string               `xml:"cbc:IssueDate"`
+	DueDate                 string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode         string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode      string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note                    string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode    string               `xml:"cbc:DocumentCurrencyCode"`
+	BillingReference        *billingReferenceXML `xml:"cac:BillingReference,omitempty"`
+	AccountingSupplierParty partyXML             `xml:"cac:AccountingSupplierParty"`
+	AccountingCustomerParty partyXML             `xml:"cac:AccountingCustomerParty"`
+	AllowanceCharges        []allowanceChargeXML `xml:"cac:AllowanceCharge"`
+	TaxTotal                taxTotalXML          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal      monetaryTotalXML     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines            []lineXML            `xml:"cac:InvoiceLine"`
+	CreditNoteLines         []lineXML            `xml:"cac:CreditNoteLine"`
+}
+
+// Marshal returns the UBL XML of the document, checked with [ValidateStructure].
+// An error is returned if the document has no lines, or isn't valid.
+func Marshal(d Document) ([]byte, error) {
+	t, err := d.Totals()
+
+	if err != nil {
+		return nil, err
+	}
+
+	amount := func(v gyro.Gyro) amountXML {
+		return amountXML{Currency: d.Currency, Value: johnny.DecimalString(v.Round(Decimals))}
+	}
+
+	optional := func(v gyro.Gyro) *amountXML {
+		if v.Equal(gyro.NewZero()) {
+			return nil
+		}
+
+		a := amount(v)
+		return &a
+	}
+
+	x := documentXML{
+		XMLName:                 xml.Name{Local: d.Type.String()},
+		Xmlns:                   InvoiceNamespace,
+		XmlnsCAC:                CACNamespace,
+		XmlnsCBC:                CBCNamespace,
+		UBLVersionID:            "2.1",
+		CustomizationID:         d.CustomizationID,
+		ID:                      d.ID,
+		IssueDate:               d.IssueDate.Format(johnny.DateLayout),
+		Note:                    d.Note,
+		DocumentCurrencyCode:    d.Currency,
+		AccountingSupplierParty: party(d.Supplier),
+		AccountingCustomerParty: party(d.Customer),
+		TaxTotal:                taxTotalXML{TaxAmount: amount(t.Tax)},
+		LegalMonetaryTotal: monetaryTotalXML{
+			LineExtensionAmount:  amount(t.LineExtension),
+			TaxExclusiveAmount:   amount(t.TaxExclusive),
+			TaxInclusiveAmount:   amount(t.TaxInclusive),
+			AllowanceTotalAmount: optional(t.Allowances),
+			ChargeTotalAmount:    optional(t.Charges),
+			PayableAmount:        amount(t.Payable),
+		},
+	}
+
+	if d.InvoiceID != "" {
+		x.BillingReference = &billingReferenceXML{InvoiceID: d.InvoiceID}
+	}
+
+	if d.Type == CreditNote {
+		x.Xmlns, x.CreditNoteTypeCode = CreditNoteNamespace, d.Type.TypeCode()
+	} else {
+		x.InvoiceTypeCode = d.Type.TypeCode()
+
+		if !d.DueDate.IsZero() {
+			x.DueDate = d.DueDate.Format(johnny.DateLayout)
+		}
+	}
+
+	for _, ac := range d.AllowanceCharges {
+		tax := category(ac.Tax)
+		x.AllowanceCharges = append(x.AllowanceCharges, allowanceChargeXML{ChargeIndicator: ac.Charge, Reason: ac.Reason, Amount: amount(ac.Amount), TaxCategory: &tax})
+	}
+
+	for _, s := range t.Subtotals {
+		x.TaxTotal.TaxSubtotals = append(x.TaxTotal.TaxSubtotals, taxSubtotalXML{TaxableAmount: amount(s.Taxable), TaxAmount: amount(s.Amount), TaxCategory: category(s.Tax)})
+	}
+
+	for _, l := range d.Lines {
+		lx := line(l, amount)
+
+		if d.Type == CreditNote {
+			lx.CreditedQuantity, lx.InvoicedQuantity = lx.InvoicedQuantity, nil
+			x.CreditNoteLines = append(x.CreditNoteLines, lx)
+		} else {
+			x.InvoiceLines = append(x.InvoiceLines, lx)
+		}
+	}
+
+	data, err := xml.MarshalIndent(x, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	data = append([]byte(xml.Header), data...)
+
+	if err := ValidateStructure(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func line(l Line, amount func(gyro.Gyro) amountXML) lineXML {
+	unit := l.UnitCode
+
+	if unit == "" {
+		unit = "C62"
+	}
+
+	ext, allowance := l.amounts()
+
+	lx := lineXML{
+		ID:                    l.ID,
+		InvoicedQuantity:      &quantityXML{UnitCode: unit, Value: johnny.DecimalString(l.Qty)},
+		LineExtensionAmount:   amount(ext),
+		Name:                  l.Name,
+		ClassifiedTaxCategory: category(l.Tax),
+		PriceAmount:           amount(l.Result.Entry),
+	}
+
+	// prices may have more decimals than amounts
+	lx.PriceAmount.Value = johnny.DecimalString(l.Result.Entry)
+
+	if !allowance.Equal(gyro.NewZero()) {
+		reason := l.AllowanceReason
+
+		if reason == "" {
+			reason = "Discount"
+		}
+
+		ac := allowanceChargeXML{Reason: reason, Amount: amount(allowance)}
+
+		if allowance.Cmp(gyro.NewZero()) < 0 {
+			ac.ChargeIndicator, ac.Amount = true, amount(gyro.NewZero().Sub(allowance))
+		}
+
+		lx.AllowanceCharges = append(lx.AllowanceCharges, ac)
+	}
+
+	return lx
+}
+
+func category(t TaxCategory) taxCategoryXML {
+	x := taxCategoryXML{ID: t.ID, ExemptionReasonCode: t.ExemptionReasonCode, ExemptionReason: t.ExemptionReason, TaxScheme: taxSchemeXML{ID: t.scheme()}}
+
+	// categories out of scope of the tax have no rate
+	if t.ID != OutOfScope {
+		x.Percent = johnny.DecimalString(t.Percent)
+	}
+
+	return x
+}
+
+func party(p Party) partyXML {
+	x := partyXML{PartyLegalEntity: &partyLegalEntityXML{RegistrationName: p.Name}}
+
+	if p.Street != "" || p.City != "" || p.PostalZone != "" || p.Country != "" {
+		x.PostalAddress = &addressXML{StreetName: p.Street, CityName: p.City, PostalZone: p.PostalZone}
+
+		if p.Country != "" {
+			x.PostalAddress.Country = &countryXML{IdentificationCode: p.Country}
+		}
+	}
+
+	if p.TaxID != "" {
+		x.PartyTaxScheme = &partyTaxSchemeXML{CompanyID: p.TaxID, TaxScheme: taxSchemeXML{ID: "VAT"}}
+	}
+
+	return x
+}
+
+//go:embed schema/*.xsd
+var schemas embed.FS
+
+var schemaFiles = []string{
+	"UBL-CommonBasicComponents-2.1-subset.xsd",
+	"UBL-CommonAggregateComponents-2.1-subset.xsd",
+	"UBL-Invoice-2.1-subset.xsd",
+	"UBL-CreditNote-2.1-subset.xsd",
+}
+
+var schema = func() *xsd.Schema {
+	files := make([]io.Reader, 0, len(schemaFiles))
+
+	for _, name := range schemaFiles {
+		f, err := schemas.Open("schema/" + name)
+
+		if err != nil {
+			panic(err)
+		}
+
+		files = append(files, f)
+	}
+
+	s, err := xsd.Load(files...)
+
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled schema: %v", err))
+	}
+
+	return s
+}()
+
+// ValidateStructure checks a UBL invoice or credit note against the subset of the UBL 2.1 schemas bundled in
+// ubl/schema, which covers only the elements the package writes, with their order, cardinality and data types.
+// It's not a validation against the official OASIS schemas: a valid UBL document using other elements is
+// rejected, and the business rules of EN 16931 are not checked.
+func ValidateStructure(r io.Reader) error {
+	return schema.Validate(r)
+}
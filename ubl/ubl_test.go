@@ -0,0 +1,228 @@
+package ubl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profe-ajedrez/gyro"
+	"github.com/profe-ajedrez/johnny"
+	"github.com/profe-ajedrez/johnny/euvat"
+)
+
+func udfs(s string) gyro.Gyro {
+	g, _ := gyro.NewFromString(s)
+	return g
+}
+
+func newLine(id string, qty, unitValue string, tax TaxCategory, visitors ...johnny.Visitor) Line {
+	visitors = append([]johnny.Visitor{johnny.WithQTY(udfs(qty))}, append(visitors, tax.Rule())...)
+
+	r, _ := johnny.Run(johnny.NewFromUnitValue(udfs(unitValue)), visitors...)
+
+	return Line{ID: id, Name: "item " + id, Qty: udfs(qty), Tax: tax, Result: r}
+}
+
+func document(typ DocumentType) Document {
+	standard := Category(johnny.NotExempt, udfs("19"), "")
+
+	return Document{
+		Type:      typ,
+		ID:        "INV-2025-001",
+		IssueDate: time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, 4, 13, 0, 0, 0, 0, time.UTC),
+		Currency:  "EUR",
+		Supplier:  Party{Name: "Seller GmbH", TaxID: "DE123456789", City: "Berlin", Country: "DE"},
+		Customer:  Party{Name: "Buyer AG", TaxID: "DE987654321", Country: "DE"},
+		Lines: []Line{
+			newLine("1", "3", "12.5", standard, johnny.NewPercentualDiscount(udfs("10"))),
+			newLine("2", "2", "7.99", Category(johnny.NotExempt, udfs("7"), "")),
+			newLine("3", "1", "100", Category(johnny.Exempt, udfs("19"), "VATEX-EU-132")),
+		},
+		AllowanceCharges: []AllowanceCharge{
+			{Reason: "Loyalty", Amount: udfs("5"), Tax: standard},
+			{Charge: true, Reason: "Freight", Amount: udfs("2.5"), Tax: standard},
+		},
+	}
+}
+
+func TestTotals(t *testing.T) {
+	got, err := document(Invoice).Totals()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name      string
+		got, want gyro.Gyro
+	}{
+		{"line extension", got.LineExtension, udfs("149.73")},
+		{"allowances", got.Allowances, udfs("5")},
+		{"charges", got.Charges, udfs("2.5")},
+		{"tax exclusive", got.TaxExclusive, udfs("147.23")},
+		// 19% of 31.25 is 5.9375, and 7% of 15.98 is 1.1186
+		{"tax", got.Tax, udfs("7.06")},
+		{"tax inclusive", got.TaxInclusive, udfs("154.29")},
+		{"payable", got.Payable, udfs("154.29")},
+	}
+
+	for i, w := range want {
+		if !w.got.Equal(w.want) {
+			t.Errorf("[test case %d] got %s %v. Expected %v", i, w.name, w.got, w.want)
+		}
+	}
+
+	subtotals := []struct {
+		id, taxable, amount string
+	}{
+		{StandardRate, "31.25", "5.94"},
+		{StandardRate, "15.98", "1.12"},
+		{Exempt, "100", "0"},
+	}
+
+	if len(got.Subtotals) != len(subtotals) {
+		t.Fatalf("got %d subtotals. Expected %d", len(got.Subtotals), len(subtotals))
+	}
+
+	for i, s := range subtotals {
+		g := got.Subtotals[i]
+
+		if g.Tax.ID != s.id || !g.Taxable.Equal(udfs(s.taxable)) || !g.Amount.Equal(udfs(s.amount)) {
+			t.Errorf("[test case %d] got %s %v and %v. Expected %s %v and %v", i, g.Tax.ID, g.Taxable, g.Amount, s.id, s.taxable, s.amount)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	testCases := []struct {
+		typ      DocumentType
+		contains []string
+		excludes []string
+	}{
+		{Invoice, []string{
+			`<Invoice xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"`,
+			`<cbc:InvoiceTypeCode>380</cbc:InvoiceTypeCode>`,
+			`<cbc:DueDate>2025-04-13</cbc:DueDate>`,
+			`<cbc:InvoicedQuantity unitCode="C62">3</cbc:InvoicedQuantity>`,
+			`<cbc:Amount currencyID="EUR">3.75</cbc:Amount>`,
+			`<cbc:TaxExemptionReasonCode>VATEX-EU-132</cbc:TaxExemptionReasonCode>`,
+			`<cbc:PayableAmount currencyID="EUR">154.29</cbc:PayableAmount>`,
+			`<cbc:PriceAmount currencyID="EUR">7.99</cbc:PriceAmount>`,
+		}, []string{"BillingReference"}},
+		{CreditNote, []string{
+			`<CreditNote xmlns="urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"`,
+			`<cbc:CreditNoteTypeCode>381</cbc:CreditNoteTypeCode>`,
+			`<cbc:CreditedQuantity unitCode="C62">2</cbc:CreditedQuantity>`,
+			`<cac:InvoiceDocumentReference>`,
+		}, []string{"InvoicedQuantity", "DueDate"}},
+	}
+
+	for i, tc := range testCases {
+		d := document(tc.typ)
+
+		if tc.typ == CreditNote {
+			d.InvoiceID = "INV-2025-000"
+		}
+
+		data, err := Marshal(d)
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		for _, s := range tc.contains {
+			if !bytes.Contains(data, []byte(s)) {
+				t.Errorf("[test case %d] %s not found in\n%s", i, s, data)
+			}
+		}
+
+		for _, s := range tc.excludes {
+			if bytes.Contains(data, []byte(s)) {
+				t.Errorf("[test case %d] %s found in\n%s", i, s, data)
+			}
+		}
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	d := document(Invoice)
+	d.Lines = nil
+
+	if _, err := Marshal(d); err == nil {
+		t.Errorf("error expected for a document without lines")
+	}
+
+	d = document(Invoice)
+	d.Currency = "euro"
+
+	if _, err := Marshal(d); err == nil || !strings.Contains(err.Error(), "currencyID") {
+		t.Errorf("got %v. Expected an invalid currency", err)
+	}
+}
+
+func TestValidateStructure(t *testing.T) {
+	valid, err := Marshal(document(Invoice))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		old, new string
+	}{
+		{"<cbc:IssueDate>2025-03-14</cbc:IssueDate>", "<cbc:IssueDate>14/03/2025</cbc:IssueDate>"},
+		{"<cbc:ChargeIndicator>false</cbc:ChargeIndicator>", ""},
+		{`<cbc:PayableAmount currencyID="EUR">`, `<cbc:PayableAmount>`},
+		{"<cbc:UBLVersionID>2.1</cbc:UBLVersionID>\n  <cbc:ID>INV-2025-001</cbc:ID>", "<cbc:ID>INV-2025-001</cbc:ID>\n  <cbc:UBLVersionID>2.1</cbc:UBLVersionID>"},
+		// valid UBL, but outside the subset
+		{"<cbc:IssueDate>2025-03-14</cbc:IssueDate>", "<cbc:IssueDate>2025-03-14</cbc:IssueDate>\n  <cbc:Note>Thanks</cbc:Note>"},
+	}
+
+	for i, tc := range testCases {
+		data := strings.Replace(string(valid), tc.old, tc.new, 1)
+
+		if data == string(valid) {
+			t.Fatalf("[test case %d] %s not found", i, tc.old)
+		}
+
+		if err := ValidateStructure(strings.NewReader(data)); err == nil {
+			t.Errorf("[test case %d] error expected", i)
+		}
+	}
+}
+
+func TestCategory(t *testing.T) {
+	testCases := []struct {
+		kind    johnny.ExemptionKind
+		reason  string
+		id      string
+		percent string
+	}{
+		{johnny.NotExempt, "", StandardRate, "21"},
+		{johnny.ZeroRated, "", ZeroRated, "0"},
+		{johnny.Exempt, "VATEX-EU-132", Exempt, "0"},
+		{johnny.Exempt, euvat.ReasonIntraCommunity, IntraCommunity, "0"},
+		{johnny.ReverseCharge, euvat.ReasonReverseCharge, ReverseCharge, "0"},
+		{johnny.OutOfScope, "VATEX-EU-O", OutOfScope, "0"},
+	}
+
+	for i, tc := range testCases {
+		got := Category(tc.kind, udfs("21"), tc.reason)
+
+		if got.ID != tc.id || !got.Percent.Equal(udfs(tc.percent)) || got.ExemptionReasonCode != tc.reason {
+			t.Errorf("[test case %d] got %+v. Expected %s at %s", i, got, tc.id, tc.percent)
+		}
+
+		r, err := johnny.Run(johnny.NewFromUnitValue(udfs("100")), got.Rule())
+
+		if err != nil {
+			t.Fatalf("[test case %d] %v", i, err)
+		}
+
+		if tc.kind != johnny.NotExempt && (!r.Taxes.Equal(gyro.NewZero()) || len(r.Exemptions) != 1 || r.Exemptions[0].Kind != tc.kind) {
+			t.Errorf("[test case %d] got taxes %v and exemptions %+v", i, r.Taxes, r.Exemptions)
+		}
+	}
+}
@@ -67,8 +67,18 @@ func NewPercentualDiscount(ratio gyro.Gyro) *PercentualDiscount {
 // The calculated discount amount is then subtracted from the Johnny value.
 // This implemenetation Visitesnt check for negative discounts
 func (pd *PercentualDiscount) Visit(b Johnny) {
-	pd.amount = b.Value().Mul(pd.ratio).Div(gyro.NewHundred())
-	b.Sub(pd.amount)
+	pd.amount = pd.Rule().apply(b).Amount
+}
+
+// Rule returns the immutable definition of the discount.
+func (pd *PercentualDiscount) Rule() PercentualDiscountRule {
+	return NewPercentualDiscountRule(pd.ratio)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the discount,
+// so it can visit another Johnny as if it were new.
+func (pd *PercentualDiscount) Reset() {
+	pd.amount = gyro.Gyro{}
 }
 
 // AmountDiscount represents a discount that is applied as a fixed amount.
@@ -91,13 +101,18 @@ func NewAmountDiscount(amount gyro.Gyro) *AmountDiscount {
 // If the Johnny value's buffer is zero, the discount ratio is set to zero.
 // This implemenetation Visitesnt check for negative discounts
 func (pd *AmountDiscount) Visit(b Johnny) {
-	if b.Value().Equal(gyro.NewZero()) {
-		pd.ratio = gyro.NewZero()
-		return
-	}
+	pd.ratio = pd.Rule().apply(b).Ratio
+}
 
-	pd.ratio = gyro.NewHundred().Mul(pd.amount).Div(b.Value())
-	b.Sub(pd.amount)
+// Rule returns the immutable definition of the discount.
+func (pd *AmountDiscount) Rule() AmountDiscountRule {
+	return NewAmountDiscountRule(pd.amount)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the discount,
+// so it can visit another Johnny as if it were new.
+func (pd *AmountDiscount) Reset() {
+	pd.ratio = gyro.Gyro{}
 }
 
 type Qty struct {
@@ -114,6 +129,13 @@ func (q Qty) Visit(b Johnny) {
 	b.Mul(q.qty)
 }
 
+// Apply multiplies the Johnny by the quantity, which is multiplied into the quantity of rc,
+// so the rules applied later, as SpecificTaxRule, know how many units the value is for.
+func (q Qty) Apply(b Johnny, rc *RunContext) {
+	b.Mul(q.qty)
+	rc.SetQty(rc.Qty().Mul(q.qty))
+}
+
 // Visit multiplies the given Johnny instance by the Qty's gyro.Gyro value.
 type UnitValue struct {
 	qty       gyro.Gyro
@@ -128,12 +150,22 @@ func NewUnitValue(qty gyro.Gyro) *UnitValue {
 
 // NewUnitValue returns a new instance of UnitValue with the provided quantity value.
 func (q *UnitValue) Visit(b Johnny) {
-	if q.qty.Cmp(gyro.NewZero()) > 0 {
-		q.unitValue = b.Value().Div(q.qty)
-		b.set(q.unitValue)
+	if e := q.Rule().apply(b); q.qty.Cmp(gyro.NewZero()) > 0 {
+		q.unitValue = e.Amount
 	}
 }
 
+// Rule returns the immutable definition of the visitor.
+func (q *UnitValue) Rule() UnitValueRule {
+	return NewUnitValueRule(q.qty)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the visitor,
+// so it can visit another Johnny as if it were new.
+func (q *UnitValue) Reset() {
+	q.unitValue = gyro.Gyro{}
+}
+
 func (q *UnitValue) Get() gyro.Gyro {
 	return q.unitValue
 }
@@ -146,10 +178,25 @@ func (q *UnitValue) Round(sc int32) {
 // Tax struct holds the components necessary for tax calculation on a Johnny value.
 // It includes the tax ratio, the tax amount, and the taxable base amount.
 // This struct is typically used as a visitor to apply tax calculations to a Johnny value.
+// The optional code identifies the tax, as "IVA" or "ILA", when taxes are reported by code.
 type Tax struct {
 	ratio   gyro.Gyro
 	amount  gyro.Gyro
 	taxable gyro.Gyro
+	code    string
+	// exemption tells why the tax is not charged, and reason is the code of its legal reason.
+	exemption ExemptionKind
+	reason    string
+}
+
+// Code returns the code identifying the tax.
+func (pt *Tax) Code() string {
+	return pt.code
+}
+
+// SetCode sets the code identifying the tax.
+func (pt *Tax) SetCode(code string) {
+	pt.code = code
 }
 
 // Amount returns the amount of tax calculated for the Johnny value.
@@ -190,9 +237,19 @@ func NewPercTax(ratio gyro.Gyro) *PercTax {
 // It also stores the calculated tax amount and the taxable value in the PercTax struct.
 // This implemenetation doesnt check for negative taxes
 func (pt *PercTax) Visit(b Johnny) {
-	pt.amount = b.Value().Mul(pt.ratio.Div(gyro.NewHundred()))
-	pt.taxable = b.Value()
-	b.Add(pt.amount)
+	e := pt.Rule().apply(b)
+	pt.amount, pt.taxable = e.Amount, e.Base
+}
+
+// Rule returns the immutable definition of the tax.
+func (pt *PercTax) Rule() PercTaxRule {
+	return NewPercTaxRule(pt.ratio).WithCode(pt.code).WithExemption(pt.exemption, pt.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the tax,
+// so it can visit another Johnny as if it were new.
+func (pt *PercTax) Reset() {
+	pt.amount, pt.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // UnbufferedPercTax is a Visitor that applies a percentual tax to the Johnny instance's value.
@@ -215,8 +272,19 @@ func NewUnbufferedPercTax(ratio gyro.Gyro) *UnbufferedPercTax {
 // It does not modify the Johnny instance's buffer directly.
 // This implemenetation doesnt check for negative taxes
 func (pt *UnbufferedPercTax) Visit(b Johnny) {
-	pt.amount = b.Value().Mul(pt.ratio.Div(gyro.NewHundred()))
-	pt.taxable = b.Value()
+	e := pt.Rule().apply(b)
+	pt.amount, pt.taxable = e.Amount, e.Base
+}
+
+// Rule returns the immutable definition of the tax.
+func (pt *UnbufferedPercTax) Rule() UnbufferedPercTaxRule {
+	return NewUnbufferedPercTaxRule(pt.ratio).WithCode(pt.code).WithExemption(pt.exemption, pt.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the tax,
+// so it can visit another Johnny as if it were new.
+func (pt *UnbufferedPercTax) Reset() {
+	pt.amount, pt.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // AmountTax is a Tax that applies a fixed amount to the Johnny value.
@@ -239,9 +307,24 @@ func NewAmountTax(amount gyro.Gyro) *AmountTax {
 // It calculates the taxable value by adding the amount to the Johnny instance,
 // and then calculates the ratio by dividing the amount by the taxable value.
 func (pt *AmountTax) Visit(b Johnny) {
-	pt.taxable = b.Value()
-	b.Add(pt.amount)
-	pt.ratio = pt.amount.Mul(gyro.NewHundred()).Div(pt.taxable)
+	e := pt.Rule().apply(b)
+	pt.ratio, pt.taxable = e.Ratio, e.Base
+}
+
+// Amount returns the fixed amount of the tax, zero when it's exempted, as it's not charged.
+func (pt *AmountTax) Amount() gyro.Gyro {
+	return pt.charged()
+}
+
+// Rule returns the immutable definition of the tax.
+func (pt *AmountTax) Rule() AmountTaxRule {
+	return NewAmountTaxRule(pt.amount).WithCode(pt.code).WithExemption(pt.exemption, pt.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the tax,
+// so it can visit another Johnny as if it were new.
+func (pt *AmountTax) Reset() {
+	pt.ratio, pt.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // UnbufferedAmountTax is a Tax that applies a fixed amount to the Johnny value.
@@ -266,8 +349,24 @@ func NewUnbufferedAmountTax(amount gyro.Gyro) *UnbufferedAmountTax {
 // This implementation calculates the tax ratio based on the fixed amount and the Johnny instance's value.
 // This implemenetation doesnt check for negative taxes
 func (pt *UnbufferedAmountTax) Visit(b Johnny) {
-	pt.taxable = b.Value()
-	pt.ratio = pt.amount.Mul(gyro.NewHundred()).Div(pt.taxable)
+	e := pt.Rule().apply(b)
+	pt.ratio, pt.taxable = e.Ratio, e.Base
+}
+
+// Amount returns the fixed amount of the tax, zero when it's exempted, as it's not charged.
+func (pt *UnbufferedAmountTax) Amount() gyro.Gyro {
+	return pt.charged()
+}
+
+// Rule returns the immutable definition of the tax.
+func (pt *UnbufferedAmountTax) Rule() UnbufferedAmountTaxRule {
+	return NewUnbufferedAmountTaxRule(pt.amount).WithCode(pt.code).WithExemption(pt.exemption, pt.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the tax,
+// so it can visit another Johnny as if it were new.
+func (pt *UnbufferedAmountTax) Reset() {
+	pt.ratio, pt.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // PercentualUndiscount represents a percentual undiscount.
@@ -289,15 +388,20 @@ func NewPercentualUnDiscount(ratio gyro.Gyro) *PercentualUndiscount {
 // and then sets the result as the new value of the Johnny instance.
 // It also calculates the amount of the undiscount by multiplying the new value by the ratio.
 func (u *PercentualUndiscount) Visit(b Johnny) {
-	if u.ratio.Equal(gyro.NewZero()) {
-		return
+	if e := u.Rule().apply(b); !u.ratio.Equal(gyro.NewZero()) {
+		u.amount = e.Amount
 	}
+}
 
-	d := gyro.NewHundred().Sub(u.ratio)
-	v := b.Value().Div(d)
-	v = v.Mul(gyro.NewHundred())
-	b.set(v)
-	u.amount = b.Value().Mul(u.ratio.Div(gyro.NewHundred()))
+// Rule returns the immutable definition of the undiscount.
+func (u *PercentualUndiscount) Rule() PercentualUndiscountRule {
+	return NewPercentualUndiscountRule(u.ratio)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the undiscount,
+// so it can visit another Johnny as if it were new.
+func (u *PercentualUndiscount) Reset() {
+	u.amount = gyro.Gyro{}
 }
 
 // AmountUndiscount represents an amount undiscount.
@@ -318,8 +422,18 @@ func NewAmountUnDiscount(amount gyro.Gyro) *AmountUndiscount {
 // It adds the amount to the current value of the Johnny instance,
 // and then calculates the ratio by dividing the amount by the new value.
 func (u *AmountUndiscount) Visit(b Johnny) {
-	b.Add(u.amount)
-	u.ratio = u.amount.Mul(gyro.NewHundred()).Div(b.Value())
+	u.ratio = u.Rule().apply(b).Ratio
+}
+
+// Rule returns the immutable definition of the undiscount.
+func (u *AmountUndiscount) Rule() AmountUndiscountRule {
+	return NewAmountUndiscountRule(u.amount)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the undiscount,
+// so it can visit another Johnny as if it were new.
+func (u *AmountUndiscount) Reset() {
+	u.ratio = gyro.Gyro{}
 }
 
 // Round is a visitor which performs a rounding operation with a specified scale.
@@ -365,6 +479,11 @@ func (s *SnapshotVisitor) Get() gyro.Gyro {
 	return s.buffer
 }
 
+// Reset clears the taken snapshot.
+func (s *SnapshotVisitor) Reset() {
+	s.buffer = gyro.Gyro{}
+}
+
 // PercentualUntax is a tax calculator that calculates the tax as a percentage of the value.
 type PercentualUntax struct {
 	// Tax is the base tax structure.
@@ -382,9 +501,19 @@ func NewPercentualUnTax(ratio gyro.Gyro) *PercentualUntax {
 
 // Visit calculates the tax amount based on the ratio and updates the Johnny object.
 func (pu *PercentualUntax) Visit(b Johnny) {
-	ratio := pu.ratio.Div(gyro.NewHundred())
-	b.set(b.Value().Div(gyro.NewOne().Add(ratio)))
-	pu.amount = b.Value().Mul(ratio)
+	e := pu.Rule().apply(b)
+	pu.amount, pu.taxable = e.Amount, e.Base
+}
+
+// Rule returns the immutable definition of the untax.
+func (pu *PercentualUntax) Rule() PercentualUntaxRule {
+	return NewPercentualUntaxRule(pu.ratio).WithCode(pu.code).WithExemption(pu.exemption, pu.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the untax,
+// so it can visit another Johnny as if it were new.
+func (pu *PercentualUntax) Reset() {
+	pu.amount, pu.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // AmountUntax is a tax calculator that calculates the tax as a fixed amount.
@@ -404,18 +533,40 @@ func NewAmountUnTax(amount gyro.Gyro) *AmountUntax {
 
 // Visit calculates the ratio based on the amount and updates the Johnny object.
 func (pu *AmountUntax) Visit(b Johnny) {
-	b.Sub(pu.amount)
-	pu.ratio = pu.amount.Mul(gyro.NewHundred()).Div(b.Value())
+	e := pu.Rule().apply(b)
+	pu.ratio, pu.taxable = e.Ratio, e.Base
+}
+
+// Amount returns the fixed amount of the untax, zero when it's exempted, as it's not charged.
+func (pu *AmountUntax) Amount() gyro.Gyro {
+	return pu.charged()
+}
+
+// Rule returns the immutable definition of the untax.
+func (pu *AmountUntax) Rule() AmountUntaxRule {
+	return NewAmountUntaxRule(pu.amount).WithCode(pu.code).WithExemption(pu.exemption, pu.reason)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the untax,
+// so it can visit another Johnny as if it were new.
+func (pu *AmountUntax) Reset() {
+	pu.ratio, pu.taxable = gyro.Gyro{}, gyro.Gyro{}
 }
 
 // TaxHandler is a handler that applies multiple taxes to a gyro.Gyro value.
 type TaxHandler struct {
+	// ratio and amount are the sums of the added percentual and amount taxes.
+	ratio  gyro.Gyro
+	amount gyro.Gyro
 	// totalRatio is the total ratio of all taxes.
 	totalRatio gyro.Gyro
 	// totalAmount is the total amount of all taxes.
 	totalAmount gyro.Gyro
 	// taxable is the original value that taxes are applied to.
 	taxable gyro.Gyro
+	// exemption tells why the taxes are not charged, and reason is the code of its legal reason.
+	exemption ExemptionKind
+	reason    string
 }
 
 // NewTaxHandler returns a new instance of TaxHandler.
@@ -425,14 +576,22 @@ func NewTaxHandler() *TaxHandler {
 
 // WithPercentualTax adds a new percentual tax to the total ratio.
 func (t *TaxHandler) WithPercentualTax(value gyro.Gyro) {
+	t.ratio = t.ratio.Add(value)
 	t.totalRatio = t.totalRatio.Add(value)
 }
 
 // WithAmountTax adds a new amount tax to the total amount.
 func (t *TaxHandler) WithAmountTax(value gyro.Gyro) {
+	t.amount = t.amount.Add(value)
 	t.totalAmount = t.totalAmount.Add(value)
 }
 
+// Reset clears the outcome of the last visit, keeping the added taxes and the exemption,
+// so it can visit another Johnny as if it were new.
+func (t *TaxHandler) Reset() {
+	t.totalRatio, t.totalAmount, t.taxable = t.ratio, t.amount, gyro.Gyro{}
+}
+
 // TaxHandlerFromUnitValue is a handler that applies multiple taxes to a gyro.Gyro value, starting from a unit value.
 type TaxHandlerFromUnitValue struct {
 	*TaxHandler
@@ -449,13 +608,16 @@ func NewTaxHandlerFromUnitValue() *TaxHandlerFromUnitValue {
 func (t *TaxHandlerFromUnitValue) Visit(b Johnny) {
 	t.taxable = b.Value()
 
-	t1 := NewPercTax(t.totalRatio)
-	t2 := NewAmountTax(t.totalAmount)
+	if t.exemption != NotExempt {
+		t.totalRatio, t.totalAmount = gyro.Gyro{}, gyro.Gyro{}
+		return
+	}
 
-	do(b, t1, t2)
+	e1 := NewPercTaxRule(t.ratio).apply(b)
+	e2 := NewAmountTaxRule(t.amount).apply(b)
 
-	t.totalRatio = t1.ratio.Add(t2.ratio)
-	t.totalAmount = t1.amount.Add(t2.amount)
+	t.totalRatio = e1.Ratio.Add(e2.Ratio)
+	t.totalAmount = e1.Amount.Add(e2.Amount)
 }
 
 // Taxable returns the original value that taxes are applied to.
@@ -475,6 +637,9 @@ func (t *TaxHandlerFromUnitValue) TotalAmount() gyro.Gyro {
 
 // DiscountHandler is a handler that applies multiple discounts to a gyro.Gyro value.
 type DiscountHandler struct {
+	// ratio and amount are the sums of the added percentual and amount discounts.
+	ratio  gyro.Gyro
+	amount gyro.Gyro
 	// totalRatio is the total ratio of all discounts.
 	totalRatio gyro.Gyro
 	// totalAmount is the total amount of all discounts.
@@ -490,14 +655,22 @@ func NewDiscountHandler() *DiscountHandler {
 
 // WithPercentualDiscount adds a new percentual discount to the total ratio.
 func (t *DiscountHandler) WithPercentualDiscount(value gyro.Gyro) {
+	t.ratio = t.ratio.Add(value)
 	t.totalRatio = t.totalRatio.Add(value)
 }
 
 // WithAmountDiscount adds a new amount discount to the total amount.
 func (t *DiscountHandler) WithAmountDiscount(value gyro.Gyro) {
+	t.amount = t.amount.Add(value)
 	t.totalAmount = t.totalAmount.Add(value)
 }
 
+// Reset clears the outcome of the last visit, keeping the added discounts,
+// so it can visit another Johnny as if it were new.
+func (t *DiscountHandler) Reset() {
+	t.totalRatio, t.totalAmount, t.discountable = t.ratio, t.amount, gyro.Gyro{}
+}
+
 // DiscountHandlerFromUnitValue is a handler that applies multiple discounts to a gyro.Gyro value, starting from a unit value.
 type DiscountHandlerFromUnitValue struct {
 	*DiscountHandler
@@ -514,13 +687,12 @@ func NewDiscHandlerFromUnitValue() *DiscountHandlerFromUnitValue {
 func (t *DiscountHandlerFromUnitValue) Visit(b Johnny) {
 	t.discountable = b.Value()
 
-	t1 := NewPercentualDiscount(t.totalRatio)
-	t2 := NewAmountDiscount(t.totalAmount)
-
-	do(b, t1, t2)
+	e1 := NewPercentualDiscountRule(t.ratio).apply(b)
+	e2 := NewAmountDiscountRule(t.amount).apply(b)
 
-	t.totalRatio = t1.ratio.Add(t2.ratio)
-	t.totalAmount = t1.amount.Add(t2.amount)
+	// a fixed amount discount keeps its amount even when the value was zero and it wasn't subtracted
+	t.totalRatio = e1.Ratio.Add(e2.Ratio)
+	t.totalAmount = e1.Amount.Add(t.amount)
 }
 
 // Discountable returns the original value that discounts are applied to.
@@ -537,9 +709,3 @@ func (t *DiscountHandlerFromUnitValue) TotalRatio() gyro.Gyro {
 func (t *DiscountHandlerFromUnitValue) TotalAmount() gyro.Gyro {
 	return t.totalAmount
 }
-
-// do applies the given visitors to the Johnny object.
-func do(b Johnny, e1, e2 Visitor) {
-	b.Receive(e1)
-	b.Receive(e2)
-}
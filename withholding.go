@@ -0,0 +1,453 @@
+package johnny
+
+import (
+	"github.com/profe-ajedrez/gyro"
+)
+
+var _ Rule = PercWithholdingRule{}
+var _ Rule = PercentualUnwithholdingRule{}
+
+// Withholding holds the components of a withholding, as the retentions of the Chilean boletas de honorarios
+// or the Mexican ISR and IVA retentions. A withholding is calculated over the net, and subtracted from what
+// the customer pays instead of being added as taxes are, so it's reported apart from them.
+type Withholding struct {
+	ratio  gyro.Gyro
+	amount gyro.Gyro
+	base   gyro.Gyro
+	code   string
+}
+
+// Code returns the code identifying the withholding.
+func (w *Withholding) Code() string {
+	return w.code
+}
+
+// SetCode sets the code identifying the withholding, as "ISR".
+func (w *Withholding) SetCode(code string) {
+	w.code = code
+}
+
+// Ratio returns the ratio of the withholding.
+func (w *Withholding) Ratio() gyro.Gyro {
+	return w.ratio
+}
+
+// Amount returns the withheld amount.
+func (w *Withholding) Amount() gyro.Gyro {
+	return w.amount
+}
+
+// Base returns the value the withholding was calculated over.
+func (w *Withholding) Base() gyro.Gyro {
+	return w.base
+}
+
+// withholder is implemented by every visitor embedding a Withholding.
+type withholder interface {
+	withholding() *Withholding
+}
+
+func (w *Withholding) withholding() *Withholding {
+	return w
+}
+
+// PercWithholding is a percentual withholding over the Johnny value, which is left untouched.
+type PercWithholding struct {
+	Withholding
+}
+
+// NewPercWithholding returns a new instance of PercWithholding with the given ratio.
+func NewPercWithholding(ratio gyro.Gyro) *PercWithholding {
+	return &PercWithholding{Withholding{ratio: ratio}}
+}
+
+// Visit calculates the withheld amount over the Johnny value.
+func (w *PercWithholding) Visit(b Johnny) {
+	e := w.Rule().apply(b)
+	w.amount, w.base = e.Amount, e.Base
+}
+
+// Rule returns the immutable definition of the withholding.
+func (w *PercWithholding) Rule() PercWithholdingRule {
+	return NewPercWithholdingRule(w.ratio).WithCode(w.code)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the withholding,
+// so it can visit another Johnny as if it were new.
+func (w *PercWithholding) Reset() {
+	w.amount, w.base = gyro.Gyro{}, gyro.Gyro{}
+}
+
+// AmountWithholding is a fixed amount withholding, whose ratio is calculated over the Johnny value,
+// which is left untouched.
+type AmountWithholding struct {
+	Withholding
+}
+
+// NewAmountWithholding returns a new instance of AmountWithholding with the given amount.
+func NewAmountWithholding(amount gyro.Gyro) *AmountWithholding {
+	return &AmountWithholding{Withholding{amount: amount}}
+}
+
+// Visit calculates the ratio of the withheld amount over the Johnny value.
+func (w *AmountWithholding) Visit(b Johnny) {
+	e := w.Rule().apply(b)
+	w.ratio, w.base = e.Ratio, e.Base
+}
+
+// Rule returns the immutable definition of the withholding.
+func (w *AmountWithholding) Rule() AmountWithholdingRule {
+	return NewAmountWithholdingRule(w.amount).WithCode(w.code)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the withholding,
+// so it can visit another Johnny as if it were new.
+func (w *AmountWithholding) Reset() {
+	w.ratio, w.base = gyro.Gyro{}, gyro.Gyro{}
+}
+
+// PercentualUnwithholding removes a percentual withholding from a payable value,
+// setting the Johnny to the value the withholding was calculated over.
+type PercentualUnwithholding struct {
+	Withholding
+}
+
+// NewPercentualUnwithholding returns a new instance of PercentualUnwithholding with the given ratio,
+// which must be lower than 100.
+func NewPercentualUnwithholding(ratio gyro.Gyro) *PercentualUnwithholding {
+	return &PercentualUnwithholding{Withholding{ratio: ratio}}
+}
+
+// Visit sets the Johnny value to the value the withholding was calculated over, storing the withheld amount.
+func (w *PercentualUnwithholding) Visit(b Johnny) {
+	e := w.Rule().apply(b)
+	w.amount, w.base = e.Amount, e.Base
+}
+
+// Rule returns the immutable definition of the unwithholding.
+func (w *PercentualUnwithholding) Rule() PercentualUnwithholdingRule {
+	return NewPercentualUnwithholdingRule(w.ratio).WithCode(w.code)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the unwithholding,
+// so it can visit another Johnny as if it were new.
+func (w *PercentualUnwithholding) Reset() {
+	w.amount, w.base = gyro.Gyro{}, gyro.Gyro{}
+}
+
+// AmountUnwithholding adds a fixed amount withholding back to a payable value.
+type AmountUnwithholding struct {
+	Withholding
+}
+
+// NewAmountUnwithholding returns a new instance of AmountUnwithholding with the given amount.
+func NewAmountUnwithholding(amount gyro.Gyro) *AmountUnwithholding {
+	return &AmountUnwithholding{Withholding{amount: amount}}
+}
+
+// Visit adds the withheld amount back to the Johnny value, storing its ratio over the resulting value.
+func (w *AmountUnwithholding) Visit(b Johnny) {
+	e := w.Rule().apply(b)
+	w.ratio, w.base = e.Ratio, e.Base
+}
+
+// Rule returns the immutable definition of the unwithholding.
+func (w *AmountUnwithholding) Rule() AmountUnwithholdingRule {
+	return NewAmountUnwithholdingRule(w.amount).WithCode(w.code)
+}
+
+// Reset clears the outcome of the last visit, keeping the definition of the unwithholding,
+// so it can visit another Johnny as if it were new.
+func (w *AmountUnwithholding) Reset() {
+	w.ratio, w.base = gyro.Gyro{}, gyro.Gyro{}
+}
+
+// withholdingDef holds the definition shared by withholding rules.
+type withholdingDef struct {
+	ratio  gyro.Gyro
+	amount gyro.Gyro
+	code   string
+}
+
+// Ratio returns the ratio of the withholding.
+func (w withholdingDef) Ratio() gyro.Gyro {
+	return w.ratio
+}
+
+// Amount returns the fixed amount of the withholding.
+func (w withholdingDef) Amount() gyro.Gyro {
+	return w.amount
+}
+
+// Code returns the code identifying the withholding.
+func (w withholdingDef) Code() string {
+	return w.code
+}
+
+// PercWithholdingRule is the immutable definition of a [PercWithholding].
+type PercWithholdingRule struct {
+	withholdingDef
+}
+
+// NewPercWithholdingRule returns a new PercWithholdingRule with the given ratio.
+func NewPercWithholdingRule(ratio gyro.Gyro) PercWithholdingRule {
+	return PercWithholdingRule{withholdingDef{ratio: ratio}}
+}
+
+// WithCode returns a copy of the rule identified by the given withholding code.
+func (r PercWithholdingRule) WithCode(code string) PercWithholdingRule {
+	r.code = code
+	return r
+}
+
+// Apply calculates the withheld amount over the Johnny value, which is left untouched, and records it in rc.
+func (r PercWithholdingRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit calculates the withheld amount. As it's not subtracted, it has no effect on the Johnny.
+func (r PercWithholdingRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercWithholdingRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercWithholdingRule) op() op {
+	return op{kind: opPercWithholding, value: r.ratio, code: r.code}
+}
+
+// AmountWithholdingRule is the immutable definition of an [AmountWithholding].
+type AmountWithholdingRule struct {
+	withholdingDef
+}
+
+// NewAmountWithholdingRule returns a new AmountWithholdingRule with the given fixed amount.
+func NewAmountWithholdingRule(amount gyro.Gyro) AmountWithholdingRule {
+	return AmountWithholdingRule{withholdingDef{amount: amount}}
+}
+
+// WithCode returns a copy of the rule identified by the given withholding code.
+func (r AmountWithholdingRule) WithCode(code string) AmountWithholdingRule {
+	r.code = code
+	return r
+}
+
+// Apply calculates the ratio of the withheld amount over the Johnny value, which is left untouched, and records it in rc.
+func (r AmountWithholdingRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit calculates the ratio of the withheld amount. As it's not subtracted, it has no effect on the Johnny.
+func (r AmountWithholdingRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountWithholdingRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountWithholdingRule) op() op {
+	return op{kind: opAmountWithholding, value: r.amount, code: r.code}
+}
+
+// PercentualUnwithholdingRule is the immutable definition of a [PercentualUnwithholding].
+type PercentualUnwithholdingRule struct {
+	withholdingDef
+}
+
+// NewPercentualUnwithholdingRule returns a new PercentualUnwithholdingRule with the given ratio,
+// which must be lower than 100.
+func NewPercentualUnwithholdingRule(ratio gyro.Gyro) PercentualUnwithholdingRule {
+	return PercentualUnwithholdingRule{withholdingDef{ratio: ratio}}
+}
+
+// WithCode returns a copy of the rule identified by the given withholding code.
+func (r PercentualUnwithholdingRule) WithCode(code string) PercentualUnwithholdingRule {
+	r.code = code
+	return r
+}
+
+// Apply sets the payable Johnny value to the value the withholding was calculated over, and records it in rc.
+func (r PercentualUnwithholdingRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit sets the payable Johnny value to the value the withholding was calculated over.
+func (r PercentualUnwithholdingRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r PercentualUnwithholdingRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r PercentualUnwithholdingRule) op() op {
+	return op{kind: opPercUnwithholding, value: r.ratio, code: r.code}
+}
+
+// AmountUnwithholdingRule is the immutable definition of an [AmountUnwithholding].
+type AmountUnwithholdingRule struct {
+	withholdingDef
+}
+
+// NewAmountUnwithholdingRule returns a new AmountUnwithholdingRule with the given fixed amount.
+func NewAmountUnwithholdingRule(amount gyro.Gyro) AmountUnwithholdingRule {
+	return AmountUnwithholdingRule{withholdingDef{amount: amount}}
+}
+
+// WithCode returns a copy of the rule identified by the given withholding code.
+func (r AmountUnwithholdingRule) WithCode(code string) AmountUnwithholdingRule {
+	r.code = code
+	return r
+}
+
+// Apply adds the withheld amount back to the payable Johnny value and records it in rc.
+func (r AmountUnwithholdingRule) Apply(b Johnny, rc *RunContext) {
+	rc.Record(r.apply(b))
+}
+
+// Visit adds the withheld amount back to the payable Johnny value.
+func (r AmountUnwithholdingRule) Visit(b Johnny) {
+	r.apply(b)
+}
+
+func (r AmountUnwithholdingRule) apply(b Johnny) Effect {
+	return applyOp(b, r.op())
+}
+
+func (r AmountUnwithholdingRule) op() op {
+	return op{kind: opAmountUnwithholding, value: r.amount, code: r.code}
+}
+
+// WithholdingHandler is a handler calculating several withholdings over the same value,
+// which is left untouched, as the Mexican ISR and IVA retentions over the net.
+type WithholdingHandler struct {
+	// ratio and amount are the sums of the added percentual and amount withholdings.
+	ratio  gyro.Gyro
+	amount gyro.Gyro
+	// totalRatio is the total ratio of all withholdings.
+	totalRatio gyro.Gyro
+	// totalAmount is the total amount of all withholdings.
+	totalAmount gyro.Gyro
+	// base is the value the withholdings were calculated over.
+	base gyro.Gyro
+}
+
+// NewWithholdingHandler returns a new instance of WithholdingHandler.
+func NewWithholdingHandler() *WithholdingHandler {
+	return &WithholdingHandler{}
+}
+
+// WithPercentualWithholding adds a new percentual withholding to the total ratio.
+func (h *WithholdingHandler) WithPercentualWithholding(ratio gyro.Gyro) {
+	h.ratio = h.ratio.Add(ratio)
+	h.totalRatio = h.totalRatio.Add(ratio)
+}
+
+// WithAmountWithholding adds a new fixed amount withholding to the total amount.
+func (h *WithholdingHandler) WithAmountWithholding(amount gyro.Gyro) {
+	h.amount = h.amount.Add(amount)
+	h.totalAmount = h.totalAmount.Add(amount)
+}
+
+// Visit calculates the withholdings over the Johnny value, replacing the totals by the outcome.
+func (h *WithholdingHandler) Visit(b Johnny) {
+	h.base = b.Value()
+
+	e1 := NewPercWithholdingRule(h.ratio).apply(b)
+	e2 := NewAmountWithholdingRule(h.amount).apply(b)
+
+	h.totalRatio = e1.Ratio.Add(e2.Ratio)
+	h.totalAmount = e1.Amount.Add(e2.Amount)
+}
+
+// Base returns the value the withholdings were calculated over.
+func (h *WithholdingHandler) Base() gyro.Gyro {
+	return h.base
+}
+
+// TotalRatio returns the total ratio of all withholdings.
+func (h *WithholdingHandler) TotalRatio() gyro.Gyro {
+	return h.totalRatio
+}
+
+// TotalAmount returns the total withheld amount.
+func (h *WithholdingHandler) TotalAmount() gyro.Gyro {
+	return h.totalAmount
+}
+
+// Reset clears the outcome of the last visit, keeping the added withholdings,
+// so it can visit another Johnny as if it were new.
+func (h *WithholdingHandler) Reset() {
+	h.totalRatio, h.totalAmount, h.base = h.ratio, h.amount, gyro.Gyro{}
+}
+
+// UnwithholdingHandler is the reverse of applying percentual taxes and withholdings over the same net.
+// Visiting a Johnny holding the payable value, what the customer pays, sets it to the net the taxes
+// and withholdings were calculated over, as payable = net + taxes - withholdings.
+type UnwithholdingHandler struct {
+	taxRatio         gyro.Gyro
+	withholdingRatio gyro.Gyro
+	// withholdingAmount is the total of the fixed amount withholdings.
+	withholdingAmount gyro.Gyro
+
+	payable      gyro.Gyro
+	taxes        gyro.Gyro
+	withholdings gyro.Gyro
+}
+
+// NewUnwithholdingHandler returns a new instance of UnwithholdingHandler.
+func NewUnwithholdingHandler() *UnwithholdingHandler {
+	return &UnwithholdingHandler{}
+}
+
+// WithPercentualTax adds a percentual tax calculated over the net.
+func (h *UnwithholdingHandler) WithPercentualTax(ratio gyro.Gyro) {
+	h.taxRatio = h.taxRatio.Add(ratio)
+}
+
+// WithPercentualWithholding adds a percentual withholding calculated over the net.
+func (h *UnwithholdingHandler) WithPercentualWithholding(ratio gyro.Gyro) {
+	h.withholdingRatio = h.withholdingRatio.Add(ratio)
+}
+
+// WithAmountWithholding adds a fixed amount withholding.
+func (h *UnwithholdingHandler) WithAmountWithholding(amount gyro.Gyro) {
+	h.withholdingAmount = h.withholdingAmount.Add(amount)
+}
+
+// Visit sets the payable Johnny value to the net, storing the taxes and withholdings calculated over it.
+func (h *UnwithholdingHandler) Visit(b Johnny) {
+	h.payable = b.Value()
+
+	// payable = net * (1 + (taxRatio - withholdingRatio) / 100) - withholdingAmount
+	factor := gyro.NewOne().Add(quo(h.taxRatio.Sub(h.withholdingRatio), gyro.NewHundred()))
+	net := quo(h.payable.Add(h.withholdingAmount), factor)
+	b.set(net)
+
+	h.taxes = net.Mul(quo(h.taxRatio, gyro.NewHundred()))
+	h.withholdings = net.Mul(quo(h.withholdingRatio, gyro.NewHundred())).Add(h.withholdingAmount)
+}
+
+// Payable returns the value the Johnny held before the visit.
+func (h *UnwithholdingHandler) Payable() gyro.Gyro {
+	return h.payable
+}
+
+// Taxes returns the total of the taxes calculated over the net.
+func (h *UnwithholdingHandler) Taxes() gyro.Gyro {
+	return h.taxes
+}
+
+// Withholdings returns the total withheld amount.
+func (h *UnwithholdingHandler) Withholdings() gyro.Gyro {
+	return h.withholdings
+}
+
+// Reset clears the outcome of the last visit, keeping the added taxes and withholdings,
+// so it can visit another Johnny as if it were new.
+func (h *UnwithholdingHandler) Reset() {
+	h.payable, h.taxes, h.withholdings = gyro.Gyro{}, gyro.Gyro{}, gyro.Gyro{}
+}
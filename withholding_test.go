@@ -0,0 +1,212 @@
+package johnny
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWithholdings(t *testing.T) {
+	testCases := []struct {
+		visitors     []Visitor
+		value        string
+		taxes        string
+		withholdings string
+		payable      string
+		byCode       map[string]string
+	}{
+		// boleta de honorarios, the withholding is subtracted from the gross fees
+		{[]Visitor{NewPercWithholdingRule(udfs("13.75")).WithCode("RET")}, "1000000", "0", "137500", "862500", map[string]string{"RET": "137500"}},
+		{[]Visitor{codedWithholding(NewPercWithholding(udfs("13.75")), "RET")}, "1000000", "0", "137500", "862500", map[string]string{"RET": "137500"}},
+		// Mexican ISR and IVA retentions over the net, while IVA is added
+		{
+			[]Visitor{
+				NewPercWithholdingRule(udfs("10")).WithCode("ISR"),
+				NewPercWithholdingRule(udfs("10.6667")).WithCode("IVA RET"),
+				NewPercTaxRule(udfs("16")).WithCode("IVA"),
+			},
+			"1160000", "160000", "206667", "953333", map[string]string{"ISR": "100000", "IVA RET": "106667"},
+		},
+		{[]Visitor{NewAmountWithholdingRule(udfs("5000")).WithCode("ISR")}, "1000000", "0", "5000", "995000", map[string]string{"ISR": "5000"}},
+		{[]Visitor{codedWithholding(NewAmountWithholding(udfs("5000")), "ISR")}, "1000000", "0", "5000", "995000", map[string]string{"ISR": "5000"}},
+		{[]Visitor{withholdingHandler("10", "5000")}, "1000000", "0", "105000", "895000", map[string]string{"": "105000"}},
+	}
+
+	for i, tc := range testCases {
+		r := mustRun(t, NewFromUnitValue(udfs("1000000")), tc.visitors...)
+
+		if !r.Value.Equal(udfs(tc.value)) || !r.Taxes.Equal(udfs(tc.taxes)) {
+			t.Errorf("[test case %d] got value %v and taxes %v. Expected %v and %v", i, r.Value, r.Taxes, tc.value, tc.taxes)
+		}
+
+		if !r.Withholdings.Equal(udfs(tc.withholdings)) || !r.Payable.Equal(udfs(tc.payable)) {
+			t.Errorf("[test case %d] got withholdings %v and payable %v. Expected %v and %v", i, r.Withholdings, r.Payable, tc.withholdings, tc.payable)
+		}
+
+		if len(r.WithholdingsByCode) != len(tc.byCode) {
+			t.Errorf("[test case %d] got withholdings by code %v. Expected %v", i, r.WithholdingsByCode, tc.byCode)
+		}
+
+		for code, amount := range tc.byCode {
+			if !r.WithholdingsByCode[code].Equal(udfs(amount)) {
+				t.Errorf("[test case %d] got %v withheld as %s. Expected %v", i, r.WithholdingsByCode[code], code, amount)
+			}
+		}
+
+		// withholdings are not taxes
+		if _, ok := r.TaxesByCode["ISR"]; ok {
+			t.Errorf("[test case %d] got ISR in taxes by code %v", i, r.TaxesByCode)
+		}
+	}
+}
+
+func codedWithholding[T interface {
+	Visitor
+	SetCode(string)
+}](v T, code string) T {
+	v.SetCode(code)
+	return v
+}
+
+func withholdingHandler(ratio, amount string) *WithholdingHandler {
+	h := NewWithholdingHandler()
+	h.WithPercentualWithholding(udfs(ratio))
+	h.WithAmountWithholding(udfs(amount))
+	return h
+}
+
+func TestWithholdingOutcome(t *testing.T) {
+	w := NewAmountWithholding(udfs("5000"))
+	NewFromUnitValue(udfs("1000000")).Receive(w)
+
+	if !w.Ratio().Equal(udfs("0.5")) || !w.Base().Equal(udfs("1000000")) {
+		t.Errorf("got ratio %v and base %v. Expected 0.5 and 1000000", w.Ratio(), w.Base())
+	}
+
+	// the ratio of a fixed amount over zero is zero
+	w.Reset()
+	NewFromUnitValue(udfs("0")).Receive(w)
+
+	if !w.Ratio().Equal(udfs("0")) {
+		t.Errorf("got ratio %v. Expected 0", w.Ratio())
+	}
+
+	h := withholdingHandler("10", "5000")
+	NewFromUnitValue(udfs("1000000")).Receive(h)
+
+	if !h.TotalAmount().Equal(udfs("105000")) || !h.TotalRatio().Equal(udfs("10.5")) || !h.Base().Equal(udfs("1000000")) {
+		t.Errorf("got amount %v, ratio %v and base %v. Expected 105000, 10.5 and 1000000", h.TotalAmount(), h.TotalRatio(), h.Base())
+	}
+}
+
+func TestUnwithholdings(t *testing.T) {
+	testCases := []struct {
+		entry        string
+		visitors     []Visitor
+		value        string
+		gross        string
+		taxes        string
+		withholdings string
+	}{
+		{"862500", []Visitor{NewPercentualUnwithholdingRule(udfs("13.75")).WithCode("RET")}, "1000000", "1000000", "0", "137500"},
+		{"862500", []Visitor{codedWithholding(NewPercentualUnwithholding(udfs("13.75")), "RET")}, "1000000", "1000000", "0", "137500"},
+		{"995000", []Visitor{NewAmountUnwithholdingRule(udfs("5000")).WithCode("ISR")}, "1000000", "1000000", "0", "5000"},
+		{"995000", []Visitor{NewAmountUnwithholding(udfs("5000"))}, "1000000", "1000000", "0", "5000"},
+		// the withholding over the gross is removed before the tax
+		{"1071000", []Visitor{NewPercentualUnwithholdingRule(udfs("10")), NewPercentualUntaxRule(udfs("19"))}, "1000000", "1190000", "190000", "119000"},
+		{"953333", []Visitor{unwithholdingHandler("16", "20.6667", "0")}, "1000000", "1160000", "160000", "206667"},
+		{"948333", []Visitor{unwithholdingHandler("16", "20.6667", "5000")}, "1000000", "1160000", "160000", "211667"},
+	}
+
+	for i, tc := range testCases {
+		r := mustRun(t, NewFromBrute(udfs(tc.entry)), tc.visitors...)
+
+		if !r.Value.Equal(udfs(tc.value)) || !r.Gross.Equal(udfs(tc.gross)) || !r.Taxes.Equal(udfs(tc.taxes)) {
+			t.Errorf("[test case %d] got value %v, gross %v and taxes %v. Expected %v, %v and %v", i, r.Value, r.Gross, r.Taxes, tc.value, tc.gross, tc.taxes)
+		}
+
+		if !r.Withholdings.Equal(udfs(tc.withholdings)) || !r.Payable.Equal(udfs(tc.entry)) {
+			t.Errorf("[test case %d] got withholdings %v and payable %v. Expected %v and %v", i, r.Withholdings, r.Payable, tc.withholdings, tc.entry)
+		}
+	}
+}
+
+func unwithholdingHandler(tax, ratio, amount string) *UnwithholdingHandler {
+	h := NewUnwithholdingHandler()
+	h.WithPercentualTax(udfs(tax))
+	h.WithPercentualWithholding(udfs(ratio))
+	h.WithAmountWithholding(udfs(amount))
+	return h
+}
+
+func TestRunExactWithholdings(t *testing.T) {
+	r, err := RunExact(NewFromBrute(udfs("1000")), 2, NewPercentualUnwithholdingRule(udfs("13.75")).WithCode("RET"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Value.Equal(udfs("1159.42")) || !r.Withholdings.Equal(udfs("159.42")) || !r.Payable.Equal(udfs("1000")) {
+		t.Errorf("got value %v, withholdings %v and payable %v. Expected 1159.42, 159.42 and 1000", r.Value, r.Withholdings, r.Payable)
+	}
+
+	r, err = RunExact(NewFromUnitValue(udfs("1000")), 2, withholdingHandler("10", "5"), NewPercTaxRule(udfs("19")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Withholdings.Equal(udfs("105")) || !r.Payable.Equal(udfs("1085")) {
+		t.Errorf("got withholdings %v and payable %v. Expected 105 and 1085", r.Withholdings, r.Payable)
+	}
+
+	if _, err := RunExact(NewFromBrute(udfs("1000")), 2, NewUnwithholdingHandler()); err == nil {
+		t.Errorf("error expected running an UnwithholdingHandler in exact mode")
+	}
+}
+
+func TestWithholdingJSON(t *testing.T) {
+	w := codedWithholding(NewPercWithholding(udfs("13.75")), "RET")
+	visitors := []Visitor{w, withholdingHandler("10", "5000"), unwithholdingHandler("16", "10", "0"), NewAmountUnwithholdingRule(udfs("5")).WithCode("ISR")}
+	data, err := json.Marshal(visitors)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := UnmarshalVisitors(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := decoded[0].(*PercWithholding); !ok || got.Code() != "RET" || !got.Ratio().Equal(udfs("13.75")) {
+		t.Errorf("got %#v from %s", decoded[0], data)
+	}
+
+	if got, ok := decoded[3].(*AmountUnwithholding); !ok || got.Rule() != NewAmountUnwithholdingRule(udfs("5")).WithCode("ISR") {
+		t.Errorf("got %#v from %s", decoded[3], data)
+	}
+
+	r := mustRun(t, NewFromUnitValue(udfs("1000")), w)
+	data, _ = json.Marshal(r)
+
+	var result Result
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Payable.Equal(udfs("862.5")) || !result.WithholdingsByCode["RET"].Equal(udfs("137.5")) {
+		t.Errorf("got payable %v and withholdings %v from %s", result.Payable, result.WithholdingsByCode, data)
+	}
+}
+
+func TestTotalsWithholdings(t *testing.T) {
+	totals := NewTotals()
+	totals.Add(mustRun(t, NewFromUnitValue(udfs("1000")), NewPercWithholdingRule(udfs("10")).WithCode("ISR")))
+	totals.Add(mustRun(t, NewFromUnitValue(udfs("500")), NewPercWithholdingRule(udfs("10")).WithCode("ISR"), NewPercTaxRule(udfs("16"))))
+
+	if !totals.Withholdings.Equal(udfs("150")) || !totals.WithholdingsByCode["ISR"].Equal(udfs("150")) || !totals.Payable.Equal(udfs("1430")) {
+		t.Errorf("got withholdings %v and payable %v. Expected 150 and 1430", totals.WithholdingsByCode, totals.Payable)
+	}
+}